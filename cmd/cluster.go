@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/cluster"
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// registerClusterHandlers applies fleet-wide admin actions on this instance
+func registerClusterHandlers(bus *cluster.Bus, rateLimiter *middleware.RateLimiter, cbManager *middleware.CircuitBreakerManager, maintenance *middleware.Maintenance) {
+	bus.Handle(cluster.EventLimitOverride, func(payload json.RawMessage) error {
+		var override cluster.LimitOverride
+		if err := json.Unmarshal(payload, &override); err != nil {
+			return err
+		}
+		rateLimiter.SetOverride(override.Consumer, config.RouteLimit{
+			RequestsPerSec: override.RequestsPerSec,
+			BurstSize:      override.BurstSize,
+		})
+		return nil
+	})
+
+	bus.Handle(cluster.EventLimitOverrideCleared, func(payload json.RawMessage) error {
+		var override cluster.LimitOverride
+		if err := json.Unmarshal(payload, &override); err != nil {
+			return err
+		}
+		rateLimiter.ClearOverride(override.Consumer)
+		return nil
+	})
+
+	bus.Handle(cluster.EventBreakerReset, func(payload json.RawMessage) error {
+		var reset cluster.BreakerReset
+		if err := json.Unmarshal(payload, &reset); err != nil {
+			return err
+		}
+		cbManager.Reset(reset.Service)
+		return nil
+	})
+
+	bus.Handle(cluster.EventMaintenance, func(payload json.RawMessage) error {
+		var toggle cluster.MaintenanceToggle
+		if err := json.Unmarshal(payload, &toggle); err != nil {
+			return err
+		}
+		maintenance.Set(toggle.Route, toggle.Enabled)
+		return nil
+	})
+
+	bus.Handle(cluster.EventMaintenanceCleared, func(payload json.RawMessage) error {
+		var toggle cluster.MaintenanceToggle
+		if err := json.Unmarshal(payload, &toggle); err != nil {
+			return err
+		}
+		maintenance.Clear(toggle.Route)
+		return nil
+	})
+}
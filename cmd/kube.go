@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/kube"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/proxy"
+	"github.com/minisource/gateway/internal/router"
+)
+
+// loadKubernetes builds the routes and their services from the cluster's
+// resources, returning fallback (the route files) when the API server can't
+// be read yet; the watch applies the cluster's routes once it can
+func loadKubernetes(cfg config.KubernetesConfig, fallback *config.RouteConfig, logger *middleware.SimpleLogger) (*kube.Controller, *config.RouteConfig, map[string]config.ServiceConfig) {
+	controller, err := kube.New(cfg)
+	if err != nil {
+		logger.Error("Invalid Kubernetes controller settings, using the route files", "error", err)
+		return nil, fallback, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RetryInterval+10*time.Second)
+	defer cancel()
+	table, err := controller.Load(ctx)
+	if err != nil {
+		logger.Warn("Failed to read routes from Kubernetes, using the route files until it is available", "error", err)
+		return controller, fallback, nil
+	}
+	logSkipped(table, logger)
+	logger.Info("Loaded routes from Kubernetes", "resources", cfg.Resources, "routes", len(table.Routes.Routes), "services", len(table.Services))
+	return controller, table.Routes, table.Services
+}
+
+// watchKubernetes applies the cluster's changes to the router and the proxy
+// until ctx is done. services are the ones the current routes use.
+func watchKubernetes(ctx context.Context, controller *kube.Controller, services map[string]config.ServiceConfig,
+	gatewayRouter *router.Router, serviceProxy *proxy.ServiceProxy, logger *middleware.SimpleLogger) {
+	controller.Watch(ctx, func(table *kube.Table) {
+		logSkipped(table, logger)
+		for _, conflict := range table.Routes.Conflicts() {
+			logger.Warn("Route conflict", "conflict", conflict.String())
+		}
+
+		// Add new services before the routes using them, and remove old
+		// ones once no route does
+		all := maps.Clone(table.Services)
+		maps.Copy(all, services)
+		serviceProxy.SyncServices(all)
+		gatewayRouter.SetRoutes(table.Routes)
+		serviceProxy.SyncServices(table.Services)
+		services = table.Services
+
+		middleware.RecordRouteInfo(table.Routes.Routes)
+		middleware.RecordRouteReload(controller.Name(), "applied")
+		logger.Info("Routes updated from Kubernetes", "routes", len(table.Routes.Routes), "services", len(table.Services))
+	}, func(err error) {
+		middleware.RecordRouteReload(controller.Name(), "failed")
+		logger.Warn("Kubernetes watch failed, keeping the current routes", "error", err)
+	})
+}
+
+// logSkipped logs the resources that can't be served
+func logSkipped(table *kube.Table, logger *middleware.SimpleLogger) {
+	for _, err := range table.Skipped {
+		logger.Warn("Kubernetes resource not fully served", "error", err)
+	}
+}
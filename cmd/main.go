@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
@@ -16,12 +20,24 @@ import (
 	"github.com/gofiber/swagger"
 	"github.com/minisource/gateway/config"
 	_ "github.com/minisource/gateway/docs" // Swagger docs
+	"github.com/minisource/gateway/internal/admin"
+	"github.com/minisource/gateway/internal/cache"
+	"github.com/minisource/gateway/internal/cluster"
+	"github.com/minisource/gateway/internal/geoip"
 	"github.com/minisource/gateway/internal/handler"
+	"github.com/minisource/gateway/internal/kube"
+	"github.com/minisource/gateway/internal/lifecycle"
+	"github.com/minisource/gateway/internal/listener"
 	"github.com/minisource/gateway/internal/middleware"
 	"github.com/minisource/gateway/internal/proxy"
 	"github.com/minisource/gateway/internal/router"
+	"github.com/minisource/gateway/internal/routesource"
+	"github.com/minisource/gateway/internal/store"
+	"github.com/minisource/gateway/internal/synthetic"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
+	"github.com/sony/gobreaker"
+	"github.com/valyala/fasthttp"
 )
 
 // @title Gateway Service API
@@ -34,6 +50,13 @@ import (
 // @in header
 // @name Authorization
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "routes" {
+		os.Exit(runRoutesCommand(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidateCommand(os.Args[2:], os.Stdout))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -41,7 +64,7 @@ func main() {
 	}
 
 	// Load routes configuration
-	routes, err := config.LoadRoutes("config/routes.yaml")
+	routes, err := config.LoadRoutes(defaultRoutesFile, cfg.Env)
 	if err != nil {
 		log.Printf("Using default routes: %v", err)
 		routes = config.DefaultRoutes()
@@ -51,41 +74,263 @@ func main() {
 	logger := middleware.NewLogger(cfg.Logging)
 	logger.Info("Starting Minisource API Gateway")
 
+	// Routes from a key-value store or the cluster replace the route files
+	// and are watched
+	var routeSource *routesource.Source
+	var kubeController *kube.Controller
+	var kubeServices map[string]config.ServiceConfig
+	switch cfg.RouteSource.Type {
+	case "file":
+	case "kubernetes":
+		kubeController, routes, kubeServices = loadKubernetes(cfg.Kubernetes, routes, logger)
+	default:
+		routeSource, routes = loadRouteSource(cfg.RouteSource, routes, logger)
+	}
+
+	for _, conflict := range routes.Conflicts() {
+		logger.Warn("Route conflict", "conflict", conflict.String())
+	}
+	middleware.SetRouteInfoTags(cfg.Metrics.RouteTags)
+	middleware.RecordRouteInfo(routes.Routes)
+
+	// Components start in registration order and stop in reverse
+	components := lifecycle.New(logger)
+
+	// Secrets read from secret managers are re-fetched to follow rotations
+	if len(cfg.Secrets.Keys()) > 0 && cfg.SecretsRefresh > 0 {
+		secretsCtx, stopSecrets := context.WithCancel(context.Background())
+		components.Register("secrets", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				go refreshSecrets(secretsCtx, cfg.Secrets, cfg.SecretsRefresh, logger)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopSecrets()
+				return nil
+			},
+		}, 0)
+	}
+
 	// Initialize tracer
 	shutdownTracer, err := middleware.InitTracer(cfg.Tracing)
 	if err != nil {
 		log.Printf("Failed to initialize tracer: %v", err)
+	} else {
+		components.Register("tracer", lifecycle.Hook{OnStop: shutdownTracer}, 0)
 	}
 
-	// Initialize Redis client (optional)
+	// Key-value store for gateway state: Redis when configured and
+	// reachable, in process otherwise
 	var redisClient *redis.Client
-	if cfg.Redis.Host != "" {
-		redisClient = redis.NewClient(&redis.Options{
+	var kv store.KV
+	if cfg.Store.Backend == store.BackendRedis && cfg.Redis.Host != "" {
+		redisOptions := &redis.Options{
 			Addr:     fmt.Sprintf("%s:%s", cfg.Redis.Host, cfg.Redis.Port),
 			Password: cfg.Redis.Password,
 			DB:       cfg.Redis.DB,
-		})
+		}
+		if cfg.Secrets.Has("REDIS_PASSWORD") {
+			// New connections authenticate with the rotated password
+			redisOptions.CredentialsProvider = func() (string, string) {
+				return "", cfg.Secrets.Get("REDIS_PASSWORD")
+			}
+		}
+		redisClient = redis.NewClient(redisOptions)
 
 		// Test connection
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := redisClient.Ping(ctx).Err(); err != nil {
-			logger.Warn("Redis connection failed, using in-memory rate limiter", "error", err)
+			logger.Warn("Redis connection failed, using the in-memory store", "error", err)
+			redisClient.Close()
 			redisClient = nil
 		} else {
 			logger.Info("Connected to Redis")
+			kv = store.NewRedis(redisClient)
+		}
+	}
+	if kv == nil {
+		backend := cfg.Store.Backend
+		if backend == store.BackendRedis {
+			backend = store.BackendMemory
+		}
+		kv, err = store.Open(backend, store.Options{Path: cfg.Store.File, FlushInterval: cfg.Store.FlushInterval})
+		if err != nil {
+			log.Fatalf("Failed to open store: %v", err)
 		}
 	}
+	components.Register("store", lifecycle.Hook{
+		OnStop: func(context.Context) error { return kv.Close() },
+	}, 0)
 
 	// Initialize service proxy
-	serviceProxy := proxy.NewServiceProxy(&cfg.Services)
-	serviceProxy.StartHealthChecks(30 * time.Second)
+	serviceProxy := proxy.NewServiceProxy(&cfg.Services, cfg.Proxy)
+	serviceProxy.SyncServices(kubeServices)
+	discoveryCtx, stopDiscovery := context.WithCancel(context.Background())
+	components.Register("proxy", lifecycle.Hook{
+		OnStart: func(context.Context) error {
+			serviceProxy.StartHealthChecks(30 * time.Second)
+			serviceProxy.StartDiscovery(discoveryCtx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			stopDiscovery()
+			return serviceProxy.Close()
+		},
+	}, 0)
+
+	// Background delivery for ingest routes, stopped after the server so
+	// requests accepted during shutdown are still delivered
+	ingester := proxy.NewIngester(serviceProxy, cfg.Ingest, logger)
+	components.Register("ingester", lifecycle.Hook{
+		OnStart: func(context.Context) error { return ingester.Start() },
+		OnStop:  ingester.Stop,
+	}, 0)
+
+	// Response cache for routes with cache enabled
+	serviceProxy.Use(cache.New(kv, cfg.Proxy.Compression, cfg.JWT.Cookie.Name))
 
 	// Initialize circuit breaker manager
 	cbManager := middleware.NewCircuitBreakerManager(cfg.Circuit)
+	cbManager.SetFallbackCheck(serviceProxy.FallbackAvailable)
 
 	// Initialize rate limiter
-	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit, redisClient)
+	rateLimiter, err := middleware.NewRateLimiter(cfg.RateLimit, kv)
+	if err != nil {
+		log.Fatalf("Invalid rate limit config: %v", err)
+	}
+	components.Register("rate-limiter", lifecycle.Hook{
+		OnStart: func(context.Context) error {
+			if err := rateLimiter.Restore(); err != nil {
+				logger.Warn("Failed to restore rate limiter snapshot", "error", err)
+			}
+			rateLimiter.StartSnapshots(logger)
+			return nil
+		},
+		OnStop: func(context.Context) error { return rateLimiter.Snapshot() },
+	}, 0)
+
+	// Initialize quota tracker
+	quotaTracker := middleware.NewQuotaTracker(cfg.Quota, kv, logger)
+
+	// Initialize concurrency limiter, shared by the replicas through the store
+	concurrencyLimiter := middleware.NewConcurrencyLimiter(cfg.Concurrency, &cfg.Services, kv)
+
+	// Share admin actions with the other replicas
+	clusterCtx, stopCluster := context.WithCancel(context.Background())
+	clusterBus := cluster.New(redisClient, cfg.Cluster, logger)
+	maintenance := middleware.NewMaintenance(cfg.Maintenance)
+	registerClusterHandlers(clusterBus, rateLimiter, cbManager, maintenance)
+	components.Register("cluster", lifecycle.Hook{
+		OnStart: func(context.Context) error {
+			clusterBus.Start(clusterCtx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			stopCluster()
+			return nil
+		},
+	}, 0)
+
+	// Access token verification; an identity provider's JWKS (or OIDC
+	// configuration) is fetched before the server starts and refreshed in
+	// the background
+	tokenConfig := middleware.TokenConfig{
+		Secret:     cfg.JWT.Secret,
+		Algorithms: cfg.JWT.Algorithms,
+		Issuers:    cfg.JWT.Issuers,
+		Audiences:  cfg.JWT.Audiences,
+	}
+	if cfg.Secrets.Has("JWT_SECRET") {
+		tokenConfig.SecretFunc = func() string { return cfg.Secrets.Get("JWT_SECRET") }
+	}
+	if cfg.JWT.JWKSURL != "" {
+		jwks := middleware.NewJWKS(cfg.JWT.JWKSURL, cfg.JWT.JWKSRefreshInterval, logger)
+		jwksCtx, stopJWKS := context.WithCancel(context.Background())
+		components.Register("jwks", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				jwks.Start(jwksCtx)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopJWKS()
+				return nil
+			},
+		}, 0)
+		tokenConfig.JWKS = jwks
+	}
+	if cfg.JWT.OIDCIssuer != "" {
+		oidc := middleware.NewOIDC(cfg.JWT.OIDCIssuer, cfg.JWT.JWKSRefreshInterval, logger)
+		oidcCtx, stopOIDC := context.WithCancel(context.Background())
+		components.Register("oidc", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				oidc.Start(oidcCtx)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopOIDC()
+				return nil
+			},
+		}, 0)
+		tokenConfig.OIDC = oidc
+	}
+	if cfg.JWT.Introspection.URL != "" {
+		tokenConfig.Introspector = middleware.NewIntrospector(cfg.JWT.Introspection)
+	}
+	tenants, err := config.LoadTenants(cfg.JWT.TenantsFile)
+	if err != nil {
+		log.Fatalf("Failed to load tenant registry: %v", err)
+	}
+	if len(tenants.Tenants) > 0 {
+		tenantTokens := middleware.NewTenantTokens(tenants, cfg.JWT.JWKSRefreshInterval, logger)
+		tenantCtx, stopTenants := context.WithCancel(context.Background())
+		components.Register("tenant-keys", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				tenantTokens.Start(tenantCtx)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopTenants()
+				return nil
+			},
+		}, 0)
+		tokenConfig.Tenants = tenantTokens
+	}
+	var revocations *middleware.Revocations
+	if cfg.JWT.Revocation.Enabled {
+		if redisClient == nil {
+			logger.Warn("Token revocations are kept in the local store; other gateways and services won't share them")
+		}
+		revocations = middleware.NewRevocations(cfg.JWT.Revocation, kv, logger)
+		tokenConfig.Revocations = revocations
+	}
+
+	// Signing clients of signature routes
+	signingClients, err := config.LoadSigningClients(cfg.Signature.ClientsFile)
+	if err != nil {
+		logger.Warn("Failed to load signing clients, signature routes will reject all requests", "error", err)
+		signingClients = &config.SigningClientsConfig{}
+	}
+	requestSigning := middleware.NewRequestSigning(cfg.Signature, signingClients, kv, logger)
+
+	// Single-use tokens of routes with replayProtection
+	replays := middleware.NewReplays(cfg.JWT.Replay, kv, logger)
+
+	// Initialize security monitor
+	securityMonitor := middleware.NewSecurityMonitor(cfg.Security, logger)
+
+	// Security audit log, closed after the listeners so the last requests
+	// are still recorded
+	auditLog, err := middleware.NewAuditLog(cfg.Audit.Sink)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	components.Register("audit-log", lifecycle.Hook{
+		OnStop: func(context.Context) error { return auditLog.Close() },
+	}, 0)
+
+	// Per-route analytics for the admin API
+	routeAnalytics := middleware.NewRouteAnalytics(cfg.Analytics)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -94,6 +339,9 @@ func main() {
 		IdleTimeout:  cfg.Server.IdleTimeout,
 		ErrorHandler: middleware.ErrorLogger(logger),
 		AppName:      "Minisource Gateway v1.0.0",
+		BodyLimit:    cfg.Server.MaxBodySize,
+		// Headers must fit the read buffer
+		ReadBufferSize: cfg.Server.MaxHeaderBytes,
 		// Disable default server header
 		ServerHeader: "",
 		// Enable trusted proxy
@@ -101,38 +349,150 @@ func main() {
 		TrustedProxies:          cfg.Server.TrustedProxies,
 	})
 
+	gatewayRouter := router.New(app, serviceProxy, routes, cfg)
+	gatewayRouter.SetIngester(ingester)
+
+	if routeSource != nil {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		components.Register("route-source", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				go watchRouteSource(watchCtx, routeSource, gatewayRouter, logger)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopWatch()
+				return nil
+			},
+		}, 0)
+	}
+	if kubeController != nil {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		components.Register("kubernetes-controller", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				go watchKubernetes(watchCtx, kubeController, kubeServices, gatewayRouter, serviceProxy, logger)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopWatch()
+				return nil
+			},
+		}, 0)
+	}
+
+	// Per-route body limits, enforced before the body is read
+	bodyLimit := middleware.BodyLimit(cfg.Paths, gatewayRouter.GetRouteForPath)
+	app.Server().HeaderReceived = bodyLimit
+
+	// Method overrides, applied before anything looks at the method
+	if cfg.MethodOverride.Enabled {
+		methodOverride := middleware.MethodOverride(cfg.MethodOverride.Header, gatewayRouter.GetRouteForPath)
+		app.Server().HeaderReceived = func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+			methodOverride(header)
+			return bodyLimit(header)
+		}
+	}
+
+	// Reject doomed Expect: 100-continue uploads before the body is sent
+	app.Server().ContinueHandler = middleware.ExpectContinue(middleware.ExpectContinueConfig{
+		Tokens:     tokenConfig,
+		CookieName: cfg.JWT.Cookie.Name,
+		Match:      gatewayRouter.GetRouteForPath,
+		Fallback:   gatewayRouter.HasFallback,
+		Available: func(service string) bool {
+			if serviceProxy.FallbackAvailable(service) {
+				return true
+			}
+			return serviceProxy.IsAvailable(service) && cbManager.GetState(service) != gobreaker.StateOpen
+		},
+	})
+
 	// Apply middleware stack (order matters!)
-	setupMiddleware(app, cfg, routes, logger, cbManager, rateLimiter)
+	setupMiddleware(app, cfg, logger, gatewayRouter, cbManager, rateLimiter, quotaTracker, concurrencyLimiter, securityMonitor, auditLog, routeAnalytics, maintenance, tokenConfig, requestSigning, replays)
 
 	// Setup health endpoints
 	healthHandler := handler.NewHealthHandler(serviceProxy)
-	healthHandler.RegisterRoutes(app)
+	// Operational endpoints, guarded by OPS_* and INTERNAL_AUTH_*
+	opsGuard, err := middleware.OpsGuard(cfg.Server)
+	if err != nil {
+		log.Fatalf("Invalid operational endpoint config: %v", err)
+	}
+	healthHandler.RegisterRoutes(app, opsGuard)
+
+	// Synthetic transaction checks
+	synthetics, err := config.LoadSynthetics(cfg.SyntheticsFile)
+	if err != nil {
+		logger.Warn("Failed to load synthetic checks", "error", err)
+		synthetics = &config.SyntheticsConfig{}
+	}
+	syntheticRunner := synthetic.NewRunner(synthetics, serviceProxy)
+	components.Register("synthetics", lifecycle.Hook{
+		OnStart: func(context.Context) error {
+			syntheticRunner.Start()
+			return nil
+		},
+	}, 0)
+	healthHandler.SetSynthetics(syntheticRunner)
 
 	// Prometheus metrics endpoint
-	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+	app.Get("/metrics", opsGuard, adaptor.HTTPHandler(promhttp.Handler()))
 
 	// Swagger route
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
 	// Circuit breaker status endpoint
-	app.Get("/circuit-breakers", func(c *fiber.Ctx) error {
+	app.Get("/circuit-breakers", opsGuard, func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"states": cbManager.GetAllStates(),
 		})
 	})
 
 	// Setup routes
-	gatewayRouter := router.New(app, serviceProxy, routes, cfg)
 	gatewayRouter.SetupRoutes()
 
-	// Start server in goroutine
-	go func() {
-		addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
-		logger.Info("Gateway listening", "address", addr)
-		if err := app.Listen(addr); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+	// Admin API (separate listener)
+	var adminServer *admin.Server
+	if cfg.Admin.Enabled {
+		adminTokens, err := config.LoadAdminTokens(cfg.Admin.TokensFile)
+		if err != nil {
+			logger.Warn("Failed to load admin tokens, admin API will reject all requests", "error", err)
 		}
-	}()
+		adminServer = admin.New(cfg.Admin, admin.NewTokenStore(adminTokens), logger)
+		adminServer.SetAuditLog(auditLog)
+		adminServer.RegisterRoutes(gatewayRouter.Routes)
+		adminServer.RegisterRouteDiff(gatewayRouter.Routes, serviceProxy.ServiceNames)
+		adminServer.RegisterMatch(gatewayRouter.Explain)
+		adminServer.RegisterDrain(healthHandler)
+		adminServer.RegisterLimits(rateLimiter, clusterBus)
+		adminServer.RegisterBreakers(clusterBus)
+		adminServer.RegisterAnalytics(routeAnalytics)
+		adminServer.RegisterMaintenance(gatewayRouter.Routes, maintenance, clusterBus)
+		if revocations != nil {
+			adminServer.RegisterRevocations(revocations)
+		}
+
+		components.Register("admin", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					logger.Info("Admin API listening", "address", fmt.Sprintf("%s:%s", cfg.Admin.Host, cfg.Admin.Port))
+					if err := adminServer.Listen(); err != nil {
+						logger.Error("Admin API stopped", "error", err)
+					}
+				}()
+				return nil
+			},
+			OnStop: adminServer.Shutdown,
+		}, 0)
+	}
+
+	// Gateway listeners, registered last so they stop accepting traffic first
+	components.Register("server", lifecycle.Hook{
+		OnStart: func(context.Context) error { return startListeners(app, cfg.Server, logger) },
+		OnStop:  app.ShutdownWithContext,
+	}, 0)
+
+	if err := components.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start gateway: %v", err)
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -145,38 +505,187 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	if err := app.ShutdownWithContext(ctx); err != nil {
-		logger.Error("Server forced to shutdown", "error", err)
+	if err := components.Stop(ctx); err != nil {
+		logger.Error("Gateway stopped with errors", "error", err)
+		return
 	}
 
-	// Cleanup
-	if err := serviceProxy.Close(); err != nil {
-		logger.Error("Failed to close proxy", "error", err)
+	logger.Info("Gateway stopped")
+}
+
+// startListeners serves app on the gateway listener and, when configured,
+// on the internal listener for service-to-service calls to internalOnly
+// routes (the same app, meant to be reachable only in-cluster)
+func startListeners(app *fiber.App, cfg config.ServerConfig, logger *middleware.SimpleLogger) error {
+	addr := fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
+	ln, err := newListener(addr, cfg)
+	if err != nil {
+		return err
 	}
 
-	if redisClient != nil {
-		if err := redisClient.Close(); err != nil {
-			logger.Error("Failed to close Redis", "error", err)
+	var internalLn net.Listener
+	if cfg.InternalPort != "" {
+		internalAddr := fmt.Sprintf("%s:%s", cfg.Host, cfg.InternalPort)
+		if internalLn, err = net.Listen("tcp", internalAddr); err != nil {
+			ln.Close()
+			return fmt.Errorf("internal listener: %w", err)
 		}
 	}
 
-	if shutdownTracer != nil {
-		if err := shutdownTracer(ctx); err != nil {
-			logger.Error("Failed to shutdown tracer", "error", err)
+	go func() {
+		logger.Info("Gateway listening", "address", addr, "tls", cfg.TLSCertFile != "")
+		if err := app.Listener(ln); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
 		}
+	}()
+	if internalLn != nil {
+		go func() {
+			logger.Info("Internal listener", "address", internalLn.Addr().String())
+			if err := app.Listener(internalLn); err != nil && err != http.ErrServerClosed {
+				logger.Error("Internal listener stopped", "error", err)
+			}
+		}()
 	}
+	return nil
+}
 
-	logger.Info("Gateway stopped")
+// newListener opens the gateway listener, with TLS when a certificate is
+// configured and PROXY protocol parsing when enabled
+func newListener(addr string, cfg config.ServerConfig) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := listener.Options{
+		ProxyProtocol:        cfg.ProxyProtocol,
+		ProxyProtocolTimeout: cfg.ProxyProtocolTimeout,
+		ProxyProtocolSources: cfg.ProxyProtocolSources,
+		ReadStallTimeout:     cfg.ReadStallTimeout,
+		MinReadRate:          cfg.MinReadRate,
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		opts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if err := tlsPolicy(opts.TLS, cfg); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		if cfg.TLSClientCAFile != "" {
+			if err := clientAuth(opts.TLS, cfg); err != nil {
+				ln.Close()
+				return nil, err
+			}
+		}
+	}
+
+	wrapped, err := listener.New(ln, opts)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+// tlsVersions are the TLS versions SERVER_TLS_MIN_VERSION and
+// SERVER_TLS_MAX_VERSION accept
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsPolicy applies the configured TLS versions, cipher suites and curves
+func tlsPolicy(tlsConfig *tls.Config, cfg config.ServerConfig) error {
+	var ok bool
+	if tlsConfig.MinVersion, ok = tlsVersions[cfg.TLSMinVersion]; !ok {
+		return fmt.Errorf("SERVER_TLS_MIN_VERSION must be 1.0, 1.1, 1.2 or 1.3, not %q", cfg.TLSMinVersion)
+	}
+	if cfg.TLSMaxVersion != "" {
+		if tlsConfig.MaxVersion, ok = tlsVersions[cfg.TLSMaxVersion]; !ok {
+			return fmt.Errorf("SERVER_TLS_MAX_VERSION must be 1.0, 1.1, 1.2 or 1.3, not %q", cfg.TLSMaxVersion)
+		}
+		if tlsConfig.MaxVersion < tlsConfig.MinVersion {
+			return fmt.Errorf("SERVER_TLS_MAX_VERSION %s is below SERVER_TLS_MIN_VERSION %s", cfg.TLSMaxVersion, cfg.TLSMinVersion)
+		}
+	}
+
+	suites := make(map[string]*tls.CipherSuite)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite
+	}
+	for _, name := range cfg.TLSCipherSuites {
+		suite, ok := suites[name]
+		if !ok {
+			return fmt.Errorf("SERVER_TLS_CIPHER_SUITES: %q is not a supported secure cipher suite", name)
+		}
+		if !slices.ContainsFunc(suite.SupportedVersions, func(v uint16) bool { return v <= tls.VersionTLS12 }) {
+			// Go doesn't let TLS 1.3 suites be configured
+			return fmt.Errorf("SERVER_TLS_CIPHER_SUITES: %s is a TLS 1.3 suite, which can't be configured", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, suite.ID)
+	}
+
+	curves := make(map[string]tls.CurveID)
+	for _, curve := range []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521} {
+		curves[curve.String()] = curve
+	}
+	for _, name := range cfg.TLSCurves {
+		curve, ok := curves[name]
+		if !ok {
+			return fmt.Errorf("SERVER_TLS_CURVES: %q is not one of X25519MLKEM768, X25519, CurveP256, CurveP384 or CurveP521", name)
+		}
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, curve)
+	}
+	return nil
+}
+
+// clientAuth makes the TLS listener verify client certificates (mTLS)
+// against the client CAs
+func clientAuth(tlsConfig *tls.Config, cfg config.ServerConfig) error {
+	pem, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return fmt.Errorf("load TLS client CAs: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("load TLS client CAs: no certificates in %s", cfg.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	switch cfg.TLSClientAuth {
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("SERVER_TLS_CLIENT_AUTH must be request or require, not %q", cfg.TLSClientAuth)
+	}
+	return nil
 }
 
 // setupMiddleware configures the middleware stack
 func setupMiddleware(
 	app *fiber.App,
 	cfg *config.Config,
-	routes *config.RouteConfig,
 	logger *middleware.SimpleLogger,
+	gatewayRouter *router.Router,
 	cbManager *middleware.CircuitBreakerManager,
 	rateLimiter *middleware.RateLimiter,
+	quotaTracker *middleware.QuotaTracker,
+	concurrencyLimiter *middleware.ConcurrencyLimiter,
+	securityMonitor *middleware.SecurityMonitor,
+	auditLog *middleware.AuditLog,
+	routeAnalytics *middleware.RouteAnalytics,
+	maintenance *middleware.Maintenance,
+	tokenConfig middleware.TokenConfig,
+	requestSigning *middleware.RequestSigning,
+	replays *middleware.Replays,
 ) {
 	// Recovery - must be first
 	app.Use(recover.New(recover.Config{
@@ -184,13 +693,66 @@ func setupMiddleware(
 	}))
 
 	// Request ID - early for tracing
-	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestID(cfg.RequestID))
+
+	// URI length and header count limits
+	app.Use(middleware.RequestLimits(cfg.Server.MaxURILength, cfg.Server.MaxHeaderCount))
+
+	// Repeated security-relevant headers - before anything reads them
+	duplicateHeaders, err := middleware.DuplicateHeaders(cfg.Server.DuplicateHeaders, cfg.Server.DuplicateHeaderNames)
+	if err != nil {
+		log.Fatalf("Invalid duplicate header config: %v", err)
+	}
+	app.Use(duplicateHeaders)
+
+	// Server-Timing - wraps everything after it
+	app.Use(middleware.ServerTiming(cfg.Timing))
+
+	// Path normalization - routing and auth see the path upstreams receive
+	app.Use(middleware.NormalizePath(cfg.Paths))
+
+	// Route resolution - before anything that reads route flags
+	app.Use(gatewayRouter.Match())
+
+	// Internal-only routes - hidden before any other middleware sees them
+	internalOnly, err := middleware.InternalOnly(cfg.Server.InternalCIDRs, cfg.Server.InternalPort)
+	if err != nil {
+		log.Fatalf("Invalid internal network config: %v", err)
+	}
+	app.Use(internalOnly)
+
+	// Identity headers sent by callers outside the internal network
+	stripIdentity, err := middleware.StripIdentityHeaders(cfg.Server.InternalCIDRs, cfg.Server.InternalPort, cfg.JWT.ClaimHeaders, gatewayRouter.Routes)
+	if err != nil {
+		log.Fatalf("Invalid internal network config: %v", err)
+	}
+	app.Use(stripIdentity)
+
+	// Client certificate identity (mTLS), required by clientCert routes
+	app.Use(middleware.ClientCert())
 
 	// Security headers
 	app.Use(middleware.SecurityHeaders())
 
+	// HttpOnly, Secure and SameSite on the token cookie upstreams set
+	sessionCookie, err := middleware.SessionCookie(cfg.JWT.Cookie)
+	if err != nil {
+		log.Fatalf("Invalid session cookie config: %v", err)
+	}
+	app.Use(sessionCookie)
+
+	// Unsafe requests authenticated by that cookie only from allowed origins
+	cookieOrigin, err := middleware.CookieOrigin(cfg.JWT.Cookie, cfg.Server.CORSAllowOrigins)
+	if err != nil {
+		log.Fatalf("Invalid session cookie config: %v", err)
+	}
+	app.Use(cookieOrigin)
+
+	// Deprecation, Sunset and successor Link headers of retiring routes
+	app.Use(middleware.Deprecation())
+
 	// CORS
-	app.Use(middleware.CORS([]string{"*"}))
+	app.Use(middleware.CORS(cfg.Server.CORSAllowOrigins, gatewayRouter.AllowedMethods, gatewayRouter.GetRouteForPath))
 
 	// Tracing
 	if cfg.Tracing.Enabled {
@@ -203,18 +765,82 @@ func setupMiddleware(
 	// Request logging
 	app.Use(middleware.RequestLogger(logger))
 
+	// Route analytics (observes the final status and authenticated user)
+	app.Use(routeAnalytics.Middleware())
+
+	// Security alerts (observes auth and rate limit rejections)
+	app.Use(securityMonitor.Middleware())
+
+	// Security audit log (observes rejections, like the alerts)
+	app.Use(auditLog.Middleware())
+
+	// Maintenance - answered before auth, without touching the backend
+	app.Use(maintenance.Middleware())
+
 	// Content type validation
 	app.Use(middleware.ContentType())
 
+	// Client location (country, ASN) and geo-restricted routes
+	var locator middleware.Locator
+	if len(cfg.GeoIP.Databases) > 0 {
+		geo, err := geoip.OpenLocator(cfg.GeoIP.Databases)
+		if err != nil {
+			log.Fatalf("Failed to load GeoIP databases: %v", err)
+		}
+		locator = geo
+	}
+	app.Use(middleware.Geo(locator, cfg.GeoIP.Metrics))
+
+	// Bot and scanner filtering by User-Agent
+	bots, err := middleware.Bots(cfg.Bots)
+	if err != nil {
+		log.Fatalf("Invalid bot filter config: %v", err)
+	}
+	app.Use(bots)
+
 	// Tenant extraction
 	app.Use(middleware.TenantExtractor())
 
+	// Request signatures of machine callers on signature routes
+	app.Use(requestSigning.Middleware())
+
 	// Authentication (after public routes are set up)
-	app.Use(middleware.NewAuthMiddleware(cfg, routes))
+	authConfig := middleware.DefaultAuthConfig(cfg.JWT.Secret)
+	authConfig.Tokens = tokenConfig
+	authConfig.ClaimHeaders = cfg.JWT.ClaimHeaders
+	authConfig.CookieName = cfg.JWT.Cookie.Name
+	if cfg.IdentityToken.Secret != "" {
+		authConfig.Identity = middleware.NewIdentityTokens(cfg.IdentityToken)
+	}
+	app.Use(middleware.NewAuthMiddleware(authConfig, gatewayRouter.Routes))
+
+	// Reused tokens on routes with replayProtection (need the claims)
+	app.Use(replays.Middleware())
+
+	// OPA authorization policies (need the claims)
+	if cfg.Policy.URL != "" {
+		app.Use(middleware.NewPolicy(cfg.Policy, logger).Middleware())
+	}
+
+	// Request body schemas
+	app.Use(middleware.BodySchema(cfg.SchemasDir, gatewayRouter.Routes, logger))
+
+	// Experiment variant assignment (needs the authenticated user)
+	app.Use(middleware.Experiments(logger))
+
+	// Request priority (needs the caller's roles), used when shedding load
+	app.Use(middleware.Priority(cfg.Priority))
 
 	// Rate limiting
 	app.Use(rateLimiter.Middleware())
 
+	// Quotas
+	app.Use(quotaTracker.Middleware())
+
+	// Requests in flight per service - before the circuit breaker, which
+	// would count its 503s as upstream failures
+	app.Use(concurrencyLimiter.Middleware())
+
 	// Circuit breaker
 	app.Use(cbManager.Middleware())
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/minisource/gateway/config"
+)
+
+// runRoutesCommand handles "gateway routes <subcommand>" and returns the
+// process exit code
+func runRoutesCommand(args []string, out io.Writer) int {
+	switch {
+	case len(args) == 3 && args[0] == "diff":
+		return runRoutesDiff(args, out)
+	case len(args) == 2 && args[0] == "check":
+		return runRoutesCheck(args, out)
+	}
+	fmt.Fprintln(os.Stderr, "usage: gateway routes diff <old.yaml> <new.yaml>")
+	fmt.Fprintln(os.Stderr, "       gateway routes check <routes.yaml | routes.d>")
+	return 2
+}
+
+// runRoutesCheck lists shadowed routes in matching order; exit code 1 means
+// some route is at least partly unreachable
+func runRoutesCheck(args []string, out io.Writer) int {
+	routes, err := loadRouteFile(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	conflicts := routes.Conflicts()
+	for _, conflict := range conflicts {
+		fmt.Fprintln(out, conflict)
+	}
+	if len(conflicts) > 0 {
+		return 1
+	}
+	fmt.Fprintln(out, "No route conflicts")
+	return 0
+}
+
+// runRoutesDiff compares two route files
+func runRoutesDiff(args []string, out io.Writer) int {
+	old, err := loadRouteFile(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	new, err := loadRouteFile(args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	changes := config.DiffRoutes(old, new)
+	printRouteChanges(out, changes)
+
+	// Like diff(1): 1 means the configurations differ
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadRouteFile loads a route file without falling back to the defaults,
+// which LoadRoutes does for missing files. The overlays of GATEWAY_ENV are
+// applied, like the gateway does.
+func loadRouteFile(path string) (*config.RouteConfig, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	routes, err := config.LoadRoutes(path, os.Getenv("GATEWAY_ENV"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return routes, nil
+}
+
+// printRouteChanges writes a readable summary of route changes
+func printRouteChanges(out io.Writer, changes []config.RouteChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "No route changes")
+		return
+	}
+
+	var added, removed, changed int
+	for _, change := range changes {
+		route := change.Route
+		label := fmt.Sprintf("%s [%s] -> %s", route.Pattern(), strings.Join(route.Methods, ","), route.Service)
+
+		switch change.Kind {
+		case config.RouteAdded:
+			added++
+			fmt.Fprintf(out, "+ %s%s\n", label, routeFlags(route))
+		case config.RouteRemoved:
+			removed++
+			fmt.Fprintf(out, "- %s%s\n", label, routeFlags(route))
+		case config.RouteChanged:
+			changed++
+			fmt.Fprintf(out, "~ %s\n", label)
+			for _, field := range change.Fields {
+				fmt.Fprintf(out, "    %s: %s -> %s\n", field.Field, field.Old, field.New)
+			}
+		}
+	}
+	fmt.Fprintf(out, "\n%d added, %d removed, %d changed\n", added, removed, changed)
+}
+
+// routeFlags highlights the settings reviewers care most about
+func routeFlags(route config.Route) string {
+	var flags []string
+	if route.Public {
+		flags = append(flags, "public")
+	}
+	if route.RateLimit != nil {
+		limit := fmt.Sprintf("rateLimit %d/s burst %d", route.RateLimit.RequestsPerSec, route.RateLimit.BurstSize)
+		if route.RateLimit.Algorithm != "" {
+			limit += " " + route.RateLimit.Algorithm
+		}
+		flags = append(flags, limit)
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(flags, ", ") + ")"
+}
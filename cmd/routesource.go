@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/router"
+	"github.com/minisource/gateway/internal/routesource"
+)
+
+// loadRouteSource reads the routes from the configured key-value store,
+// returning fallback (the route files) when the store can't be read yet;
+// the watch applies the store's routes once it can
+func loadRouteSource(cfg config.RouteSourceConfig, fallback *config.RouteConfig, logger *middleware.SimpleLogger) (*routesource.Source, *config.RouteConfig) {
+	source, err := routesource.New(cfg)
+	if err != nil {
+		logger.Error("Invalid route source, using the route files", "error", err)
+		return nil, fallback
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RetryInterval+10*time.Second)
+	defer cancel()
+	routes, err := source.Load(ctx)
+	if err != nil {
+		logger.Warn("Failed to load routes from the route source, using the route files until it is available",
+			"source", source.Name(), "error", err)
+		return source, fallback
+	}
+	logger.Info("Loaded routes from the route source", "source", source.Name(), "key", cfg.Key, "routes", len(routes.Routes))
+	return source, routes
+}
+
+// watchRouteSource applies the route source's changes to the router until
+// ctx is done
+func watchRouteSource(ctx context.Context, source *routesource.Source, gatewayRouter *router.Router, logger *middleware.SimpleLogger) {
+	source.Watch(ctx, func(routes *config.RouteConfig) {
+		for _, conflict := range routes.Conflicts() {
+			logger.Warn("Route conflict", "conflict", conflict.String())
+		}
+		gatewayRouter.SetRoutes(routes)
+		middleware.RecordRouteInfo(routes.Routes)
+		middleware.RecordRouteReload(source.Name(), "applied")
+		logger.Info("Routes updated from the route source", "source", source.Name(), "routes", len(routes.Routes))
+	}, func(err error) {
+		middleware.RecordRouteReload(source.Name(), "failed")
+		logger.Warn("Route source update failed, keeping the current routes", "source", source.Name(), "error", err)
+	})
+}
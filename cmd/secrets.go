@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// refreshSecrets re-fetches the secrets read from secret managers every
+// interval until ctx is done. Values read through them (the JWT secret,
+// the Redis password) follow rotations; the others need a restart.
+func refreshSecrets(ctx context.Context, secrets *config.Secrets, interval time.Duration, logger *middleware.SimpleLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := secrets.Refresh(ctx)
+		if err != nil {
+			logger.Warn("Failed to refresh secrets, keeping the current values", "error", err)
+		}
+		if len(changed) > 0 {
+			logger.Info("Secrets rotated", "variables", changed)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/schema"
+)
+
+// defaultRoutesFile is the route file the gateway loads
+const defaultRoutesFile = "config/routes.yaml"
+
+// runValidateCommand handles "gateway validate [routes]": it loads the
+// environment configuration and checks it together with the route files
+// (see config.RouteFiles), the admin tokens, the synthetic checks and the
+// request body schemas. Exit code 1 means errors were found; warnings alone
+// (e.g. shadowed routes) pass.
+func runValidateCommand(args []string, out io.Writer) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: gateway validate [routes.yaml | routes.d]")
+		return 2
+	}
+	routesFile := defaultRoutesFile
+	if len(args) == 1 {
+		routesFile = args[0]
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(out, "config: %v\n", err)
+		return 1
+	}
+
+	var errs, warnings int
+	for _, env := range config.InvalidEnv() {
+		errs++
+		fmt.Fprintf(out, "env: %s is not valid, the default would be used\n", env)
+	}
+
+	services := []string{"auth", "notifier"}
+	for name := range cfg.Services.Additional {
+		services = append(services, name)
+	}
+	problems, err := config.CheckRoutes(routesFile, cfg.Env, services)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, problem := range problems {
+		if problem.Warning {
+			warnings++
+		} else {
+			errs++
+		}
+		fmt.Fprintln(out, problem)
+	}
+
+	if cfg.Admin.Enabled {
+		if _, err := config.LoadAdminTokens(cfg.Admin.TokensFile); err != nil {
+			errs++
+			fmt.Fprintf(out, "%s: %v\n", cfg.Admin.TokensFile, err)
+		}
+	}
+	if _, err := config.LoadSynthetics(cfg.SyntheticsFile); err != nil {
+		errs++
+		fmt.Fprintf(out, "%s: %v\n", cfg.SyntheticsFile, err)
+	}
+	if _, err := config.LoadSigningClients(cfg.Signature.ClientsFile); err != nil {
+		errs++
+		fmt.Fprintf(out, "%s: %v\n", cfg.Signature.ClientsFile, err)
+	}
+	// Schemas are only loaded on request; routes with errors are reported above
+	if routes, err := config.LoadRoutes(routesFile, cfg.Env); err == nil {
+		checked := make(map[string]bool)
+		for _, route := range routes.Routes {
+			if route.Schema == "" || checked[route.Schema] {
+				continue
+			}
+			checked[route.Schema] = true
+			if _, err := schema.Load(cfg.SchemasDir, route.Schema); err != nil {
+				errs++
+				fmt.Fprintf(out, "schema %s: %v\n", route.Schema, err)
+			}
+		}
+	}
+
+	if errs > 0 || warnings > 0 {
+		fmt.Fprintf(out, "\n%d errors, %d warnings\n", errs, warnings)
+	}
+	if errs > 0 {
+		return 1
+	}
+	if warnings == 0 {
+		fmt.Fprintln(out, "Configuration is valid")
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Admin API scopes
+const (
+	ScopeRoutesRead  = "routes:read"
+	ScopeLimitsWrite = "limits:write"
+	ScopeDrain       = "drain"
+	ScopeBreakers    = "breakers:write"
+	ScopeAnalytics   = "analytics:read"
+	ScopeMaintenance = "maintenance"
+	ScopeTokens      = "tokens:revoke"
+)
+
+// AdminTokensConfig holds the admin API tokens
+type AdminTokensConfig struct {
+	Tokens []AdminToken `yaml:"tokens"`
+}
+
+// AdminToken is an admin API credential. Only the SHA-256 of the token is
+// stored so the file can be committed to a secrets store without exposing it.
+type AdminToken struct {
+	Name        string   `yaml:"name"`
+	TokenSHA256 string   `yaml:"tokenSHA256"`
+	Scopes      []string `yaml:"scopes"`
+}
+
+// LoadAdminTokens loads admin API tokens from a YAML file
+func LoadAdminTokens(path string) (*AdminTokensConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg AdminTokensConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{
+		ScopeRoutesRead:  true,
+		ScopeLimitsWrite: true,
+		ScopeDrain:       true,
+		ScopeBreakers:    true,
+		ScopeAnalytics:   true,
+		ScopeMaintenance: true,
+		ScopeTokens:      true,
+	}
+	for _, token := range cfg.Tokens {
+		if token.Name == "" || token.TokenSHA256 == "" {
+			return nil, fmt.Errorf("admin token requires name and tokenSHA256")
+		}
+		for _, scope := range token.Scopes {
+			if !known[scope] {
+				return nil, fmt.Errorf("admin token %s: unknown scope %q", token.Name, scope)
+			}
+		}
+	}
+
+	return &cfg, nil
+}
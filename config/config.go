@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -10,14 +11,60 @@ import (
 )
 
 type Config struct {
+	// Env names the deployment environment (e.g. staging, prod); it selects
+	// the route overlays loaded over the route files (routes.<env>.yaml)
+	Env       string
 	Server    ServerConfig
 	Services  ServicesConfig
-	Redis     RedisConfig
-	JWT       JWTConfig
+	Proxy     ProxyConfig
+	Ingest    IngestConfig
+	RequestID RequestIDConfig
+	Priority  PriorityConfig
+	// MethodOverride lets POST requests carry another method in a header
+	MethodOverride MethodOverrideConfig
+	// Paths is how request paths are normalized before routing
+	Paths PathConfig
+	Redis RedisConfig
+	Store StoreConfig
+	// RouteSource is where routes are read from when not from the route files
+	RouteSource RouteSourceConfig
+	// Kubernetes builds the routes from cluster resources (ROUTES_SOURCE=kubernetes)
+	Kubernetes KubernetesConfig
+	JWT        JWTConfig
+	// Signature verifies the HMAC signatures of signature routes
+	Signature SignatureConfig
+	// Policy delegates authorization decisions to Open Policy Agent
+	Policy PolicyConfig
+	// IdentityToken asserts authenticated identities to upstreams
+	IdentityToken IdentityTokenConfig
+	// GeoIP locates clients for geo restrictions and enrichment
+	GeoIP GeoIPConfig
+	// Bots filters automated clients by their User-Agent
+	Bots      BotConfig
 	RateLimit RateLimitConfig
+	Quota     QuotaConfig
+	Security  SecurityAlertsConfig
+	Audit     AuditConfig
 	Circuit   CircuitConfig
 	Tracing   TracingConfig
 	Logging   LoggingConfig
+	Metrics   MetricsConfig
+	Timing    ServerTimingConfig
+	Analytics AnalyticsConfig
+	// Maintenance is the response of routes in maintenance
+	Maintenance MaintenanceConfig
+	// Concurrency caps the requests in flight to the services
+	Concurrency ConcurrencyConfig
+	Admin       AdminConfig
+	Cluster     ClusterConfig
+	// SyntheticsFile lists synthetic transaction checks
+	SyntheticsFile string
+	// SchemasDir holds the request body schemas routes refer to
+	SchemasDir string
+	// Secrets are the values read from secret managers, re-fetched every
+	// SecretsRefresh (0 disables it)
+	Secrets        *Secrets
+	SecretsRefresh time.Duration
 }
 
 type ServerConfig struct {
@@ -28,19 +75,201 @@ type ServerConfig struct {
 	IdleTimeout     time.Duration
 	ShutdownTimeout time.Duration
 	TrustedProxies  []string
+	// TLSCertFile and TLSKeyFile enable TLS on the gateway listener
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile verifies client certificates (mTLS) against these
+	// CAs. TLSClientAuth is request (verify certificates when presented,
+	// routes with clientCert require one) or require (every connection).
+	TLSClientCAFile string
+	TLSClientAuth   string
+	// TLSMinVersion and TLSMaxVersion bound the TLS versions negotiated
+	// (1.0 to 1.3; an empty maximum is the newest). TLSCipherSuites (for
+	// TLS 1.2 and below) and TLSCurves, given by their Go names, replace
+	// Go's defaults when set.
+	TLSMinVersion   string
+	TLSMaxVersion   string
+	TLSCipherSuites []string
+	TLSCurves       []string
+	// ProxyProtocol parses PROXY protocol v1/v2 headers from load balancers
+	// in ProxyProtocolSources (any peer when empty) to recover client IPs
+	ProxyProtocol        bool
+	ProxyProtocolTimeout time.Duration
+	ProxyProtocolSources []string
+	// ReadStallTimeout closes connections whose request (headers or body)
+	// stops arriving for longer, and MinReadRate those sending it slower
+	// than this many bytes per second after ReadStallTimeout; 0 disables them
+	ReadStallTimeout time.Duration
+	MinReadRate      int
+	// InternalCIDRs and InternalPort decide who may call internalOnly
+	// routes: clients in these ranges, or anyone connecting to the internal
+	// listener on InternalPort (empty disables it)
+	InternalCIDRs []string
+	InternalPort  string
+	// InternalUsername and InternalPassword, when set, are the basic auth
+	// credentials required on /metrics and /circuit-breakers
+	InternalUsername string
+	InternalPassword string
+	// OpsAllowCIDRs, when set, are the only networks (besides the internal
+	// listener) served the operational endpoints; OpsInternalPortOnly serves
+	// them on the internal listener alone. OpsToken is a bearer token
+	// accepted on them besides the basic auth credentials.
+	OpsAllowCIDRs       []string
+	OpsInternalPortOnly bool
+	OpsToken            string
+	// MaxBodySize is the request body limit in bytes for routes without
+	// their own maxBodySize
+	MaxBodySize int
+	// MaxHeaderBytes bounds the request line and headers, which must fit
+	// the connection's read buffer (431 otherwise)
+	MaxHeaderBytes int
+	// MaxURILength and MaxHeaderCount reject longer request URIs (414) and
+	// requests with more headers (431); 0 disables them
+	MaxURILength   int
+	MaxHeaderCount int
+	// DuplicateHeaders is what happens to requests repeating one of
+	// DuplicateHeaderNames: reject (400), first (the other values are
+	// dropped) or off
+	DuplicateHeaders     string
+	DuplicateHeaderNames []string
+	// CORSAllowOrigins are the origins CORS admits, "*" for any. With a
+	// session cookie they must be listed: unsafe requests authenticated by
+	// the cookie are only accepted from them.
+	CORSAllowOrigins []string
 }
 
 type ServicesConfig struct {
 	Auth     ServiceConfig
 	Notifier ServiceConfig
+	// Additional services (e.g. read replicas) listed in ADDITIONAL_SERVICES.
+	// Each is configured like the built-in ones, with its name upper-cased
+	// and dashes replaced by underscores as the variable prefix.
+	Additional map[string]ServiceConfig
 }
 
 type ServiceConfig struct {
-	URL             string
-	Timeout         time.Duration
+	URL     string
+	Timeout time.Duration
+	// MaxIdleConns is not enforced: fasthttp bounds idle connections by
+	// MaxConnsPerHost and closes them after IdleConnTimeout
 	MaxIdleConns    int
 	MaxConnsPerHost int
-	HealthPath      string
+	// IdleConnTimeout closes keep-alive connections idle for longer
+	IdleConnTimeout time.Duration
+	// MaxConnWaitTimeout is how long a request waits for a free connection
+	// when MaxConnsPerHost is reached (0 fails immediately)
+	MaxConnWaitTimeout time.Duration
+	// ReadBufferSize and WriteBufferSize size per-connection buffers; larger
+	// read buffers are needed for big response headers (0 uses 4KB)
+	ReadBufferSize  int
+	WriteBufferSize int
+	// HealthPath is probed by the health checks; empty skips them and
+	// keeps the service healthy
+	HealthPath string
+	// SlowStart ramps traffic up over this window after the service
+	// recovers from unhealthy, sending the rest to FallbackURL; without a
+	// fallback the service keeps all traffic (0 sends full load immediately)
+	SlowStart time.Duration
+	// SRVName, when set, is resolved every SRVRefresh and requests are
+	// balanced across the returned host:port pairs using URL's scheme
+	SRVName    string
+	SRVRefresh time.Duration
+	// DNSResetAfter consecutive dial failures replace the client so the
+	// upstream hostname is re-resolved (0 disables)
+	DNSResetAfter int
+	// FallbackURL is tried when the primary is unhealthy or its circuit is
+	// open, e.g. the same service in another region
+	FallbackURL string
+	// PreserveHost forwards the client's Host header instead of the
+	// upstream's; HostHeader sends a fixed Host instead. Routes can override both.
+	PreserveHost bool
+	HostHeader   string
+	// MaxInFlight caps the requests in flight to the service across all
+	// gateway instances when CONCURRENCY_LIMIT_ENABLED is set (0: no cap)
+	MaxInFlight int
+}
+
+// ProxyConfig holds settings shared by all proxied requests
+type ProxyConfig struct {
+	// StreamWriteTimeout bounds how long a single write to a streaming
+	// client may block before the connection is dropped
+	StreamWriteTimeout time.Duration
+	// StreamMinRate is the minimum average bytes/sec a streaming client
+	// must read at once StreamMinRateGrace has elapsed, measured over the
+	// time spent writing to it (0 disables)
+	StreamMinRate      int
+	StreamMinRateGrace time.Duration
+	// SlowClientPolicy decides what happens to the upstream response when
+	// a slow client is aborted: "disconnect" or "drain"
+	SlowClientPolicy string
+	Compression      CompressionConfig
+	// MaxDecodedBodySize caps, in bytes, how far a compressed response is
+	// decoded for normalization; larger responses are relayed as encoded
+	// and not cached (0 = no limit)
+	MaxDecodedBodySize int
+	// ForwardedForDepth is how many right-most X-Forwarded-For entries from
+	// a trusted proxy are kept before the client address is appended
+	// (0 keeps the whole chain)
+	ForwardedForDepth int
+	// ForwardedHeader also emits the RFC 7239 Forwarded header
+	ForwardedHeader bool
+}
+
+// CompressionConfig controls egress compression of normalized (cacheable)
+// responses, which are kept uncompressed inside the gateway
+type CompressionConfig struct {
+	// Encodings the gateway may produce, in order of preference
+	Encodings []string
+	// Level is the gzip and deflate level (1-9)
+	Level int
+	// BrotliQuality (0-11) and ZstdLevel (1 fastest - 4 best) tune the
+	// other codings
+	BrotliQuality int
+	ZstdLevel     int
+	// MinSize is the smallest body worth compressing, in bytes
+	MinSize int
+}
+
+// RequestIDConfig controls which inbound request IDs are honored
+type RequestIDConfig struct {
+	// Headers are checked in order for a client-supplied request ID
+	Headers []string
+	// Trust is "any", "trusted" (only from TRUSTED_PROXIES) or "never"
+	Trust string
+}
+
+// PathConfig is the request path normalization policy. Paths are routed
+// and authorized percent-decoded, with repeated slashes merged and dot
+// segments resolved, as upstreams receive them.
+type PathConfig struct {
+	// DoubleSlashes and DotSegments are "normalize" or "reject" (400)
+	DoubleSlashes string
+	DotSegments   string
+	// TrailingSlash is "keep", "strip" or "redirect" (308 to the path
+	// without it)
+	TrailingSlash string
+}
+
+// MethodOverrideConfig controls the method override header, for clients
+// behind proxies that only pass GET and POST. It applies to routes with
+// methodOverride only.
+type MethodOverrideConfig struct {
+	Enabled bool
+	Header  string
+}
+
+// PriorityConfig controls how request priorities are assigned. Requests
+// start at their route's requestPriority (normal by default); the caller's
+// roles and then the priority header may change it.
+type PriorityConfig struct {
+	// Header carries the priority from clients and to upstreams
+	Header string
+	// Trust is "any", "trusted" (only from TRUSTED_PROXIES) or "never" for
+	// raising the priority by header; any caller may lower its own
+	Trust string
+	// HighRoles and LowRoles assign priorities by the caller's JWT roles
+	HighRoles []string
+	LowRoles  []string
 }
 
 type RedisConfig struct {
@@ -50,10 +279,223 @@ type RedisConfig struct {
 	DB       int
 }
 
+// StoreConfig selects the key-value store for gateway state: "redis"
+// (shared by all instances, falling back to memory when Redis is down),
+// "memory", or "file" for single-node deployments keeping state in File
+type StoreConfig struct {
+	Backend       string
+	File          string
+	FlushInterval time.Duration
+}
+
+// RouteSourceConfig reads the route table from a key-value store instead
+// of the route files and watches it, so a fleet of gateways converges on
+// the same routes without redeploys
+type RouteSourceConfig struct {
+	// Type is file (the route files), consul, etcd or kubernetes (see
+	// KubernetesConfig)
+	Type    string
+	Address string
+	// Key holds the routes, or is a prefix ending in / whose keys are merged
+	// in key order like the files of a route directory
+	Key   string
+	Token string
+	// Format is used for keys without a .yaml, .json or .toml extension
+	Format string
+	// Wait bounds a blocking read before it is renewed
+	Wait          time.Duration
+	RetryInterval time.Duration
+}
+
+// KubernetesConfig makes the gateway a cluster ingress: routes are built
+// from Ingress or Gateway API HTTPRoute resources and follow their changes
+type KubernetesConfig struct {
+	// Resources is ingress or gateway-api
+	Resources string
+	// IngressClass selects the Ingresses served, by spec.ingressClassName or
+	// the kubernetes.io/ingress.class annotation (empty serves every Ingress)
+	IngressClass string
+	// Gateway is the [namespace/]name of the Gateway whose HTTPRoutes are served
+	Gateway string
+	// Namespace limits the resources watched (empty watches all namespaces)
+	Namespace     string
+	ClusterDomain string
+	// APIServer, TokenFile and CAFile default to the pod's service account
+	APIServer     string
+	TokenFile     string
+	CAFile        string
+	RetryInterval time.Duration
+	// Backend configures the services built from backend references; its
+	// URL is ignored. Kubernetes already routes to ready endpoints only, so
+	// health checks are off unless KUBE_BACKEND_HEALTH_PATH is set.
+	Backend ServiceConfig
+}
+
 type JWTConfig struct {
 	Secret           string
 	AccessExpiresIn  time.Duration
 	RefreshExpiresIn time.Duration
+	// JWKSURL is the key set of an identity provider signing tokens with
+	// RSA or ECDSA keys, refreshed every JWKSRefreshInterval
+	JWKSURL             string
+	JWKSRefreshInterval time.Duration
+	// OIDCIssuer is an OpenID Connect provider whose key set and
+	// algorithms are discovered, and refreshed every JWKSRefreshInterval;
+	// JWKSURL, when also set, takes precedence for the keys
+	OIDCIssuer string
+	// Algorithms are the accepted token algorithms: by default RS256 and
+	// ES256 with a JWKS URL, those the OIDC provider advertises with an
+	// issuer, else the HMAC ones (verified with Secret)
+	Algorithms []string
+	// Issuers and Audiences restrict tokens to these iss values (by
+	// default the OIDC issuer) and to those carrying one of these aud
+	// values (empty accepts any)
+	Issuers   []string
+	Audiences []string
+	// Revocation checks tokens against the revocations in the store
+	Revocation RevocationConfig
+	// Replay rejects reused tokens on routes with replayProtection
+	Replay ReplayConfig
+	// Introspection validates opaque tokens with the auth service
+	Introspection IntrospectionConfig
+	// ClaimHeaders maps request headers sent upstream to the claims
+	// (dotted paths for nested ones) they carry
+	ClaimHeaders map[string]string
+	// Cookie is the session cookie browser clients send their token in
+	Cookie SessionCookieConfig
+	// TenantsFile is the registry of tenants with their own identity
+	// provider
+	TenantsFile string
+}
+
+// SessionCookieConfig controls tokens sent in a cookie: upstreams (the
+// auth service at login) set it, and the gateway enforces its attributes
+type SessionCookieConfig struct {
+	// Name is the cookie's name; empty reads tokens only from the header
+	Name string
+	// Secure and SameSite (Strict, Lax or None) are set on the cookie in
+	// responses, along with HttpOnly
+	Secure   bool
+	SameSite string
+}
+
+// DefaultDuplicateHeaderNames are the security-relevant headers a request
+// may only carry once: credentials, tenant, signature and forwarding
+// headers, and those changing how the gateway treats the request
+var DefaultDuplicateHeaderNames = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"X-Tenant-ID",
+	"X-Client-ID",
+	"X-Timestamp",
+	"X-Signature",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-HTTP-Method-Override",
+	"X-Request-Priority",
+}
+
+// DefaultClaimHeaders returns the identity headers sent upstream by default
+func DefaultClaimHeaders() map[string]string {
+	return map[string]string{
+		"X-User-ID":    "user_id",
+		"X-Tenant-ID":  "tenant_id",
+		"X-User-Email": "email",
+		"X-User-Roles": "roles",
+	}
+}
+
+// IntrospectionConfig controls OAuth 2.0 token introspection (RFC 7662)
+type IntrospectionConfig struct {
+	// URL is the introspection endpoint; empty disables introspection
+	URL string
+	// ClientID and ClientSecret authenticate the gateway to the endpoint
+	ClientID     string
+	ClientSecret string
+	// Mode is opaque (introspect tokens that aren't JWTs) or all
+	Mode string
+	// CacheTTL is how long a result is reused, at most until the token expires
+	CacheTTL time.Duration
+	Timeout  time.Duration
+}
+
+// PolicyConfig controls authorization by an Open Policy Agent server
+type PolicyConfig struct {
+	// URL is the OPA server (e.g. a sidecar); empty disables policies
+	URL string
+	// DefaultPolicy is the decision (a data path such as gateway/authz/allow)
+	// of non-public routes without their own policy; empty checks only
+	// routes with a policy
+	DefaultPolicy string
+	Timeout       time.Duration
+	// FailOpen allows requests when OPA can't be queried; by default they
+	// are rejected with a 503
+	FailOpen bool
+}
+
+// GeoIPConfig controls client geolocation
+type GeoIPConfig struct {
+	// Databases are MaxMind DB files (e.g. GeoLite2-Country and
+	// GeoLite2-ASN); empty leaves clients unlocated
+	Databases []string
+	// Metrics counts requests by country, an opt-in label set
+	Metrics bool
+}
+
+// BotConfig controls User-Agent filtering
+type BotConfig struct {
+	// Mode is what happens to bots on routes without their own bots
+	// setting: off, monitor (count them) or block (403)
+	Mode string
+	// AllowAgents and DenyAgents are case-insensitive User-Agent regular
+	// expressions; allowed agents are never treated as bots
+	AllowAgents []string
+	DenyAgents  []string
+	// MissingAgent treats requests without a User-Agent as bots
+	MissingAgent bool
+	// Scanners treats known vulnerability scanners (sqlmap, nikto, ...) as
+	// bots
+	Scanners bool
+}
+
+// IdentityTokenConfig controls the short-lived tokens minted for upstreams
+// with the identity of authenticated requests
+type IdentityTokenConfig struct {
+	// Secret signs the tokens (HS256) and is shared with the upstreams
+	// verifying them; empty disables them
+	Secret string
+	// TTL is how long a token is valid, at most until the caller's expires
+	TTL    time.Duration
+	Issuer string
+}
+
+// SignatureConfig controls HMAC request signature verification
+type SignatureConfig struct {
+	// ClientsFile lists the signing clients and their secrets
+	ClientsFile string
+	// MaxSkew is how far a request's timestamp may be from the gateway's
+	// clock; signatures are remembered for as long to reject replays
+	MaxSkew time.Duration
+}
+
+// RevocationConfig controls the checks of tokens revoked before expiry
+type RevocationConfig struct {
+	Enabled bool
+	// FailClosed rejects requests when the revocations can't be read;
+	// by default the token is accepted and the failure logged
+	FailClosed bool
+	// UserTTL is how long revoking a user's tokens lasts: the longest
+	// lifetime of the tokens the gateway accepts
+	UserTTL time.Duration
+}
+
+// ReplayConfig controls the jti cache of routes with replayProtection
+type ReplayConfig struct {
+	// FailClosed rejects requests when the cache can't be read; otherwise
+	// the token is accepted and the failure logged
+	FailClosed bool
+	// TTL is how long the jti of a token without exp is remembered
+	TTL time.Duration
 }
 
 type RateLimitConfig struct {
@@ -61,6 +503,69 @@ type RateLimitConfig struct {
 	RequestsPerSec  int
 	BurstSize       int
 	CleanupInterval time.Duration
+	// Algorithm is the default of RateLimitAlgorithms, for routes without
+	// their own
+	Algorithm string
+	// SnapshotFile persists in-memory buckets across restarts (empty disables)
+	SnapshotFile     string
+	SnapshotInterval time.Duration
+}
+
+// ConcurrencyConfig caps the requests in flight to the services. With
+// Redis as the store the caps hold across all gateway instances; otherwise
+// each instance applies them on its own.
+type ConcurrencyConfig struct {
+	Enabled bool
+	// MaxInFlight caps the requests in flight to all services together
+	// (0: no overall cap); ServiceConfig.MaxInFlight caps each service
+	MaxInFlight int
+	// LeaseTTL is how long a request holds its slot at most, freeing the
+	// slots of instances that stopped with requests in flight. It should
+	// exceed the longest service timeout.
+	LeaseTTL time.Duration
+}
+
+// QuotaConfig limits the requests a tenant (or user, when no tenant is set)
+// may make per period and notifies a webhook as usage crosses thresholds
+type QuotaConfig struct {
+	Enabled bool
+	Limit   int
+	Period  time.Duration
+	// Thresholds are percentages of Limit that trigger a webhook event
+	Thresholds     []int
+	WebhookURL     string
+	WebhookTimeout time.Duration
+	// Enforce rejects requests over the limit; otherwise quota only warns
+	Enforce bool
+}
+
+// SecurityAlertsConfig controls alerting on spikes of 401/403/429 responses
+// per IP and tenant
+type SecurityAlertsConfig struct {
+	Enabled bool
+	Window  time.Duration
+	// MinEvents is the smallest count in a window that can alert
+	MinEvents int
+	// SpikeFactor is how far above its baseline a key must be to alert
+	SpikeFactor    float64
+	Cooldown       time.Duration
+	WebhookURL     string
+	WebhookTimeout time.Duration
+}
+
+// AuditConfig controls the security audit log
+type AuditConfig struct {
+	// Sink is stdout, stderr, a file path, or a syslog://host:port (UDP) or
+	// syslog+tcp://host:port collector; empty disables the audit log
+	Sink string
+}
+
+// ClusterConfig controls sharing of admin actions between replicas over
+// Redis pub/sub (used with the redis store backend while Redis is available)
+type ClusterConfig struct {
+	Channel string
+	// InstanceID identifies this replica in events; defaults to the hostname
+	InstanceID string
 }
 
 type CircuitConfig struct {
@@ -76,6 +581,11 @@ type TracingConfig struct {
 	ServiceName string
 	Endpoint    string
 	SampleRate  float64
+	// MaxQueueSize bounds spans waiting for export; more are dropped
+	MaxQueueSize  int
+	ExportTimeout time.Duration
+	// ExportRetryMax is how long a failed batch is retried (0 disables retries)
+	ExportRetryMax time.Duration
 }
 
 type LoggingConfig struct {
@@ -83,10 +593,77 @@ type LoggingConfig struct {
 	Format string
 }
 
+// MetricsConfig controls the Prometheus metrics
+type MetricsConfig struct {
+	// RouteTags are the route tags exported as gateway_route_info labels;
+	// others stay out of metrics to bound their cardinality
+	RouteTags []string
+}
+
+// ServerTimingConfig controls the Server-Timing response header
+type ServerTimingConfig struct {
+	Enabled bool
+	// Phases to report: gateway, auth, upstream
+	Phases []string
+}
+
+// IngestConfig controls background delivery for ingest routes
+type IngestConfig struct {
+	// QueueSize bounds the requests waiting for delivery; beyond it
+	// clients get a 503
+	QueueSize int
+	Workers   int
+	// MaxRetries and RetryBackoff (doubled per attempt) apply to failed
+	// deliveries and 429/5xx answers
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// DeadLetterFile receives undeliverable requests as JSON lines
+	DeadLetterFile string
+}
+
+// MaintenanceConfig is the 503 response of routes in maintenance
+type MaintenanceConfig struct {
+	Message string
+	// RetryAfter is sent as the Retry-After header (0 omits it)
+	RetryAfter time.Duration
+}
+
+// AnalyticsConfig controls the in-memory per-route analytics
+type AnalyticsConfig struct {
+	Enabled bool
+	// MaxConsumers caps the distinct consumers tracked per route and minute
+	MaxConsumers int
+}
+
+// AdminConfig configures the admin API listener
+type AdminConfig struct {
+	Enabled    bool
+	Host       string
+	Port       string
+	TokensFile string
+}
+
 func Load() (*Config, error) {
 	_ = godotenv.Load()
+	invalidEnv = nil
+	secrets := NewSecrets(defaultSecretProviders())
+
+	// Tokens of an identity provider are signed with its keys; the shared
+	// secret then stays unused unless HMAC algorithms are configured
+	jwksURL := getEnv("JWT_JWKS_URL", "")
+	oidcIssuer := getEnv("JWT_OIDC_ISSUER", "")
+	jwtAlgorithms := []string{"HS256", "HS384", "HS512"}
+	var jwtIssuers []string
+	if oidcIssuer != "" {
+		jwtAlgorithms = nil
+		jwtIssuers = []string{oidcIssuer}
+	}
+	if jwksURL != "" {
+		jwtAlgorithms = []string{"RS256", "ES256"}
+	}
 
-	return &Config{
+	cfg := &Config{
+		Env: getEnv("GATEWAY_ENV", ""),
 		Server: ServerConfig{
 			Port:            getEnv("SERVER_PORT", "8080"),
 			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
@@ -95,39 +672,203 @@ func Load() (*Config, error) {
 			IdleTimeout:     getDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
 			ShutdownTimeout: getDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
 			TrustedProxies:  getEnvSlice("TRUSTED_PROXIES", []string{"127.0.0.1"}),
+			TLSCertFile:     getEnv("SERVER_TLS_CERT_FILE", ""),
+			TLSKeyFile:      getEnv("SERVER_TLS_KEY_FILE", ""),
+			TLSClientCAFile: getEnv("SERVER_TLS_CLIENT_CA_FILE", ""),
+			TLSClientAuth:   getEnv("SERVER_TLS_CLIENT_AUTH", "request"),
+			TLSMinVersion:   getEnv("SERVER_TLS_MIN_VERSION", "1.2"),
+			TLSMaxVersion:   getEnv("SERVER_TLS_MAX_VERSION", ""),
+			TLSCipherSuites: getEnvSlice("SERVER_TLS_CIPHER_SUITES", nil),
+			TLSCurves:       getEnvSlice("SERVER_TLS_CURVES", nil),
+
+			ProxyProtocol:        getEnvBool("SERVER_PROXY_PROTOCOL", false),
+			ProxyProtocolTimeout: getDuration("SERVER_PROXY_PROTOCOL_TIMEOUT", 5*time.Second),
+			ProxyProtocolSources: getEnvSlice("SERVER_PROXY_PROTOCOL_SOURCES", nil),
+			ReadStallTimeout:     getDuration("SERVER_READ_STALL_TIMEOUT", 10*time.Second),
+			MinReadRate:          getEnvInt("SERVER_MIN_READ_RATE", 512),
+
+			InternalCIDRs: getEnvSlice("INTERNAL_CIDRS", nil),
+			InternalPort:  getEnv("SERVER_INTERNAL_PORT", ""),
+
+			InternalUsername:    getEnv("INTERNAL_AUTH_USERNAME", ""),
+			InternalPassword:    secrets.get("INTERNAL_AUTH_PASSWORD", ""),
+			OpsAllowCIDRs:       getEnvSlice("OPS_ALLOW_CIDRS", nil),
+			OpsInternalPortOnly: getEnvBool("OPS_INTERNAL_PORT_ONLY", false),
+			OpsToken:            secrets.get("OPS_BEARER_TOKEN", ""),
+
+			MaxBodySize:    getEnvInt("SERVER_MAX_BODY_SIZE", 4*1024*1024),
+			MaxHeaderBytes: getEnvInt("SERVER_MAX_HEADER_BYTES", 8*1024),
+			MaxURILength:   getEnvInt("SERVER_MAX_URI_LENGTH", 4*1024),
+			MaxHeaderCount: getEnvInt("SERVER_MAX_HEADER_COUNT", 100),
+
+			DuplicateHeaders:     getEnv("SERVER_DUPLICATE_HEADERS", "reject"),
+			DuplicateHeaderNames: getEnvSlice("SERVER_DUPLICATE_HEADER_NAMES", DefaultDuplicateHeaderNames),
+
+			CORSAllowOrigins: getEnvSlice("CORS_ALLOW_ORIGINS", []string{"*"}),
 		},
 		Services: ServicesConfig{
-			Auth: ServiceConfig{
-				URL:             getEnv("AUTH_SERVICE_URL", "http://localhost:5000"),
-				Timeout:         getDuration("AUTH_SERVICE_TIMEOUT", 30*time.Second),
-				MaxIdleConns:    getEnvInt("AUTH_MAX_IDLE_CONNS", 100),
-				MaxConnsPerHost: getEnvInt("AUTH_MAX_CONNS_PER_HOST", 100),
-				HealthPath:      getEnv("AUTH_HEALTH_PATH", "/api/health"),
-			},
-			Notifier: ServiceConfig{
-				URL:             getEnv("NOTIFIER_SERVICE_URL", "http://localhost:5001"),
-				Timeout:         getDuration("NOTIFIER_SERVICE_TIMEOUT", 30*time.Second),
-				MaxIdleConns:    getEnvInt("NOTIFIER_MAX_IDLE_CONNS", 100),
-				MaxConnsPerHost: getEnvInt("NOTIFIER_MAX_CONNS_PER_HOST", 100),
-				HealthPath:      getEnv("NOTIFIER_HEALTH_PATH", "/api/health"),
+			Auth:       loadServiceConfig("AUTH", "http://localhost:5000"),
+			Notifier:   loadServiceConfig("NOTIFIER", "http://localhost:5001"),
+			Additional: loadAdditionalServices(),
+		},
+		Proxy: ProxyConfig{
+			StreamWriteTimeout: getDuration("PROXY_STREAM_WRITE_TIMEOUT", 10*time.Second),
+			StreamMinRate:      getEnvInt("PROXY_STREAM_MIN_RATE", 0),
+			StreamMinRateGrace: getDuration("PROXY_STREAM_MIN_RATE_GRACE", 5*time.Second),
+			SlowClientPolicy:   getEnv("PROXY_SLOW_CLIENT_POLICY", "disconnect"),
+			ForwardedForDepth:  getEnvInt("PROXY_FORWARDED_FOR_DEPTH", 0),
+			ForwardedHeader:    getEnvBool("PROXY_FORWARDED_HEADER", false),
+			MaxDecodedBodySize: getEnvInt("PROXY_MAX_DECODED_BODY_SIZE", 32*1024*1024),
+			Compression: CompressionConfig{
+				Encodings:     getEnvSlice("COMPRESSION_ENCODINGS", []string{"zstd", "br", "gzip", "deflate"}),
+				Level:         getEnvInt("COMPRESSION_LEVEL", 6),
+				BrotliQuality: getEnvInt("COMPRESSION_BROTLI_QUALITY", 4),
+				ZstdLevel:     getEnvInt("COMPRESSION_ZSTD_LEVEL", 2),
+				MinSize:       getEnvInt("COMPRESSION_MIN_SIZE", 1024),
 			},
 		},
+		Ingest: IngestConfig{
+			QueueSize:      getEnvInt("INGEST_QUEUE_SIZE", 10000),
+			Workers:        getEnvInt("INGEST_WORKERS", 4),
+			MaxRetries:     getEnvInt("INGEST_MAX_RETRIES", 3),
+			RetryBackoff:   getDuration("INGEST_RETRY_BACKOFF", 500*time.Millisecond),
+			DeadLetterFile: getEnv("INGEST_DEAD_LETTER_FILE", ""),
+		},
+		RequestID: RequestIDConfig{
+			Headers: getEnvSlice("REQUEST_ID_HEADERS", []string{"X-Request-ID"}),
+			Trust:   getEnv("REQUEST_ID_TRUST", "any"),
+		},
+		Paths: PathConfig{
+			DoubleSlashes: getEnv("PATH_DOUBLE_SLASHES", "normalize"),
+			DotSegments:   getEnv("PATH_DOT_SEGMENTS", "normalize"),
+			TrailingSlash: getEnv("PATH_TRAILING_SLASH", "keep"),
+		},
+		MethodOverride: MethodOverrideConfig{
+			Enabled: getEnvBool("METHOD_OVERRIDE_ENABLED", false),
+			Header:  getEnv("METHOD_OVERRIDE_HEADER", "X-HTTP-Method-Override"),
+		},
+		Priority: PriorityConfig{
+			Header:    getEnv("PRIORITY_HEADER", "X-Request-Priority"),
+			Trust:     getEnv("PRIORITY_TRUST", "trusted"),
+			HighRoles: getEnvSlice("PRIORITY_HIGH_ROLES", nil),
+			LowRoles:  getEnvSlice("PRIORITY_LOW_ROLES", nil),
+		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
 			Port:     getEnv("REDIS_PORT", "6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
+			Password: secrets.get("REDIS_PASSWORD", ""),
 			DB:       getEnvInt("REDIS_DB", 0),
 		},
+		Store: StoreConfig{
+			Backend:       getEnv("STORE_BACKEND", "redis"),
+			File:          getEnv("STORE_FILE", "gateway-store.json"),
+			FlushInterval: getDuration("STORE_FLUSH_INTERVAL", 30*time.Second),
+		},
+		RouteSource: RouteSourceConfig{
+			Type:          getEnv("ROUTES_SOURCE", "file"),
+			Address:       getEnv("ROUTES_KV_ADDRESS", ""),
+			Key:           getEnv("ROUTES_KV_KEY", "gateway/routes"),
+			Token:         secrets.get("ROUTES_KV_TOKEN", ""),
+			Format:        getEnv("ROUTES_KV_FORMAT", "yaml"),
+			Wait:          getDuration("ROUTES_KV_WAIT", 5*time.Minute),
+			RetryInterval: getDuration("ROUTES_KV_RETRY", 5*time.Second),
+		},
+		Kubernetes: loadKubernetesConfig(),
 		JWT: JWTConfig{
-			Secret:           getEnv("JWT_SECRET", "your-secret-key"),
-			AccessExpiresIn:  getDuration("JWT_ACCESS_EXPIRES", 15*time.Minute),
-			RefreshExpiresIn: getDuration("JWT_REFRESH_EXPIRES", 7*24*time.Hour),
+			Secret:              secrets.get("JWT_SECRET", "your-secret-key"),
+			AccessExpiresIn:     getDuration("JWT_ACCESS_EXPIRES", 15*time.Minute),
+			RefreshExpiresIn:    getDuration("JWT_REFRESH_EXPIRES", 7*24*time.Hour),
+			JWKSURL:             jwksURL,
+			JWKSRefreshInterval: getDuration("JWT_JWKS_REFRESH_INTERVAL", 15*time.Minute),
+			OIDCIssuer:          oidcIssuer,
+			Algorithms:          getEnvSlice("JWT_ALGORITHMS", jwtAlgorithms),
+			Issuers:             getEnvSlice("JWT_ISSUERS", jwtIssuers),
+			Audiences:           getEnvSlice("JWT_AUDIENCES", nil),
+			Revocation: RevocationConfig{
+				Enabled:    getEnvBool("JWT_REVOCATION_ENABLED", false),
+				FailClosed: getEnvBool("JWT_REVOCATION_FAIL_CLOSED", false),
+				UserTTL:    getDuration("JWT_REVOCATION_USER_TTL", 24*time.Hour),
+			},
+			Replay: ReplayConfig{
+				FailClosed: getEnvBool("JWT_REPLAY_FAIL_CLOSED", true),
+				TTL:        getDuration("JWT_REPLAY_TTL", 24*time.Hour),
+			},
+			ClaimHeaders: getEnvClaimHeaders("JWT_CLAIM_HEADERS"),
+			TenantsFile:  getEnv("JWT_TENANTS_FILE", "config/tenants.yaml"),
+			Introspection: IntrospectionConfig{
+				URL:          getEnv("JWT_INTROSPECTION_URL", ""),
+				ClientID:     getEnv("JWT_INTROSPECTION_CLIENT_ID", ""),
+				ClientSecret: secrets.get("JWT_INTROSPECTION_CLIENT_SECRET", ""),
+				Mode:         getEnv("JWT_INTROSPECTION_MODE", "opaque"),
+				CacheTTL:     getDuration("JWT_INTROSPECTION_CACHE_TTL", 30*time.Second),
+				Timeout:      getDuration("JWT_INTROSPECTION_TIMEOUT", 5*time.Second),
+			},
+			Cookie: SessionCookieConfig{
+				Name:     getEnv("JWT_COOKIE_NAME", ""),
+				Secure:   getEnvBool("JWT_COOKIE_SECURE", true),
+				SameSite: getEnv("JWT_COOKIE_SAME_SITE", "Lax"),
+			},
+		},
+		Policy: PolicyConfig{
+			URL:           getEnv("OPA_URL", ""),
+			DefaultPolicy: getEnv("OPA_POLICY", ""),
+			Timeout:       getDuration("OPA_TIMEOUT", 500*time.Millisecond),
+			FailOpen:      getEnvBool("OPA_FAIL_OPEN", false),
+		},
+		GeoIP: GeoIPConfig{
+			Databases: getEnvSlice("GEOIP_DATABASES", nil),
+			Metrics:   getEnvBool("GEOIP_METRICS", false),
+		},
+		Bots: BotConfig{
+			Mode:         getEnv("BOT_FILTER", "off"),
+			AllowAgents:  getEnvSlice("BOT_ALLOW_AGENTS", nil),
+			DenyAgents:   getEnvSlice("BOT_DENY_AGENTS", nil),
+			MissingAgent: getEnvBool("BOT_BLOCK_MISSING_AGENT", true),
+			Scanners:     getEnvBool("BOT_BLOCK_SCANNERS", true),
+		},
+		IdentityToken: IdentityTokenConfig{
+			Secret: secrets.get("IDENTITY_TOKEN_SECRET", ""),
+			TTL:    getDuration("IDENTITY_TOKEN_TTL", time.Minute),
+			Issuer: getEnv("IDENTITY_TOKEN_ISSUER", "gateway"),
+		},
+		Signature: SignatureConfig{
+			ClientsFile: getEnv("SIGNATURE_CLIENTS_FILE", "config/signing_clients.yaml"),
+			MaxSkew:     getDuration("SIGNATURE_MAX_SKEW", 5*time.Minute),
 		},
 		RateLimit: RateLimitConfig{
-			Enabled:         getEnvBool("RATE_LIMIT_ENABLED", true),
-			RequestsPerSec:  getEnvInt("RATE_LIMIT_RPS", 100),
-			BurstSize:       getEnvInt("RATE_LIMIT_BURST", 200),
-			CleanupInterval: getDuration("RATE_LIMIT_CLEANUP", 1*time.Minute),
+			Enabled:          getEnvBool("RATE_LIMIT_ENABLED", true),
+			RequestsPerSec:   getEnvInt("RATE_LIMIT_RPS", 100),
+			BurstSize:        getEnvInt("RATE_LIMIT_BURST", 200),
+			CleanupInterval:  getDuration("RATE_LIMIT_CLEANUP", 1*time.Minute),
+			Algorithm:        getEnv("RATE_LIMIT_ALGORITHM", "token_bucket"),
+			SnapshotFile:     getEnv("RATE_LIMIT_SNAPSHOT_FILE", ""),
+			SnapshotInterval: getDuration("RATE_LIMIT_SNAPSHOT_INTERVAL", 30*time.Second),
+		},
+		Concurrency: ConcurrencyConfig{
+			Enabled:     getEnvBool("CONCURRENCY_LIMIT_ENABLED", false),
+			MaxInFlight: getEnvInt("CONCURRENCY_MAX_IN_FLIGHT", 0),
+			LeaseTTL:    getDuration("CONCURRENCY_LEASE_TTL", 2*time.Minute),
+		},
+		Quota: QuotaConfig{
+			Enabled:        getEnvBool("QUOTA_ENABLED", false),
+			Limit:          getEnvInt("QUOTA_LIMIT", 100000),
+			Period:         getDuration("QUOTA_PERIOD", 24*time.Hour),
+			Thresholds:     getEnvIntSlice("QUOTA_WARN_THRESHOLDS", []int{80, 100}),
+			WebhookURL:     getEnv("QUOTA_WEBHOOK_URL", ""),
+			WebhookTimeout: getDuration("QUOTA_WEBHOOK_TIMEOUT", 5*time.Second),
+			Enforce:        getEnvBool("QUOTA_ENFORCE", false),
+		},
+		Security: SecurityAlertsConfig{
+			Enabled:        getEnvBool("SECURITY_ALERTS_ENABLED", false),
+			Window:         getDuration("SECURITY_ALERT_WINDOW", time.Minute),
+			MinEvents:      getEnvInt("SECURITY_ALERT_MIN_EVENTS", 20),
+			SpikeFactor:    getEnvFloat("SECURITY_ALERT_SPIKE_FACTOR", 5),
+			Cooldown:       getDuration("SECURITY_ALERT_COOLDOWN", 10*time.Minute),
+			WebhookURL:     getEnv("SECURITY_ALERT_WEBHOOK_URL", ""),
+			WebhookTimeout: getDuration("SECURITY_ALERT_WEBHOOK_TIMEOUT", 5*time.Second),
+		},
+		Audit: AuditConfig{
+			Sink: getEnv("AUDIT_LOG_SINK", ""),
 		},
 		Circuit: CircuitConfig{
 			Enabled:          getEnvBool("CIRCUIT_ENABLED", true),
@@ -141,12 +882,105 @@ func Load() (*Config, error) {
 			ServiceName: getEnv("SERVICE_NAME", "minisource-gateway"),
 			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
 			SampleRate:  getEnvFloat("TRACING_SAMPLE_RATE", 1.0),
+
+			MaxQueueSize:   getEnvInt("TRACING_MAX_QUEUE_SIZE", 2048),
+			ExportTimeout:  getDuration("TRACING_EXPORT_TIMEOUT", 10*time.Second),
+			ExportRetryMax: getDuration("TRACING_EXPORT_RETRY_MAX", 30*time.Second),
 		},
 		Logging: LoggingConfig{
 			Level:  getEnv("LOG_LEVEL", "info"),
 			Format: getEnv("LOG_FORMAT", "json"),
 		},
-	}, nil
+		Metrics: MetricsConfig{
+			RouteTags: getEnvTagNames("METRICS_ROUTE_TAGS"),
+		},
+		Timing: ServerTimingConfig{
+			Enabled: getEnvBool("SERVER_TIMING_ENABLED", false),
+			Phases:  getEnvSlice("SERVER_TIMING_PHASES", []string{"gateway", "auth", "upstream"}),
+		},
+		Maintenance: MaintenanceConfig{
+			Message:    getEnv("MAINTENANCE_MESSAGE", "This resource is temporarily down for maintenance"),
+			RetryAfter: getDuration("MAINTENANCE_RETRY_AFTER", 5*time.Minute),
+		},
+		Analytics: AnalyticsConfig{
+			Enabled:      getEnvBool("ANALYTICS_ENABLED", true),
+			MaxConsumers: getEnvInt("ANALYTICS_MAX_CONSUMERS", 1000),
+		},
+		Admin: AdminConfig{
+			Enabled:    getEnvBool("ADMIN_ENABLED", false),
+			Host:       getEnv("ADMIN_HOST", "0.0.0.0"),
+			Port:       getEnv("ADMIN_PORT", "9090"),
+			TokensFile: getEnv("ADMIN_TOKENS_FILE", "config/admin_tokens.yaml"),
+		},
+		SyntheticsFile: getEnv("SYNTHETICS_FILE", "config/synthetics.yaml"),
+		SchemasDir:     getEnv("SCHEMAS_DIR", "config/schemas"),
+		Cluster: ClusterConfig{
+			Channel:    getEnv("CLUSTER_CHANNEL", "gateway:cluster"),
+			InstanceID: getEnv("CLUSTER_INSTANCE_ID", hostname()),
+		},
+		Secrets:        secrets,
+		SecretsRefresh: getDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+	}
+	if err := secrets.err(); err != nil {
+		return nil, fmt.Errorf("fetch secrets: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadServiceConfig reads the settings of one backend service from
+// environment variables sharing the given prefix
+func loadServiceConfig(prefix, defaultURL string) ServiceConfig {
+	return ServiceConfig{
+		URL:                getEnv(prefix+"_SERVICE_URL", defaultURL),
+		Timeout:            getDuration(prefix+"_SERVICE_TIMEOUT", 30*time.Second),
+		MaxIdleConns:       getEnvInt(prefix+"_MAX_IDLE_CONNS", 100),
+		MaxConnsPerHost:    getEnvInt(prefix+"_MAX_CONNS_PER_HOST", 100),
+		IdleConnTimeout:    getDuration(prefix+"_IDLE_CONN_TIMEOUT", 30*time.Second),
+		MaxConnWaitTimeout: getDuration(prefix+"_MAX_CONN_WAIT_TIMEOUT", 0),
+		ReadBufferSize:     getEnvInt(prefix+"_READ_BUFFER_SIZE", 0),
+		WriteBufferSize:    getEnvInt(prefix+"_WRITE_BUFFER_SIZE", 0),
+		HealthPath:         getEnv(prefix+"_HEALTH_PATH", "/api/health"),
+		SlowStart:          getDuration(prefix+"_SLOW_START", 0),
+		SRVName:            getEnv(prefix+"_SRV_NAME", ""),
+		SRVRefresh:         getDuration(prefix+"_SRV_REFRESH", 30*time.Second),
+		DNSResetAfter:      getEnvInt(prefix+"_DNS_RESET_AFTER", 3),
+		FallbackURL:        getEnv(prefix+"_FALLBACK_URL", ""),
+		PreserveHost:       getEnvBool(prefix+"_PRESERVE_HOST", false),
+		HostHeader:         getEnv(prefix+"_HOST_HEADER", ""),
+		MaxInFlight:        getEnvInt(prefix+"_MAX_IN_FLIGHT", 0),
+	}
+}
+
+// loadKubernetesConfig reads the KUBE_* settings
+func loadKubernetesConfig() KubernetesConfig {
+	backend := loadServiceConfig("KUBE_BACKEND", "")
+	backend.HealthPath = getEnv("KUBE_BACKEND_HEALTH_PATH", "")
+	return KubernetesConfig{
+		Resources:     getEnv("KUBE_RESOURCES", "ingress"),
+		IngressClass:  getEnv("KUBE_INGRESS_CLASS", "minisource"),
+		Gateway:       getEnv("KUBE_GATEWAY", "minisource"),
+		Namespace:     getEnv("KUBE_NAMESPACE", ""),
+		ClusterDomain: getEnv("KUBE_CLUSTER_DOMAIN", "cluster.local"),
+		APIServer:     getEnv("KUBE_API_SERVER", ""),
+		TokenFile:     getEnv("KUBE_TOKEN_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
+		CAFile:        getEnv("KUBE_CA_FILE", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"),
+		RetryInterval: getDuration("KUBE_RETRY", 5*time.Second),
+		Backend:       backend,
+	}
+}
+
+// loadAdditionalServices reads the services named in ADDITIONAL_SERVICES
+func loadAdditionalServices() map[string]ServiceConfig {
+	services := make(map[string]ServiceConfig)
+	for _, name := range getEnvSlice("ADDITIONAL_SERVICES", nil) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		services[name] = loadServiceConfig(prefix, "")
+	}
+	return services
 }
 
 func getEnv(key, defaultValue string) string {
@@ -156,11 +990,21 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// invalidEnv lists the variables whose values couldn't be parsed, so
+// their defaults were used
+var invalidEnv []string
+
+// InvalidEnv returns the variables Load ignored as unparsable, as KEY=value
+func InvalidEnv() []string {
+	return invalidEnv
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
+		invalidEnv = append(invalidEnv, key+"="+value)
 	}
 	return defaultValue
 }
@@ -170,6 +1014,7 @@ func getEnvBool(key string, defaultValue bool) bool {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
 			return boolValue
 		}
+		invalidEnv = append(invalidEnv, key+"="+value)
 	}
 	return defaultValue
 }
@@ -179,6 +1024,7 @@ func getEnvFloat(key string, defaultValue float64) float64 {
 		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
 			return floatValue
 		}
+		invalidEnv = append(invalidEnv, key+"="+value)
 	}
 	return defaultValue
 }
@@ -188,6 +1034,7 @@ func getDuration(key string, defaultValue time.Duration) time.Duration {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
+		invalidEnv = append(invalidEnv, key+"="+value)
 	}
 	return defaultValue
 }
@@ -198,3 +1045,65 @@ func getEnvSlice(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// getEnvTagNames reads a list of route tag names; names that can't be
+// metric labels are ignored
+func getEnvTagNames(key string) []string {
+	var names []string
+	for _, name := range getEnvSlice(key, nil) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !tagName.MatchString(name) {
+			invalidEnv = append(invalidEnv, key+"="+name)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// getEnvClaimHeaders reads Header=claim pairs; without the variable the
+// default identity headers are sent
+func getEnvClaimHeaders(key string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return DefaultClaimHeaders()
+	}
+
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		header, claim, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		header, claim = strings.TrimSpace(header), strings.TrimSpace(claim)
+		if !ok || header == "" || claim == "" || strings.ContainsAny(header, " \t:") {
+			invalidEnv = append(invalidEnv, key+"="+pair)
+			continue
+		}
+		headers[header] = claim
+	}
+	return headers
+}
+
+func getEnvIntSlice(key string, defaultValue []int) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []int
+	for _, part := range strings.Split(value, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "gateway"
+	}
+	return name
+}
@@ -1,21 +1,34 @@
 package config
 
 import (
+	"fmt"
+	"maps"
 	"os"
-
-	"gopkg.in/yaml.v3"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 )
 
 // RouteConfig defines routing rules
 type RouteConfig struct {
 	Routes []Route `yaml:"routes"`
+	// Fallback serves requests for paths no route covers, instead of the
+	// gateway's 404: a service, a redirect or a custom response, whose
+	// body may reference {path} and {method}. Paths some route covers
+	// with other methods still get a 405.
+	Fallback *Route `yaml:"fallback,omitempty"`
 }
 
 // Route defines a single route mapping
 type Route struct {
-	Path           string       `yaml:"path"`
-	Service        string       `yaml:"service"`
-	StripPrefix    bool         `yaml:"stripPrefix"`
+	Path        string `yaml:"path"`
+	Service     string `yaml:"service"`
+	StripPrefix bool   `yaml:"stripPrefix"`
+	// PrefixRewrite replaces the route path with another prefix upstream
+	// (/api/v1 with prefixRewrite /internal/v2 sends /api/v1/users to
+	// /internal/v2/users)
+	PrefixRewrite  string       `yaml:"prefixRewrite,omitempty"`
 	Methods        []string     `yaml:"methods"`
 	Public         bool         `yaml:"public"`
 	RateLimit      *RouteLimit  `yaml:"rateLimit,omitempty"`
@@ -23,12 +36,324 @@ type Route struct {
 	CircuitBreaker bool         `yaml:"circuitBreaker"`
 	Retry          *RetryConfig `yaml:"retry,omitempty"`
 	Cache          *CacheConfig `yaml:"cache,omitempty"`
+	Stream         bool         `yaml:"stream,omitempty"`
+	// Ingest answers 202 as soon as the request is queued and delivers it
+	// to the service in the background (see INGEST_*), for telemetry-style
+	// endpoints that don't need the upstream's answer
+	Ingest bool       `yaml:"ingest,omitempty"`
+	Skip   SkipConfig `yaml:"skip,omitempty"`
+	// RequiredRoles admits callers with any of the roles; RequiredScopes
+	// requires every scope. Both need an authenticated (non-public) route.
+	RequiredRoles  []string `yaml:"requiredRoles,omitempty"`
+	RequiredScopes []string `yaml:"requiredScopes,omitempty"`
+	// ReplayProtection accepts each token only once (by its jti, see
+	// JWT_REPLAY_*); it needs an authenticated (non-public) route
+	ReplayProtection bool `yaml:"replayProtection,omitempty"`
+	// ClaimHeaders adds headers carrying token claims (dotted paths for
+	// nested ones) to JWT_CLAIM_HEADERS for the route's upstream; a header
+	// mapped to "" isn't sent
+	ClaimHeaders map[string]string `yaml:"claimHeaders,omitempty"`
+	// Signature authenticates machine callers by an HMAC request signature
+	// (see SIGNATURE_*) instead of a bearer token
+	Signature *RouteSignature `yaml:"signature,omitempty"`
+	// ClientCert requires a verified TLS client certificate (see
+	// SERVER_TLS_CLIENT_*), in addition to the route's other authentication
+	ClientCert *RouteClientCert `yaml:"clientCert,omitempty"`
+	// Geo restricts the route to callers by location (see GEOIP_DATABASES)
+	Geo *RouteGeo `yaml:"geo,omitempty"`
+	// Bots is what happens to bots (see BOT_*) on the route: off, monitor or
+	// block, overriding BOT_FILTER
+	Bots string `yaml:"bots,omitempty"`
+	// Policy is the Open Policy Agent decision authorizing the route's
+	// requests (see OPA_*), overriding OPA_POLICY
+	Policy string `yaml:"policy,omitempty"`
+	// Schema is the JSON Schema POST, PUT and PATCH bodies must match: a
+	// JSON or YAML file in SCHEMAS_DIR, optionally with a #/pointer to the
+	// schema within it (openapi.yaml#/components/schemas/Order)
+	Schema string `yaml:"schema,omitempty"`
+	// RequestHeaders and ResponseHeaders transform the headers sent to the
+	// upstream and returned to the client
+	RequestHeaders  *HeaderTransformConfig `yaml:"requestHeaders,omitempty"`
+	ResponseHeaders *HeaderTransformConfig `yaml:"responseHeaders,omitempty"`
+	// SetResponseHeaders are set on proxied responses once the upstream's
+	// headers are copied (and transformed by ResponseHeaders), e.g. a
+	// Cache-Control policy the gateway owns
+	SetResponseHeaders []ResponseHeader `yaml:"setResponseHeaders,omitempty"`
+	// RequestQuery transforms the query parameters sent to the upstream
+	RequestQuery *QueryTransformConfig `yaml:"requestQuery,omitempty"`
+	// CORS overrides the global CORS policy for the route
+	CORS *CORSConfig `yaml:"cors,omitempty"`
+	// InternalOnly hides the route from callers outside the internal
+	// network (see INTERNAL_CIDRS and SERVER_INTERNAL_PORT)
+	InternalOnly bool `yaml:"internalOnly,omitempty"`
+	// MaxBodySize overrides the global request body limit (SERVER_MAX_BODY_SIZE),
+	// in bytes. Larger bodies are rejected with 413 before they are read.
+	MaxBodySize int `yaml:"maxBodySize,omitempty"`
+	// Deprecated, SunsetDate (2006-01-02 or RFC 3339) and SuccessorLink
+	// announce the route's retirement in Deprecation, Sunset and Link headers
+	Deprecated    bool   `yaml:"deprecated,omitempty"`
+	SunsetDate    string `yaml:"sunsetDate,omitempty"`
+	SuccessorLink string `yaml:"successorLink,omitempty"`
+	// Maintenance answers the route with a 503 (see MAINTENANCE_MESSAGE)
+	// without calling the backend; the admin API can toggle it at runtime
+	Maintenance bool `yaml:"maintenance,omitempty"`
+	// Legacy normalizes old clients' path and query quirks before forwarding
+	Legacy *LegacyConfig `yaml:"legacy,omitempty"`
+	// PathRegex matches request paths with a regular expression instead of
+	// Path, for patterns prefix matching can't express. Named groups are
+	// available like :name path parameters.
+	PathRegex string `yaml:"pathRegex,omitempty"`
+	// Response, when set, is returned directly without calling a service
+	Response *StaticResponse `yaml:"response,omitempty"`
+	// Redirect, when set, answers with a redirect instead of proxying
+	Redirect *RedirectConfig `yaml:"redirect,omitempty"`
+	// Rewrite reshapes the upstream path with a regular expression
+	Rewrite *RewriteConfig `yaml:"rewrite,omitempty"`
+	// Headers and Query restrict the route to requests carrying these
+	// exact header / query parameter values, in addition to path and method
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Query   map[string]string `yaml:"query,omitempty"`
+	// ReadService, when set, serves GET/HEAD requests while Service keeps
+	// serving mutating methods (for split read/write deployments)
+	ReadService string `yaml:"readService,omitempty"`
+	// Experiment splits traffic between variants and logs each exposure
+	Experiment *ExperimentConfig `yaml:"experiment,omitempty"`
+	// PreserveHost forwards the client's Host header and HostHeader sends a
+	// fixed one, for backends doing virtual-host routing. They override the
+	// service's settings; by default the upstream's host is sent.
+	PreserveHost bool   `yaml:"preserveHost,omitempty"`
+	HostHeader   string `yaml:"hostHeader,omitempty"`
+	// Priority orders overlapping routes: higher wins. Routes of equal
+	// priority are matched most specific path first.
+	Priority int `yaml:"priority,omitempty"`
+	// RequestPriority (high, normal, low) is the default load-shedding
+	// priority of the route's requests (see PRIORITY_*)
+	RequestPriority string `yaml:"requestPriority,omitempty"`
+	// MethodOverride lets POST requests use the method override header
+	// (see METHOD_OVERRIDE_*) to reach the route with PUT, PATCH or DELETE
+	MethodOverride bool `yaml:"methodOverride,omitempty"`
+	// Tags label the route for ownership and cost attribution (e.g. team,
+	// tier, product). They are logged with its requests, listed by the
+	// admin API and, for the names in METRICS_ROUTE_TAGS, exported as
+	// gateway_route_info labels.
+	Tags map[string]string `yaml:"tags,omitempty"`
+	// VersionPrefix and Versions declare the route once for several API
+	// versions: it is served at <versionPrefix>/<version><path> for each
+	// version, with the version's settings (see ExpandVersions)
+	VersionPrefix string                  `yaml:"versionPrefix,omitempty"`
+	Versions      map[string]RouteVersion `yaml:"versions,omitempty"`
+}
+
+// RequestPriority orders requests for load shedding; the zero value is normal
+type RequestPriority int
+
+// Request priorities
+const (
+	PriorityLow    RequestPriority = -1
+	PriorityNormal RequestPriority = 0
+	PriorityHigh   RequestPriority = 1
+)
+
+// ParsePriority parses a priority name, case-insensitively
+func ParsePriority(s string) (RequestPriority, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return PriorityLow, true
+	case "normal":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	}
+	return PriorityNormal, false
+}
+
+func (p RequestPriority) String() string {
+	switch {
+	case p < PriorityNormal:
+		return "low"
+	case p > PriorityNormal:
+		return "high"
+	}
+	return "normal"
+}
+
+// Pattern returns the route's path, or its path regex for regex routes
+func (r Route) Pattern() string {
+	if r.PathRegex != "" {
+		return r.PathRegex
+	}
+	return r.Path
+}
+
+// Sunset returns the parsed SunsetDate
+func (r Route) Sunset() (time.Time, bool) {
+	if r.SunsetDate == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.DateOnly, r.SunsetDate); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.RFC3339, r.SunsetDate)
+	return t, err == nil
+}
+
+// ServiceFor returns the service that serves the given method
+func (r Route) ServiceFor(method string) string {
+	if r.ReadService != "" && (method == "GET" || method == "HEAD") {
+		return r.ReadService
+	}
+	return r.Service
+}
+
+// HeaderTransformConfig edits headers, applied as remove, then rename, then
+// add (so added headers always end up set)
+type HeaderTransformConfig struct {
+	Add    map[string]string `yaml:"add,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+	// Rename maps old header names to new ones
+	Rename map[string]string `yaml:"rename,omitempty"`
+}
+
+// RouteSignature requires requests signed by a signing client (see
+// LoadSigningClients)
+type RouteSignature struct {
+	// Clients are the client IDs admitted; empty admits every client
+	Clients []string `yaml:"clients,omitempty"`
+}
+
+// RouteClientCert requires requests over mTLS with a verified client
+// certificate
+type RouteClientCert struct {
+	// Identities are the certificate identities admitted (URI, DNS or
+	// email SANs, or the subject common name); empty admits any
+	Identities []string `yaml:"identities,omitempty"`
+}
+
+// RouteGeo restricts a route by the client's location
+type RouteGeo struct {
+	// AllowCountries admits only clients from these countries (ISO 3166-1
+	// alpha-2 codes); clients whose country is unknown are rejected
+	AllowCountries []string `yaml:"allowCountries,omitempty"`
+	// DenyCountries and DenyASNs reject clients from these countries and
+	// autonomous systems (e.g. hosting providers)
+	DenyCountries []string `yaml:"denyCountries,omitempty"`
+	DenyASNs      []uint   `yaml:"denyAsns,omitempty"`
+}
+
+// ResponseHeader is a header a route sets on its responses
+type ResponseHeader struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	// Mode is override (the default), replacing the upstream's header, or
+	// append, adding the value next to it
+	Mode string `yaml:"mode,omitempty"`
+}
+
+// framingHeaders are the response headers routes can't set: the gateway
+// owns the framing of its responses
+var framingHeaders = []string{"connection", "content-length", "transfer-encoding"}
+
+// QueryTransformConfig edits query parameters like HeaderTransformConfig
+// edits headers. Remove entries ending in * remove every parameter with the
+// prefix (utm_*); Add values may reference environment variables as ${VAR}
+// to keep credentials out of route files.
+type QueryTransformConfig struct {
+	Add    map[string]string `yaml:"add,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+	// Rename maps old parameter names to new ones
+	Rename map[string]string `yaml:"rename,omitempty"`
+}
+
+// CORSConfig is a route's CORS policy. Empty lists keep the global setting;
+// AllowMethods defaults to the methods the route table accepts.
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allowOrigins,omitempty"`
+	AllowMethods []string `yaml:"allowMethods,omitempty"`
+	AllowHeaders []string `yaml:"allowHeaders,omitempty"`
+	// AllowCredentials defaults to true
+	AllowCredentials *bool `yaml:"allowCredentials,omitempty"`
+}
+
+// RewriteConfig rewrites the upstream path. Target may reference capture
+// groups of Pattern as $1 or ${name}. Paths that don't match are unchanged.
+type RewriteConfig struct {
+	Pattern string `yaml:"pattern"`
+	Target  string `yaml:"target"`
+}
+
+// ExperimentConfig splits a route's traffic between weighted variants.
+// Consumers are assigned by hashing their user ID (or IP for anonymous
+// requests), so each consumer keeps seeing the same variant.
+type ExperimentConfig struct {
+	Name     string              `yaml:"name"`
+	Variants []ExperimentVariant `yaml:"variants"`
+	// Rollback, when set, sends a canary variant's traffic back to the
+	// baseline once its error rate exceeds the baseline's by too much
+	Rollback *RollbackConfig `yaml:"rollback,omitempty"`
+}
+
+// RollbackConfig is the error budget of an experiment's canary variants.
+// Error rates (5xx responses) are compared per window once both the canary
+// and the baseline have served MinRequests in it; a rolled back variant stays
+// rolled back until the gateway restarts.
+type RollbackConfig struct {
+	// Baseline is the stable variant; defaults to the first one
+	Baseline string `yaml:"baseline,omitempty"`
+	// MaxErrorRateDelta is the allowed canary minus baseline error rate (0-1)
+	MaxErrorRateDelta float64 `yaml:"maxErrorRateDelta"`
+	MinRequests       int     `yaml:"minRequests,omitempty"`
+	Window            string  `yaml:"window,omitempty"`
+}
+
+// BaselineVariant returns the experiment's stable variant
+func (e *ExperimentConfig) BaselineVariant() ExperimentVariant {
+	if e.Rollback != nil {
+		for _, v := range e.Variants {
+			if v.Name == e.Rollback.Baseline {
+				return v
+			}
+		}
+	}
+	return e.Variants[0]
+}
+
+// ExperimentVariant is one arm of an experiment. An empty Service keeps the
+// route's own service.
+type ExperimentVariant struct {
+	Name    string `yaml:"name"`
+	Service string `yaml:"service,omitempty"`
+	Weight  int    `yaml:"weight"`
+}
+
+// RedirectConfig defines a redirect route. Target may reference {path} (the
+// request path), {rest} (the path after the route prefix) and {query} (the raw
+// query string); if {query} isn't used the query string is appended as-is.
+type RedirectConfig struct {
+	Status int    `yaml:"status"`
+	Target string `yaml:"target"`
+}
+
+// StaticResponse defines a fixed response served by the gateway itself
+type StaticResponse struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body"`
+}
+
+// SkipConfig disables individual middleware for a route, e.g. for
+// high-volume ingestion endpoints where the policies aren't needed
+type SkipConfig struct {
+	ContentType bool `yaml:"contentType"`
+	Metrics     bool `yaml:"metrics"`
+	Logging     bool `yaml:"logging"`
 }
 
 // RouteLimit defines per-route rate limiting
 type RouteLimit struct {
 	RequestsPerSec int `yaml:"requestsPerSec"`
 	BurstSize      int `yaml:"burstSize"`
+	// Algorithm is one of RateLimitAlgorithms; empty uses RATE_LIMIT_ALGORITHM
+	Algorithm string `yaml:"algorithm,omitempty"`
 }
 
 // RetryConfig defines retry behavior
@@ -39,29 +364,289 @@ type RetryConfig struct {
 
 // CacheConfig defines response caching
 type CacheConfig struct {
-	Enabled bool     `yaml:"enabled"`
-	TTL     string   `yaml:"ttl"`
+	Enabled bool `yaml:"enabled"`
+	// TTL is a duration such as 30s (default 1m)
+	TTL string `yaml:"ttl"`
+	// Methods whose responses are cached (default GET)
 	Methods []string `yaml:"methods"`
 }
 
-// LoadRoutes loads route configuration from YAML file
-func LoadRoutes(path string) (*RouteConfig, error) {
-	data, err := os.ReadFile(path)
+// LoadRoutes loads the route configuration from path, a route file or a
+// directory of them (see RouteFiles), with the overlays for env (see
+// RouteOverlays), falling back to the default routes when there are no
+// route files
+func LoadRoutes(path, env string) (*RouteConfig, error) {
+	files, err := RouteFiles(path)
 	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
 		return DefaultRoutes(), nil
 	}
-
-	var config RouteConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	overlays, err := RouteOverlays(path, env)
+	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	docs := make([]RouteDocument, 0, len(files)+len(overlays))
+	for _, file := range append(files, overlays...) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, RouteDocument{
+			Name:    file,
+			Format:  RouteFormat(file),
+			Data:    data,
+			Overlay: slices.Contains(overlays, file),
+		})
+	}
+
+	return ParseRoutes(docs)
+}
+
+// Validate checks route settings that can't be verified by unmarshalling.
+// Routes must already be sorted.
+func (rc *RouteConfig) Validate() error {
+	for _, conflict := range rc.Conflicts() {
+		if conflict.Ambiguous {
+			return fmt.Errorf("%s", conflict)
+		}
+	}
+	for _, route := range rc.Routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+	if rc.Fallback != nil {
+		if errs := rc.Fallback.checkFallback(); len(errs) > 0 {
+			return errs[0]
+		}
+	}
+	return nil
+}
+
+// Validate checks the route's own settings, without the rest of the table
+func (r Route) Validate() error {
+	if errs := r.check(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// routeError is a problem with a route setting
+type routeError struct {
+	route Route
+	// field is the setting's YAML path (e.g. cache.ttl, methods.1)
+	field string
+	err   error
+	// fallback marks problems of the route table's fallback
+	fallback bool
+}
+
+func (e routeError) Error() string {
+	if e.fallback {
+		return fmt.Sprintf("fallback: %v", e.err)
+	}
+	return fmt.Sprintf("route %s: %v", e.route.Pattern(), e.err)
+}
+
+// check returns the route's invalid settings
+func (r Route) check() []routeError {
+	var errs []routeError
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, routeError{route: r, field: field, err: fmt.Errorf(format, args...)})
+	}
+
+	if (r.Path == "") == (r.PathRegex == "") {
+		fail("path", "needs exactly one of path and pathRegex")
+	}
+	if r.Cache != nil && r.Cache.TTL != "" {
+		if ttl, err := time.ParseDuration(r.Cache.TTL); err != nil || ttl <= 0 {
+			fail("cache.ttl", "cache ttl must be a positive duration")
+		}
+	}
+	if r.Ingest && (r.Stream || r.Response != nil || r.Redirect != nil || (r.Cache != nil && r.Cache.Enabled)) {
+		fail("ingest", "ingest can't be combined with stream, cache, response or redirect")
+	}
+	if _, ok := r.Sunset(); r.SunsetDate != "" && !ok {
+		fail("sunsetDate", "sunsetDate must be a date (2006-01-02) or RFC 3339 time")
+	}
+	if _, ok := ParsePriority(r.RequestPriority); r.RequestPriority != "" && !ok {
+		fail("requestPriority", "requestPriority must be high, normal or low")
+	}
+	if r.MaxBodySize < 0 {
+		fail("maxBodySize", "maxBodySize must not be negative")
+	}
+	if r.Public && (len(r.RequiredRoles) > 0 || len(r.RequiredScopes) > 0) {
+		fail("public", "requiredRoles and requiredScopes need a non-public route")
+	}
+	if r.Public && r.ReplayProtection {
+		fail("replayProtection", "replayProtection needs a non-public route")
+	}
+	for header := range r.ClaimHeaders {
+		if header == "" || strings.ContainsAny(header, " \t\r\n:") {
+			fail("claimHeaders."+header, "claimHeaders needs header names without spaces or colons")
+		}
+	}
+	if r.Signature != nil {
+		if len(r.RequiredRoles) > 0 || len(r.RequiredScopes) > 0 {
+			fail("signature", "requiredRoles and requiredScopes need token-authenticated callers, not signed requests")
+		}
+		for i, client := range r.Signature.Clients {
+			if client == "" {
+				fail(fmt.Sprintf("signature.clients.%d", i), "signature client must not be empty")
+			}
+		}
+	}
+	if r.Policy != "" && !policyPath.MatchString(r.Policy) {
+		fail("policy", "policy must be a data path such as gateway/authz/allow")
+	}
+	if file, pointer, _ := strings.Cut(r.Schema, "#"); r.Schema != "" && (file == "" || (pointer != "" && !strings.HasPrefix(pointer, "/"))) {
+		fail("schema", "schema must be a file, optionally followed by #/pointer")
+	}
+	if r.Geo != nil {
+		for _, list := range []struct {
+			field string
+			codes []string
+		}{{"allowCountries", r.Geo.AllowCountries}, {"denyCountries", r.Geo.DenyCountries}} {
+			for i, code := range list.codes {
+				if !countryCode.MatchString(code) {
+					fail(fmt.Sprintf("geo.%s.%d", list.field, i), "country %q must be an ISO 3166-1 alpha-2 code such as DE", code)
+				}
+			}
+		}
+	}
+	if r.RateLimit != nil {
+		if r.RateLimit.RequestsPerSec <= 0 {
+			fail("rateLimit.requestsPerSec", "rateLimit requestsPerSec must be positive")
+		}
+		if r.RateLimit.BurstSize <= 0 {
+			fail("rateLimit.burstSize", "rateLimit burstSize must be positive")
+		}
+		if r.RateLimit.Algorithm != "" && !slices.Contains(RateLimitAlgorithms, r.RateLimit.Algorithm) {
+			fail("rateLimit.algorithm", "rateLimit algorithm must be token_bucket, fixed_window, sliding_window or gcra")
+		}
+	}
+	if r.Bots != "" && !slices.Contains(BotModes, r.Bots) {
+		fail("bots", "bots must be off, monitor or block")
+	}
+	if r.ClientCert != nil {
+		for i, identity := range r.ClientCert.Identities {
+			if identity == "" {
+				fail(fmt.Sprintf("clientCert.identities.%d", i), "clientCert identity must not be empty")
+			}
+		}
+	}
+	if r.PathRegex != "" {
+		if _, err := regexp.Compile(r.PathRegex); err != nil {
+			fail("pathRegex", "invalid pathRegex: %w", err)
+		}
+		if r.StripPrefix {
+			fail("stripPrefix", "stripPrefix needs a path; use rewrite with pathRegex")
+		}
+		if r.PrefixRewrite != "" {
+			fail("prefixRewrite", "prefixRewrite needs a path; use rewrite with pathRegex")
+		}
+	}
+	if r.PrefixRewrite != "" && !strings.HasPrefix(r.PrefixRewrite, "/") {
+		fail("prefixRewrite", "prefixRewrite must start with /")
+	}
+	if r.Rewrite != nil {
+		if _, err := regexp.Compile(r.Rewrite.Pattern); err != nil {
+			fail("rewrite.pattern", "invalid rewrite pattern: %w", err)
+		}
+	}
+	if r.VersionPrefix != "" || len(r.Versions) > 0 {
+		errs = append(errs, r.checkVersions()...)
+	}
+	for i, h := range r.SetResponseHeaders {
+		field := fmt.Sprintf("setResponseHeaders.%d", i)
+		switch {
+		case h.Name == "" || strings.ContainsAny(h.Name, " \t\r\n:"):
+			fail(field+".name", "setResponseHeaders needs a header name without spaces or colons")
+		case slices.Contains(framingHeaders, strings.ToLower(h.Name)):
+			fail(field+".name", "setResponseHeaders can't set %s", h.Name)
+		}
+		if strings.ContainsAny(h.Value, "\r\n") {
+			fail(field+".value", "setResponseHeaders values must be a single line")
+		}
+		if h.Mode != "" && h.Mode != "override" && h.Mode != "append" {
+			fail(field+".mode", "setResponseHeaders mode must be override or append")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Tags)) {
+		if !tagName.MatchString(name) {
+			fail("tags."+name, "tag %q must be letters, digits and underscores, not starting with a digit", name)
+		}
+	}
+	if exp := r.Experiment; exp != nil {
+		if exp.Name == "" || len(exp.Variants) == 0 {
+			fail("experiment", "experiment needs a name and variants")
+		}
+		for i, v := range exp.Variants {
+			if v.Name == "" || v.Weight <= 0 {
+				fail(fmt.Sprintf("experiment.variants.%d", i), "experiment %s: variants need a name and a positive weight", exp.Name)
+			}
+		}
+		if err := exp.Rollback.validate(exp.Variants); err != nil {
+			fail("experiment.rollback", "experiment %s: %w", exp.Name, err)
+		}
+	}
+	return errs
+}
+
+// countryCode is an ISO 3166-1 alpha-2 country code
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// RateLimitAlgorithms are the values of RATE_LIMIT_ALGORITHM and route
+// rateLimit algorithm settings. All hold a client to requestsPerSec on
+// average and burstSize at once: token_bucket refills continuously,
+// fixed_window counts per window of burstSize/requestsPerSec seconds (up
+// to twice burstSize across a window boundary), sliding_window counts the
+// requests of the last window, strictly, and gcra spaces requests like a
+// token bucket but keeps a single timestamp per client.
+var RateLimitAlgorithms = []string{"token_bucket", "fixed_window", "sliding_window", "gcra"}
+
+// BotModes are the values of BOT_FILTER and route bots settings
+var BotModes = []string{"off", "monitor", "block"}
+
+// policyPath is an OPA data path: package and rule names separated by /
+var policyPath = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(/[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// tagName is what a route tag may be named, so it can be a metric label
+var tagName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validate checks the rollback settings against the experiment's variants
+func (r *RollbackConfig) validate(variants []ExperimentVariant) error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxErrorRateDelta <= 0 || r.MaxErrorRateDelta > 1 {
+		return fmt.Errorf("rollback maxErrorRateDelta must be between 0 and 1")
+	}
+	if r.MinRequests < 0 {
+		return fmt.Errorf("rollback minRequests must not be negative")
+	}
+	if r.Window != "" {
+		if d, err := time.ParseDuration(r.Window); err != nil || d <= 0 {
+			return fmt.Errorf("invalid rollback window %q", r.Window)
+		}
+	}
+	if r.Baseline == "" {
+		return nil
+	}
+	for _, v := range variants {
+		if v.Name == r.Baseline {
+			return nil
+		}
+	}
+	return fmt.Errorf("rollback baseline %q is not a variant", r.Baseline)
 }
 
 // DefaultRoutes returns default routing configuration
 func DefaultRoutes() *RouteConfig {
-	return &RouteConfig{
+	routes := &RouteConfig{
 		Routes: []Route{
 			// Auth service routes
 			{
@@ -208,6 +793,13 @@ func DefaultRoutes() *RouteConfig {
 				Methods:     []string{"GET"},
 				Public:      true,
 			},
+			{
+				Path:        "/live",
+				Service:     "gateway",
+				StripPrefix: false,
+				Methods:     []string{"GET"},
+				Public:      true,
+			},
 			// Metrics (internal)
 			{
 				Path:        "/metrics",
@@ -216,6 +808,22 @@ func DefaultRoutes() *RouteConfig {
 				Methods:     []string{"GET"},
 				Public:      true,
 			},
+			{
+				Path:        "/circuit-breakers",
+				Service:     "gateway",
+				StripPrefix: false,
+				Methods:     []string{"GET"},
+				Public:      true,
+			},
+			{
+				Path:        "/swagger",
+				Service:     "gateway",
+				StripPrefix: false,
+				Methods:     []string{"GET"},
+				Public:      true,
+			},
 		},
 	}
+	routes.Sort()
+	return routes
 }
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RouteConflict reports a route that can never serve some of its methods
+// because an earlier route in matching order takes those requests
+type RouteConflict struct {
+	Route Route
+	// Index is the position of Route in the table
+	Index   int
+	Winner  Route
+	Methods []string
+	// Ambiguous is set when only declaration order decides between the two
+	// routes (same path, priority and predicates), which Validate rejects
+	Ambiguous bool
+}
+
+func (c RouteConflict) String() string {
+	if c.Ambiguous {
+		return fmt.Sprintf("route %s [%s] is declared twice with the same priority",
+			c.Route.Pattern(), strings.Join(c.Methods, ","))
+	}
+	return fmt.Sprintf("route %s [%s] is shadowed by %s (priority %d)",
+		c.Route.Pattern(), strings.Join(c.Methods, ","), c.Winner.Pattern(), c.Winner.Priority)
+}
+
+// Sort orders routes for matching: higher priority first, then more specific
+// paths (more segments, then fewer :name parameters, then longer), then
+// declaration order. Without explicit priorities this makes /api/v1/auth/login
+// win over /api/v1/auth, and /users/me over /users/:id, wherever either is
+// declared.
+func (rc *RouteConfig) Sort() {
+	sort.SliceStable(rc.Routes, func(i, j int) bool {
+		a, b := rc.Routes[i], rc.Routes[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		sa, sb := pathSegments(a.Path), pathSegments(b.Path)
+		if len(sa) != len(sb) {
+			return len(sa) > len(sb)
+		}
+		if pa, pb := strings.Count(a.Path, "/:"), strings.Count(b.Path, "/:"); pa != pb {
+			return pa < pb
+		}
+		return len(a.Path) > len(b.Path)
+	})
+}
+
+// Conflicts returns the routes that are fully or partly unreachable given the
+// matching order. Routes must already be sorted.
+func (rc *RouteConfig) Conflicts() []RouteConflict {
+	var conflicts []RouteConflict
+	for i, route := range rc.Routes {
+		if route.PathRegex != "" {
+			// Regular expressions can't be compared; priority orders them
+			continue
+		}
+		for _, winner := range rc.Routes[:i] {
+			if winner.PathRegex != "" || !pathCovers(route.Path, winner.Path) || !predicatesCover(winner, route) {
+				continue
+			}
+			methods := sharedMethods(winner.Methods, route.Methods)
+			if len(methods) == 0 {
+				continue
+			}
+			conflicts = append(conflicts, RouteConflict{
+				Route:   route,
+				Index:   i,
+				Winner:  winner,
+				Methods: methods,
+				Ambiguous: pathTemplate(winner.Path) == pathTemplate(route.Path) && winner.Priority == route.Priority &&
+					len(winner.Headers) == len(route.Headers) && len(winner.Query) == len(route.Query),
+			})
+		}
+	}
+	return conflicts
+}
+
+// pathCovers reports whether requests for path also match the route prefix
+func pathCovers(path, prefix string) bool {
+	if !HasPathParams(path) && !HasPathParams(prefix) {
+		return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+	}
+
+	// A parameter in the prefix covers any segment; a parameter in path is
+	// only covered by one in the prefix
+	p, s := pathSegments(prefix), pathSegments(path)
+	if len(s) < len(p) {
+		return false
+	}
+	for i, seg := range p {
+		if !strings.HasPrefix(seg, ":") && seg != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// predicatesCover reports whether every request matching route's header and
+// query predicates also matches winner's
+func predicatesCover(winner, route Route) bool {
+	for name, value := range winner.Headers {
+		if route.Headers[name] != value {
+			return false
+		}
+	}
+	for name, value := range winner.Query {
+		if route.Query[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedMethods returns the methods in both lists
+func sharedMethods(a, b []string) []string {
+	var shared []string
+	for _, m := range b {
+		for _, n := range a {
+			if strings.EqualFold(m, n) {
+				shared = append(shared, strings.ToUpper(m))
+				break
+			}
+		}
+	}
+	return shared
+}
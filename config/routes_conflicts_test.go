@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestSortAndConflicts(t *testing.T) {
+	routes := &RouteConfig{Routes: []Route{
+		{Path: "/api/v1/auth", Service: "auth", Methods: []string{"GET", "POST"}},
+		{Path: "/api/v1/auth/login", Service: "auth", Methods: []string{"POST"}},
+		{Path: "/api/v1/admin", Service: "auth", Methods: []string{"GET"}, Priority: 10},
+		{Path: "/api/v1/admin/stats", Service: "stats", Methods: []string{"GET"}},
+	}}
+	routes.Sort()
+
+	want := []string{"/api/v1/admin", "/api/v1/admin/stats", "/api/v1/auth/login", "/api/v1/auth"}
+	for i, path := range want {
+		if routes.Routes[i].Path != path {
+			t.Fatalf("route %d = %s, want %s", i, routes.Routes[i].Path, path)
+		}
+	}
+
+	conflicts := routes.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Route.Path != "/api/v1/admin/stats" || conflicts[0].Ambiguous {
+		t.Fatalf("unexpected conflicts %+v", conflicts)
+	}
+	if err := routes.Validate(); err != nil {
+		t.Fatalf("shadowed routes should not fail validation: %v", err)
+	}
+
+	routes.Routes = append(routes.Routes, Route{Path: "/api/v1/auth", Service: "auth-v2", Methods: []string{"post"}})
+	routes.Sort()
+	if err := routes.Validate(); err == nil {
+		t.Fatal("expected duplicate route to fail validation")
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RouteChangeKind classifies a difference between two route configurations
+type RouteChangeKind string
+
+const (
+	RouteAdded   RouteChangeKind = "added"
+	RouteRemoved RouteChangeKind = "removed"
+	RouteChanged RouteChangeKind = "changed"
+)
+
+// RouteChange describes one added, removed or changed route
+type RouteChange struct {
+	Kind  RouteChangeKind
+	Route Route
+	// Fields lists the changed settings, keyed by their YAML name
+	Fields []FieldChange
+}
+
+// FieldChange is a single changed route setting
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// DiffRoutes compares two route configurations. Routes are identified by
+// path plus header/query predicates; repeated identities (e.g. one path split
+// by method) are paired up in file order.
+func DiffRoutes(old, new *RouteConfig) []RouteChange {
+	oldRoutes, oldOrder := indexRoutes(old)
+	newRoutes, newOrder := indexRoutes(new)
+
+	var changes []RouteChange
+	for _, id := range oldOrder {
+		before := oldRoutes[id]
+		after, ok := newRoutes[id]
+		if !ok {
+			changes = append(changes, RouteChange{Kind: RouteRemoved, Route: before})
+			continue
+		}
+		if fields := diffRouteFields(before, after); len(fields) > 0 {
+			changes = append(changes, RouteChange{Kind: RouteChanged, Route: after, Fields: fields})
+		}
+	}
+	for _, id := range newOrder {
+		if _, ok := oldRoutes[id]; !ok {
+			changes = append(changes, RouteChange{Kind: RouteAdded, Route: newRoutes[id]})
+		}
+	}
+	return changes
+}
+
+// indexRoutes keys routes by identity, keeping file order
+func indexRoutes(rc *RouteConfig) (map[string]Route, []string) {
+	routes := make(map[string]Route, len(rc.Routes))
+	order := make([]string, 0, len(rc.Routes))
+	seen := make(map[string]int)
+
+	for _, route := range rc.Routes {
+		id := route.Pattern() + predicateKey("h", route.Headers) + predicateKey("q", route.Query)
+		seen[id]++
+		if n := seen[id]; n > 1 {
+			id = fmt.Sprintf("%s#%d", id, n)
+		}
+		routes[id] = route
+		order = append(order, id)
+	}
+	// The fallback is compared like a route with its pattern as path
+	if rc.Fallback != nil {
+		fallback := *rc.Fallback
+		fallback.Path = FallbackPattern
+		routes[FallbackPattern] = fallback
+		order = append(order, FallbackPattern)
+	}
+	return routes, order
+}
+
+// predicateKey renders predicates in a stable order
+func predicateKey(kind string, predicates map[string]string) string {
+	if len(predicates) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(predicates))
+	for k := range predicates {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s:%s=%s", kind, k, predicates[k])
+	}
+	return b.String()
+}
+
+// diffRouteFields compares every route setting by its YAML name
+func diffRouteFields(old, new Route) []FieldChange {
+	var fields []FieldChange
+
+	oldVal, newVal := reflect.ValueOf(old), reflect.ValueOf(new)
+	routeType := oldVal.Type()
+	for i := 0; i < routeType.NumField(); i++ {
+		a, b := oldVal.Field(i).Interface(), newVal.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		name, _, _ := strings.Cut(routeType.Field(i).Tag.Get("yaml"), ",")
+		fields = append(fields, FieldChange{Field: name, Old: formatSetting(a), New: formatSetting(b)})
+	}
+	return fields
+}
+
+// formatSetting renders a route setting for display
+func formatSetting(v any) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return "none"
+		}
+		return fmt.Sprintf("%+v", rv.Elem().Interface())
+	case reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return "none"
+		}
+	case reflect.String:
+		if rv.Len() == 0 {
+			return `""`
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
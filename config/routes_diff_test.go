@@ -0,0 +1,44 @@
+package config
+
+import "testing"
+
+func TestDiffRoutes(t *testing.T) {
+	old := &RouteConfig{Routes: []Route{
+		{Path: "/api/v1/auth/login", Service: "auth", Methods: []string{"POST"}, Public: true,
+			RateLimit: &RouteLimit{RequestsPerSec: 10, BurstSize: 20}},
+		{Path: "/api/v1/legacy", Service: "auth", Methods: []string{"GET"}},
+	}}
+	new := &RouteConfig{Routes: []Route{
+		{Path: "/api/v1/auth/login", Service: "auth", Methods: []string{"POST"}, Public: false},
+		{Path: "/api/v1/notifications", Service: "notifier", Methods: []string{"GET"}},
+	}}
+
+	changes := DiffRoutes(old, new)
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3: %+v", len(changes), changes)
+	}
+
+	if c := changes[0]; c.Kind != RouteChanged || len(c.Fields) != 2 ||
+		c.Fields[0].Field != "public" || c.Fields[1].Field != "rateLimit" || c.Fields[1].New != "none" {
+		t.Errorf("unexpected change %+v", c)
+	}
+	if c := changes[1]; c.Kind != RouteRemoved || c.Route.Path != "/api/v1/legacy" {
+		t.Errorf("unexpected change %+v", c)
+	}
+	if c := changes[2]; c.Kind != RouteAdded || c.Route.Path != "/api/v1/notifications" {
+		t.Errorf("unexpected change %+v", c)
+	}
+}
+
+func TestDiffRoutesFallback(t *testing.T) {
+	old := &RouteConfig{Fallback: &Route{Service: "web"}}
+	new := &RouteConfig{Fallback: &Route{Service: "spa"}}
+
+	changes := DiffRoutes(old, new)
+	if len(changes) != 1 || changes[0].Kind != RouteChanged || changes[0].Route.Path != FallbackPattern {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if changes := DiffRoutes(old, &RouteConfig{}); len(changes) != 1 || changes[0].Kind != RouteRemoved {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+}
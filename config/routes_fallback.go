@@ -0,0 +1,44 @@
+package config
+
+import "fmt"
+
+// FallbackPattern is the pattern of the fallback route in metrics, logs and
+// analytics
+const FallbackPattern = "*"
+
+// checkFallback returns the invalid settings of a route table's fallback:
+// a route without path or predicates that proxies to a service, redirects
+// or answers with a fixed response
+func (r Route) checkFallback() []routeError {
+	var errs []routeError
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, routeError{route: r, field: field, err: fmt.Errorf(format, args...), fallback: true})
+	}
+
+	if r.Path != "" || r.PathRegex != "" || r.VersionPrefix != "" {
+		fail("path", "the fallback serves every unmatched path; remove path, pathRegex and versionPrefix")
+	}
+	if len(r.Headers) > 0 || len(r.Query) > 0 {
+		fail("headers", "the fallback can't have header or query predicates")
+	}
+	if r.StripPrefix || r.PrefixRewrite != "" {
+		fail("stripPrefix", "the fallback has no path to strip or rewrite")
+	}
+	handlers := 0
+	for _, set := range []bool{r.Service != "", r.Response != nil, r.Redirect != nil} {
+		if set {
+			handlers++
+		}
+	}
+	if handlers != 1 {
+		fail("service", "the fallback needs exactly one of service, response and redirect")
+	}
+
+	// The route checks, with the fallback's path
+	r.Path = FallbackPattern
+	for _, e := range r.check() {
+		e.fallback = true
+		errs = append(errs, e)
+	}
+	return errs
+}
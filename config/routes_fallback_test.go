@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRoutesFallback(t *testing.T) {
+	docs := []RouteDocument{
+		{Name: "routes.yaml", Format: "yaml", Data: []byte("fallback:\n  service: web\n  public: true\n")},
+		{Name: "routes.d/10-docs.json", Format: "json", Data: []byte(`{"fallback": {"redirect": {"target": "https://docs.example.com{path}"}}}`)},
+		{Name: "routes.d/20-items.yaml", Format: "yaml", Data: []byte("routes:\n  - path: /items\n    service: web\n    methods: [GET]\n")},
+	}
+	routes, err := ParseRoutes(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb := routes.Fallback; fb == nil || fb.Redirect == nil || fb.Service != "" || len(routes.Routes) != 1 {
+		t.Errorf("routes = %+v, fallback %+v", routes.Routes, fb)
+	}
+
+	for _, fallback := range []string{
+		"fallback:\n  path: /\n  service: web\n",
+		"fallback:\n  service: web\n  response: {body: gone}\n",
+		"fallback:\n  public: true\n",
+		"fallback:\n  service: web\n  stripPrefix: true\n",
+		"fallback:\n  service: web\n  timeout: soon\n  headers: {X-Beta: \"1\"}\n",
+	} {
+		_, err := ParseRoutes([]RouteDocument{{Name: "routes.yaml", Format: "yaml", Data: []byte(fallback)}})
+		if err == nil || !strings.HasPrefix(err.Error(), "fallback: ") {
+			t.Errorf("%q: err = %v", fallback, err)
+		}
+	}
+}
+
+func TestCheckRoutesFallback(t *testing.T) {
+	data := `routes:
+  - path: /items
+    service: web
+    methods: [GET]
+fallback:
+  service: docs
+  cache: {enabled: true, ttl: soon}
+`
+	problems := CheckRouteDocuments([]RouteDocument{{Name: "routes.yaml", Format: "yaml", Data: []byte(data)}}, []string{"web"})
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v", problems)
+	}
+	if p := problems[0]; p.Line != 6 || p.Message != `fallback: unknown service "docs"` {
+		t.Errorf("service problem = %s", p)
+	}
+	if p := problems[1]; p.Line != 7 || !strings.Contains(p.Message, "cache ttl") {
+		t.Errorf("cache problem = %s", p)
+	}
+}
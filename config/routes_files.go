@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RouteFiles lists the route files loaded for path, in merge order.
+//
+// path is either a route file, followed by the fragments in the directory
+// of the same name with a .d extension (routes.yaml and routes.d/), or a
+// directory of fragments. Fragments are read in file name order, so a
+// numeric prefix (10-auth.yaml) orders them. YAML (.yaml, .yml), JSON
+// (.json) and TOML (.toml) files are read; anything else is ignored.
+func RouteFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return routeFragments(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var files []string
+	if err == nil {
+		files = append(files, path)
+	}
+	fragments, err := routeFragments(strings.TrimSuffix(path, filepath.Ext(path)) + ".d")
+	if err != nil {
+		return nil, err
+	}
+	return append(files, fragments...), nil
+}
+
+// routeFragments lists the route files in dir, if it exists
+func routeFragments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && RouteFormat(entry.Name()) != "" {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// RouteFormat returns the format of a route file by its extension, or ""
+func RouteFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	}
+	return ""
+}
+
+// RouteDocument is route configuration to merge, such as a route file or
+// a key-value store entry
+type RouteDocument struct {
+	// Name identifies the document in errors
+	Name string
+	// Format is yaml, json or toml; anything else is read as YAML, which
+	// JSON is a subset of
+	Format string
+	Data   []byte
+	// Overlay changes the routes of the documents before it instead of
+	// only adding routes (see RouteOverlays)
+	Overlay bool
+}
+
+// ParseRoutes merges route documents in order, like the files of a route
+// directory, and validates the result. A later document's fallback
+// replaces earlier ones.
+func ParseRoutes(docs []RouteDocument) (*RouteConfig, error) {
+	var (
+		config RouteConfig
+		// nodes holds each route's node, in the order of config, for overlays
+		nodes []*yaml.Node
+	)
+	for _, doc := range docs {
+		node, err := parseRouteData(doc.Format, doc.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", doc.Name, err)
+		}
+		var fragment RouteConfig
+		if err := node.Decode(&fragment); err != nil {
+			return nil, fmt.Errorf("%s: %w", doc.Name, err)
+		}
+		if fragment.Fallback != nil {
+			config.Fallback = fragment.Fallback
+		}
+		fragmentNodes := routeNodes(node, len(fragment.Routes))
+		if fragmentNodes == nil {
+			fragmentNodes = make([]*yaml.Node, len(fragment.Routes))
+		}
+
+		for i, route := range fragment.Routes {
+			var targets []int
+			if doc.Overlay {
+				targets = overlayTargets(config.Routes, route)
+			}
+			if len(targets) == 0 {
+				config.Routes = append(config.Routes, route)
+				nodes = append(nodes, fragmentNodes[i])
+				continue
+			}
+			overlay := fragmentNodes[i]
+			if overlay == nil {
+				return nil, fmt.Errorf("%s: overlay routes can't use anchors or aliases", doc.Name)
+			}
+			for _, t := range targets {
+				if nodes[t], config.Routes[t], err = overlayRoute(nodes[t], config.Routes[t], overlay, nil); err != nil {
+					return nil, fmt.Errorf("%s: %w", doc.Name, err)
+				}
+			}
+		}
+	}
+
+	// Versioned routes are checked before they are expanded, so errors
+	// name the route as written
+	for _, route := range config.Routes {
+		if route.VersionPrefix != "" || len(route.Versions) > 0 {
+			if err := route.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	config.Routes = ExpandVersions(config.Routes)
+
+	config.Sort()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// parseRouteData parses route file contents of the given format
+func parseRouteData(format string, data []byte) (*yaml.Node, error) {
+	if format == "toml" {
+		return parseTOML(data)
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	if node.Kind == 0 {
+		// An empty file has no routes
+		return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}, nil
+	}
+	return &node, nil
+}
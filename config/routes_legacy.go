@@ -0,0 +1,53 @@
+package config
+
+import "strings"
+
+// LegacyConfig normalizes quirks of legacy clients. The request is rewritten
+// as soon as the route is matched, so the rest of the gateway and the
+// upstream only see the normalized form.
+type LegacyConfig struct {
+	// PathParams moves ;name=value path parameters (e.g. ;jsessionid=...)
+	// into the query string
+	PathParams bool `yaml:"pathParams,omitempty"`
+	// MergeSlashes folds repeated slashes in the path
+	MergeSlashes bool `yaml:"mergeSlashes,omitempty"`
+	// QueryParams renames legacy query parameters, old name to new
+	QueryParams map[string]string `yaml:"queryParams,omitempty"`
+}
+
+// PathParam is a ;name=value parameter removed from a path segment
+type PathParam struct {
+	Name  string
+	Value string
+}
+
+// NormalizePath applies the path options and returns the normalized path
+// with the path parameters it removed
+func (l *LegacyConfig) NormalizePath(path string) (string, []PathParam) {
+	var params []PathParam
+	if l.PathParams && strings.Contains(path, ";") {
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			name, rest, found := strings.Cut(segment, ";")
+			if !found {
+				continue
+			}
+			segments[i] = name
+			for _, param := range strings.Split(rest, ";") {
+				if param == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(param, "=")
+				params = append(params, PathParam{Name: key, Value: value})
+			}
+		}
+		path = strings.Join(segments, "/")
+	}
+
+	if l.MergeSlashes {
+		for strings.Contains(path, "//") {
+			path = strings.ReplaceAll(path, "//", "/")
+		}
+	}
+	return path, params
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLegacyNormalizePath(t *testing.T) {
+	legacy := &LegacyConfig{PathParams: true, MergeSlashes: true}
+
+	path, params := legacy.NormalizePath("/api//v1/cart;jsessionid=ABC123///items;v=2;flag")
+	if want := "/api/v1/cart/items"; path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	want := []PathParam{{"jsessionid", "ABC123"}, {"v", "2"}, {"flag", ""}}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %v, want %v", params, want)
+	}
+
+	slashesOnly := &LegacyConfig{MergeSlashes: true}
+	if path, params := slashesOnly.NormalizePath("/api//v1;jsessionid=x"); path != "/api/v1;jsessionid=x" || params != nil {
+		t.Errorf("mergeSlashes only = %s %v", path, params)
+	}
+
+	paramsOnly := &LegacyConfig{PathParams: true}
+	if path, _ := paramsOnly.NormalizePath("/api//v1;jsessionid=x"); path != "/api//v1" {
+		t.Errorf("pathParams only = %s", path)
+	}
+}
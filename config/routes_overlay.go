@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RouteOverlays lists the overlay files of a route file for env, in merge
+// order: the file's name with the environment before the extension, in any
+// route format (routes.prod.yaml, routes.prod.json, ...). Directories and
+// an empty env have no overlays.
+//
+// An overlay route with the same path (or pathRegex), versionPrefix,
+// headers and query as routes of the files changes their settings: mappings
+// are merged key by key, anything else is replaced. With methods it only
+// changes the route with exactly those methods. Other overlay routes are
+// added, so an environment can have routes of its own.
+func RouteOverlays(path, env string) ([]string, error) {
+	if env == "" {
+		return nil, nil
+	}
+	if strings.ContainsAny(env, `./\`) {
+		return nil, fmt.Errorf("invalid environment %q", env)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, nil
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	var overlays []string
+	for _, ext := range []string{".yaml", ".yml", ".json", ".toml"} {
+		file := base + "." + env + ext
+		if _, err := os.Stat(file); err == nil {
+			overlays = append(overlays, file)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return overlays, nil
+}
+
+// overlayTargets returns the indexes of the routes an overlay route changes
+func overlayTargets(routes []Route, overlay Route) []int {
+	var targets []int
+	for i, route := range routes {
+		if route.Path == overlay.Path && route.PathRegex == overlay.PathRegex && route.VersionPrefix == overlay.VersionPrefix &&
+			maps.Equal(route.Headers, overlay.Headers) && maps.Equal(route.Query, overlay.Query) &&
+			(overlay.Methods == nil || sameMethods(route.Methods, overlay.Methods)) {
+			targets = append(targets, i)
+		}
+	}
+	return targets
+}
+
+// sameMethods reports whether two method lists hold the same methods
+func sameMethods(a, b []string) bool {
+	normalize := func(methods []string) []string {
+		out := make([]string, len(methods))
+		for i, m := range methods {
+			out[i] = strings.ToUpper(m)
+		}
+		slices.Sort(out)
+		return slices.Compact(out)
+	}
+	return slices.Equal(normalize(a), normalize(b))
+}
+
+// overlayRoute merges an overlay route's node into the node of route and
+// returns the merged node and route. The base node is changed in place; a
+// missing one (e.g. a route written with YAML aliases) is made from route.
+// inserted, when set, is called with every node taken from the overlay.
+func overlayRoute(base *yaml.Node, route Route, overlay *yaml.Node, inserted func(*yaml.Node)) (*yaml.Node, Route, error) {
+	if base == nil || base.Kind != yaml.MappingNode {
+		base = &yaml.Node{}
+		if err := base.Encode(route); err != nil {
+			return nil, route, err
+		}
+	}
+	mergeNode(base, overlay, inserted)
+
+	var merged Route
+	if err := base.Decode(&merged); err != nil {
+		return nil, route, err
+	}
+	return base, merged, nil
+}
+
+// mergeNode merges the mapping src into dst: values that are mappings on
+// both sides are merged, other values of src replace those of dst
+func mergeNode(dst, src *yaml.Node, inserted func(*yaml.Node)) {
+	if src.Kind == yaml.AliasNode {
+		src = src.Alias
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+
+		j := 0
+		for ; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				break
+			}
+		}
+		switch {
+		case j+1 >= len(dst.Content):
+			dst.Content = append(dst.Content, key, value)
+			walkNodes(key, inserted)
+			walkNodes(value, inserted)
+		case value.Kind == yaml.MappingNode && dst.Content[j+1].Kind == yaml.MappingNode:
+			mergeNode(dst.Content[j+1], value, inserted)
+		default:
+			dst.Content[j+1] = value
+			walkNodes(value, inserted)
+		}
+	}
+}
+
+// walkNodes calls fn with node and every node below it
+func walkNodes(node *yaml.Node, fn func(*yaml.Node)) {
+	if fn == nil {
+		return
+	}
+	fn(node)
+	for _, child := range node.Content {
+		walkNodes(child, fn)
+	}
+}
+
+// routeNodes returns the node of each of a route document's count routes,
+// or nil when they can't be told apart (anchors or aliases)
+func routeNodes(doc *yaml.Node, count int) []*yaml.Node {
+	var nodes []*yaml.Node
+	if seq := lookupNode(doc, "routes"); seq != nil && seq.Kind == yaml.SequenceNode {
+		nodes = seq.Content
+	}
+	if len(nodes) != count {
+		return nil
+	}
+	return nodes
+}
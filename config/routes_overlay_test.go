@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRouteFiles writes files relative to a temporary directory and
+// returns it
+func writeRouteFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const overlayBase = `defaults: &orders
+  service: auth
+  methods: [GET]
+routes:
+  - path: /api/v1/orders
+    service: auth
+    methods: [GET]
+    rateLimit: {requestsPerSec: 100, burstSize: 200}
+    timeout: 10s
+  - path: /api/v1/orders
+    service: auth
+    methods: [POST]
+    timeout: 10s
+  - <<: *orders
+    path: /api/v1/carts
+`
+
+func TestLoadRoutesOverlay(t *testing.T) {
+	dir := writeRouteFiles(t, map[string]string{
+		"routes.yaml": overlayBase,
+		"routes.prod.yaml": `routes:
+  - path: /api/v1/orders
+    methods: [GET]
+    rateLimit: {requestsPerSec: 10}
+  - path: /api/v1/carts
+    timeout: 2s
+`,
+		"routes.prod.json":    `{"routes": [{"path": "/api/v1/orders", "timeout": "5s"}]}`,
+		"routes.staging.yaml": "routes:\n  - path: /debug\n    service: auth\n    methods: [GET]\n",
+	})
+	path := filepath.Join(dir, "routes.yaml")
+
+	routes, err := LoadRoutes(path, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byMethod := make(map[string]Route)
+	for _, route := range routes.Routes {
+		byMethod[route.Path+" "+strings.Join(route.Methods, ",")] = route
+	}
+	if len(routes.Routes) != 3 {
+		t.Fatalf("routes = %+v", routes.Routes)
+	}
+	get := byMethod["/api/v1/orders GET"]
+	if get.RateLimit == nil || get.RateLimit.RequestsPerSec != 10 || get.RateLimit.BurstSize != 200 || get.Timeout != "5s" || get.Service != "auth" {
+		t.Errorf("GET route = %+v", get)
+	}
+	if post := byMethod["/api/v1/orders POST"]; post.Timeout != "5s" || post.RateLimit != nil {
+		t.Errorf("POST route = %+v", post)
+	}
+	// A route written with aliases is merged too
+	if carts := byMethod["/api/v1/carts GET"]; carts.Timeout != "2s" || carts.Service != "auth" {
+		t.Errorf("carts route = %+v", carts)
+	}
+
+	staging, err := LoadRoutes(path, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staging.Routes) != 4 || staging.Routes[3].Path != "/debug" {
+		t.Errorf("staging routes = %+v", staging.Routes)
+	}
+
+	if _, err := LoadRoutes(path, "../prod"); err == nil {
+		t.Error("invalid environment accepted")
+	}
+}
+
+func TestCheckRoutesOverlay(t *testing.T) {
+	dir := writeRouteFiles(t, map[string]string{
+		"routes.yaml": overlayBase,
+		"routes.prod.yaml": `routes:
+  - path: /api/v1/orders
+    methods: [POST]
+    timeout: soon
+  - path: /api/v1/reports
+    service: reports
+    methods: [GET]
+`,
+	})
+
+	problems, err := CheckRoutes(filepath.Join(dir, "routes.yaml"), "prod", []string{"auth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v", problems)
+	}
+	for i, want := range []struct {
+		line    int
+		message string
+	}{
+		{4, "timeout must be a positive duration"},
+		{6, `unknown service "reports"`},
+	} {
+		p := problems[i]
+		if filepath.Base(p.File) != "routes.prod.yaml" || p.Line != want.line || !strings.Contains(p.Message, want.message) {
+			t.Errorf("problem %d = %s, want line %d %q", i, p, want.line, want.message)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import "strings"
+
+// MatchPath reports whether a request path is the route path or below it.
+// Route path segments written as :name match any single non-empty segment;
+// their values are returned by name.
+func MatchPath(routePath, path string) (map[string]string, bool) {
+	if !HasPathParams(routePath) {
+		if path == routePath || strings.HasPrefix(path, strings.TrimSuffix(routePath, "/")+"/") {
+			return nil, true
+		}
+		return nil, false
+	}
+
+	pattern, segments := pathSegments(routePath), pathSegments(path)
+	if len(segments) < len(pattern) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, seg := range pattern {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[name] = segments[i]
+		} else if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// MatchedPrefix returns the part of path matched by the route path, which
+// MatchPath must have accepted
+func MatchedPrefix(routePath, path string) string {
+	if !HasPathParams(routePath) {
+		return routePath
+	}
+	n := len(pathSegments(routePath))
+	return "/" + strings.Join(pathSegments(path)[:n], "/")
+}
+
+// HasPathParams reports whether the route path has :name segments
+func HasPathParams(routePath string) bool {
+	return strings.Contains(routePath, "/:")
+}
+
+// pathSegments splits a path into its segments
+func pathSegments(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// pathTemplate replaces parameter names so paths differing only in them compare equal
+func pathTemplate(routePath string) string {
+	segments := pathSegments(routePath)
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") {
+			segments[i] = ":"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
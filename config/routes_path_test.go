@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		route, path string
+		ok          bool
+		id          string
+	}{
+		{"/api/v1/users", "/api/v1/users/42", true, ""},
+		{"/api/v1/users", "/api/v1/usersx", false, ""},
+		{"/api/v1/users/:id/notifications", "/api/v1/users/42/notifications", true, "42"},
+		{"/api/v1/users/:id/notifications", "/api/v1/users/42/notifications/7", true, "42"},
+		{"/api/v1/users/:id/notifications", "/api/v1/users/42/settings", false, ""},
+		{"/api/v1/users/:id/notifications", "/api/v1/users//notifications", false, ""},
+		{"/api/v1/users/:id", "/api/v1/users", false, ""},
+	}
+	for _, tt := range tests {
+		params, ok := MatchPath(tt.route, tt.path)
+		if ok != tt.ok || params["id"] != tt.id {
+			t.Errorf("MatchPath(%s, %s) = %v, %v", tt.route, tt.path, params, ok)
+		}
+	}
+
+	if got := MatchedPrefix("/api/v1/users/:id", "/api/v1/users/42/avatar"); got != "/api/v1/users/42" {
+		t.Errorf("MatchedPrefix = %s", got)
+	}
+}
+
+func TestSortPathParams(t *testing.T) {
+	routes := &RouteConfig{Routes: []Route{
+		{Path: "/users/:id", Service: "users", Methods: []string{"GET"}},
+		{Path: "/users/me", Service: "profile", Methods: []string{"GET"}},
+		{Path: "/users/:userId", Service: "legacy", Methods: []string{"GET"}},
+	}}
+	routes.Sort()
+
+	if routes.Routes[0].Path != "/users/me" {
+		t.Fatalf("literal segment should sort first, got %s", routes.Routes[0].Path)
+	}
+	if err := routes.Validate(); err == nil {
+		t.Fatal("expected routes differing only in parameter names to be ambiguous")
+	}
+}
+
+func TestValidatePathRegex(t *testing.T) {
+	valid := &RouteConfig{Routes: []Route{
+		{PathRegex: `^/api/v1/(users|accounts)/\d+$`, Service: "auth", Methods: []string{"GET"}},
+		{Path: "/api/v1/users", Service: "auth", Methods: []string{"GET"}},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	for _, route := range []Route{
+		{PathRegex: `^/api/(`, Service: "auth"},
+		{Path: "/api", PathRegex: `^/api$`, Service: "auth"},
+		{PathRegex: `^/api/v1/users/\d+$`, Service: "auth", StripPrefix: true},
+	} {
+		rc := &RouteConfig{Routes: []Route{route}}
+		if err := rc.Validate(); err == nil {
+			t.Errorf("expected %+v to fail validation", route)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RouteVersion is the settings of one API version of a versioned route
+type RouteVersion struct {
+	// Service serves the version instead of the route's service (and
+	// readService)
+	Service string `yaml:"service,omitempty"`
+	// Rewrite reshapes the version's upstream path, e.g. to drop or rename
+	// the version segment
+	Rewrite *RewriteConfig `yaml:"rewrite,omitempty"`
+	// Deprecated, SunsetDate and SuccessorLink announce the version's
+	// retirement like the route settings of the same name
+	Deprecated    bool   `yaml:"deprecated,omitempty"`
+	SunsetDate    string `yaml:"sunsetDate,omitempty"`
+	SuccessorLink string `yaml:"successorLink,omitempty"`
+}
+
+// versionName is what a version may be named: a single path segment
+var versionName = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// ExpandVersions replaces each versioned route with a route per version,
+// in version name order: the route at <versionPrefix>/<version><path> with
+// the version's settings applied. Other routes are kept as they are.
+func ExpandVersions(routes []Route) []Route {
+	expanded := make([]Route, 0, len(routes))
+	for _, route := range routes {
+		if route.VersionPrefix == "" {
+			expanded = append(expanded, route)
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(route.Versions)) {
+			expanded = append(expanded, route.version(name))
+		}
+	}
+	return expanded
+}
+
+// version returns the route serving one of its versions
+func (r Route) version(name string) Route {
+	v := r.Versions[name]
+	route := r
+	route.VersionPrefix, route.Versions = "", nil
+
+	route.Path = strings.TrimSuffix(r.VersionPrefix, "/") + "/" + name
+	if r.Path != "/" {
+		route.Path += r.Path
+	}
+	if v.Service != "" {
+		route.Service, route.ReadService = v.Service, ""
+	}
+	if v.Rewrite != nil {
+		route.Rewrite = v.Rewrite
+	}
+	if v.Deprecated {
+		route.Deprecated = true
+	}
+	if v.SunsetDate != "" {
+		route.SunsetDate = v.SunsetDate
+	}
+	if v.SuccessorLink != "" {
+		route.SuccessorLink = v.SuccessorLink
+	}
+	return route
+}
+
+// checkVersions returns the invalid version settings of a versioned route
+func (r Route) checkVersions() []routeError {
+	var errs []routeError
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, routeError{route: r, field: field, err: fmt.Errorf(format, args...)})
+	}
+
+	if r.VersionPrefix == "" {
+		fail("versions", "versions need a versionPrefix")
+		return errs
+	}
+	if !strings.HasPrefix(r.VersionPrefix, "/") {
+		fail("versionPrefix", "versionPrefix must start with /")
+	}
+	if r.PathRegex != "" {
+		fail("versionPrefix", "versionPrefix needs a path, not a pathRegex")
+	}
+	if r.Path != "" && !strings.HasPrefix(r.Path, "/") {
+		fail("path", "the path of a versioned route must start with /")
+	}
+	if len(r.Versions) == 0 {
+		fail("versionPrefix", "versionPrefix needs versions")
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Versions)) {
+		v := r.Versions[name]
+		if !versionName.MatchString(name) {
+			fail("versions."+name, "version %q must be a single path segment", name)
+		}
+		if v.Rewrite != nil {
+			if _, err := regexp.Compile(v.Rewrite.Pattern); err != nil {
+				fail("versions."+name+".rewrite.pattern", "version %s: invalid rewrite pattern: %w", name, err)
+			}
+		}
+		if _, ok := (Route{SunsetDate: v.SunsetDate}).Sunset(); v.SunsetDate != "" && !ok {
+			fail("versions."+name+".sunsetDate", "version %s: sunsetDate must be a date (2006-01-02) or RFC 3339 time", name)
+		}
+	}
+	return errs
+}
+
+// versionsHaveServices reports whether every version of a versioned route
+// has its own service, so the route needs none
+func (r Route) versionsHaveServices() bool {
+	if len(r.Versions) == 0 {
+		return false
+	}
+	for _, v := range r.Versions {
+		if v.Service == "" {
+			return false
+		}
+	}
+	return true
+}
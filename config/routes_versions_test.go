@@ -0,0 +1,77 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const versionedRoutes = `routes:
+  - path: /notifications
+    versionPrefix: /api
+    service: notifier
+    readService: notifier-read
+    methods: [GET, POST]
+    timeout: 5s
+    versions:
+      v1:
+        deprecated: true
+        sunsetDate: 2027-01-01
+        successorLink: /api/v2/notifications
+      v2:
+        service: notifications
+        rewrite: {pattern: "^/api/v2", target: ""}
+`
+
+func TestExpandVersions(t *testing.T) {
+	routes, err := ParseRoutes([]RouteDocument{{Name: "routes.yaml", Format: "yaml", Data: []byte(versionedRoutes)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes.Routes) != 2 {
+		t.Fatalf("routes = %+v", routes.Routes)
+	}
+	v1, v2 := routes.Routes[0], routes.Routes[1]
+	if v1.Path != "/api/v1/notifications" || v1.Service != "notifier" || v1.ReadService != "notifier-read" ||
+		!v1.Deprecated || v1.SunsetDate != "2027-01-01" || v1.Rewrite != nil || v1.Versions != nil {
+		t.Errorf("v1 = %+v", v1)
+	}
+	if v2.Path != "/api/v2/notifications" || v2.Service != "notifications" || v2.ReadService != "" ||
+		v2.Deprecated || v2.Rewrite == nil || v2.Timeout != "5s" {
+		t.Errorf("v2 = %+v", v2)
+	}
+
+	root := ExpandVersions([]Route{{Path: "/", VersionPrefix: "/api/", Versions: map[string]RouteVersion{"v3": {}}}})
+	if len(root) != 1 || root[0].Path != "/api/v3" {
+		t.Errorf("root = %+v", root)
+	}
+
+	for _, bad := range []string{
+		strings.Replace(versionedRoutes, "v2:", "v2/beta:", 1),
+		strings.Replace(versionedRoutes, "versionPrefix: /api", "versionPrefix: api", 1),
+		strings.Replace(versionedRoutes, "sunsetDate: 2027-01-01", "sunsetDate: soon", 1),
+		"routes:\n  - path: /a\n    service: notifier\n    methods: [GET]\n    versions: {v1: {}}\n",
+	} {
+		if _, err := ParseRoutes([]RouteDocument{{Name: "routes.yaml", Format: "yaml", Data: []byte(bad)}}); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
+
+func TestCheckVersionedRoutes(t *testing.T) {
+	data := versionedRoutes + `  - path: /api/v2/notifications
+    service: notifier
+    methods: [GET]
+`
+	problems := CheckRouteDocuments([]RouteDocument{{Name: "routes.yaml", Format: "yaml", Data: []byte(data)}},
+		[]string{"notifier", "notifier-read"})
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v", problems)
+	}
+	if p := problems[0]; p.Line != 14 || !strings.Contains(p.Message, `version v2: unknown service "notifications"`) {
+		t.Errorf("service problem = %s", p)
+	}
+	// The plain route duplicates the v2 version, which is reported where it's declared
+	if p := problems[1]; p.Line != 16 || !strings.Contains(p.Message, "/api/v2/notifications") {
+		t.Errorf("conflict problem = %s", p)
+	}
+}
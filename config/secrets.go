@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider fetches secrets from a secret manager. ref is the
+// reference without its scheme and #field.
+type SecretProvider interface {
+	Fetch(ctx context.Context, ref string) (string, error)
+}
+
+// secretFetchTimeout bounds one fetch from a secret manager
+const secretFetchTimeout = 10 * time.Second
+
+// Secrets holds the configuration values read from secret managers.
+// Variables such as JWT_SECRET can hold a reference instead of the secret:
+//
+//	vault://secret/gateway#jwt_secret          (Vault KV v2: mount/path#field)
+//	awssm://gateway/prod#jwt_secret            (AWS Secrets Manager: id[#JSON field])
+//	gcpsm://my-project/gateway-jwt[/version]   (GCP Secret Manager[#JSON field])
+//
+// Refresh re-fetches them, so values read through Get follow rotations.
+type Secrets struct {
+	providers map[string]SecretProvider
+
+	mu sync.RWMutex
+	// refs are the references of the variables holding one
+	refs   map[string]string
+	values map[string]string
+	errs   []error
+}
+
+// NewSecrets resolves references with providers, by scheme
+func NewSecrets(providers map[string]SecretProvider) *Secrets {
+	return &Secrets{
+		providers: providers,
+		refs:      make(map[string]string),
+		values:    make(map[string]string),
+	}
+}
+
+// defaultSecretProviders are the secret managers configured by their
+// usual environment variables
+func defaultSecretProviders() map[string]SecretProvider {
+	client := &http.Client{Timeout: secretFetchTimeout}
+	return map[string]SecretProvider{
+		"vault": newVaultProvider(client),
+		"awssm": newAWSSecretsProvider(client),
+		"gcpsm": newGCPSecretsProvider(client),
+	}
+}
+
+// get returns the variable's value, fetching it when it is a reference. A
+// failed fetch is kept for err.
+func (s *Secrets) get(key, defaultValue string) string {
+	value := getEnv(key, defaultValue)
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok || s.providers[scheme] == nil {
+		return value
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	secret, err := s.fetch(ctx, value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", key, err))
+		return ""
+	}
+	s.refs[key] = value
+	s.values[key] = secret
+	return secret
+}
+
+// err returns the fetches get failed
+func (s *Secrets) err() error {
+	return errors.Join(s.errs...)
+}
+
+// fetch resolves a reference
+func (s *Secrets) fetch(ctx context.Context, ref string) (string, error) {
+	scheme, rest, _ := strings.Cut(ref, "://")
+	rest, field, _ := strings.Cut(rest, "#")
+	secret, err := s.providers[scheme].Fetch(ctx, rest)
+	if err != nil || field == "" {
+		return secret, err
+	}
+	return secretField(secret, field)
+}
+
+// secretField returns a field of a secret holding a JSON object
+func secretField(secret, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret isn't a JSON object with a %s field", field)
+	}
+	switch v := fields[field].(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", fmt.Errorf("secret has no %s field", field)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b), nil
+	}
+}
+
+// Get returns the current value of a variable read from a secret manager
+func (s *Secrets) Get(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+// Has reports whether a variable holds a secret manager reference
+func (s *Secrets) Has(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.refs[key]
+	return ok
+}
+
+// Keys returns the variables holding a secret manager reference
+func (s *Secrets) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Sorted(maps.Keys(s.refs))
+}
+
+// Refresh re-fetches the secrets and returns the variables whose value
+// changed. Secrets failing to fetch keep their value.
+func (s *Secrets) Refresh(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	refs := maps.Clone(s.refs)
+	s.mu.RUnlock()
+
+	var changed []string
+	var errs []error
+	for key, ref := range refs {
+		secret, err := s.fetch(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		s.mu.Lock()
+		if s.values[key] != secret {
+			s.values[key] = secret
+			changed = append(changed, key)
+		}
+		s.mu.Unlock()
+	}
+	return changed, errors.Join(errs...)
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// fetchSecretJSON sends a secret manager request and decodes its JSON
+// answer into out
+func fetchSecretJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// vaultProvider reads Vault KV v2 secrets (vault://mount/path#field) with
+// VAULT_TOKEN from VAULT_ADDR, in VAULT_NAMESPACE when set
+type vaultProvider struct {
+	client    *http.Client
+	addr      string
+	token     string
+	namespace string
+}
+
+func newVaultProvider(client *http.Client) *vaultProvider {
+	return &vaultProvider{
+		client:    client,
+		addr:      strings.TrimSuffix(getEnv("VAULT_ADDR", "https://127.0.0.1:8200"), "/"),
+		token:     getEnv("VAULT_TOKEN", ""),
+		namespace: getEnv("VAULT_NAMESPACE", ""),
+	}
+}
+
+// Fetch implements SecretProvider, returning the secret's fields as a
+// JSON object
+func (p *vaultProvider) Fetch(ctx context.Context, ref string) (string, error) {
+	mount, path, ok := strings.Cut(ref, "/")
+	if !ok || mount == "" || path == "" {
+		return "", fmt.Errorf("vault: %q isn't mount/path", ref)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+mount+"/data/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	var secret struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := fetchSecretJSON(p.client, req, &secret); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	return string(secret.Data.Data), nil
+}
+
+// awsSecretsProvider reads AWS Secrets Manager secrets (awssm://id) in
+// AWS_REGION with the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN credentials
+type awsSecretsProvider struct {
+	client       *http.Client
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	now          func() time.Time
+}
+
+func newAWSSecretsProvider(client *http.Client) *awsSecretsProvider {
+	region := getEnv("AWS_REGION", getEnv("AWS_DEFAULT_REGION", ""))
+	return &awsSecretsProvider{
+		client:       client,
+		endpoint:     getEnv("AWS_ENDPOINT_URL_SECRETS_MANAGER", getEnv("AWS_ENDPOINT_URL", "https://secretsmanager."+region+".amazonaws.com")),
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		now:          time.Now,
+	}
+}
+
+// Fetch implements SecretProvider
+func (p *awsSecretsProvider) Fetch(ctx context.Context, ref string) (string, error) {
+	if p.region == "" || p.accessKey == "" || p.secretKey == "" {
+		return "", errors.New("awssm: needs AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": ref})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, body)
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+	}
+	if err := fetchSecretJSON(p.client, req, &secret); err != nil {
+		return "", fmt.Errorf("awssm: %w", err)
+	}
+	if secret.SecretString == "" {
+		return string(secret.SecretBinary), nil
+	}
+	return secret.SecretString, nil
+}
+
+// sign adds an AWS Signature Version 4 to a request
+func (p *awsSecretsProvider) sign(req *http.Request, body []byte) {
+	now := p.now().UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.sessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if p.sessionToken != "" {
+		headers = []string{"content-type", "host", "x-amz-date", "x-amz-security-token", "x-amz-target"}
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + p.region + "/secretsmanager/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + p.secretKey)
+	for _, part := range []string{date, p.region, "secretsmanager", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpSecretsProvider reads GCP Secret Manager secrets
+// (gcpsm://project/secret[/version]) with the service account of the
+// instance, from the metadata server (GCE_METADATA_HOST)
+type gcpSecretsProvider struct {
+	client       *http.Client
+	endpoint     string
+	metadataHost string
+}
+
+func newGCPSecretsProvider(client *http.Client) *gcpSecretsProvider {
+	return &gcpSecretsProvider{
+		client:       client,
+		endpoint:     "https://secretmanager.googleapis.com",
+		metadataHost: getEnv("GCE_METADATA_HOST", "metadata.google.internal"),
+	}
+}
+
+// Fetch implements SecretProvider
+func (p *gcpSecretsProvider) Fetch(ctx context.Context, ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) == 2 {
+		parts = append(parts, "latest")
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("gcpsm: %q isn't project/secret[/version]", ref)
+	}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+p.metadataHost+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	tokenReq.Header.Set("Metadata-Flavor", "Google")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := fetchSecretJSON(p.client, tokenReq, &token); err != nil {
+		return "", fmt.Errorf("gcpsm: access token: %w", err)
+	}
+
+	path := fmt.Sprintf("/v1/projects/%s/secrets/%s/versions/%s:access",
+		url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(parts[2]))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := fetchSecretJSON(p.client, req, &secret); err != nil {
+		return "", fmt.Errorf("gcpsm: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("gcpsm: payload: %w", err)
+	}
+	return string(data), nil
+}
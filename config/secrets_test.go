@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mapProvider serves secrets from a map
+type mapProvider map[string]string
+
+func (p mapProvider) Fetch(_ context.Context, ref string) (string, error) {
+	secret, ok := p[ref]
+	if !ok {
+		return "", http.ErrMissingFile
+	}
+	return secret, nil
+}
+
+func TestSecrets(t *testing.T) {
+	provider := mapProvider{
+		"gateway/prod": `{"jwt_secret":"s3cret","redis":{"db":2}}`,
+		"redis":        "hunter2",
+	}
+	secrets := NewSecrets(map[string]SecretProvider{"test": provider})
+
+	t.Setenv("JWT_SECRET", "test://gateway/prod#jwt_secret")
+	t.Setenv("REDIS_PASSWORD", "test://redis")
+	t.Setenv("PLAIN", "not-a-reference")
+	t.Setenv("OTHER_SCHEME", "https://example.com")
+	for key, want := range map[string]string{
+		"JWT_SECRET":     "s3cret",
+		"REDIS_PASSWORD": "hunter2",
+		"PLAIN":          "not-a-reference",
+		"OTHER_SCHEME":   "https://example.com",
+	} {
+		if got := secrets.get(key, ""); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if err := secrets.err(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := secrets.Keys(); !slices.Equal(keys, []string{"JWT_SECRET", "REDIS_PASSWORD"}) {
+		t.Errorf("Keys() = %v", keys)
+	}
+
+	t.Setenv("MISSING", "test://gone")
+	t.Setenv("NO_FIELD", "test://gateway/prod#password")
+	secrets.get("MISSING", "")
+	secrets.get("NO_FIELD", "")
+	if err := secrets.err(); err == nil || !strings.Contains(err.Error(), "MISSING") || !strings.Contains(err.Error(), "NO_FIELD") {
+		t.Errorf("err() = %v, want both failed fetches", err)
+	}
+
+	// Rotation
+	provider["redis"] = "correct-horse"
+	changed, err := secrets.Refresh(context.Background())
+	if err != nil || !slices.Equal(changed, []string{"REDIS_PASSWORD"}) {
+		t.Fatalf("Refresh() = %v, %v", changed, err)
+	}
+	if got := secrets.Get("REDIS_PASSWORD"); got != "correct-horse" {
+		t.Errorf("rotated REDIS_PASSWORD = %q", got)
+	}
+
+	// A failed fetch keeps the value
+	delete(provider, "redis")
+	if _, err := secrets.Refresh(context.Background()); err == nil {
+		t.Error("failed refresh not reported")
+	}
+	if got := secrets.Get("REDIS_PASSWORD"); got != "correct-horse" {
+		t.Errorf("REDIS_PASSWORD after a failed refresh = %q", got)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/gateway" || r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"jwt_secret":"s3cret"},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	secrets := NewSecrets(map[string]SecretProvider{
+		"vault": &vaultProvider{client: server.Client(), addr: server.URL, token: "root"},
+	})
+	got, err := secrets.fetch(context.Background(), "vault://secret/gateway#jwt_secret")
+	if err != nil || got != "s3cret" {
+		t.Errorf("fetch = %q, %v", got, err)
+	}
+	if _, err := secrets.fetch(context.Background(), "vault://secret/other#jwt_secret"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("denied fetch = %v", err)
+	}
+}
+
+func TestAWSSecretsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		auth := r.Header.Get("Authorization")
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || body.SecretId != "gateway/prod" ||
+			!strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240102/eu-west-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature=") ||
+			r.Header.Get("X-Amz-Date") != "20240102T030405Z" || r.Header.Get("X-Amz-Security-Token") != "session" {
+			http.Error(w, `{"__type":"AccessDeniedException"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"Name":"gateway/prod","SecretString":"{\"jwt_secret\":\"s3cret\"}"}`))
+	}))
+	defer server.Close()
+
+	provider := &awsSecretsProvider{
+		client:       server.Client(),
+		endpoint:     server.URL,
+		region:       "eu-west-1",
+		accessKey:    "AKID",
+		secretKey:    "secret",
+		sessionToken: "session",
+		now:          func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	secrets := NewSecrets(map[string]SecretProvider{"awssm": provider})
+	got, err := secrets.fetch(context.Background(), "awssm://gateway/prod#jwt_secret")
+	if err != nil || got != "s3cret" {
+		t.Errorf("fetch = %q, %v", got, err)
+	}
+
+	provider.accessKey = ""
+	if _, err := secrets.fetch(context.Background(), "awssm://gateway/prod"); err == nil {
+		t.Error("fetch without credentials succeeded")
+	}
+}
+
+func TestGCPSecretsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token" && r.Header.Get("Metadata-Flavor") == "Google":
+			w.Write([]byte(`{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`))
+		case r.URL.Path == "/v1/projects/my-project/secrets/gateway-jwt/versions/latest:access" && r.Header.Get("Authorization") == "Bearer ya29.token":
+			data := base64.StdEncoding.EncodeToString([]byte("s3cret"))
+			w.Write([]byte(`{"name":"projects/1/secrets/gateway-jwt/versions/4","payload":{"data":"` + data + `"}}`))
+		default:
+			http.Error(w, `{"error":{"code":404}}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	secrets := NewSecrets(map[string]SecretProvider{
+		"gcpsm": &gcpSecretsProvider{
+			client:       server.Client(),
+			endpoint:     server.URL,
+			metadataHost: strings.TrimPrefix(server.URL, "http://"),
+		},
+	})
+	got, err := secrets.fetch(context.Background(), "gcpsm://my-project/gateway-jwt")
+	if err != nil || got != "s3cret" {
+		t.Errorf("fetch = %q, %v", got, err)
+	}
+	if _, err := secrets.fetch(context.Background(), "gcpsm://my-project/gateway-jwt/1"); err == nil {
+		t.Error("missing version fetched")
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SigningClientsConfig lists the machine clients allowed to sign requests
+type SigningClientsConfig struct {
+	Clients []SigningClient `yaml:"clients"`
+}
+
+// SigningClient is a caller of signature routes and the secret it signs
+// requests with. Secret may reference environment variables as ${VAR} to
+// keep it out of the file.
+type SigningClient struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+// LoadSigningClients loads the signing clients. A missing file means no
+// clients, so signature routes reject every request.
+func LoadSigningClients(path string) (*SigningClientsConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &SigningClientsConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg SigningClientsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i, client := range cfg.Clients {
+		if client.ID == "" {
+			return nil, fmt.Errorf("signing client requires id")
+		}
+		if seen[client.ID] {
+			return nil, fmt.Errorf("signing client %s: duplicate id", client.ID)
+		}
+		seen[client.ID] = true
+		cfg.Clients[i].Secret = os.ExpandEnv(client.Secret)
+		if cfg.Clients[i].Secret == "" {
+			return nil, fmt.Errorf("signing client %s: empty secret", client.ID)
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyntheticsConfig lists synthetic transaction checks
+type SyntheticsConfig struct {
+	Checks []SyntheticCheck `yaml:"checks"`
+}
+
+// SyntheticCheck is a real request sent to a service on an interval (e.g. a
+// canary login) whose status and latency are evaluated, so a service that is
+// up but slow can be told apart from one that is down. Headers and Body may
+// reference environment variables as ${VAR} to keep credentials out of the file.
+type SyntheticCheck struct {
+	Name    string            `yaml:"name"`
+	Service string            `yaml:"service"`
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	// Interval between runs, Timeout per run, and MaxLatency above which a
+	// successful run counts as slow
+	Interval   string `yaml:"interval"`
+	Timeout    string `yaml:"timeout"`
+	MaxLatency string `yaml:"maxLatency"`
+	// ExpectStatus is the required response status (default: any 2xx)
+	ExpectStatus int `yaml:"expectStatus,omitempty"`
+}
+
+// LoadSynthetics loads synthetic checks. A missing file means no checks.
+func LoadSynthetics(path string) (*SyntheticsConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &SyntheticsConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg SyntheticsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	for _, check := range cfg.Checks {
+		if check.Name == "" || check.Service == "" || check.Path == "" {
+			return nil, fmt.Errorf("synthetic check requires name, service and path")
+		}
+		for field, value := range map[string]string{
+			"interval":   check.Interval,
+			"timeout":    check.Timeout,
+			"maxLatency": check.MaxLatency,
+		} {
+			if _, err := time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("synthetic check %s: invalid %s: %w", check.Name, field, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TenantsConfig is the registry of tenants with their own identity provider
+type TenantsConfig struct {
+	Tenants []Tenant `yaml:"tenants"`
+}
+
+// Tenant is how the access tokens of a tenant are verified. Requests are
+// matched to it by their subdomain, else by their token's iss.
+type Tenant struct {
+	ID string `yaml:"id"`
+	// Subdomain is the first label of the tenant's hosts (acme in
+	// acme.example.com); defaults to the ID
+	Subdomain string `yaml:"subdomain"`
+	// Issuer is the tenant's only accepted iss value
+	Issuer string `yaml:"issuer"`
+	// Discovery reads the key set and algorithms from the issuer's OpenID
+	// Connect configuration
+	Discovery bool `yaml:"discovery"`
+	// JWKSURL is the key set of RSA and ECDSA-signed tokens
+	JWKSURL string `yaml:"jwksUrl"`
+	// Secret verifies HMAC-signed tokens. It may reference environment
+	// variables as ${VAR} to keep it out of the file.
+	Secret string `yaml:"secret"`
+	// Algorithms are the accepted alg values; by default those of the
+	// provider with discovery, RS256 and ES256 with a JWKS URL, else the
+	// HMAC ones
+	Algorithms []string `yaml:"algorithms"`
+	Audiences  []string `yaml:"audiences"`
+}
+
+// LoadTenants loads the tenant registry. A missing file means no tenants,
+// so every token is verified with the JWT_* settings.
+func LoadTenants(path string) (*TenantsConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &TenantsConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg TenantsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	subdomains := make(map[string]string)
+	issuers := make(map[string]string)
+	for i := range cfg.Tenants {
+		tenant := &cfg.Tenants[i]
+		if tenant.ID == "" {
+			return nil, fmt.Errorf("tenant requires id")
+		}
+		if ids[tenant.ID] {
+			return nil, fmt.Errorf("tenant %s: duplicate id", tenant.ID)
+		}
+		ids[tenant.ID] = true
+
+		if tenant.Subdomain == "" {
+			tenant.Subdomain = tenant.ID
+		}
+		if other, ok := subdomains[tenant.Subdomain]; ok {
+			return nil, fmt.Errorf("tenant %s: subdomain %s already belongs to tenant %s", tenant.ID, tenant.Subdomain, other)
+		}
+		subdomains[tenant.Subdomain] = tenant.ID
+
+		if tenant.Issuer == "" {
+			return nil, fmt.Errorf("tenant %s: issuer required", tenant.ID)
+		}
+		if other, ok := issuers[tenant.Issuer]; ok {
+			return nil, fmt.Errorf("tenant %s: issuer %s already belongs to tenant %s", tenant.ID, tenant.Issuer, other)
+		}
+		issuers[tenant.Issuer] = tenant.ID
+
+		tenant.Secret = os.ExpandEnv(tenant.Secret)
+		if !tenant.Discovery && tenant.JWKSURL == "" && tenant.Secret == "" {
+			return nil, fmt.Errorf("tenant %s: needs discovery, a jwksUrl or a secret", tenant.ID)
+		}
+		if len(tenant.Algorithms) == 0 {
+			switch {
+			case tenant.JWKSURL != "":
+				tenant.Algorithms = []string{"RS256", "ES256"}
+			case !tenant.Discovery:
+				tenant.Algorithms = []string{"HS256", "HS384", "HS512"}
+			}
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadTenants(t *testing.T) {
+	load := func(yaml string) (*TenantsConfig, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "tenants.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadTenants(path)
+	}
+
+	t.Setenv("ACME_JWT_SECRET", "s3cret")
+	cfg, err := load(`
+tenants:
+  - id: acme
+    issuer: acme-auth
+    secret: ${ACME_JWT_SECRET}
+  - id: globex
+    subdomain: globex-corp
+    issuer: https://auth.globex.example.com
+    jwksUrl: https://auth.globex.example.com/keys
+  - id: initech
+    issuer: https://initech.okta.com
+    discovery: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme, globex, initech := cfg.Tenants[0], cfg.Tenants[1], cfg.Tenants[2]
+	if acme.Subdomain != "acme" || acme.Secret != "s3cret" || !slices.Equal(acme.Algorithms, []string{"HS256", "HS384", "HS512"}) {
+		t.Errorf("acme = %+v", acme)
+	}
+	if globex.Subdomain != "globex-corp" || !slices.Equal(globex.Algorithms, []string{"RS256", "ES256"}) {
+		t.Errorf("globex = %+v", globex)
+	}
+	if initech.Algorithms != nil {
+		t.Errorf("initech algorithms = %v, want the provider's", initech.Algorithms)
+	}
+
+	for yaml, want := range map[string]string{
+		"tenants: [{issuer: a, secret: s}]":                                                     "requires id",
+		"tenants: [{id: a, secret: s}]":                                                         "issuer required",
+		"tenants: [{id: a, issuer: a}]":                                                         "needs discovery",
+		"tenants: [{id: a, issuer: a, secret: s}, {id: a, issuer: b, secret: s}]":               "duplicate id",
+		"tenants: [{id: a, issuer: x, secret: s}, {id: b, issuer: x, secret: s}]":               "issuer x already belongs",
+		"tenants: [{id: a, issuer: a, secret: s}, {id: b, subdomain: a, issuer: b, secret: s}]": "subdomain a already belongs",
+	} {
+		if _, err := load(yaml); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", yaml, err, want)
+		}
+	}
+
+	if cfg, err := LoadTenants(filepath.Join(t.TempDir(), "missing.yaml")); err != nil || len(cfg.Tenants) != 0 {
+		t.Errorf("missing file = %v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,463 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseTOML parses a TOML document into a YAML node tree, so TOML route
+// files decode through the same yaml tags and report problems at the same
+// kind of locations as YAML ones.
+//
+// It covers what route files use: tables, arrays of tables, dotted and
+// quoted keys, strings, integers, floats, booleans, arrays and inline
+// tables. Dates and times are kept as strings.
+func parseTOML(data []byte) (*yaml.Node, error) {
+	p := &tomlParser{src: []rune(string(data)), line: 1, col: 1}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	table := root
+	// defined holds the tables opened by a [header], which may appear once
+	defined := make(map[*yaml.Node]bool)
+
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			break
+		}
+
+		if p.peek() == '[' {
+			line := p.line
+			array := p.peekAt(1) == '['
+			p.next()
+			if array {
+				p.next()
+			}
+			p.skipBlank(false)
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			for _, r := range closing {
+				if p.peek() != r {
+					return nil, p.errorf("expected %s", closing)
+				}
+				p.next()
+			}
+			if table, err = openTable(root, keys, array); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if !array {
+				if defined[table] {
+					return nil, fmt.Errorf("line %d: table %s is already defined", line, keys[len(keys)-1].Value)
+				}
+				defined[table] = true
+			}
+		} else {
+			line := p.line
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			if p.peek() != '=' {
+				return nil, p.errorf("expected = after key")
+			}
+			p.next()
+			p.skipBlank(false)
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := setKey(table, keys, value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		p.skipBlank(false)
+		if !p.eof() && p.peek() != '\n' {
+			return nil, p.errorf("expected end of line")
+		}
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Column: 1, Content: []*yaml.Node{root}}, nil
+}
+
+// tomlParser reads a TOML document, tracking the position for nodes and errors
+type tomlParser struct {
+	src       []rune
+	pos       int
+	line, col int
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() rune {
+	return p.peekAt(0)
+}
+
+func (p *tomlParser) peekAt(offset int) rune {
+	if p.pos+offset >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+offset]
+}
+
+func (p *tomlParser) next() rune {
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line, p.col = p.line+1, 1
+	} else {
+		p.col++
+	}
+	return r
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips spaces, tabs, carriage returns and comments, and newlines
+// too when newlines is set
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.next()
+		case '\n':
+			if !newlines {
+				return
+			}
+			p.next()
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// key reads a possibly dotted key into scalar nodes
+func (p *tomlParser) key() ([]*yaml.Node, error) {
+	var keys []*yaml.Node
+	for {
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Line: p.line, Column: p.col}
+		switch r := p.peek(); {
+		case r == '"' || r == '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			node.Value = s
+		case isBareKeyRune(r):
+			start := p.pos
+			for !p.eof() && isBareKeyRune(p.peek()) {
+				p.next()
+			}
+			node.Value = string(p.src[start:p.pos])
+		default:
+			return nil, p.errorf("expected a key")
+		}
+		keys = append(keys, node)
+
+		p.skipBlank(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.next()
+		p.skipBlank(false)
+	}
+}
+
+func isBareKeyRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-'
+}
+
+var (
+	tomlInteger = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlFloat   = regexp.MustCompile(`^[+-]?([0-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$|^[+-]?(inf|nan)$`)
+	tomlDate    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?$|^\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+)
+
+// value reads a value into a node
+func (p *tomlParser) value() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: p.line, Column: p.col}
+
+	switch p.peek() {
+	case '"', '\'':
+		s, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		node.Tag, node.Value, node.Style = "!!str", s, yaml.DoubleQuotedStyle
+		return node, nil
+	case '[':
+		return p.array(node)
+	case '{':
+		return p.inlineTable(node)
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", p.peek()) {
+		p.next()
+	}
+	token := string(p.src[start:p.pos])
+	switch {
+	case token == "true" || token == "false":
+		node.Tag, node.Value = "!!bool", token
+	case tomlInteger.MatchString(token):
+		node.Tag, node.Value = "!!int", strings.ReplaceAll(token, "_", "")
+	case tomlFloat.MatchString(token):
+		node.Tag, node.Value = "!!float", strings.NewReplacer("_", "", "inf", ".inf", "nan", ".nan").Replace(token)
+	case tomlDate.MatchString(token):
+		node.Tag, node.Value = "!!str", token
+	default:
+		return nil, fmt.Errorf("line %d: invalid value %q", node.Line, token)
+	}
+	return node, nil
+}
+
+// array reads [a, b, ...], which may span lines
+func (p *tomlParser) array(node *yaml.Node) (*yaml.Node, error) {
+	node.Kind, node.Tag, node.Style = yaml.SequenceNode, "!!seq", yaml.FlowStyle
+	p.next()
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.next()
+			return node, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, item)
+
+		p.skipBlank(true)
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable reads {key = value, ...} on one line
+func (p *tomlParser) inlineTable(node *yaml.Node) (*yaml.Node, error) {
+	node.Kind, node.Tag, node.Style = yaml.MappingNode, "!!map", yaml.FlowStyle
+	p.next()
+	p.skipBlank(false)
+	if p.peek() == '}' {
+		p.next()
+		return node, nil
+	}
+	for {
+		line := p.line
+		keys, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.peek() != '=' {
+			return nil, p.errorf("expected = after key")
+		}
+		p.next()
+		p.skipBlank(false)
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := setKey(node, keys, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		p.skipBlank(false)
+		switch p.peek() {
+		case ',':
+			p.next()
+			p.skipBlank(false)
+		case '}':
+			p.next()
+			return node, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// str reads a basic ("..."), literal ('...') or multi-line string
+func (p *tomlParser) str() (string, error) {
+	quote := p.next()
+	multiline := p.peek() == quote && p.peekAt(1) == quote
+	if multiline {
+		p.next()
+		p.next()
+		// A newline right after the opening quotes is trimmed
+		if p.peek() == '\r' && p.peekAt(1) == '\n' {
+			p.next()
+		}
+		if p.peek() == '\n' {
+			p.next()
+		}
+	} else if p.peek() == quote {
+		p.next()
+		return "", nil
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		r := p.peek()
+		switch {
+		case r == quote && (!multiline || p.peekAt(1) == quote && p.peekAt(2) == quote):
+			n := 1
+			if multiline {
+				n = 3
+			}
+			for range n {
+				p.next()
+			}
+			return b.String(), nil
+		case r == '\n' && !multiline:
+			return "", p.errorf("unterminated string")
+		case r == '\\' && quote == '"':
+			p.next()
+			if err := p.escape(&b, multiline); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteRune(p.next())
+		}
+	}
+}
+
+// escape decodes the escape sequence after a backslash in a basic string
+func (p *tomlParser) escape(b *strings.Builder, multiline bool) error {
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	r := p.next()
+	switch r {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteRune(r)
+	case 'u', 'U':
+		n := 4
+		if r == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(string(p.src[p.pos:p.pos+n]), 16, 32)
+		if err != nil {
+			return p.errorf("invalid unicode escape")
+		}
+		for range n {
+			p.next()
+		}
+		b.WriteRune(rune(code))
+	case ' ', '\t', '\r', '\n':
+		// A line-ending backslash trims the following whitespace
+		if !multiline {
+			return p.errorf("invalid escape")
+		}
+		for !p.eof() && strings.ContainsRune(" \t\r\n", p.peek()) {
+			p.next()
+		}
+	default:
+		return p.errorf("invalid escape \\%c", r)
+	}
+	return nil
+}
+
+// openTable returns the table a [header] or [[header]] selects, creating it
+func openTable(root *yaml.Node, keys []*yaml.Node, array bool) (*yaml.Node, error) {
+	node := root
+	for i, key := range keys {
+		last := i == len(keys)-1
+		existing := mappingValue(node, key.Value)
+		if existing == nil {
+			existing = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+			if last && array {
+				existing.Kind, existing.Tag = yaml.SequenceNode, "!!seq"
+			}
+			node.Content = append(node.Content, key, existing)
+		}
+
+		switch {
+		case existing.Kind == yaml.SequenceNode && last && array:
+			table := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+			existing.Content = append(existing.Content, table)
+			node = table
+		case existing.Kind == yaml.SequenceNode && !last && len(existing.Content) > 0:
+			// Sub-tables of an array of tables belong to its last element
+			node = existing.Content[len(existing.Content)-1]
+			if node.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("key %s is not a table", key.Value)
+			}
+		case existing.Kind == yaml.MappingNode && !(last && array):
+			node = existing
+		default:
+			return nil, fmt.Errorf("key %s is already defined", key.Value)
+		}
+	}
+	return node, nil
+}
+
+// setKey assigns value to a possibly dotted key within table
+func setKey(table *yaml.Node, keys []*yaml.Node, value *yaml.Node) error {
+	for _, key := range keys[:len(keys)-1] {
+		existing := mappingValue(table, key.Value)
+		if existing == nil {
+			existing = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+			table.Content = append(table.Content, key, existing)
+		} else if existing.Kind != yaml.MappingNode {
+			return fmt.Errorf("key %s is not a table", key.Value)
+		}
+		table = existing
+	}
+
+	key := keys[len(keys)-1]
+	if mappingValue(table, key.Value) != nil {
+		return fmt.Errorf("key %s is already defined", key.Value)
+	}
+	table.Content = append(table.Content, key, value)
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
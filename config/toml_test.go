@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestParseTOMLRoutes(t *testing.T) {
+	data := []byte(`# Orders
+[[routes]]
+path = "/api/v1/orders"
+service = 'orders'
+methods = ["GET", "POST",]
+priority = 10
+updated = 2024-05-01T10:00:00Z
+
+[routes.cache]
+enabled = true
+ttl = "30s"
+
+[[routes]]
+path = """/api/v1/\
+carts"""
+service = "orders"
+rateLimit = { requestsPerSec = 5, burstSize = 10 }
+`)
+	node, err := parseTOML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rc RouteConfig
+	if err := node.Decode(&rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Routes) != 2 {
+		t.Fatalf("got %d routes", len(rc.Routes))
+	}
+
+	orders := rc.Routes[0]
+	if orders.Path != "/api/v1/orders" || orders.Service != "orders" || len(orders.Methods) != 2 || orders.Priority != 10 {
+		t.Errorf("unexpected route %+v", orders)
+	}
+	if orders.Cache == nil || !orders.Cache.Enabled || orders.Cache.TTL != "30s" {
+		t.Errorf("unexpected cache %+v", orders.Cache)
+	}
+	carts := rc.Routes[1]
+	if carts.Path != "/api/v1/carts" || carts.RateLimit == nil || carts.RateLimit.BurstSize != 10 {
+		t.Errorf("unexpected route %+v", carts)
+	}
+
+	// Lines are kept for validation problems
+	if path := mappingValue(node.Content[0], "routes").Content[1]; path.Line != 13 {
+		t.Errorf("second route at line %d", path.Line)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, data := range []string{
+		"path = \"/a\"\npath = \"/b\"\n",
+		"[routes]\n[routes]\n",
+		"path = \"/a\n",
+		"path = \n",
+		"routes = [1, 2\n",
+	} {
+		if _, err := parseTOML([]byte(data)); err == nil {
+			t.Errorf("parseTOML(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is an issue CheckRoutes found in a route file
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	// Warning marks problems that don't stop the routes from loading
+	Warning bool
+}
+
+func (p Problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("%s:%d:%d: warning: %s", p.File, p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// routeMethods are the methods the router registers routes for
+var routeMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+
+// CheckRoutes validates the route files for path and their overlays for env
+// like LoadRoutes, but reports every problem with its location instead of
+// stopping at the first (see CheckRouteDocuments). The error is for route
+// files that can't be listed or read.
+func CheckRoutes(path, env string, services []string) ([]Problem, error) {
+	files, err := RouteFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	overlays, err := RouteOverlays(path, env)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]RouteDocument, 0, len(files)+len(overlays))
+	for _, file := range append(files, overlays...) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, RouteDocument{
+			Name:    file,
+			Format:  RouteFormat(file),
+			Data:    data,
+			Overlay: slices.Contains(overlays, file),
+		})
+	}
+	return CheckRouteDocuments(docs, services), nil
+}
+
+// CheckRouteDocuments validates route documents like ParseRoutes, but
+// reports every problem with its document and location instead of stopping
+// at the first. It also checks what loading tolerates: unknown services,
+// unsupported methods and unparsable timeouts, and lists shadowed routes as
+// warnings.
+func CheckRouteDocuments(docs []RouteDocument, services []string) []Problem {
+	known := map[string]bool{"gateway": true}
+	for _, name := range services {
+		known[name] = true
+	}
+
+	var (
+		problems []Problem
+		all      RouteConfig
+		// locations holds each route's file and node, in the order of all
+		locations []routeLocation
+		// origins are the files of the settings overlays merged into routes
+		origins = make(map[*yaml.Node]string)
+		// fallbackAt is where the fallback in effect is declared
+		fallbackAt routeLocation
+	)
+	for _, doc := range docs {
+		file := doc.Name
+		rc, nodes, fallbackNode, fileProblems := parseRouteFile(doc.Format, doc.Data)
+		for _, problem := range fileProblems {
+			problem.File = file
+			problems = append(problems, problem)
+		}
+		if rc.Fallback != nil {
+			all.Fallback, fallbackAt = rc.Fallback, routeLocation{file: file, node: fallbackNode}
+		}
+		routes := rc.Routes
+
+		for i, route := range routes {
+			var targets []int
+			if doc.Overlay {
+				targets = overlayTargets(all.Routes, route)
+			}
+			if len(targets) == 0 {
+				all.Routes = append(all.Routes, route)
+				locations = append(locations, routeLocation{file: file, node: nodes[i]})
+				continue
+			}
+			if nodes[i].Kind != yaml.MappingNode {
+				problems = append(problems, Problem{File: file, Message: "overlay routes can't use anchors or aliases"})
+				continue
+			}
+			for _, t := range targets {
+				node, merged, err := overlayRoute(locations[t].node, all.Routes[t], nodes[i], func(n *yaml.Node) { origins[n] = file })
+				if err != nil {
+					problems = append(problems, Problem{File: file, Line: nodes[i].Line, Column: nodes[i].Column, Message: err.Error()})
+					continue
+				}
+				locations[t].node, all.Routes[t] = node, merged
+			}
+		}
+	}
+
+	for i, route := range all.Routes {
+		at := locations[i]
+		for _, e := range append(route.check(), route.lint(known)...) {
+			node, value := locateNode(at.node, e.field)
+			if node == nil {
+				node = at.node
+			}
+			// Settings from an overlay are reported where the overlay has them
+			file := at.file
+			if origin, ok := origins[value]; ok {
+				node, file = value, origin
+			} else if origin, ok := origins[node]; ok {
+				file = origin
+			}
+			problems = append(problems, Problem{File: file, Line: node.Line, Column: node.Column, Message: e.Error()})
+		}
+	}
+
+	if fb := all.Fallback; fb != nil {
+		errs := fb.checkFallback()
+		if fb.Service != "" && !known[fb.Service] {
+			errs = append(errs, routeError{route: *fb, field: "service", err: fmt.Errorf("unknown service %q", fb.Service), fallback: true})
+		}
+		for _, e := range errs {
+			node, _ := locateNode(fallbackAt.node, e.field)
+			if node == nil {
+				node = fallbackAt.node
+			}
+			problems = append(problems, Problem{File: fallbackAt.file, Line: node.Line, Column: node.Column, Message: e.Error()})
+		}
+	}
+
+	// Conflicts depend on matching order, so they are found in a sorted copy
+	// of the routes served, each version of a versioned route on its own;
+	// declared holds the index in all of each served route
+	var (
+		served   []Route
+		declared []int
+	)
+	for i, route := range all.Routes {
+		for _, r := range ExpandVersions([]Route{route}) {
+			served = append(served, r)
+			declared = append(declared, i)
+		}
+	}
+	sorted := &RouteConfig{Routes: slices.Clone(served)}
+	sorted.Sort()
+	for _, conflict := range sorted.Conflicts() {
+		at := locations[declared[lastIndex(served, conflict.Route)]]
+		problems = append(problems, Problem{
+			File:    at.file,
+			Line:    at.node.Line,
+			Column:  at.node.Column,
+			Message: conflict.String(),
+			Warning: !conflict.Ambiguous,
+		})
+	}
+
+	order := func(name string) int {
+		return slices.IndexFunc(docs, func(doc RouteDocument) bool { return doc.Name == name })
+	}
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		if a.File != b.File {
+			return order(a.File) - order(b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return problems
+}
+
+// routeLocation is where a route is declared
+type routeLocation struct {
+	file string
+	node *yaml.Node
+}
+
+// parseRouteFile parses one file and returns its routes with the node of
+// each, and the node of its fallback; routes that can't be told apart are
+// all at the document
+func parseRouteFile(format string, data []byte) (RouteConfig, []*yaml.Node, *yaml.Node, []Problem) {
+	var rc RouteConfig
+	doc, err := parseRouteData(format, data)
+	if err != nil {
+		return rc, nil, nil, yamlProblems(err)
+	}
+	if err := doc.Decode(&rc); err != nil {
+		return rc, nil, nil, yamlProblems(err)
+	}
+	fallback := lookupNode(doc, "fallback")
+	if fallback == nil || fallback.Kind != yaml.MappingNode {
+		fallback = doc
+	}
+
+	nodes := routeNodes(doc, len(rc.Routes))
+	if nodes == nil {
+		// Anchors or aliases; fall back to the document start
+		nodes = make([]*yaml.Node, len(rc.Routes))
+		for i := range nodes {
+			nodes[i] = doc
+		}
+	}
+	return rc, nodes, fallback, nil
+}
+
+// lint checks settings that loading tolerates but that leave the route
+// broken or ignored
+func (r Route) lint(services map[string]bool) []routeError {
+	var errs []routeError
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, routeError{route: r, field: field, err: fmt.Errorf(format, args...)})
+	}
+
+	if len(r.Methods) == 0 {
+		fail("methods", "no methods; the route is never served")
+	}
+	for i, method := range r.Methods {
+		if !slices.Contains(routeMethods, strings.ToUpper(method)) {
+			fail(fmt.Sprintf("methods.%d", i), "unsupported method %q (use %s)", method, strings.Join(routeMethods, ", "))
+		}
+	}
+
+	if r.MethodOverride && !slices.ContainsFunc(r.Methods, func(m string) bool {
+		return slices.Contains([]string{"PUT", "PATCH", "DELETE"}, strings.ToUpper(m))
+	}) {
+		fail("methodOverride", "methodOverride needs PUT, PATCH or DELETE in methods")
+	}
+	if r.Schema != "" && !slices.ContainsFunc(r.Methods, func(m string) bool {
+		return slices.Contains([]string{"POST", "PUT", "PATCH"}, strings.ToUpper(m))
+	}) {
+		fail("schema", "schema needs POST, PUT or PATCH in methods")
+	}
+
+	if r.Response == nil && r.Redirect == nil && !services[r.Service] && !r.versionsHaveServices() {
+		fail("service", "unknown service %q", r.Service)
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Versions)) {
+		if service := r.Versions[name].Service; service != "" && !services[service] {
+			fail("versions."+name+".service", "version %s: unknown service %q", name, service)
+		}
+	}
+	if r.ReadService != "" && !services[r.ReadService] {
+		fail("readService", "unknown service %q", r.ReadService)
+	}
+	if r.Experiment != nil {
+		for i, v := range r.Experiment.Variants {
+			if v.Service != "" && !services[v.Service] {
+				fail(fmt.Sprintf("experiment.variants.%d.service", i), "experiment %s: unknown service %q", r.Experiment.Name, v.Service)
+			}
+		}
+	}
+
+	if r.Timeout != "" {
+		if d, err := time.ParseDuration(r.Timeout); err != nil || d <= 0 {
+			fail("timeout", "timeout must be a positive duration")
+		}
+	}
+	if r.Retry != nil && r.Retry.WaitTime != "" {
+		if _, err := time.ParseDuration(r.Retry.WaitTime); err != nil {
+			fail("retry.waitTime", "retry waitTime must be a duration")
+		}
+	}
+	return errs
+}
+
+// lookupNode follows a dotted path of mapping keys and sequence indexes
+// (e.g. experiment.variants.0.service) from node and returns the value,
+// or nil when the path doesn't exist
+func lookupNode(node *yaml.Node, path string) *yaml.Node {
+	_, value := locateNode(node, path)
+	return value
+}
+
+// locateNode is lookupNode also returning where to report the setting: the
+// key of a mapping entry, or the deepest node found when the path ends early
+func locateNode(node *yaml.Node, path string) (at, value *yaml.Node) {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, part := range strings.Split(path, ".") {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == part {
+					at, next = node.Content[i], node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(part); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				at = next
+			}
+		}
+		if next == nil {
+			return at, nil
+		}
+		node = next
+	}
+	return at, node
+}
+
+// lastIndex returns the index of the last route equal to route. Equal
+// routes are only reported as duplicates, and the duplicate is the later one.
+func lastIndex(routes []Route, route Route) int {
+	for i := len(routes) - 1; i >= 0; i-- {
+		if reflect.DeepEqual(routes[i], route) {
+			return i
+		}
+	}
+	return 0
+}
+
+// yamlLine extracts the line number yaml.v3 puts in its error messages
+var yamlLine = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlProblems converts YAML syntax and type errors to problems
+func yamlProblems(err error) []Problem {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	problems := make([]Problem, 0, len(messages))
+	for _, message := range messages {
+		problem := Problem{Message: message}
+		if m := yamlLine.FindStringSubmatch(message); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			problem.Message = m[2]
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRoutes(t *testing.T) {
+	data := []byte(`routes:
+  - path: /api/v1/orders
+    service: auth
+    methods: [GET, FETCH]
+    timeout: soon
+  - path: /api/v1/orders
+    service: billing
+    methods: [GET]
+  - path: /api/v1/orders/export
+    service: auth
+    methods: [GET]
+    cache:
+      enabled: true
+      ttl: -1s
+  - pathRegex: "^/reports/(["
+    service: auth
+    methods: [GET]
+  - path: /api/v1
+    service: auth
+    methods: [GET]
+    priority: 10
+    methodOverride: true
+  - path: /api/v2
+    service: auth
+    methods: [GET]
+    prefixRewrite: internal
+    tags:
+      team: commerce
+      cost-center: cc-42
+    setResponseHeaders:
+      - {name: Cache-Control, value: no-store}
+      - {name: Content-Length, value: "0", mode: replace}
+  - path: /api/v3
+    service: auth
+    methods: [POST]
+    requiredRoles: [admin]
+    signature:
+      clients: [billing-worker]
+  - path: /api/v4
+    service: auth
+    methods: [GET]
+    claimHeaders:
+      X-Org: org.id
+      "X Org": org.id
+  - path: /api/v5
+    service: auth
+    methods: [GET]
+    schema: "order.json#components"
+  - path: /api/v6
+    service: auth
+    methods: [GET]
+    geo:
+      allowCountries: [DE, uk]
+  - path: /api/v7
+    service: auth
+    methods: [GET]
+    bots: log
+  - path: /api/v8
+    service: auth
+    methods: [POST]
+    public: true
+    replayProtection: true
+  - path: /api/v9
+    service: auth
+    methods: [GET]
+    rateLimit:
+      requestsPerSec: 5
+      algorithm: leaky_bucket
+`)
+
+	want := []struct {
+		line    int
+		message string
+		warning bool
+	}{
+		{2, "shadowed by /api/v1", true},
+		{4, `unsupported method "FETCH"`, false},
+		{5, "timeout must be a positive duration", false},
+		{6, "shadowed by /api/v1", true},
+		{6, "declared twice", false},
+		{7, `unknown service "billing"`, false},
+		{9, "shadowed by /api/v1", true},
+		{14, "cache ttl must be a positive duration", false},
+		{15, "invalid pathRegex", false},
+		{22, "methodOverride needs PUT, PATCH or DELETE", false},
+		{26, "prefixRewrite must start with /", false},
+		{29, `tag "cost-center" must be letters, digits and underscores`, false},
+		{32, "setResponseHeaders can't set Content-Length", false},
+		{32, "setResponseHeaders mode must be override or append", false},
+		{37, "requiredRoles and requiredScopes need token-authenticated callers", false},
+		{44, "claimHeaders needs header names without spaces or colons", false},
+		{48, "schema must be a file, optionally followed by #/pointer", false},
+		{48, "schema needs POST, PUT or PATCH in methods", false},
+		{53, `country "uk" must be an ISO 3166-1 alpha-2 code`, false},
+		{57, "bots must be off, monitor or block", false},
+		{62, "replayProtection needs a non-public route", false},
+		{66, "rateLimit burstSize must be positive", false},
+		{68, "rateLimit algorithm must be token_bucket, fixed_window, sliding_window or gcra", false},
+	}
+
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := CheckRoutes(path, "", []string{"auth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %v", len(problems), len(want), problems)
+	}
+	for i, w := range want {
+		p := problems[i]
+		if p.File != path || p.Line != w.line || !strings.Contains(p.Message, w.message) || p.Warning != w.warning {
+			t.Errorf("problem %d = %s, want line %d %q (warning %v)", i, p, w.line, w.message, w.warning)
+		}
+	}
+}
+
+func TestCheckRoutesFragments(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"routes.yaml":         "routes:\n  - path: /api/v1/a\n    service: auth\n    methods: [GET]\n",
+		"routes.d/10-b.json":  `{"routes": [{"path": "/api/v1/b", "service": "auth", "methods": ["GET"]}]}`,
+		"routes.d/20-a.toml":  "[[routes]]\npath = \"/api/v1/a\"\nservice = \"auth\"\nmethods = [\"GET\"]\n",
+		"routes.d/30-bad.yml": "routes:\n  - path: /a\n    methods: GET: x\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := CheckRoutes(filepath.Join(dir, "routes.yaml"), "", []string{"auth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+	// The duplicate is reported where it is declared, after the syntax error's file in merge order
+	if p := problems[0]; filepath.Base(p.File) != "20-a.toml" || p.Line != 1 || !strings.Contains(p.Message, "declared twice") {
+		t.Errorf("duplicate reported as %s", p)
+	}
+	if p := problems[1]; filepath.Base(p.File) != "30-bad.yml" || p.Line != 3 {
+		t.Errorf("syntax error reported as %s", p)
+	}
+}
@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// Server is the admin API. It listens on its own port, outside the public
+// middleware stack, and authenticates callers with scoped admin tokens.
+type Server struct {
+	app    *fiber.App
+	cfg    config.AdminConfig
+	tokens *TokenStore
+	logger middleware.Logger
+	// auditLog also receives admin actions, when enabled
+	auditLog *middleware.AuditLog
+}
+
+// Drainer is implemented by components that can take the gateway out of rotation
+type Drainer interface {
+	SetDraining(draining bool)
+	IsDraining() bool
+}
+
+// New creates a new admin server
+func New(cfg config.AdminConfig, tokens *TokenStore, logger middleware.Logger) *Server {
+	app := fiber.New(fiber.Config{
+		AppName:               "Minisource Gateway Admin",
+		DisableStartupMessage: true,
+	})
+
+	return &Server{
+		app:    app,
+		cfg:    cfg,
+		tokens: tokens,
+		logger: logger,
+	}
+}
+
+// SetAuditLog records admin actions in the security audit log too
+func (s *Server) SetAuditLog(auditLog *middleware.AuditLog) {
+	s.auditLog = auditLog
+}
+
+// Handle registers an admin endpoint that requires the given scope
+func (s *Server) Handle(method, path, scope string, handler fiber.Handler) {
+	s.app.Add(method, "/admin"+path, s.authorize(scope), handler)
+}
+
+// RegisterRoutes exposes the route table; routes returns the current one.
+// Repeated tag query parameters (name:value, or name for any value) list
+// only the routes with all these tags, e.g. ?tag=team:payments.
+func (s *Server) RegisterRoutes(routes func() *config.RouteConfig) {
+	s.Handle(fiber.MethodGet, "/routes", config.ScopeRoutesRead, func(c *fiber.Ctx) error {
+		filters := c.Context().QueryArgs().PeekMulti("tag")
+		matched := []config.Route{}
+		for _, route := range routes().Routes {
+			if hasTags(route, filters) {
+				matched = append(matched, route)
+			}
+		}
+		return c.JSON(fiber.Map{
+			"routes": matched,
+		})
+	})
+}
+
+// hasTags reports whether a route has all the name:value or name tags
+func hasTags(route config.Route, filters [][]byte) bool {
+	for _, filter := range filters {
+		name, value, hasValue := strings.Cut(string(filter), ":")
+		got, ok := route.Tags[name]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterDrain exposes drain control. POST starts draining (readiness
+// fails so load balancers stop sending traffic), DELETE resumes.
+func (s *Server) RegisterDrain(drainer Drainer) {
+	s.Handle(fiber.MethodGet, "/drain", config.ScopeDrain, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"draining": drainer.IsDraining()})
+	})
+	s.Handle(fiber.MethodPost, "/drain", config.ScopeDrain, func(c *fiber.Ctx) error {
+		drainer.SetDraining(true)
+		return c.JSON(fiber.Map{"draining": true})
+	})
+	s.Handle(fiber.MethodDelete, "/drain", config.ScopeDrain, func(c *fiber.Ctx) error {
+		drainer.SetDraining(false)
+		return c.JSON(fiber.Map{"draining": false})
+	})
+}
+
+// authorize checks the admin token and scope, and writes the audit log
+func (s *Server) authorize(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := s.authenticate(c)
+		if !ok {
+			err := c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "unauthorized",
+				"message": "Invalid admin token",
+			})
+			s.audit(c, "", scope, "denied", "invalid token")
+			return err
+		}
+
+		if !token.HasScope(scope) {
+			err := c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "forbidden",
+				"message": fmt.Sprintf("Token lacks scope %s", scope),
+			})
+			s.audit(c, token.Name, scope, "denied", "missing scope")
+			return err
+		}
+
+		err := c.Next()
+		s.audit(c, token.Name, scope, "allowed", "")
+		return err
+	}
+}
+
+// authenticate returns the admin token of the request: a bearer token, or
+// basic auth with the token's name as user name and the token as password
+// (for tools that only support static credentials)
+func (s *Server) authenticate(c *fiber.Ctx) (*Token, bool) {
+	if name, secret, ok := middleware.BasicCredentials(c); ok {
+		token, ok := s.tokens.Authenticate(secret)
+		return token, ok && token.Name == name
+	}
+	return s.tokens.Authenticate(bearerToken(c))
+}
+
+// audit logs an admin API action
+func (s *Server) audit(c *fiber.Ctx, tokenName, scope, outcome, reason string) {
+	s.logger.Info("Admin audit",
+		"token", tokenName,
+		"scope", scope,
+		"outcome", outcome,
+		"reason", reason,
+		"method", c.Method(),
+		"path", c.Path(),
+		"status", c.Response().StatusCode(),
+		"ip", c.IP(),
+	)
+
+	event := middleware.RequestEvent(c, middleware.AuditAdminAction, reason)
+	event.Actor, event.Scope, event.Outcome = tokenName, scope, outcome
+	s.auditLog.Record(event)
+}
+
+// Listen starts serving the admin API
+func (s *Server) Listen() error {
+	return s.app.Listen(fmt.Sprintf("%s:%s", s.cfg.Host, s.cfg.Port))
+}
+
+// Shutdown stops the admin API
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.app.ShutdownWithContext(ctx)
+}
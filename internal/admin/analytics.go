@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// Analytics reports rolling per-route aggregates
+type Analytics interface {
+	Report(window time.Duration, top int) []middleware.RouteReport
+}
+
+// RegisterAnalytics exposes per-route analytics of this instance. window
+// (default 5m, at most 60m) and top (default 10) tune the report; route
+// selects a single route template.
+func (s *Server) RegisterAnalytics(analytics Analytics) {
+	s.Handle(fiber.MethodGet, "/analytics", config.ScopeAnalytics, func(c *fiber.Ctx) error {
+		window, err := time.ParseDuration(c.Query("window", "5m"))
+		if err != nil || window < time.Minute || window > time.Hour {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "window must be a duration between 1m and 60m",
+			})
+		}
+		top := c.QueryInt("top", 10)
+		if top <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "top must be positive",
+			})
+		}
+
+		reports := analytics.Report(window, top)
+		if route := c.Query("route"); route != "" {
+			selected := reports[:0]
+			for _, report := range reports {
+				if report.Route == route {
+					selected = append(selected, report)
+				}
+			}
+			reports = selected
+		}
+		return c.JSON(fiber.Map{
+			"window": window.String(),
+			"routes": reports,
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/cluster"
+)
+
+// Publisher applies an action on this instance and shares it with the fleet
+type Publisher interface {
+	Publish(ctx context.Context, eventType string, payload any) error
+}
+
+// LimitOverrides lists the rate limit overrides in effect
+type LimitOverrides interface {
+	Overrides() map[string]config.RouteLimit
+}
+
+// RegisterLimits exposes per-consumer rate limit overrides. Changes are
+// published so every instance applies them.
+func (s *Server) RegisterLimits(limits LimitOverrides, publisher Publisher) {
+	s.Handle(fiber.MethodGet, "/limits", config.ScopeLimitsWrite, func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"overrides": limits.Overrides()})
+	})
+
+	s.Handle(fiber.MethodPut, "/limits/:consumer", config.ScopeLimitsWrite, func(c *fiber.Ctx) error {
+		var limit config.RouteLimit
+		if err := c.BodyParser(&limit); err != nil || limit.RequestsPerSec <= 0 || limit.BurstSize <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "requestsPerSec and burstSize must be positive",
+			})
+		}
+
+		override := cluster.LimitOverride{
+			Consumer:       c.Params("consumer"),
+			RequestsPerSec: limit.RequestsPerSec,
+			BurstSize:      limit.BurstSize,
+		}
+		return s.publish(c, publisher, cluster.EventLimitOverride, override)
+	})
+
+	s.Handle(fiber.MethodDelete, "/limits/:consumer", config.ScopeLimitsWrite, func(c *fiber.Ctx) error {
+		override := cluster.LimitOverride{Consumer: c.Params("consumer")}
+		return s.publish(c, publisher, cluster.EventLimitOverrideCleared, override)
+	})
+}
+
+// RegisterBreakers exposes circuit breaker resets across the fleet
+func (s *Server) RegisterBreakers(publisher Publisher) {
+	s.Handle(fiber.MethodPost, "/breakers/:service/reset", config.ScopeBreakers, func(c *fiber.Ctx) error {
+		reset := cluster.BreakerReset{Service: c.Params("service")}
+		return s.publish(c, publisher, cluster.EventBreakerReset, reset)
+	})
+}
+
+// publish shares an action and reports the outcome. A failed broadcast is
+// a 502: the change is in effect locally but other instances may not have it.
+func (s *Server) publish(c *fiber.Ctx, publisher Publisher, eventType string, payload any) error {
+	if err := publisher.Publish(c.Context(), eventType, payload); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "publish_failed",
+			"message": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"event": eventType, "payload": payload})
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/cluster"
+)
+
+// MaintenanceOverrides lists the runtime maintenance overrides in effect
+type MaintenanceOverrides interface {
+	Overrides() map[string]bool
+}
+
+// RegisterMaintenance exposes the per-route maintenance switch. Routes are
+// selected by pattern with the route query parameter; changes are
+// published so every instance applies them. routes returns the current
+// route table.
+func (s *Server) RegisterMaintenance(routes func() *config.RouteConfig, maintenance MaintenanceOverrides, publisher Publisher) {
+	s.Handle(fiber.MethodGet, "/maintenance", config.ScopeMaintenance, func(c *fiber.Ctx) error {
+		active := []string{}
+		overrides := maintenance.Overrides()
+		for _, route := range routes().Routes {
+			enabled, ok := overrides[route.Pattern()]
+			if (ok && enabled) || (!ok && route.Maintenance) {
+				active = append(active, route.Pattern())
+			}
+		}
+		return c.JSON(fiber.Map{"active": active, "overrides": overrides})
+	})
+
+	s.Handle(fiber.MethodPut, "/maintenance", config.ScopeMaintenance, func(c *fiber.Ctx) error {
+		var body struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "Body must be {\"enabled\": true|false}",
+			})
+		}
+		route := c.Query("route")
+		if !hasRoute(routes(), route) {
+			return routeNotFound(c, route)
+		}
+		toggle := cluster.MaintenanceToggle{Route: route, Enabled: body.Enabled}
+		return s.publish(c, publisher, cluster.EventMaintenance, toggle)
+	})
+
+	s.Handle(fiber.MethodDelete, "/maintenance", config.ScopeMaintenance, func(c *fiber.Ctx) error {
+		route := c.Query("route")
+		if !hasRoute(routes(), route) {
+			return routeNotFound(c, route)
+		}
+		return s.publish(c, publisher, cluster.EventMaintenanceCleared, cluster.MaintenanceToggle{Route: route})
+	})
+}
+
+// hasRoute reports whether a route with the pattern exists
+func hasRoute(routes *config.RouteConfig, pattern string) bool {
+	for _, route := range routes.Routes {
+		if route.Pattern() == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// routeNotFound answers a request naming an unknown route
+func routeNotFound(c *fiber.Ctx, pattern string) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"error":   "not_found",
+		"message": "No route with pattern " + pattern,
+	})
+}
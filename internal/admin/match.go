@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/router"
+)
+
+// RegisterMatch exposes route-match debugging: which route serves a request
+// (method and path query parameters, plus header=Name:value for header
+// predicates), why, the middleware flags that apply to it and where it is
+// sent. explain resolves the request against the live route table.
+func (s *Server) RegisterMatch(explain func(router.MatchRequest) router.MatchExplanation) {
+	s.Handle(fiber.MethodGet, "/debug/match", config.ScopeRoutesRead, func(c *fiber.Ctx) error {
+		req := router.MatchRequest{Method: c.Query("method", fiber.MethodGet), Path: c.Query("path")}
+		if !strings.HasPrefix(req.Path, "/") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "The path query parameter must be a request path starting with /",
+			})
+		}
+		for _, header := range c.Context().QueryArgs().PeekMulti("header") {
+			name, value, ok := strings.Cut(string(header), ":")
+			if !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "bad_request",
+					"message": "Header parameters must be Name:value",
+				})
+			}
+			if req.Headers == nil {
+				req.Headers = make(map[string]string)
+			}
+			req.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+
+		exp := explain(req)
+		candidates := []fiber.Map{}
+		for _, candidate := range exp.Candidates {
+			candidates = append(candidates, fiber.Map{
+				"index":   candidate.Index,
+				"route":   candidate.Pattern,
+				"matched": candidate.Matched,
+				"reason":  candidate.Reason,
+			})
+		}
+		if exp.Route == nil {
+			return c.JSON(fiber.Map{"matched": false, "candidates": candidates})
+		}
+
+		route := exp.Route
+		return c.JSON(fiber.Map{
+			"matched":    true,
+			"index":      exp.Index,
+			"fallback":   exp.Fallback,
+			"route":      route,
+			"params":     exp.Params,
+			"candidates": candidates,
+			"flags": fiber.Map{
+				"public":         route.Public,
+				"rateLimit":      route.RateLimit,
+				"circuitBreaker": route.CircuitBreaker,
+				"internalOnly":   route.InternalOnly,
+				"maintenance":    route.Maintenance,
+				"cache":          route.Cache != nil && route.Cache.Enabled,
+				"timeout":        route.Timeout,
+				"retry":          route.Retry != nil,
+				"requiredRoles":  route.RequiredRoles,
+				"requiredScopes": route.RequiredScopes,
+			},
+			"handler":  exp.Handler,
+			"service":  exp.Service,
+			"upstream": exp.Upstream,
+		})
+	})
+}
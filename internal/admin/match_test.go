@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/router"
+)
+
+func TestMatch(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret"))
+	tokens := NewTokenStore(&config.AdminTokensConfig{Tokens: []config.AdminToken{
+		{Name: "support", TokenSHA256: hex.EncodeToString(sum[:]), Scopes: []string{config.ScopeRoutesRead}},
+	}})
+	s := New(config.AdminConfig{}, tokens, middleware.NewLogger(config.LoggingConfig{}))
+
+	var got router.MatchRequest
+	s.RegisterMatch(func(req router.MatchRequest) router.MatchExplanation {
+		got = req
+		route := config.Route{Path: "/api/v1/users", Service: "users", Public: true, RateLimit: &config.RouteLimit{RequestsPerSec: 5}}
+		return router.MatchExplanation{Route: &route, Index: 3, Handler: "proxy", Service: "users", Upstream: "http://users/api/v1/users/42"}
+	})
+
+	match := func(query string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodGet, "/admin/debug/match?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := s.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, out := match("path=/api/v1/users/42&header=X-Beta:%201&header=X-Tenant:acme")
+	if status != fiber.StatusOK || out["matched"] != true || out["upstream"] != "http://users/api/v1/users/42" {
+		t.Fatalf("match = %d %v", status, out)
+	}
+	if got.Method != fiber.MethodGet || got.Headers["X-Beta"] != "1" || got.Headers["X-Tenant"] != "acme" {
+		t.Errorf("request = %+v", got)
+	}
+	flags := out["flags"].(map[string]any)
+	if flags["public"] != true || flags["circuitBreaker"] != false || flags["rateLimit"].(map[string]any)["RequestsPerSec"] != 5.0 {
+		t.Errorf("flags = %v", flags)
+	}
+
+	if status, _ := match("method=GET"); status != fiber.StatusBadRequest {
+		t.Errorf("missing path = %d", status)
+	}
+	if status, _ := match("path=/a&header=X-Beta"); status != fiber.StatusBadRequest {
+		t.Errorf("malformed header = %d", status)
+	}
+}
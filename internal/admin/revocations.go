@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+// Revoker revokes access tokens before they expire
+type Revoker interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeUser(ctx context.Context, userID string) error
+}
+
+// RegisterRevocations exposes token revocation, e.g. after a compromise:
+// a body with jti and expiresAt revokes one token, one with userId every
+// token issued to the user so far.
+func (s *Server) RegisterRevocations(revoker Revoker) {
+	s.Handle(fiber.MethodPost, "/revocations", config.ScopeTokens, func(c *fiber.Ctx) error {
+		var body struct {
+			JTI       string    `json:"jti"`
+			ExpiresAt time.Time `json:"expiresAt"`
+			UserID    string    `json:"userId"`
+		}
+		if err := c.BodyParser(&body); err != nil || (body.JTI == "") == (body.UserID == "") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "Body needs either jti (with expiresAt) or userId",
+			})
+		}
+
+		var err error
+		if body.JTI != "" {
+			if body.ExpiresAt.IsZero() {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "bad_request",
+					"message": "expiresAt must be the token's expiry (RFC 3339)",
+				})
+			}
+			err = revoker.RevokeToken(c.Context(), body.JTI, body.ExpiresAt)
+		} else {
+			err = revoker.RevokeUser(c.Context(), body.UserID)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "service_unavailable",
+				"message": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{"revoked": true, "jti": body.JTI, "userId": body.UserID})
+	})
+}
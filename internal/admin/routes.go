@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+// RegisterRouteDiff exposes a dry run of a route change: the candidate
+// route file in the request body is validated and compared with the live
+// route table, without applying it. routes returns the live table and
+// services the names of the services routes may use.
+func (s *Server) RegisterRouteDiff(routes func() *config.RouteConfig, services func() []string) {
+	s.Handle(fiber.MethodPost, "/routes/diff", config.ScopeRoutesRead, func(c *fiber.Ctx) error {
+		format := routeBodyFormat(c)
+		if format == "" || len(c.Body()) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "bad_request",
+				"message": "Body must be a route file in YAML, JSON or TOML (see the format query parameter)",
+			})
+		}
+
+		docs := []config.RouteDocument{{Name: "candidate", Format: format, Data: c.Body()}}
+		problems := []fiber.Map{}
+		valid := true
+		for _, p := range config.CheckRouteDocuments(docs, services()) {
+			valid = valid && p.Warning
+			problems = append(problems, fiber.Map{
+				"line":    p.Line,
+				"column":  p.Column,
+				"message": p.Message,
+				"warning": p.Warning,
+			})
+		}
+
+		// Candidates the gateway wouldn't load have no diff
+		candidate, err := config.ParseRoutes(docs)
+		if err != nil {
+			return c.JSON(fiber.Map{"valid": false, "problems": problems})
+		}
+
+		changes := []fiber.Map{}
+		summary := map[config.RouteChangeKind]int{config.RouteAdded: 0, config.RouteRemoved: 0, config.RouteChanged: 0}
+		for _, change := range config.DiffRoutes(routes(), candidate) {
+			summary[change.Kind]++
+			fields := []fiber.Map{}
+			for _, f := range change.Fields {
+				fields = append(fields, fiber.Map{"field": f.Field, "old": f.Old, "new": f.New})
+			}
+			changes = append(changes, fiber.Map{"kind": change.Kind, "route": change.Route, "fields": fields})
+		}
+		return c.JSON(fiber.Map{
+			"valid":    valid,
+			"problems": problems,
+			"changes":  changes,
+			"summary":  summary,
+		})
+	})
+}
+
+// routeBodyFormat returns the format of a route file in the request body:
+// the format query parameter, else a JSON or TOML content type, else YAML
+// (also for curl's default form content type). Unknown formats are "".
+func routeBodyFormat(c *fiber.Ctx) string {
+	format := c.Query("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+		switch {
+		case strings.HasSuffix(mediaType, "json"):
+			format = "json"
+		case strings.HasSuffix(mediaType, "toml"):
+			format = "toml"
+		default:
+			format = "yaml"
+		}
+	}
+	switch format {
+	case "yaml", "json", "toml":
+		return format
+	}
+	return ""
+}
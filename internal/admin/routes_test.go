@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+func TestRouteDiff(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret"))
+	tokens := NewTokenStore(&config.AdminTokensConfig{Tokens: []config.AdminToken{
+		{Name: "deploy", TokenSHA256: hex.EncodeToString(sum[:]), Scopes: []string{config.ScopeRoutesRead}},
+	}})
+	s := New(config.AdminConfig{}, tokens, middleware.NewLogger(config.LoggingConfig{}))
+
+	live := &config.RouteConfig{Routes: []config.Route{
+		{Path: "/api/v1/orders", Service: "orders", Methods: []string{"GET"}, Timeout: "10s"},
+		{Path: "/api/v1/carts", Service: "orders", Methods: []string{"GET"}},
+	}}
+	s.RegisterRouteDiff(func() *config.RouteConfig { return live }, func() []string { return []string{"orders"} })
+
+	diff := func(contentType, body string) (int, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodPost, "/admin/routes/diff", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Content-Type", contentType)
+		resp, err := s.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, out := diff("application/yaml", `routes:
+  - path: /api/v1/orders
+    service: orders
+    methods: [GET]
+    timeout: 5s
+  - path: /api/v1/users
+    service: users
+    methods: [GET]
+`)
+	if status != fiber.StatusOK || out["valid"] != false {
+		t.Fatalf("diff = %d %v", status, out)
+	}
+	if problems := out["problems"].([]any); len(problems) != 1 || !strings.Contains(problems[0].(map[string]any)["message"].(string), `unknown service "users"`) {
+		t.Errorf("problems = %v", problems)
+	}
+	summary := out["summary"].(map[string]any)
+	if summary["added"] != 1.0 || summary["removed"] != 1.0 || summary["changed"] != 1.0 {
+		t.Errorf("summary = %v", summary)
+	}
+	if len(live.Routes) != 2 || live.Routes[0].Timeout != "10s" {
+		t.Error("live routes changed")
+	}
+
+	// A candidate the gateway rejects has problems but no diff
+	status, out = diff("application/json", `{"routes": [{"path": "/a", "service": "orders", "methods": ["GET"], "cache": {"ttl": "soon"}}]}`)
+	if status != fiber.StatusOK || out["valid"] != false || out["changes"] != nil || len(out["problems"].([]any)) != 1 {
+		t.Errorf("invalid candidate = %d %v", status, out)
+	}
+
+	if status, _ := diff("application/x-www-form-urlencoded", ""); status != fiber.StatusBadRequest {
+		t.Errorf("empty candidate = %d", status)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, "/admin/routes/diff?format=xml", strings.NewReader("<routes/>"))
+	req.Header.Set("Authorization", "Bearer secret")
+	if resp, err := s.app.Test(req); err != nil || resp.StatusCode != fiber.StatusBadRequest {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestRoutesByTag(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret"))
+	tokens := NewTokenStore(&config.AdminTokensConfig{Tokens: []config.AdminToken{
+		{Name: "ops", TokenSHA256: hex.EncodeToString(sum[:]), Scopes: []string{config.ScopeRoutesRead}},
+	}})
+	s := New(config.AdminConfig{}, tokens, middleware.NewLogger(config.LoggingConfig{}))
+
+	live := &config.RouteConfig{Routes: []config.Route{
+		{Path: "/api/v1/orders", Service: "orders", Tags: map[string]string{"team": "commerce", "tier": "1"}},
+		{Path: "/api/v1/carts", Service: "orders", Tags: map[string]string{"team": "commerce"}},
+		{Path: "/api/v1/users", Service: "users"},
+	}}
+	s.RegisterRoutes(func() *config.RouteConfig { return live })
+
+	list := func(query string) []string {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodGet, "/admin/routes"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := s.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct{ Routes []config.Route }
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		var paths []string
+		for _, route := range out.Routes {
+			paths = append(paths, route.Path)
+		}
+		return paths
+	}
+
+	if paths := list(""); len(paths) != 3 {
+		t.Errorf("all routes = %v", paths)
+	}
+	if paths := list("?tag=team:commerce"); len(paths) != 2 {
+		t.Errorf("team:commerce = %v", paths)
+	}
+	if paths := list("?tag=team:commerce&tag=tier"); len(paths) != 1 || paths[0] != "/api/v1/orders" {
+		t.Errorf("team:commerce and tier = %v", paths)
+	}
+	if paths := list("?tag=team:identity"); len(paths) != 0 {
+		t.Errorf("team:identity = %v", paths)
+	}
+}
+
+func TestAdminBasicAuth(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret"))
+	tokens := NewTokenStore(&config.AdminTokensConfig{Tokens: []config.AdminToken{
+		{Name: "deploy", TokenSHA256: hex.EncodeToString(sum[:]), Scopes: []string{config.ScopeRoutesRead}},
+	}})
+	s := New(config.AdminConfig{}, tokens, middleware.NewLogger(config.LoggingConfig{}))
+	s.RegisterRoutes(func() *config.RouteConfig { return &config.RouteConfig{} })
+
+	for _, tc := range []struct {
+		user, password string
+		want           int
+	}{
+		{"deploy", "secret", fiber.StatusOK},
+		{"other", "secret", fiber.StatusUnauthorized},
+		{"deploy", "wrong", fiber.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(fiber.MethodGet, "/admin/routes", nil)
+		req.SetBasicAuth(tc.user, tc.password)
+		resp, err := s.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s:%s = %d, want %d", tc.user, tc.password, resp.StatusCode, tc.want)
+		}
+	}
+}
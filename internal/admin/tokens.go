@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+// TokenStore validates admin API tokens. It is deliberately separate from
+// the end-user JWT validation so admin credentials can't be minted by the
+// auth service and user tokens can't reach the admin API.
+type TokenStore struct {
+	tokens []Token
+}
+
+// Token is an authenticated admin API credential
+type Token struct {
+	Name   string
+	digest []byte
+	scopes map[string]bool
+}
+
+// NewTokenStore creates a token store from configuration
+func NewTokenStore(cfg *config.AdminTokensConfig) *TokenStore {
+	store := &TokenStore{}
+	if cfg == nil {
+		return store
+	}
+
+	for _, t := range cfg.Tokens {
+		digest, err := hex.DecodeString(strings.ToLower(t.TokenSHA256))
+		if err != nil || len(digest) != sha256.Size {
+			continue
+		}
+		scopes := make(map[string]bool, len(t.Scopes))
+		for _, scope := range t.Scopes {
+			scopes[scope] = true
+		}
+		store.tokens = append(store.tokens, Token{Name: t.Name, digest: digest, scopes: scopes})
+	}
+	return store
+}
+
+// Authenticate returns the token matching the presented secret
+func (s *TokenStore) Authenticate(secret string) (*Token, bool) {
+	sum := sha256.Sum256([]byte(secret))
+
+	var match *Token
+	// Compare against every token so timing doesn't reveal which one matched
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare(sum[:], s.tokens[i].digest) == 1 {
+			match = &s.tokens[i]
+		}
+	}
+	return match, match != nil
+}
+
+// HasScope reports whether the token grants scope
+func (t *Token) HasScope(scope string) bool {
+	return t.scopes[scope]
+}
+
+// bearerToken extracts the bearer token from the Authorization header
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,239 @@
+// Package cache serves repeated reads of cacheable routes from stored
+// upstream responses in the gateway's key-value store.
+//
+// It plugs into the proxy as an interceptor: hits are answered before the
+// upstream is called and misses are stored once the upstream answers.
+// Stored bodies are encoding-neutral (see compress.Normalize) and are
+// compressed per client on the way out.
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/compress"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/proxy"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+	"github.com/valyala/fasthttp"
+)
+
+// DefaultTTL applies to cached routes without a ttl
+const DefaultTTL = time.Minute
+
+// HeaderXCache reports whether a response was served from the cache
+const HeaderXCache = "X-Cache"
+
+// Cache is a proxy interceptor caching upstream responses of routes with
+// cache enabled, per method, path, query and tenant. As a shared cache it
+// keeps responses to authenticated requests only when the upstream marks
+// them public, and serves a stored response only to requests matching its
+// Vary headers.
+type Cache struct {
+	store   store.KV
+	encoder *compress.Encoder
+	// cookieName is the session cookie carrying browser clients' tokens
+	cookieName string
+}
+
+// entry is a stored response
+type entry struct {
+	Status   int         `json:"status"`
+	Headers  [][2]string `json:"headers"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+	// Vary holds the request's values of the headers the response varies on
+	Vary map[string]string `json:"vary,omitempty"`
+}
+
+// New creates a response cache keeping entries in kv, or in memory when kv
+// is nil. Requests with cookieName (the session cookie) count as
+// authenticated.
+func New(kv store.KV, compression config.CompressionConfig, cookieName string) *Cache {
+	if kv == nil {
+		kv = store.NewMemory(time.Minute)
+	}
+	return &Cache{
+		store:      kv,
+		encoder:    compress.NewEncoder(compression),
+		cookieName: cookieName,
+	}
+}
+
+// OnRequest implements proxy.Interceptor. A hit is written to the client
+// and returns proxy.ErrHandled; store errors are treated as misses.
+func (ch *Cache) OnRequest(c *fiber.Ctx, service string, req *fasthttp.Request) error {
+	route, ok := cacheableRoute(c)
+	if !ok {
+		return nil
+	}
+
+	data, found, err := ch.store.Get(c.Context(), Key(c))
+	var cached entry
+	if err != nil || !found || json.Unmarshal(data, &cached) != nil || !cached.matches(c) {
+		middleware.RecordCacheResult(route.Pattern(), "miss")
+		c.Set(HeaderXCache, "MISS")
+		return nil
+	}
+
+	middleware.RecordCacheResult(route.Pattern(), "hit")
+	for _, header := range cached.Headers {
+		c.Set(header[0], header[1])
+	}
+	c.Set(fiber.HeaderAge, strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+	c.Set(HeaderXCache, "HIT")
+	c.Status(cached.Status)
+	if err := c.Send(ch.encoder.Apply(c, cached.Body)); err != nil {
+		return err
+	}
+	return proxy.ErrHandled
+}
+
+// OnResponse implements proxy.Interceptor, storing successful responses the
+// upstream hasn't marked as private or uncacheable
+func (ch *Cache) OnResponse(c *fiber.Ctx, service string, resp *fasthttp.Response) error {
+	route, ok := cacheableRoute(c)
+	if !ok || resp.StatusCode() != fiber.StatusOK || !storable(resp, ch.authenticated(c)) {
+		return nil
+	}
+
+	cached := entry{
+		Status:   resp.StatusCode(),
+		Body:     append([]byte(nil), resp.Body()...),
+		StoredAt: time.Now(),
+	}
+	for _, name := range varyHeaders(resp) {
+		if cached.Vary == nil {
+			cached.Vary = make(map[string]string)
+		}
+		cached.Vary[name] = c.Get(name)
+	}
+	resp.Header.VisitAll(func(key, value []byte) {
+		if !skipHeaders[http.CanonicalHeaderKey(string(key))] {
+			cached.Headers = append(cached.Headers, [2]string{string(key), string(value)})
+		}
+	})
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return nil
+	}
+	// A failed write only costs a later miss
+	_ = ch.store.Set(c.Context(), Key(c), data, TTL(route.Cache))
+	return nil
+}
+
+// Key identifies a cached response by method, tenant, path and query
+func Key(c *fiber.Ctx) string {
+	return "cache:" + c.Method() + ":" + reqctx.TenantID(c) + ":" + c.Path() + "?" + string(c.Request().URI().QueryString())
+}
+
+// TTL returns the route's cache lifetime. The value is checked by
+// RouteConfig.Validate when routes are loaded.
+func TTL(cfg *config.CacheConfig) time.Duration {
+	if ttl, err := time.ParseDuration(cfg.TTL); err == nil && ttl > 0 {
+		return ttl
+	}
+	return DefaultTTL
+}
+
+// cacheableRoute returns the request's route if its responses are cached
+// for the request method. Streamed routes are never cached since their body
+// isn't buffered.
+func cacheableRoute(c *fiber.Ctx) (config.Route, bool) {
+	route, ok := reqctx.Route(c)
+	if !ok || route.Cache == nil || !route.Cache.Enabled || route.Stream {
+		return route, false
+	}
+	methods := route.Cache.Methods
+	if len(methods) == 0 {
+		methods = []string{fiber.MethodGet}
+	}
+	for _, method := range methods {
+		if strings.EqualFold(method, c.Method()) {
+			return route, true
+		}
+	}
+	return route, false
+}
+
+// authenticated reports whether the request carries credentials
+func (ch *Cache) authenticated(c *fiber.Ctx) bool {
+	return c.Get(fiber.HeaderAuthorization) != "" ||
+		(ch.cookieName != "" && c.Cookies(ch.cookieName) != "") ||
+		reqctx.UserID(c) != ""
+}
+
+// storable reports whether the upstream allows shared caching. Responses
+// to authenticated requests need public or s-maxage (RFC 9111 section
+// 3.5), and those varying on every request (Vary: *) can't be reused.
+func storable(resp *fasthttp.Response, authenticated bool) bool {
+	shared := false
+	for _, directive := range strings.Split(string(resp.Header.Peek(fiber.HeaderCacheControl)), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store", directive == "no-cache", directive == "private":
+			return false
+		case directive == "public", strings.HasPrefix(directive, "s-maxage="):
+			shared = true
+		}
+	}
+	if authenticated && !shared {
+		return false
+	}
+	for _, vary := range resp.Header.PeekAll(fiber.HeaderVary) {
+		if strings.Contains(string(vary), "*") {
+			return false
+		}
+	}
+	// Bodies too large to normalize are still encoded
+	if len(resp.Header.ContentEncoding()) != 0 {
+		return false
+	}
+	return len(resp.Header.Peek(fiber.HeaderSetCookie)) == 0
+}
+
+// varyHeaders returns the request headers a response varies on, but
+// Accept-Encoding: stored bodies are encoding-neutral and compressed per
+// client when served
+func varyHeaders(resp *fasthttp.Response) []string {
+	var names []string
+	for _, vary := range resp.Header.PeekAll(fiber.HeaderVary) {
+		for _, name := range strings.Split(string(vary), ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && name != fiber.HeaderAcceptEncoding {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// matches reports whether the request has the header values the stored
+// response varies on
+func (e entry) matches(c *fiber.Ctx) bool {
+	for name, value := range e.Vary {
+		if c.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// skipHeaders are not stored: per-connection headers, and those the
+// gateway sets again when serving a hit
+var skipHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Date":              true,
+	"Set-Cookie":        true,
+	HeaderXCache:        true,
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/proxy"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCache(t *testing.T) {
+	ch := New(nil, config.CompressionConfig{MinSize: 1 << 20}, "session")
+
+	route := config.Route{Path: "/api/v1/catalog", Cache: &config.CacheConfig{Enabled: true, TTL: "1m"}}
+	upstreamCalls := 0
+	cacheControl, vary := "", ""
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, route)
+		reqctx.SetTenantID(c, c.Get("X-Tenant-ID"))
+		return c.Next()
+	})
+	// Stands in for ServiceProxy.Forward
+	app.All("/*", func(c *fiber.Ctx) error {
+		if err := ch.OnRequest(c, "catalog", nil); errors.Is(err, proxy.ErrHandled) {
+			return nil
+		}
+		upstreamCalls++
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		resp.SetBodyString("items " + c.Get("X-Tenant-ID") + c.Get("Accept-Language"))
+		resp.Header.SetContentType("text/plain")
+		if cacheControl != "" {
+			resp.Header.Set(fiber.HeaderCacheControl, cacheControl)
+		}
+		if vary != "" {
+			resp.Header.Set(fiber.HeaderVary, vary)
+		}
+		if err := ch.OnResponse(c, "catalog", resp); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, string(resp.Header.ContentType()))
+		return c.Send(resp.Body())
+	})
+
+	getWith := func(method, target string, headers map[string]string) (string, string) {
+		req := httptest.NewRequest(method, target, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get(HeaderXCache), string(body)
+	}
+	get := func(method, target, tenant string) (string, string) {
+		return getWith(method, target, map[string]string{"X-Tenant-ID": tenant})
+	}
+
+	if xCache, _ := get("GET", "/api/v1/catalog?page=1", "acme"); xCache != "MISS" {
+		t.Errorf("first request X-Cache = %q, want MISS", xCache)
+	}
+	if xCache, body := get("GET", "/api/v1/catalog?page=1", "acme"); xCache != "HIT" || body != "items acme" {
+		t.Errorf("second request = %q %q, want HIT with the stored body", xCache, body)
+	}
+	if xCache, body := get("GET", "/api/v1/catalog?page=1", "globex"); xCache != "MISS" || body != "items globex" {
+		t.Errorf("other tenant = %q %q, want a separate entry", xCache, body)
+	}
+	if xCache, _ := get("GET", "/api/v1/catalog?page=2", "acme"); xCache != "MISS" {
+		t.Errorf("other query X-Cache = %q, want MISS", xCache)
+	}
+	if xCache, _ := get("POST", "/api/v1/catalog?page=1", "acme"); xCache != "" {
+		t.Errorf("POST X-Cache = %q, want none", xCache)
+	}
+	if upstreamCalls != 4 {
+		t.Errorf("upstream calls = %d, want 4", upstreamCalls)
+	}
+
+	cacheControl = "private, max-age=60"
+	get("GET", "/api/v1/catalog?page=3", "acme")
+	if xCache, _ := get("GET", "/api/v1/catalog?page=3", "acme"); xCache != "MISS" {
+		t.Errorf("private response was cached")
+	}
+
+	// Responses to authenticated requests are shared only when public
+	cacheControl = ""
+	for target, credentials := range map[string]map[string]string{
+		"/api/v1/me?via=header": {"Authorization": "Bearer user-a"},
+		"/api/v1/me?via=cookie": {"Cookie": "session=user-a"},
+	} {
+		getWith("GET", target, credentials)
+		if xCache, _ := get("GET", target, ""); xCache != "MISS" {
+			t.Errorf("response to %v was shared", credentials)
+		}
+	}
+	cacheControl = "public, max-age=60"
+	getWith("GET", "/api/v1/catalog?page=4", map[string]string{"Authorization": "Bearer user-a"})
+	if xCache, _ := get("GET", "/api/v1/catalog?page=4", ""); xCache != "HIT" {
+		t.Errorf("public response to an authenticated request X-Cache = %q, want HIT", xCache)
+	}
+
+	// Stored responses are served only to requests with the same Vary values
+	cacheControl, vary = "", "Accept-Language, Accept-Encoding"
+	getWith("GET", "/api/v1/catalog?page=5", map[string]string{"Accept-Language": "de"})
+	if xCache, body := getWith("GET", "/api/v1/catalog?page=5", map[string]string{"Accept-Language": "de", "Accept-Encoding": "gzip"}); xCache != "HIT" || body != "items de" {
+		t.Errorf("same language = %q %q, want HIT", xCache, body)
+	}
+	if xCache, body := getWith("GET", "/api/v1/catalog?page=5", map[string]string{"Accept-Language": "fr"}); xCache != "MISS" || body != "items fr" {
+		t.Errorf("other language = %q %q, want MISS", xCache, body)
+	}
+	vary = "*"
+	get("GET", "/api/v1/catalog?page=6", "")
+	if xCache, _ := get("GET", "/api/v1/catalog?page=6", ""); xCache != "MISS" {
+		t.Errorf("Vary: * response was cached")
+	}
+}
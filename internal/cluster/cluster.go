@@ -0,0 +1,150 @@
+// Package cluster shares admin actions between gateway replicas over Redis
+// pub/sub, so a change made through one instance's admin API is applied by
+// the whole fleet within seconds.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// Event types broadcast between instances
+const (
+	EventLimitOverride        = "limits.override"
+	EventLimitOverrideCleared = "limits.override_cleared"
+	EventBreakerReset         = "breaker.reset"
+	EventMaintenance          = "maintenance.set"
+	EventMaintenanceCleared   = "maintenance.cleared"
+)
+
+// LimitOverride replaces the rate limit of one consumer (user ID or IP)
+type LimitOverride struct {
+	Consumer       string `json:"consumer"`
+	RequestsPerSec int    `json:"requestsPerSec,omitempty"`
+	BurstSize      int    `json:"burstSize,omitempty"`
+}
+
+// BreakerReset closes the circuit breaker of a service
+type BreakerReset struct {
+	Service string `json:"service"`
+}
+
+// MaintenanceToggle puts a route (by pattern) in or out of maintenance
+type MaintenanceToggle struct {
+	Route   string `json:"route"`
+	Enabled bool   `json:"enabled,omitempty"`
+}
+
+// Event is an action shared between instances
+type Event struct {
+	Type    string          `json:"type"`
+	Origin  string          `json:"origin"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Time    time.Time       `json:"time"`
+}
+
+// Handler applies an event's payload on this instance
+type Handler func(payload json.RawMessage) error
+
+// Bus publishes events to every instance, including the local one. Without
+// Redis it only applies events locally.
+type Bus struct {
+	redis  *redis.Client
+	cfg    config.ClusterConfig
+	logger middleware.Logger
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// New creates a bus; redisClient may be nil
+func New(redisClient *redis.Client, cfg config.ClusterConfig, logger middleware.Logger) *Bus {
+	return &Bus{
+		redis:    redisClient,
+		cfg:      cfg,
+		logger:   logger,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler for an event type
+func (b *Bus) Handle(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = handler
+}
+
+// Publish applies an event locally and broadcasts it to the other instances.
+// A failed broadcast is returned after the local change has been applied.
+func (b *Bus) Publish(ctx context.Context, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	event := Event{Type: eventType, Origin: b.cfg.InstanceID, Payload: data, Time: time.Now()}
+
+	if err := b.dispatch(event); err != nil {
+		return err
+	}
+	if b.redis == nil {
+		return nil
+	}
+
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := b.redis.Publish(ctx, b.cfg.Channel, msg).Err(); err != nil {
+		return fmt.Errorf("broadcast %s: %w", eventType, err)
+	}
+	middleware.RecordClusterEvent(eventType, "published")
+	return nil
+}
+
+// Start subscribes to events from other instances until ctx is done
+func (b *Bus) Start(ctx context.Context) {
+	if b.redis == nil {
+		return
+	}
+
+	sub := b.redis.Subscribe(ctx, b.cfg.Channel)
+	go func() {
+		defer sub.Close()
+		for msg := range sub.Channel() {
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				b.logger.Warn("Invalid cluster event", "error", err)
+				continue
+			}
+			// Our own events were applied when published
+			if event.Origin == b.cfg.InstanceID {
+				continue
+			}
+			if err := b.dispatch(event); err != nil {
+				b.logger.Error("Failed to apply cluster event", "type", event.Type, "origin", event.Origin, "error", err)
+				continue
+			}
+			middleware.RecordClusterEvent(event.Type, "applied")
+			b.logger.Info("Applied cluster event", "type", event.Type, "origin", event.Origin)
+		}
+	}()
+}
+
+// dispatch runs the handler for an event
+func (b *Bus) dispatch(event Event) error {
+	b.mu.RLock()
+	handler, ok := b.handlers[event.Type]
+	b.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("no handler for event type %q", event.Type)
+	}
+	return handler(event.Payload)
+}
@@ -0,0 +1,201 @@
+// Package compress normalizes upstream response encodings and compresses
+// responses on egress according to the client's Accept-Encoding.
+//
+// Responses that the gateway may store (e.g. cached routes) are decoded to
+// identity when they arrive, so a single stored copy can be re-encoded for
+// whichever encoding each client accepts.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+// Supported content codings
+const (
+	Identity = "identity"
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+	Zstd     = "zstd"
+)
+
+// UpstreamAcceptEncoding is sent upstream when responses will be normalized,
+// limited to the codings Normalize can decode
+const UpstreamAcceptEncoding = "gzip, deflate, br, zstd"
+
+// ErrTooLarge is returned by Normalize when the decoded body would exceed
+// its limit
+var ErrTooLarge = errors.New("decoded body exceeds the size limit")
+
+// Normalize decodes a gzip, deflate, brotli or zstd encoded response body in
+// place and drops its Content-Encoding, leaving an identity response. At
+// most maxSize bytes are decoded (0 for no limit); past that it returns
+// ErrTooLarge and leaves the response encoded.
+func Normalize(resp *fasthttp.Response, maxSize int) error {
+	encoding := strings.ToLower(strings.TrimSpace(string(resp.Header.ContentEncoding())))
+	switch encoding {
+	case "", Identity:
+		return nil
+	case Gzip, Deflate, Brotli, Zstd:
+		body, err := decode(encoding, resp.Body(), maxSize)
+		if errors.Is(err, ErrTooLarge) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("decode %s body: %w", encoding, err)
+		}
+		resp.SetBody(body)
+		resp.Header.Del(fiber.HeaderContentEncoding)
+		return nil
+	default:
+		return fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// decode decodes body through a reader, so a small body that expands
+// without bound is never decoded past maxSize bytes
+func decode(encoding string, body []byte, maxSize int) ([]byte, error) {
+	var r io.Reader
+	src := bytes.NewReader(body)
+	switch encoding {
+	case Gzip:
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case Deflate:
+		zr, err := zlib.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case Brotli:
+		r = brotli.NewReader(src)
+	case Zstd:
+		zr, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if maxSize <= 0 {
+		return io.ReadAll(r)
+	}
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if len(decoded) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return decoded, err
+}
+
+// Encoder compresses identity bodies for clients
+type Encoder struct {
+	cfg config.CompressionConfig
+}
+
+// NewEncoder creates an encoder
+func NewEncoder(cfg config.CompressionConfig) *Encoder {
+	return &Encoder{cfg: cfg}
+}
+
+// Apply compresses body with the best encoding the client accepts and sets
+// Content-Encoding and Vary accordingly. Small bodies are returned as-is.
+func (e *Encoder) Apply(c *fiber.Ctx, body []byte) []byte {
+	c.Vary(fiber.HeaderAcceptEncoding)
+	if len(body) < e.cfg.MinSize {
+		return body
+	}
+
+	encoding := Negotiate(c.Get(fiber.HeaderAcceptEncoding), e.cfg.Encodings)
+	encoded, ok := Encode(encoding, body, e.level(encoding))
+	if !ok {
+		return body
+	}
+	c.Set(fiber.HeaderContentEncoding, encoding)
+	return encoded
+}
+
+// level returns the configured level for encoding. Each coding has its own
+// scale: gzip and deflate 1-9, brotli quality 0-11, zstd 1-4.
+func (e *Encoder) level(encoding string) int {
+	switch encoding {
+	case Brotli:
+		return e.cfg.BrotliQuality
+	case Zstd:
+		return e.cfg.ZstdLevel
+	default:
+		return e.cfg.Level
+	}
+}
+
+// Encode compresses body with encoding at the coding's level. ok is false
+// for identity or unknown encodings.
+func Encode(encoding string, body []byte, level int) ([]byte, bool) {
+	switch encoding {
+	case Gzip:
+		return fasthttp.AppendGzipBytesLevel(nil, body, level), true
+	case Deflate:
+		return fasthttp.AppendDeflateBytesLevel(nil, body, level), true
+	case Brotli:
+		return fasthttp.AppendBrotliBytesLevel(nil, body, level), true
+	case Zstd:
+		return fasthttp.AppendZstdBytesLevel(nil, body, level), true
+	default:
+		return nil, false
+	}
+}
+
+// Negotiate picks an encoding from an Accept-Encoding header. The highest
+// q-value wins; ties go to the earliest entry in supported. Identity is
+// returned when the client accepts none of them.
+func Negotiate(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return Identity
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := Identity, 0.0
+	for _, encoding := range supported {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,123 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestNegotiate(t *testing.T) {
+	supported := []string{Gzip, Deflate}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", Identity},
+		{"gzip", Gzip},
+		{"deflate, gzip", Gzip},
+		{"gzip;q=0.5, deflate", Deflate},
+		{"gzip;q=0, deflate;q=0", Identity},
+		{"br", Identity},
+		{"*", Gzip},
+		{"*;q=0.1, deflate;q=0.5", Deflate},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, supported); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	body := []byte(`{"message":"hello"}`)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.SetBody(fasthttp.AppendGzipBytes(nil, body))
+
+	if err := Normalize(resp, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(resp.Body()); got != string(body) {
+		t.Errorf("body = %q, want %q", got, body)
+	}
+	if enc := resp.Header.ContentEncoding(); len(enc) != 0 {
+		t.Errorf("Content-Encoding = %q, want empty", enc)
+	}
+
+	resp.Header.Set("Content-Encoding", "compress")
+	if err := Normalize(resp, 0); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+}
+
+func TestNegotiateModernCodings(t *testing.T) {
+	supported := []string{Zstd, Brotli, Gzip, Deflate}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"gzip, deflate, br, zstd", Zstd},
+		{"gzip, deflate, br", Brotli},
+		{"br;q=0.9, gzip", Gzip},
+		{"zstd;q=0, br;q=0, gzip;q=0.5", Gzip},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, supported); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	body := []byte(strings.Repeat(`{"id":1,"name":"widget","tags":["a","b"]},`, 200))
+
+	for encoding, level := range map[string]int{Gzip: 6, Deflate: 6, Brotli: 4, Zstd: 2} {
+		encoded, ok := Encode(encoding, body, level)
+		if !ok || len(encoded) >= len(body) {
+			t.Errorf("%s: encoded %d of %d bytes", encoding, len(encoded), len(body))
+			continue
+		}
+
+		resp := fasthttp.AcquireResponse()
+		resp.Header.Set("Content-Encoding", encoding)
+		resp.SetBody(encoded)
+		if err := Normalize(resp, 0); err != nil {
+			t.Errorf("%s: %v", encoding, err)
+		} else if !bytes.Equal(resp.Body(), body) {
+			t.Errorf("%s: body changed in round trip", encoding)
+		}
+		fasthttp.ReleaseResponse(resp)
+	}
+}
+
+func TestNormalizeLimit(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 1<<20)
+
+	for encoding, level := range map[string]int{Gzip: 6, Deflate: 6, Brotli: 4, Zstd: 2} {
+		encoded, _ := Encode(encoding, body, level)
+
+		resp := fasthttp.AcquireResponse()
+		resp.Header.Set("Content-Encoding", encoding)
+		resp.SetBody(encoded)
+		if err := Normalize(resp, 64<<10); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: err = %v, want ErrTooLarge", encoding, err)
+		}
+		if !bytes.Equal(resp.Body(), encoded) || string(resp.Header.ContentEncoding()) != encoding {
+			t.Errorf("%s: response changed past the limit", encoding)
+		}
+
+		if err := Normalize(resp, len(body)); err != nil || len(resp.Body()) != len(body) {
+			t.Errorf("%s: at the limit: %v, %d bytes", encoding, err, len(resp.Body()))
+		}
+		fasthttp.ReleaseResponse(resp)
+	}
+}
@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"net/netip"
+)
+
+// Location is what the databases know about an address
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code, e.g. DE
+	Country string
+	// ASN and ASOrg are the autonomous system announcing the address
+	ASN   uint
+	ASOrg string
+}
+
+// Locator looks addresses up in several databases, typically a country (or
+// city) one and an ASN one, merging what they know
+type Locator struct {
+	dbs []*DB
+}
+
+// OpenLocator loads the databases at paths
+func OpenLocator(paths []string) (*Locator, error) {
+	l := &Locator{}
+	for _, path := range paths {
+		db, err := Open(path)
+		if err != nil {
+			return nil, err
+		}
+		l.dbs = append(l.dbs, db)
+	}
+	return l, nil
+}
+
+// Locate returns what the databases know about addr; unknown fields are
+// empty, e.g. for private addresses
+func (l *Locator) Locate(addr netip.Addr) Location {
+	var loc Location
+	for _, db := range l.dbs {
+		record, err := db.Lookup(addr)
+		if err != nil || record == nil {
+			continue
+		}
+		if loc.Country == "" {
+			// The registered country stands in for anycast and satellite
+			// providers without a located one
+			loc.Country = isoCode(record, "country")
+			if loc.Country == "" {
+				loc.Country = isoCode(record, "registered_country")
+			}
+		}
+		if asn, ok := asUint(record["autonomous_system_number"]); ok && loc.ASN == 0 {
+			loc.ASN = asn
+			loc.ASOrg, _ = record["autonomous_system_organization"].(string)
+		}
+	}
+	return loc
+}
+
+// isoCode returns the iso_code of one of a record's country maps
+func isoCode(record map[string]any, key string) string {
+	country, _ := record[key].(map[string]any)
+	code, _ := country["iso_code"].(string)
+	return code
+}
@@ -0,0 +1,154 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// encode appends a value in the MaxMind DB data format
+func encode(buf []byte, v any) []byte {
+	header := func(kind, size int) {
+		ctrl := size
+		if size >= 29 {
+			ctrl = 29 // one extra size byte: values up to 284
+		}
+		if kind > 7 {
+			buf = append(buf, byte(ctrl), byte(kind-7))
+		} else {
+			buf = append(buf, byte(kind<<5|ctrl))
+		}
+		if size >= 29 {
+			buf = append(buf, byte(size-29))
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		header(typeString, len(v))
+		buf = append(buf, v...)
+	case uint32:
+		b := binary.BigEndian.AppendUint32(nil, v)
+		b = bytes.TrimLeft(b, "\x00")
+		header(typeUint32, len(b))
+		buf = append(buf, b...)
+	case map[string]any:
+		header(typeMap, len(v))
+		for _, k := range slices.Sorted(func(yield func(string) bool) {
+			for k := range v {
+				if !yield(k) {
+					return
+				}
+			}
+		}) {
+			buf = encode(buf, k)
+			buf = encode(buf, v[k])
+		}
+	}
+	return buf
+}
+
+// writeDB writes an IPv6 MaxMind DB with 24-bit records mapping networks to
+// records; IPv4 networks are placed in ::/96 like MaxMind does
+func writeDB(t *testing.T, networks map[string]map[string]any) string {
+	t.Helper()
+	type node struct{ child [2]int } // 0: empty, >0: node index+1, <0: -(data offset+1)
+	nodes := []node{{}}
+	var data []byte
+	for _, cidr := range slices.Sorted(func(yield func(string) bool) {
+		for k := range networks {
+			if !yield(k) {
+				return
+			}
+		}
+	}) {
+		prefix := netip.MustParsePrefix(cidr)
+		bits, length := prefix.Addr().As16(), prefix.Bits()
+		if prefix.Addr().Is4() {
+			v4 := prefix.Addr().As4()
+			bits = [16]byte{12: v4[0], 13: v4[1], 14: v4[2], 15: v4[3]}
+			length += 96
+		}
+		offset := len(data)
+		data = encode(data, networks[cidr])
+
+		n := 0
+		for i := 0; i < length; i++ {
+			bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+			if i == length-1 {
+				nodes[n].child[bit] = -(offset + 1)
+				break
+			}
+			if nodes[n].child[bit] <= 0 {
+				nodes = append(nodes, node{})
+				nodes[n].child[bit] = len(nodes)
+			}
+			n = nodes[n].child[bit] - 1
+		}
+	}
+
+	count := len(nodes)
+	var file []byte
+	for _, n := range nodes {
+		for _, child := range n.child {
+			record := count // empty
+			switch {
+			case child > 0:
+				record = child - 1
+			case child < 0:
+				record = count + dataSectionSeparator + (-child - 1)
+			}
+			file = append(file, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+	file = append(file, make([]byte, dataSectionSeparator)...)
+	file = append(file, data...)
+	file = append(file, metadataMarker...)
+	file = encode(file, map[string]any{
+		"node_count":    uint32(count),
+		"record_size":   uint32(24),
+		"ip_version":    uint32(6),
+		"database_type": "Test-Country-ASN",
+	})
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLocate(t *testing.T) {
+	country := writeDB(t, map[string]map[string]any{
+		"81.2.69.0/24":   {"country": map[string]any{"iso_code": "GB"}},
+		"2001:db8::/32":  {"country": map[string]any{"iso_code": "DE"}},
+		"203.0.113.0/24": {"registered_country": map[string]any{"iso_code": "AU"}},
+	})
+	asn := writeDB(t, map[string]map[string]any{
+		"81.2.0.0/16": {"autonomous_system_number": uint32(20712), "autonomous_system_organization": "Andrews & Arnold Ltd"},
+	})
+	locator, err := OpenLocator([]string{country, asn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for addr, want := range map[string]Location{
+		"81.2.69.160":        {Country: "GB", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"},
+		"::ffff:81.2.69.160": {Country: "GB", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"},
+		"81.2.1.1":           {ASN: 20712, ASOrg: "Andrews & Arnold Ltd"},
+		"2001:db8::1":        {Country: "DE"},
+		"203.0.113.9":        {Country: "AU"},
+		"10.0.0.1":           {},
+	} {
+		if got := locator.Locate(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s = %+v, want %+v", addr, got, want)
+		}
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("missing database opened")
+	}
+}
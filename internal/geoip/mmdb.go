@@ -0,0 +1,299 @@
+// Package geoip looks up the country and autonomous system of IP addresses
+// in MaxMind DB files (GeoLite2/GeoIP2 Country, City and ASN, or any
+// database with the same record layout).
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata at the end of a MaxMind DB file
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the gap between the search tree and the data
+const dataSectionSeparator = 16
+
+// DB is a MaxMind DB file loaded in memory
+type DB struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dbType     string
+	// ipv4Start is the node IPv4 lookups start from in IPv6 trees
+	ipv4Start uint
+}
+
+// Open loads a MaxMind DB file
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newDB(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+func newDB(buf []byte) (*DB, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, errors.New("not a MaxMind DB file")
+	}
+	metaBuf := buf[at+len(metadataMarker):]
+	value, _, err := decoder{metaBuf}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	meta, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata: not a map")
+	}
+
+	db := &DB{buf: buf}
+	db.nodeCount, _ = asUint(meta["node_count"])
+	db.recordSize, _ = asUint(meta["record_size"])
+	db.ipVersion, _ = asUint(meta["ip_version"])
+	db.dbType, _ = meta["database_type"].(string)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(at) {
+		return nil, errors.New("search tree larger than the file")
+	}
+	db.data = buf[treeSize+dataSectionSeparator : at]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Type returns the database type, e.g. GeoLite2-Country
+func (db *DB) Type() string {
+	return db.dbType
+}
+
+// Lookup returns the record of the network containing addr, if any
+func (db *DB) Lookup(addr netip.Addr) (map[string]any, error) {
+	addr = addr.Unmap()
+	node, bits, start := uint(0), addr.As16(), 0
+	switch {
+	case addr.Is4() && db.ipVersion == 6:
+		node, start = db.ipv4Start, 96
+	case addr.Is4():
+		start = 96
+	case db.ipVersion != 6:
+		return nil, nil
+	}
+
+	for i := start; i < 128 && node < db.nodeCount; i++ {
+		bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+		node = db.record(node, uint(bit))
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+
+	offset := node - db.nodeCount - dataSectionSeparator
+	value, _, err := decoder{db.data}.decode(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+// record reads the left (0) or right (1) record of a node
+func (db *DB) record(node, side uint) uint {
+	size := db.recordSize / 4
+	b := db.buf[node*size : node*size+size]
+	switch db.recordSize {
+	case 24:
+		b = b[side*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if side == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[side*4:]))
+	}
+}
+
+// Data section types
+const (
+	typePointer = 1 + iota
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds nested values, so a corrupt file can't recurse forever
+const maxDepth = 32
+
+var errCorrupt = errors.New("corrupt data section")
+
+// decoder decodes values of a data section
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset after it
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth || offset >= uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+	if kind == typePointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+	if kind == 0 {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errCorrupt
+		}
+		kind = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errCorrupt
+		}
+		extra := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, min(size, 1024))
+		for range size {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			if m[name], offset, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for range size {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	b, next := d.buf[offset:offset+size], offset+size
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if kind == typeInt32 {
+			return int64(int32(v)), next, nil
+		}
+		return v, next, nil
+	case typeUint128:
+		// Not used by the records read here; kept as its bytes
+		return bytes.Clone(b), next, nil
+	case typeContainer, typeEndMarker:
+		return nil, next, nil
+	}
+	return nil, 0, errCorrupt
+}
+
+// pointer decodes a pointer, returning its target and the offset after it
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	v := uint(0)
+	if n < 4 {
+		v = uint(ctrl & 0x7)
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	v += [...]uint{0, 2048, 526336, 0}[n-1]
+	return v, offset + n, nil
+}
+
+// asUint returns an unsigned metadata or record value
+func asUint(v any) (uint, bool) {
+	n, ok := v.(uint64)
+	return uint(n), ok
+}
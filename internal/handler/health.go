@@ -2,17 +2,21 @@ package handler
 
 import (
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/internal/proxy"
+	"github.com/minisource/gateway/internal/synthetic"
 )
 
 var startTime = time.Now()
 
 // HealthHandler handles health check endpoints
 type HealthHandler struct {
-	proxy *proxy.ServiceProxy
+	proxy      *proxy.ServiceProxy
+	draining   atomic.Bool
+	synthetics *synthetic.Runner
 }
 
 // NewHealthHandler creates a new health handler
@@ -22,12 +26,19 @@ func NewHealthHandler(proxy *proxy.ServiceProxy) *HealthHandler {
 	}
 }
 
-// RegisterRoutes registers health check routes
-func (h *HealthHandler) RegisterRoutes(app *fiber.App) {
+// RegisterRoutes registers health check routes; ops guards those detailing
+// the backends
+func (h *HealthHandler) RegisterRoutes(app *fiber.App, ops fiber.Handler) {
 	app.Get("/health", h.Health)
 	app.Get("/ready", h.Ready)
 	app.Get("/live", h.Live)
-	app.Get("/health/services", h.ServicesHealth)
+	app.Get("/health/services", ops, h.ServicesHealth)
+	app.Get("/health/synthetic", ops, h.SyntheticHealth)
+}
+
+// SetSynthetics attaches the synthetic check runner reported by /health/synthetic
+func (h *HealthHandler) SetSynthetics(runner *synthetic.Runner) {
+	h.synthetics = runner
 }
 
 // Health returns overall gateway health
@@ -40,8 +51,25 @@ func (h *HealthHandler) Health(c *fiber.Ctx) error {
 	})
 }
 
+// SetDraining takes the gateway out of (or back into) rotation by failing readiness
+func (h *HealthHandler) SetDraining(draining bool) {
+	h.draining.Store(draining)
+}
+
+// IsDraining reports whether the gateway is draining
+func (h *HealthHandler) IsDraining() bool {
+	return h.draining.Load()
+}
+
 // Ready checks if gateway is ready to serve traffic
 func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	if h.IsDraining() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":    "draining",
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+		})
+	}
+
 	services := h.proxy.GetServicesHealth()
 	allHealthy := true
 
@@ -97,6 +125,33 @@ func (h *HealthHandler) ServicesHealth(c *fiber.Ctx) error {
 	})
 }
 
+// SyntheticHealth reports synthetic transaction checks, separately from
+// basic health: "degraded" when a check is slow, 503 when one is failing
+func (h *HealthHandler) SyntheticHealth(c *fiber.Ctx) error {
+	var results []synthetic.Result
+	if h.synthetics != nil {
+		results = h.synthetics.Results()
+	}
+
+	status, code := "ok", fiber.StatusOK
+	for _, result := range results {
+		switch result.Status {
+		case synthetic.StatusFailing:
+			status, code = "failing", fiber.StatusServiceUnavailable
+		case synthetic.StatusSlow:
+			if code == fiber.StatusOK {
+				status = "degraded"
+			}
+		}
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"status":    status,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"checks":    results,
+	})
+}
+
 // getMemoryStats returns current memory statistics
 func getMemoryStats() fiber.Map {
 	var m runtime.MemStats
@@ -0,0 +1,201 @@
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/minisource/gateway/config"
+)
+
+// watchTimeout is how long the API server holds a watch open, in seconds
+const watchTimeout = 300
+
+// errGone means the resource version is too old to watch from: the
+// resources have to be listed again
+var errGone = errors.New("kubernetes: resource version expired")
+
+// client lists and watches resources through the Kubernetes REST API
+type client struct {
+	http   *http.Client
+	server string
+	// tokenFile is read for every request: projected service account
+	// tokens are rotated while the pod runs
+	tokenFile string
+}
+
+// objectMeta is the metadata the controller uses
+type objectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	ResourceVersion   string            `json:"resourceVersion"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	Annotations       map[string]string `json:"annotations"`
+}
+
+// object is a resource with its metadata decoded and its spec left raw
+type object struct {
+	Metadata objectMeta      `json:"metadata"`
+	Raw      json.RawMessage `json:"-"`
+}
+
+func (o *object) UnmarshalJSON(data []byte) error {
+	var meta struct {
+		Metadata objectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	o.Metadata, o.Raw = meta.Metadata, data
+	return nil
+}
+
+// key identifies the object within its kind
+func (o *object) key() string {
+	return o.Metadata.Namespace + "/" + o.Metadata.Name
+}
+
+type list struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []object `json:"items"`
+}
+
+// event is a watch notification. Object is a resource, or a Status for
+// ERROR events.
+type event struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// newClient creates a client for the configured API server, or the one of
+// the cluster the gateway runs in
+func newClient(cfg config.KubernetesConfig) (*client, error) {
+	server := cfg.APIServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes: not running in a cluster and KUBE_API_SERVER is not set")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" && strings.HasPrefix(server, "https://") {
+		pem, err := os.ReadFile(cfg.CAFile)
+		switch {
+		case err == nil:
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("kubernetes: no certificates in %s", cfg.CAFile)
+			}
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("kubernetes: %w", err)
+		}
+	}
+
+	// No client timeout: watches are held open for watchTimeout
+	return &client{
+		http:      &http.Client{Transport: transport},
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: cfg.TokenFile,
+	}, nil
+}
+
+// list returns the resources at path and the version to watch them from
+func (c *client) list(ctx context.Context, path string) ([]object, string, error) {
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var l list
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, "", fmt.Errorf("kubernetes: list %s: %w", path, err)
+	}
+	return l.Items, l.Metadata.ResourceVersion, nil
+}
+
+// watch calls fn with the changes to the resources at path after version
+// until the server ends the watch or ctx is done
+func (c *client) watch(ctx context.Context, path, version string, fn func(event) error) error {
+	query := url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {version},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {fmt.Sprint(watchTimeout)},
+	}
+	resp, err := c.get(ctx, path+"?"+query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev event
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("kubernetes: watch %s: %w", path, err)
+		}
+		if ev.Type == "ERROR" {
+			var s status
+			_ = json.Unmarshal(ev.Object, &s)
+			if s.Code == http.StatusGone {
+				return errGone
+			}
+			return fmt.Errorf("kubernetes: watch %s: %s", path, s.Message)
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// get sends an authenticated GET and checks the response status
+func (c *client) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.tokenFile != "" {
+		// Without a token file (e.g. through kubectl proxy) requests are
+		// sent unauthenticated
+		if token, err := os.ReadFile(c.tokenFile); err == nil {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusGone {
+			return nil, errGone
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("kubernetes: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,265 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/minisource/gateway/config"
+)
+
+// gatewayGroup is the API group of Gateway API resources
+const gatewayGroup = "gateway.networking.k8s.io"
+
+// httpRoute is the part of a gateway.networking.k8s.io/v1 HTTPRoute the
+// gateway serves
+type httpRoute struct {
+	Spec struct {
+		ParentRefs []struct {
+			Group     *string `json:"group"`
+			Kind      *string `json:"kind"`
+			Namespace string  `json:"namespace"`
+			Name      string  `json:"name"`
+		} `json:"parentRefs"`
+		Hostnames []string `json:"hostnames"`
+		Rules     []struct {
+			Matches     []httpRouteMatch  `json:"matches"`
+			Filters     []httpRouteFilter `json:"filters"`
+			BackendRefs []struct {
+				Group     string `json:"group"`
+				Kind      string `json:"kind"`
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+				Port      int    `json:"port"`
+				Weight    *int   `json:"weight"`
+			} `json:"backendRefs"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+type httpRouteMatch struct {
+	Path *struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"path"`
+	Headers     []httpMatchValue `json:"headers"`
+	QueryParams []httpMatchValue `json:"queryParams"`
+	Method      string           `json:"method"`
+}
+
+// httpMatchValue matches a header or query parameter; Type defaults to Exact
+type httpMatchValue struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type httpRouteFilter struct {
+	Type                   string        `json:"type"`
+	RequestHeaderModifier  *headerFilter `json:"requestHeaderModifier"`
+	ResponseHeaderModifier *headerFilter `json:"responseHeaderModifier"`
+	URLRewrite             *struct {
+		Path *struct {
+			Type               string `json:"type"`
+			ReplacePrefixMatch string `json:"replacePrefixMatch"`
+		} `json:"path"`
+	} `json:"urlRewrite"`
+}
+
+type headerFilter struct {
+	Set    []httpMatchValue `json:"set"`
+	Add    []httpMatchValue `json:"add"`
+	Remove []string         `json:"remove"`
+}
+
+// translateHTTPRoute adds the routes of an HTTPRoute attached to the
+// configured Gateway. Each match of a rule becomes a route per hostname;
+// a rule with several weighted backends splits its traffic with an
+// experiment. Rules with filters other than header modifiers and prefix
+// stripping URL rewrites aren't served.
+func translateHTTPRoute(b *builder, obj object) {
+	var hr httpRoute
+	if err := json.Unmarshal(obj.Raw, &hr); err != nil {
+		b.skip(obj, "%v", err)
+		return
+	}
+	attached := false
+	for _, ref := range hr.Spec.ParentRefs {
+		if (ref.Group == nil || *ref.Group == gatewayGroup) && (ref.Kind == nil || *ref.Kind == "Gateway") &&
+			b.isGateway(ref.Namespace, ref.Name, obj.Metadata.Namespace) {
+			attached = true
+		}
+	}
+	if !attached {
+		return
+	}
+	base, err := baseRoute(obj)
+	if err != nil {
+		b.skip(obj, "%v", err)
+		return
+	}
+
+	hosts := hr.Spec.Hostnames
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	for i, rule := range hr.Spec.Rules {
+		route := base
+		if err := applyFilters(&route, rule.Filters); err != nil {
+			b.skip(obj, "rule %d: %v", i, err)
+			continue
+		}
+
+		var variants []config.ExperimentVariant
+		for _, ref := range rule.BackendRefs {
+			weight := 1
+			if ref.Weight != nil {
+				weight = *ref.Weight
+			}
+			switch {
+			case (ref.Group != "" && ref.Group != "core") || (ref.Kind != "" && ref.Kind != "Service"):
+				b.skip(obj, "rule %d: only Service backends are supported", i)
+			case ref.Namespace != "" && ref.Namespace != obj.Metadata.Namespace:
+				b.skip(obj, "rule %d: backend %s/%s is in another namespace", i, ref.Namespace, ref.Name)
+			case ref.Port == 0:
+				b.skip(obj, "rule %d: backend %s needs a port", i, ref.Name)
+			case weight > 0:
+				service := b.service(obj.Metadata.Namespace, ref.Name, ref.Port)
+				variants = append(variants, config.ExperimentVariant{Name: service, Service: service, Weight: weight})
+			}
+		}
+		if len(variants) == 0 {
+			b.skip(obj, "rule %d has no backends", i)
+			continue
+		}
+		route.Service = variants[0].Service
+		if len(variants) > 1 {
+			route.Experiment = &config.ExperimentConfig{
+				Name:     fmt.Sprintf("%s/rule-%d", obj.key(), i),
+				Variants: variants,
+			}
+		}
+
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []httpRouteMatch{{}}
+		}
+		for _, m := range matches {
+			for _, host := range hosts {
+				if strings.HasPrefix(host, "*") {
+					b.skip(obj, "wildcard hostname %s is not supported", host)
+					continue
+				}
+				mt, err := translateMatch(m)
+				if err != nil {
+					b.skip(obj, "rule %d: %v", i, err)
+					continue
+				}
+				mt.host = host
+				b.add(obj, route, mt)
+			}
+		}
+	}
+}
+
+// isGateway reports whether a parent reference names the configured
+// Gateway. A reference without a namespace is to the route's namespace.
+func (b *builder) isGateway(namespace, name, routeNamespace string) bool {
+	if namespace == "" {
+		namespace = routeNamespace
+	}
+	want := b.cluster.Gateway
+	if ns, n, ok := strings.Cut(want, "/"); ok {
+		return namespace == ns && name == n
+	}
+	return name == want
+}
+
+// translateMatch converts an HTTPRoute match; a match without a path
+// matches every path
+func translateMatch(m httpRouteMatch) (match, error) {
+	mt := match{path: "/"}
+	if m.Path != nil {
+		switch m.Path.Type {
+		case "", "PathPrefix":
+			mt.path = m.Path.Value
+		case "Exact":
+			mt.path, mt.exact = m.Path.Value, true
+		default:
+			return mt, fmt.Errorf("path match type %s is not supported", m.Path.Type)
+		}
+		if mt.path == "" {
+			mt.path = "/"
+		}
+	}
+	if m.Method != "" {
+		mt.methods = []string{m.Method}
+	}
+
+	var err error
+	if mt.headers, err = exactValues(m.Headers); err != nil {
+		return mt, err
+	}
+	if mt.query, err = exactValues(m.QueryParams); err != nil {
+		return mt, err
+	}
+	return mt, nil
+}
+
+// exactValues returns the values of Exact header or query matches
+func exactValues(matches []httpMatchValue) (map[string]string, error) {
+	var values map[string]string
+	for _, m := range matches {
+		if m.Type != "" && m.Type != "Exact" {
+			return nil, fmt.Errorf("%s match on %s is not supported", m.Type, m.Name)
+		}
+		if values == nil {
+			values = make(map[string]string)
+		}
+		values[m.Name] = m.Value
+	}
+	return values, nil
+}
+
+// applyFilters sets the route settings of a rule's filters
+func applyFilters(route *config.Route, filters []httpRouteFilter) error {
+	for _, f := range filters {
+		switch f.Type {
+		case "RequestHeaderModifier":
+			route.RequestHeaders = headerTransform(f.RequestHeaderModifier)
+		case "ResponseHeaderModifier":
+			route.ResponseHeaders = headerTransform(f.ResponseHeaderModifier)
+		case "URLRewrite":
+			// Replacing the matched prefix with / is stripping it
+			if f.URLRewrite == nil || f.URLRewrite.Path == nil || f.URLRewrite.Path.Type != "ReplacePrefixMatch" {
+				return fmt.Errorf("only URLRewrite filters replacing the path prefix are supported")
+			}
+			if prefix := f.URLRewrite.Path.ReplacePrefixMatch; prefix == "/" || prefix == "" {
+				route.StripPrefix = true
+			} else {
+				route.PrefixRewrite = prefix
+			}
+		default:
+			return fmt.Errorf("%s filters are not supported", f.Type)
+		}
+	}
+	return nil
+}
+
+// headerTransform converts a header modifier; added headers replace the
+// request's values like set ones
+func headerTransform(f *headerFilter) *config.HeaderTransformConfig {
+	if f == nil {
+		return nil
+	}
+	t := &config.HeaderTransformConfig{Remove: f.Remove}
+	for _, values := range [][]httpMatchValue{f.Add, f.Set} {
+		for _, h := range values {
+			if t.Add == nil {
+				t.Add = make(map[string]string)
+			}
+			t.Add[h.Name] = h.Value
+		}
+	}
+	return t
+}
@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ingressClassAnnotation is the class of Ingresses predating ingressClassName
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// ingress is the part of a networking.k8s.io/v1 Ingress the gateway serves
+type ingress struct {
+	Spec struct {
+		IngressClassName string          `json:"ingressClassName"`
+		DefaultBackend   *ingressBackend `json:"defaultBackend"`
+		Rules            []struct {
+			Host string `json:"host"`
+			HTTP *struct {
+				Paths []struct {
+					Path     string         `json:"path"`
+					PathType string         `json:"pathType"`
+					Backend  ingressBackend `json:"backend"`
+				} `json:"paths"`
+			} `json:"http"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+type ingressBackend struct {
+	Service *struct {
+		Name string `json:"name"`
+		Port struct {
+			Name   string `json:"name"`
+			Number int    `json:"number"`
+		} `json:"port"`
+	} `json:"service"`
+}
+
+// translateIngress adds the routes of an Ingress of the configured class.
+// Prefix and ImplementationSpecific paths match the path and the paths below
+// it; Exact paths only the path. The default backend serves / for any host.
+func translateIngress(b *builder, obj object) {
+	var ing ingress
+	if err := json.Unmarshal(obj.Raw, &ing); err != nil {
+		b.skip(obj, "%v", err)
+		return
+	}
+	class := ing.Spec.IngressClassName
+	if class == "" {
+		class = obj.Metadata.Annotations[ingressClassAnnotation]
+	}
+	if b.cluster.IngressClass != "" && class != b.cluster.IngressClass {
+		return
+	}
+	base, err := baseRoute(obj)
+	if err != nil {
+		b.skip(obj, "%v", err)
+		return
+	}
+
+	for _, rule := range ing.Spec.Rules {
+		if strings.HasPrefix(rule.Host, "*") {
+			b.skip(obj, "wildcard host %s is not supported", rule.Host)
+			continue
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			service, ok := b.ingressService(obj, p.Backend)
+			if !ok {
+				continue
+			}
+			path := p.Path
+			if path == "" {
+				path = "/"
+			}
+			route := base
+			route.Service = service
+			b.add(obj, route, match{host: rule.Host, exact: p.PathType == "Exact", path: path})
+		}
+	}
+
+	if ing.Spec.DefaultBackend != nil {
+		if service, ok := b.ingressService(obj, *ing.Spec.DefaultBackend); ok {
+			route := base
+			route.Service = service
+			// Below every other route for the same path
+			route.Priority--
+			b.add(obj, route, match{path: "/"})
+		}
+	}
+}
+
+// ingressService returns the service of an Ingress backend
+func (b *builder) ingressService(obj object, backend ingressBackend) (string, bool) {
+	svc := backend.Service
+	switch {
+	case svc == nil:
+		b.skip(obj, "only Service backends are supported")
+		return "", false
+	case svc.Port.Number == 0:
+		// Resolving port names needs the Service itself
+		b.skip(obj, "backend %s: only numbered ports are supported", svc.Name)
+		return "", false
+	}
+	return b.service(obj.Metadata.Namespace, svc.Name, svc.Port.Number), true
+}
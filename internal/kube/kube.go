@@ -0,0 +1,389 @@
+// Package kube runs the gateway as a Kubernetes ingress controller: it
+// watches Ingress or Gateway API HTTPRoute resources and translates them
+// into the route table and the services routes proxy to, so the gateway
+// serves a cluster without route files.
+//
+// Backends are Kubernetes Services, reached through their cluster DNS
+// name. Gateway-specific route settings (rate limits, caching, auth roles,
+// ...) are set with the gateway.minisource.io/route annotation, which holds
+// route settings in the route file format and applies to every route of
+// the resource.
+package kube
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minisource/gateway/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Resource kinds served
+const (
+	ResourcesIngress    = "ingress"
+	ResourcesGatewayAPI = "gateway-api"
+)
+
+// Annotations read from Ingress and HTTPRoute resources
+const (
+	// AnnotationRoute holds route settings applied to each generated route
+	AnnotationRoute = "gateway.minisource.io/route"
+	// AnnotationPublic ("true") serves the routes without authentication
+	AnnotationPublic = "gateway.minisource.io/public"
+)
+
+// allMethods are the methods routes without a method match are served for
+var allMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+
+// Table is the route table and the services built from the resources
+type Table struct {
+	Routes   *config.RouteConfig
+	Services map[string]config.ServiceConfig
+	// Skipped lists the resources, or the parts of them, that can't be served
+	Skipped []error
+}
+
+// Controller keeps a route table in sync with the cluster's resources
+type Controller struct {
+	cfg    config.KubernetesConfig
+	client *client
+	path   string
+	// translate turns one resource into routes
+	translate func(b *builder, obj object)
+
+	objects map[string]object
+	version string
+	table   *Table
+}
+
+// New creates a controller for the configured resources
+func New(cfg config.KubernetesConfig) (*Controller, error) {
+	if cfg.ClusterDomain == "" {
+		cfg.ClusterDomain = "cluster.local"
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 5 * time.Second
+	}
+
+	c := &Controller{cfg: cfg, objects: make(map[string]object)}
+	namespace := ""
+	if cfg.Namespace != "" {
+		namespace = "/namespaces/" + cfg.Namespace
+	}
+	switch cfg.Resources {
+	case ResourcesIngress:
+		c.path = "/apis/networking.k8s.io/v1" + namespace + "/ingresses"
+		c.translate = translateIngress
+	case ResourcesGatewayAPI:
+		if cfg.Gateway == "" {
+			return nil, fmt.Errorf("kubernetes: %s needs a gateway name", cfg.Resources)
+		}
+		c.path = "/apis/gateway.networking.k8s.io/v1" + namespace + "/httproutes"
+		c.translate = translateHTTPRoute
+	default:
+		return nil, fmt.Errorf("kubernetes: unknown resources %q", cfg.Resources)
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return c, nil
+}
+
+// Name identifies the controller in logs and metrics
+func (c *Controller) Name() string {
+	return "kubernetes"
+}
+
+// Load lists the resources and builds the route table from them
+func (c *Controller) Load(ctx context.Context) (*Table, error) {
+	if err := c.list(ctx); err != nil {
+		return nil, err
+	}
+	c.table = c.build()
+	return c.table, nil
+}
+
+// Watch calls apply with the new table whenever the resources change the
+// routes or services, until ctx is done. API errors are passed to onError
+// and the watch is retried; when Load failed, the resources are listed
+// first.
+func (c *Controller) Watch(ctx context.Context, apply func(*Table), onError func(error)) {
+	for ctx.Err() == nil {
+		err := c.sync(ctx, apply)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == errGone {
+			// The watch fell too far behind: list everything again
+			c.version = ""
+			continue
+		}
+		if err != nil {
+			onError(err)
+			select {
+			case <-time.After(c.cfg.RetryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// sync lists the resources if needed, then follows their changes until
+// the watch ends
+func (c *Controller) sync(ctx context.Context, apply func(*Table)) error {
+	if c.version == "" {
+		if err := c.list(ctx); err != nil {
+			return err
+		}
+		c.update(apply)
+	}
+	return c.client.watch(ctx, c.path, c.version, func(ev event) error {
+		var obj object
+		if err := obj.UnmarshalJSON(ev.Object); err != nil {
+			return fmt.Errorf("kubernetes: %w", err)
+		}
+		c.version = obj.Metadata.ResourceVersion
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			c.objects[obj.key()] = obj
+		case "DELETED":
+			delete(c.objects, obj.key())
+		default:
+			// BOOKMARK only moves the version forward
+			return nil
+		}
+		c.update(apply)
+		return nil
+	})
+}
+
+// list replaces the known resources with the current ones
+func (c *Controller) list(ctx context.Context) error {
+	items, version, err := c.client.list(ctx, c.path)
+	if err != nil {
+		return err
+	}
+	c.objects = make(map[string]object, len(items))
+	for _, obj := range items {
+		c.objects[obj.key()] = obj
+	}
+	c.version = version
+	return nil
+}
+
+// update rebuilds the table and applies it if routes or services changed
+func (c *Controller) update(apply func(*Table)) {
+	table := c.build()
+	if c.table != nil && reflect.DeepEqual(table.Routes, c.table.Routes) && reflect.DeepEqual(table.Services, c.table.Services) {
+		return
+	}
+	c.table = table
+	apply(table)
+}
+
+// build translates the resources into a table. Resources are translated
+// oldest first, so when two claim the same host and path the older one
+// keeps it.
+func (c *Controller) build() *Table {
+	objects := make([]object, 0, len(c.objects))
+	for _, obj := range c.objects {
+		objects = append(objects, obj)
+	}
+	slices.SortFunc(objects, func(a, b object) int {
+		return cmp.Or(
+			cmp.Compare(a.Metadata.CreationTimestamp, b.Metadata.CreationTimestamp),
+			cmp.Compare(a.key(), b.key()),
+		)
+	})
+
+	b := &builder{cluster: c.cfg, services: make(map[string]config.ServiceConfig)}
+	for _, obj := range objects {
+		c.translate(b, obj)
+	}
+	return b.table()
+}
+
+// builder collects the routes and services of the resources
+type builder struct {
+	cluster  config.KubernetesConfig
+	routes   []config.Route
+	services map[string]config.ServiceConfig
+	skipped  []error
+}
+
+// skip records a resource, or part of one, that isn't served
+func (b *builder) skip(obj object, format string, args ...any) {
+	b.skipped = append(b.skipped, fmt.Errorf("%s: %s", obj.key(), fmt.Sprintf(format, args...)))
+}
+
+// service returns the gateway service for a Kubernetes Service port
+func (b *builder) service(namespace, name string, port int) string {
+	service := fmt.Sprintf("%s.%s:%d", name, namespace, port)
+	svc := b.cluster.Backend
+	svc.URL = fmt.Sprintf("http://%s.%s.svc.%s:%d", name, namespace, b.cluster.ClusterDomain, port)
+	b.services[service] = svc
+	return service
+}
+
+// match describes the requests a generated route serves
+type match struct {
+	host string
+	// exact matches only the path itself, not the paths below it
+	exact   bool
+	path    string
+	methods []string
+	headers map[string]string
+	query   map[string]string
+}
+
+// add adds a route serving the match from base, the resource's route
+// settings
+func (b *builder) add(obj object, base config.Route, m match) {
+	route := base
+	if len(route.Methods) == 0 {
+		route.Methods = allMethods
+	}
+	if len(m.methods) > 0 {
+		route.Methods = m.methods
+	}
+
+	path := m.path
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	switch {
+	case m.exact:
+		route.PathRegex = "^" + regexp.QuoteMeta(path) + "$"
+		route.Priority++
+	case config.HasPathParams(path):
+		// A literal : segment would be read as a parameter
+		route.PathRegex = "^" + regexp.QuoteMeta(path) + "(/|$)"
+	default:
+		route.Path = path
+	}
+	if route.PathRegex != "" {
+		route.StripPrefix = false
+		if route.PrefixRewrite != "" {
+			route.Rewrite = &config.RewriteConfig{
+				Pattern: "^" + regexp.QuoteMeta(path),
+				Target:  strings.ReplaceAll(route.PrefixRewrite, "$", "$$"),
+			}
+			route.PrefixRewrite = ""
+		}
+	}
+
+	// Host-specific routes win over routes for any host
+	route.Headers = mergeMaps(route.Headers, m.headers)
+	route.Query = mergeMaps(route.Query, m.query)
+	if m.host != "" {
+		route.Headers = mergeMaps(route.Headers, map[string]string{"Host": m.host})
+		route.Priority += 2
+	}
+
+	if err := route.Validate(); err != nil {
+		b.skip(obj, "%v", err)
+		return
+	}
+	b.routes = append(b.routes, route)
+}
+
+// table sorts the routes and drops the ones another resource already serves
+func (b *builder) table() *Table {
+	// Routes with more predicates are tried first among equals
+	slices.SortStableFunc(b.routes, func(x, y config.Route) int {
+		return cmp.Compare(len(y.Headers)+len(y.Query), len(x.Headers)+len(x.Query))
+	})
+	routes := &config.RouteConfig{Routes: b.routes}
+	routes.Sort()
+
+	drop := make(map[int]bool)
+	for _, conflict := range routes.Conflicts() {
+		if conflict.Ambiguous && !drop[conflict.Index] {
+			drop[conflict.Index] = true
+			b.skipped = append(b.skipped, fmt.Errorf("%s is already served", conflict))
+		}
+	}
+	// Conflicts can't compare regex routes; exact paths are the same regex
+	for i, route := range routes.Routes {
+		for _, winner := range routes.Routes[:i] {
+			if route.PathRegex != "" && !drop[i] && sameMatch(winner, route) {
+				drop[i] = true
+				b.skipped = append(b.skipped, fmt.Errorf("route %s is already served", route.PathRegex))
+			}
+		}
+	}
+	if len(drop) > 0 {
+		kept := make([]config.Route, 0, len(routes.Routes)-len(drop))
+		for i, route := range routes.Routes {
+			if !drop[i] {
+				kept = append(kept, route)
+			}
+		}
+		routes.Routes = kept
+	}
+
+	// Only keep the services routes still use
+	services := make(map[string]config.ServiceConfig)
+	for _, route := range routes.Routes {
+		services[route.Service] = b.services[route.Service]
+		if route.Experiment != nil {
+			for _, v := range route.Experiment.Variants {
+				services[v.Service] = b.services[v.Service]
+			}
+		}
+	}
+	return &Table{Routes: routes, Services: services, Skipped: b.skipped}
+}
+
+// sameMatch reports whether two routes match the same requests
+func sameMatch(a, b config.Route) bool {
+	return a.PathRegex == b.PathRegex && a.Path == b.Path && a.Priority == b.Priority &&
+		reflect.DeepEqual(a.Headers, b.Headers) && reflect.DeepEqual(a.Query, b.Query) &&
+		slices.ContainsFunc(a.Methods, func(m string) bool { return slices.Contains(b.Methods, m) })
+}
+
+// baseRoute returns the route settings from the resource's annotations
+func baseRoute(obj object) (config.Route, error) {
+	var route config.Route
+	if settings := obj.Metadata.Annotations[AnnotationRoute]; settings != "" {
+		if err := yaml.Unmarshal([]byte(settings), &route); err != nil {
+			return route, fmt.Errorf("%s: %w", AnnotationRoute, err)
+		}
+		// Paths, predicates and backends come from the resource
+		route.Path, route.PathRegex, route.Service = "", "", ""
+		route.Experiment, route.ReadService = nil, ""
+	}
+	if public := obj.Metadata.Annotations[AnnotationPublic]; public != "" {
+		v, err := strconv.ParseBool(public)
+		if err != nil {
+			return route, fmt.Errorf("%s: %w", AnnotationPublic, err)
+		}
+		route.Public = v
+	}
+	return route, nil
+}
+
+// mergeMaps merges maps into a new one, later values winning
+func mergeMaps(ms ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, m := range ms {
+		for k, v := range m {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
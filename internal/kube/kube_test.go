@@ -0,0 +1,252 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+// parse decodes a resource
+func parse(t *testing.T, resource string) object {
+	t.Helper()
+	var obj object
+	if err := json.Unmarshal([]byte(resource), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// translate builds the table of resources
+func translate(cfg config.KubernetesConfig, fn func(*builder, object), objects ...object) *Table {
+	cfg.ClusterDomain = "cluster.local"
+	b := &builder{cluster: cfg, services: make(map[string]config.ServiceConfig)}
+	for _, obj := range objects {
+		fn(b, obj)
+	}
+	return b.table()
+}
+
+const ordersIngress = `{
+  "metadata": {"name": "orders", "namespace": "shop", "creationTimestamp": "2026-01-01T00:00:00Z",
+    "annotations": {"gateway.minisource.io/route": "requiredRoles: [orders]\ntimeout: 5s\npath: /ignored"}},
+  "spec": {
+    "ingressClassName": "minisource",
+    "defaultBackend": {"service": {"name": "web", "port": {"number": 80}}},
+    "rules": [
+      {"host": "api.example.com", "http": {"paths": [
+        {"path": "/api/v1/orders/", "pathType": "Prefix", "backend": {"service": {"name": "orders", "port": {"number": 8080}}}},
+        {"path": "/api/v1/orders/count", "pathType": "Exact", "backend": {"service": {"name": "orders", "port": {"number": 8080}}}},
+        {"path": "/api/v1/stock", "pathType": "Prefix", "backend": {"service": {"name": "stock", "port": {"name": "http"}}}}
+      ]}},
+      {"host": "*.example.com", "http": {"paths": [
+        {"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 80}}}}
+      ]}}
+    ]
+  }
+}`
+
+func TestTranslateIngress(t *testing.T) {
+	other := parse(t, `{"metadata": {"name": "legacy", "namespace": "shop", "annotations": {"kubernetes.io/ingress.class": "nginx"}},
+		"spec": {"defaultBackend": {"service": {"name": "legacy", "port": {"number": 80}}}}}`)
+	table := translate(config.KubernetesConfig{IngressClass: "minisource"}, translateIngress, parse(t, ordersIngress), other)
+
+	routes := table.Routes.Routes
+	if len(routes) != 3 {
+		t.Fatalf("routes = %+v", routes)
+	}
+	exact, prefix, fallback := routes[0], routes[1], routes[2]
+	if exact.PathRegex != `^/api/v1/orders/count$` || exact.Priority != 3 || exact.Headers["Host"] != "api.example.com" {
+		t.Errorf("exact route = %+v", exact)
+	}
+	if prefix.Path != "/api/v1/orders" || prefix.Service != "orders.shop:8080" || prefix.Timeout != "5s" ||
+		len(prefix.RequiredRoles) != 1 || prefix.Public || len(prefix.Methods) != len(allMethods) {
+		t.Errorf("prefix route = %+v", prefix)
+	}
+	if fallback.Path != "/" || fallback.Service != "web.shop:80" || fallback.Priority != -1 || fallback.Headers != nil {
+		t.Errorf("default backend route = %+v", fallback)
+	}
+
+	if got := table.Services["orders.shop:8080"].URL; got != "http://orders.shop.svc.cluster.local:8080" {
+		t.Errorf("service URL = %s", got)
+	}
+	if len(table.Services) != 2 {
+		t.Errorf("services = %v", table.Services)
+	}
+	// The named port and the wildcard host
+	if len(table.Skipped) != 2 {
+		t.Errorf("skipped = %v", table.Skipped)
+	}
+}
+
+func TestTranslateHTTPRoute(t *testing.T) {
+	route := parse(t, `{
+	  "metadata": {"name": "checkout", "namespace": "shop", "annotations": {"gateway.minisource.io/public": "true"}},
+	  "spec": {
+	    "parentRefs": [{"name": "minisource", "namespace": "gateways"}],
+	    "hostnames": ["shop.example.com"],
+	    "rules": [
+	      {"matches": [{"path": {"type": "PathPrefix", "value": "/checkout"}, "method": "POST",
+	          "headers": [{"name": "X-Canary", "value": "1"}]}],
+	       "filters": [{"type": "URLRewrite", "urlRewrite": {"path": {"type": "ReplacePrefixMatch", "replacePrefixMatch": "/v2/checkout"}}}],
+	       "backendRefs": [{"name": "checkout-v2", "port": 80}]},
+	      {"matches": [{"path": {"type": "PathPrefix", "value": "/checkout"}}],
+	       "filters": [{"type": "URLRewrite", "urlRewrite": {"path": {"type": "ReplacePrefixMatch", "replacePrefixMatch": "/"}}},
+	                   {"type": "RequestHeaderModifier", "requestHeaderModifier": {"set": [{"name": "X-Shop", "value": "1"}]}}],
+	       "backendRefs": [{"name": "checkout", "port": 80, "weight": 90}, {"name": "checkout-v2", "port": 80, "weight": 10},
+	                       {"name": "other", "namespace": "billing", "port": 80}]},
+	      {"matches": [{"path": {"type": "RegularExpression", "value": "/c.*"}}], "backendRefs": [{"name": "checkout", "port": 80}]},
+	      {"filters": [{"type": "RequestMirror"}], "backendRefs": [{"name": "checkout", "port": 80}]}
+	    ]
+	  }
+	}`)
+	detached := parse(t, `{"metadata": {"name": "other", "namespace": "shop"},
+		"spec": {"parentRefs": [{"name": "minisource"}], "rules": [{"backendRefs": [{"name": "other", "port": 80}]}]}}`)
+	table := translate(config.KubernetesConfig{Gateway: "gateways/minisource"}, translateHTTPRoute, route, detached)
+
+	routes := table.Routes.Routes
+	if len(routes) != 2 {
+		t.Fatalf("routes = %+v", routes)
+	}
+	canary, split := routes[0], routes[1]
+	if canary.Service != "checkout-v2.shop:80" || canary.Headers["X-Canary"] != "1" || canary.Headers["Host"] != "shop.example.com" ||
+		len(canary.Methods) != 1 || !canary.Public || canary.PrefixRewrite != "/v2/checkout" || canary.StripPrefix {
+		t.Errorf("canary route = %+v", canary)
+	}
+	if !split.StripPrefix || split.RequestHeaders.Add["X-Shop"] != "1" || split.Experiment == nil ||
+		len(split.Experiment.Variants) != 2 || split.Experiment.Variants[0].Weight != 90 {
+		t.Errorf("split route = %+v", split)
+	}
+	// The cross-namespace backend, the regex match and the mirror filter
+	if len(table.Skipped) != 3 {
+		t.Errorf("skipped = %v", table.Skipped)
+	}
+}
+
+func TestOlderResourceKeepsPath(t *testing.T) {
+	older := parse(t, ordersIngress)
+	newer := parse(t, strings.Replace(strings.Replace(ordersIngress, `"name": "orders", "namespace"`, `"name": "orders-copy", "namespace"`, 1),
+		"2026-01-01", "2026-02-01", 1))
+
+	c := &Controller{cfg: config.KubernetesConfig{IngressClass: "minisource"}, translate: translateIngress,
+		objects: map[string]object{older.key(): older, newer.key(): newer}}
+	table := c.build()
+	if len(table.Routes.Routes) != 3 {
+		t.Fatalf("routes = %+v", table.Routes.Routes)
+	}
+	if err := table.Routes.Validate(); err != nil {
+		t.Error(err)
+	}
+	var duplicates int
+	for _, err := range table.Skipped {
+		if strings.Contains(err.Error(), "already served") {
+			duplicates++
+		}
+	}
+	if duplicates != 3 {
+		t.Errorf("skipped = %v", table.Skipped)
+	}
+}
+
+// fakeAPI serves an ingress list and a watch streaming the events sent to it
+type fakeAPI struct {
+	mu      sync.Mutex
+	items   []string
+	version int
+	events  chan string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" || r.URL.Path != "/apis/networking.k8s.io/v1/namespaces/shop/ingresses" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.URL.Query().Get("watch") == "" {
+		f.mu.Lock()
+		fmt.Fprintf(w, `{"metadata": {"resourceVersion": "%d"}, "items": [%s]}`, f.version, strings.Join(f.items, ","))
+		f.mu.Unlock()
+		return
+	}
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case ev := <-f.events:
+			fmt.Fprintln(w, ev)
+			w.(http.Flusher).Flush()
+			if strings.Contains(ev, `"ERROR"`) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func TestControllerWatch(t *testing.T) {
+	api := &fakeAPI{items: []string{ordersIngress}, version: 10, events: make(chan string)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	token := t.TempDir() + "/token"
+	if err := os.WriteFile(token, []byte("token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(config.KubernetesConfig{
+		Resources:     ResourcesIngress,
+		IngressClass:  "minisource",
+		Namespace:     "shop",
+		APIServer:     server.URL,
+		TokenFile:     token,
+		RetryInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := c.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Routes.Routes) != 3 {
+		t.Fatalf("loaded %d routes", len(table.Routes.Routes))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	applied := make(chan *Table, 1)
+	go c.Watch(ctx, func(table *Table) { applied <- table }, func(err error) { t.Log(err) })
+	expectRoutes := func(n int) {
+		t.Helper()
+		select {
+		case table := <-applied:
+			if len(table.Routes.Routes) != n {
+				t.Errorf("applied %d routes, want %d", len(table.Routes.Routes), n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("change not applied")
+		}
+	}
+
+	users := `{"metadata": {"name": "users", "namespace": "shop", "resourceVersion": "11"}, "spec": {"ingressClassName": "minisource",
+		"rules": [{"http": {"paths": [{"path": "/api/v1/users", "pathType": "Prefix", "backend": {"service": {"name": "users", "port": {"number": 80}}}}]}}]}}`
+	api.events <- `{"type": "ADDED", "object": ` + users + `}`
+	expectRoutes(4)
+
+	// A bookmark changes nothing; an expired version lists again
+	api.events <- `{"type": "BOOKMARK", "object": {"metadata": {"resourceVersion": "12"}}}`
+	api.mu.Lock()
+	api.items, api.version = []string{users}, 13
+	api.mu.Unlock()
+	api.events <- `{"type": "ERROR", "object": {"kind": "Status", "code": 410, "message": "too old"}}`
+	expectRoutes(1)
+
+	api.events <- `{"type": "DELETED", "object": ` + users + `}`
+	expectRoutes(0)
+}
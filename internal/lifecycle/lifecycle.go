@@ -0,0 +1,122 @@
+// Package lifecycle starts the gateway's subsystems in order and stops them
+// in reverse order, bounding each stop so one stalled component can't hold
+// up the rest of the shutdown.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// Component is a subsystem with a managed lifetime
+type Component interface {
+	// Start brings the component up; long-running work belongs in goroutines
+	Start(ctx context.Context) error
+	// Stop releases the component's resources, giving up when ctx is done
+	Stop(ctx context.Context) error
+}
+
+// Hook adapts functions to a Component. Nil functions are skipped.
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Start implements Component
+func (h Hook) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+// Stop implements Component
+func (h Hook) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// Manager runs components in registration order
+type Manager struct {
+	logger     middleware.Logger
+	components []component
+	started    int
+}
+
+type component struct {
+	name    string
+	c       Component
+	timeout time.Duration
+}
+
+// New creates a lifecycle manager
+func New(logger middleware.Logger) *Manager {
+	return &Manager{logger: logger}
+}
+
+// Register adds a component. Components start in registration order and
+// stop in reverse, so register dependencies first. timeout bounds its Stop
+// (0 leaves it to the shutdown deadline).
+func (m *Manager) Register(name string, c Component, timeout time.Duration) {
+	m.components = append(m.components, component{name: name, c: c, timeout: timeout})
+}
+
+// Start starts every component in order. If one fails, those already
+// started are stopped again and the error names the failing component.
+func (m *Manager) Start(ctx context.Context) error {
+	for _, comp := range m.components[m.started:] {
+		if err := comp.c.Start(ctx); err != nil {
+			stopErr := m.Stop(ctx)
+			return errors.Join(fmt.Errorf("start %s: %w", comp.name, err), stopErr)
+		}
+		m.started++
+		m.logger.Debug("Component started", "component", comp.name)
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse order. A component that
+// hasn't returned by its timeout or ctx's deadline is reported as stalled
+// and left behind so the others still get to stop.
+func (m *Manager) Stop(ctx context.Context) error {
+	var errs []error
+	for ; m.started > 0; m.started-- {
+		comp := m.components[m.started-1]
+		if err := m.stop(ctx, comp); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", comp.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stop runs one component's Stop within its timeout
+func (m *Manager) stop(ctx context.Context, comp component) error {
+	if comp.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, comp.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- comp.c.Stop(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			m.logger.Error("Component failed to stop", "component", comp.name, "error", err)
+			return err
+		}
+		m.logger.Info("Component stopped", "component", comp.name, "duration", time.Since(start).String())
+		return nil
+	case <-ctx.Done():
+		m.logger.Error("Component stalled during shutdown", "component", comp.name, "waited", time.Since(start).String())
+		return ctx.Err()
+	}
+}
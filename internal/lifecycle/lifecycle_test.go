@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// recorder returns a hook logging its calls
+func recorder(name string, calls *[]string) Hook {
+	return Hook{
+		OnStart: func(context.Context) error { *calls = append(*calls, "start "+name); return nil },
+		OnStop:  func(context.Context) error { *calls = append(*calls, "stop "+name); return nil },
+	}
+}
+
+func TestManagerOrder(t *testing.T) {
+	var calls []string
+	m := New(nopLogger{})
+	m.Register("redis", recorder("redis", &calls), 0)
+	m.Register("proxy", recorder("proxy", &calls), 0)
+	m.Register("server", recorder("server", &calls), 0)
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start redis", "start proxy", "start server", "stop server", "stop proxy", "stop redis"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	var calls []string
+	m := New(nopLogger{})
+	m.Register("redis", recorder("redis", &calls), 0)
+	m.Register("admin", Hook{OnStart: func(context.Context) error { return errors.New("port in use") }}, 0)
+	m.Register("server", recorder("server", &calls), 0)
+
+	err := m.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "start admin: port in use") {
+		t.Fatalf("err = %v, want the failing component named", err)
+	}
+	if want := []string{"start redis", "stop redis"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestManagerStalledStop(t *testing.T) {
+	var calls []string
+	m := New(nopLogger{})
+	m.Register("redis", recorder("redis", &calls), 0)
+	m.Register("tracer", Hook{OnStop: func(context.Context) error {
+		time.Sleep(time.Second) // ignores its context
+		return nil
+	}}, 10*time.Millisecond)
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := m.Stop(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stop tracer") {
+		t.Errorf("err = %v, want the stalled tracer reported", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("stop waited %s for the stalled component", elapsed)
+	}
+	if want := []string{"start redis", "stop redis"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,171 @@
+// Package listener wraps the gateway's network listener to observe
+// connections below the request level (accepts, TLS handshakes, timeouts),
+// which is where load balancer and keepalive problems show up.
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// Options configures the wrapped listener
+type Options struct {
+	// TLS, when set, serves connections over TLS and counts handshake failures
+	TLS *tls.Config
+	// ProxyProtocol expects a PROXY protocol v1/v2 header on every connection
+	// from ProxyProtocolSources (all peers when empty), read within
+	// ProxyProtocolTimeout
+	ProxyProtocol        bool
+	ProxyProtocolTimeout time.Duration
+	ProxyProtocolSources []string
+	// ReadStallTimeout and MinReadRate (bytes per second) close connections
+	// whose requests arrive too slowly; 0 disables them
+	ReadStallTimeout time.Duration
+	MinReadRate      int
+}
+
+// Listener records connection metrics for every accepted connection
+type Listener struct {
+	net.Listener
+	opts    Options
+	sources []*net.IPNet
+}
+
+// New wraps ln
+func New(ln net.Listener, opts Options) (*Listener, error) {
+	sources, err := parseSources(opts.ProxyProtocolSources)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{Listener: ln, opts: opts, sources: sources}, nil
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	raw, err := l.Listener.Accept()
+	if err != nil {
+		if !errors.Is(err, net.ErrClosed) {
+			middleware.RecordConnAcceptError()
+		}
+		return nil, err
+	}
+
+	middleware.RecordConnAccepted()
+	var conn net.Conn = &trackedConn{Conn: raw}
+	// The PROXY header precedes the TLS handshake on the wire
+	if l.opts.ProxyProtocol && allowedSource(raw.RemoteAddr(), l.sources) {
+		conn = newProxyConn(conn, l.opts.ProxyProtocolTimeout)
+	}
+	var tc *tlsConn
+	if l.opts.TLS != nil {
+		tc = &tlsConn{Conn: tls.Server(conn, l.opts.TLS)}
+		conn = tc
+	}
+	if l.opts.ReadStallTimeout > 0 || l.opts.MinReadRate > 0 {
+		sc := newSlowConn(conn, l.opts.ReadStallTimeout, l.opts.MinReadRate)
+		conn = sc
+		if tc != nil {
+			conn = &tlsSlowConn{slowConn: sc, tlsState: tlsState{tc}}
+		}
+	}
+	wc := &watchedConn{Conn: conn}
+	if tc != nil {
+		return &tlsWatchedConn{watchedConn: wc, tlsState: tlsState{tc}}, nil
+	}
+	return wc, nil
+}
+
+// trackedConn notes whether the last read timed out so the close can be
+// attributed to it
+type trackedConn struct {
+	net.Conn
+	timedOut  bool
+	closeOnce sync.Once
+}
+
+// Read implements net.Conn
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	var netErr net.Error
+	c.timedOut = errors.As(err, &netErr) && netErr.Timeout()
+	return n, err
+}
+
+// Close implements net.Conn
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		reason := "closed"
+		if c.timedOut {
+			reason = "timeout"
+		}
+		middleware.RecordConnClosed(reason)
+	})
+	return c.Conn.Close()
+}
+
+// tlsConn performs the handshake on first use so its failures can be
+// counted separately from request errors
+type tlsConn struct {
+	*tls.Conn
+	once sync.Once
+	err  error
+}
+
+func (c *tlsConn) handshake() error {
+	c.once.Do(func() {
+		if c.err = c.Conn.Handshake(); c.err != nil {
+			middleware.RecordTLSHandshakeError()
+		}
+	})
+	return c.err
+}
+
+// Read implements net.Conn
+func (c *tlsConn) Read(b []byte) (int, error) {
+	if err := c.handshake(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// Write implements net.Conn
+func (c *tlsConn) Write(b []byte) (int, error) {
+	if err := c.handshake(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// tlsState forwards the methods fasthttp finds TLS connections by
+// (Handshake and ConnectionState) to the TLS layer under a wrapper, so
+// IsTLS and TLSConnectionState still see it
+type tlsState struct {
+	tls *tlsConn
+}
+
+// Handshake runs the TLS handshake, counting failures once
+func (s tlsState) Handshake() error {
+	return s.tls.handshake()
+}
+
+// ConnectionState returns the TLS connection state
+func (s tlsState) ConnectionState() tls.ConnectionState {
+	return s.tls.ConnectionState()
+}
+
+// tlsWatchedConn is a watchedConn over TLS
+type tlsWatchedConn struct {
+	*watchedConn
+	tlsState
+}
+
+// tlsSlowConn is a slowConn over TLS
+type tlsSlowConn struct {
+	*slowConn
+	tlsState
+}
@@ -0,0 +1,211 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxProxyV1Length is the longest valid v1 header, including CRLF
+const maxProxyV1Length = 107
+
+// errNoProxyHeader is returned for connections that don't start with a PROXY header
+var errNoProxyHeader = errors.New("listener: missing PROXY protocol header")
+
+// proxyConn reads a PROXY protocol header before the first use of the
+// connection and reports the client address it carries as RemoteAddr.
+// Parsing is deferred so a slow peer never blocks Accept.
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+}
+
+func newProxyConn(conn net.Conn, timeout time.Duration) *proxyConn {
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+}
+
+func (c *proxyConn) init() error {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.remoteAddr, c.err = readProxyHeader(c.reader)
+		if c.err != nil {
+			middleware.RecordProxyProtocolError()
+		}
+	})
+	return c.err
+}
+
+// Read implements net.Conn
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if err := c.init(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header, or the
+// peer's address for LOCAL/UNKNOWN headers and failed parses
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if err := c.init(); err == nil && c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader parses a v1 or v2 header. A nil address means the header
+// carried no client address (LOCAL or UNKNOWN).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		// Short connections may still hold a v1 header
+		if prefix, _ = r.Peek(5); string(prefix) != "PROXY" {
+			return nil, errNoProxyHeader
+		}
+	}
+
+	switch {
+	case bytes.Equal(prefix, proxyV2Signature):
+		return readProxyV2(r)
+	case bytes.HasPrefix(prefix, []byte("PROXY ")):
+		return readProxyV1(r)
+	}
+	return nil, errNoProxyHeader
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6 src dst sport dport\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyV1Length {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("listener: PROXY v1 header too long")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("listener: malformed PROXY v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("listener: malformed PROXY v1 address %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 parses the binary v2 header, skipping any TLVs
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 {
+		return nil, fmt.Errorf("listener: unsupported PROXY version %d", version)
+	}
+	family := header[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	// LOCAL connections (e.g. load balancer health checks) keep the peer address
+	if command == 0x0 {
+		return nil, nil
+	}
+	if command != 0x1 {
+		return nil, fmt.Errorf("listener: unsupported PROXY v2 command %d", command)
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("listener: short PROXY v2 IPv4 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("listener: short PROXY v2 IPv6 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	// Other families (UDP, unix) carry no usable client address
+	return nil, nil
+}
+
+// parseSources parses IPs and CIDRs allowed to send PROXY headers
+func parseSources(sources []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+				source += "/32"
+			} else {
+				source += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROXY protocol source %q: %w", source, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// allowedSource reports whether addr may send a PROXY header. An empty
+// list allows every peer.
+func allowedSource(addr net.Addr, sources []*net.IPNet) bool {
+	if len(sources) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range sources {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
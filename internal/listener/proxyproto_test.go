@@ -0,0 +1,57 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\nGET / HTTP/1.1\r\n"))
+
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addr.String(); got != "203.0.113.7:51234" {
+		t.Errorf("addr = %s", got)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("remaining data = %q", rest)
+	}
+}
+
+func TestReadProxyV2(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+	buf.Write([]byte{0x21, 0x11})
+	binary.Write(&buf, binary.BigEndian, uint16(12))
+	buf.Write(net.ParseIP("198.51.100.9").To4())
+	buf.Write(net.ParseIP("10.0.0.1").To4())
+	binary.Write(&buf, binary.BigEndian, uint16(40000))
+	binary.Write(&buf, binary.BigEndian, uint16(443))
+	buf.WriteString("GET")
+
+	r := bufio.NewReader(&buf)
+	addr, err := readProxyHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addr.String(); got != "198.51.100.9:40000" {
+		t.Errorf("addr = %s", got)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET" {
+		t.Errorf("remaining data = %q", rest)
+	}
+}
+
+func TestReadProxyHeaderMissing(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	if _, err := readProxyHeader(r); err != errNoProxyHeader {
+		t.Errorf("err = %v, want errNoProxyHeader", err)
+	}
+}
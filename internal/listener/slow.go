@@ -0,0 +1,97 @@
+package listener
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/minisource/gateway/internal/middleware"
+)
+
+// slowConn closes connections whose requests arrive too slowly (slowloris
+// and slow body attacks). Once the first byte of a request is read, every
+// further read must return within stall, and the request as a whole must
+// keep up with minRate bytes per second after that grace. The request ends
+// when the response is written. The server's own deadlines still apply;
+// the earliest wins. It is only used from the connection's serving
+// goroutine.
+type slowConn struct {
+	net.Conn
+	stall   time.Duration
+	minRate int
+
+	// deadline is the read deadline the server set
+	deadline time.Time
+	// start is when the request's first byte was read; zero between requests
+	start    time.Time
+	received int
+}
+
+func newSlowConn(conn net.Conn, stall time.Duration, minRate int) *slowConn {
+	return &slowConn{Conn: conn, stall: stall, minRate: minRate}
+}
+
+// limit returns the deadline for the next read of a request in progress
+// and which limit sets it: stall, rate, or "" for the server's deadline
+func (c *slowConn) limit(now time.Time) (time.Time, string) {
+	deadline, reason := c.deadline, ""
+	earlier := func(t time.Time, why string) {
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline, reason = t, why
+		}
+	}
+	if c.stall > 0 {
+		earlier(now.Add(c.stall), "stall")
+	}
+	if c.minRate > 0 {
+		allowed := c.stall + time.Duration(c.received)*time.Second/time.Duration(c.minRate)
+		earlier(c.start.Add(allowed), "rate")
+	}
+	return deadline, reason
+}
+
+// Read implements net.Conn
+func (c *slowConn) Read(b []byte) (int, error) {
+	reason := ""
+	if !c.start.IsZero() {
+		var deadline time.Time
+		if deadline, reason = c.limit(time.Now()); reason != "" {
+			c.Conn.SetReadDeadline(deadline)
+		}
+	}
+
+	n, err := c.Conn.Read(b)
+	if reason != "" {
+		c.Conn.SetReadDeadline(c.deadline)
+	}
+	if n > 0 {
+		if c.start.IsZero() {
+			c.start, c.received = time.Now(), 0
+		}
+		c.received += n
+	}
+
+	var netErr net.Error
+	if reason != "" && errors.As(err, &netErr) && netErr.Timeout() {
+		middleware.RecordSlowConnection(reason)
+	}
+	return n, err
+}
+
+// Write implements net.Conn; a response ends the request being read
+func (c *slowConn) Write(b []byte) (int, error) {
+	c.start = time.Time{}
+	return c.Conn.Write(b)
+}
+
+// SetDeadline implements net.Conn
+func (c *slowConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn
+func (c *slowConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
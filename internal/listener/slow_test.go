@@ -0,0 +1,95 @@
+package listener
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// isTimeout reports whether err is a read deadline passing
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestSlowConnStall(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newSlowConn(server, 50*time.Millisecond, 0)
+	buf := make([]byte, 64)
+
+	// Waiting for a request isn't limited
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		client.Write([]byte("GET / HTTP/1.1\r\n"))
+	}()
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("idle wait = %v", err)
+	}
+
+	// The rest of the request stalls
+	started := time.Now()
+	if _, err := conn.Read(buf); !isTimeout(err) {
+		t.Fatalf("stalled request = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("stall detected after %v", elapsed)
+	}
+}
+
+func TestSlowConnRate(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	// 100 bytes/s after a 100ms grace: the 10th byte is due by 200ms
+	conn := newSlowConn(server, 100*time.Millisecond, 100)
+
+	go func() {
+		for range 20 {
+			if _, err := client.Write([]byte("x")); err != nil {
+				return
+			}
+			time.Sleep(40 * time.Millisecond)
+		}
+	}()
+
+	buf := make([]byte, 1)
+	for i := range 20 {
+		if _, err := conn.Read(buf); err != nil {
+			if !isTimeout(err) || i < 3 {
+				t.Fatalf("byte %d = %v", i, err)
+			}
+			return
+		}
+	}
+	t.Fatal("trickled request not closed")
+}
+
+func TestSlowConnResponseEndsRequest(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newSlowConn(server, 50*time.Millisecond, 0)
+	buf := make([]byte, 64)
+
+	go client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		b := make([]byte, 64)
+		client.Read(b)
+	}()
+	if _, err := conn.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server's keep-alive deadline applies again, not the stall limit
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	started := time.Now()
+	if _, err := conn.Read(buf); !isTimeout(err) {
+		t.Fatalf("idle read = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Errorf("idle connection timed out after %v, before the server's deadline", elapsed)
+	}
+}
@@ -0,0 +1,87 @@
+package listener
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// watchedConn is the outermost wrapper of every accepted connection (inside
+// tlsWatchedConn, which only adds the TLS methods). It lets
+// a handler watch for the client going away while the connection is otherwise
+// idle (the server doesn't read while a handler runs); any bytes read while
+// watching, e.g. a pipelined request, are handed back on the next Read.
+type watchedConn struct {
+	net.Conn
+	mu      sync.Mutex
+	pending []byte
+}
+
+// Read implements net.Conn
+func (c *watchedConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		c.mu.Unlock()
+		return n, nil
+	}
+	c.mu.Unlock()
+	return c.Conn.Read(b)
+}
+
+// WatchClose reports on gone when the client closes conn. Call stop before
+// the connection is used again; it waits for the watcher to finish. Only
+// connections accepted by a Listener can be watched; for others gone is nil.
+// Watching ends early, without reporting, if the client sends more data.
+func WatchClose(conn net.Conn) (gone <-chan struct{}, stop func()) {
+	var wc *watchedConn
+	switch c := conn.(type) {
+	case *watchedConn:
+		wc = c
+	case *tlsWatchedConn:
+		wc = c.watchedConn
+	default:
+		return nil, func() {}
+	}
+
+	// Waiting on an idle client isn't a slow request
+	inner := wc.Conn
+	switch sc := inner.(type) {
+	case *slowConn:
+		inner = sc.Conn
+	case *tlsSlowConn:
+		inner = sc.Conn
+	}
+
+	goneCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var b [1]byte
+		n, err := inner.Read(b[:])
+		if n > 0 {
+			wc.mu.Lock()
+			wc.pending = append(wc.pending, b[:n]...)
+			wc.mu.Unlock()
+		}
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			close(goneCh)
+		}
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			// Unblock the watcher's read; the server sets its own deadline
+			// before it reads the next request
+			wc.Conn.SetReadDeadline(time.Unix(1, 0))
+			<-done
+			wc.Conn.SetReadDeadline(time.Time{})
+		})
+	}
+	return goneCh, stop
+}
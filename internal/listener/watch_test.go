@@ -0,0 +1,47 @@
+package listener
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWatchClose(t *testing.T) {
+	server, client := net.Pipe()
+	conn := &watchedConn{Conn: server}
+
+	gone, stop := WatchClose(conn)
+	client.Close()
+
+	select {
+	case <-gone:
+	case <-time.After(time.Second):
+		t.Fatal("client close not reported")
+	}
+	stop()
+}
+
+func TestWatchCloseKeepsPipelinedData(t *testing.T) {
+	server, client := net.Pipe()
+	conn := &watchedConn{Conn: server}
+
+	gone, stop := WatchClose(conn)
+	go client.Write([]byte("GET /next"))
+
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	select {
+	case <-gone:
+		t.Fatal("pipelined data reported as close")
+	default:
+	}
+
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "GET /next" {
+		t.Errorf("read %q after watching", buf)
+	}
+}
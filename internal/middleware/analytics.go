@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// analyticsSlots is the number of one-minute slots kept per route, the
+// longest window a report can cover
+const analyticsSlots = 60
+
+// latencyBoundsMs are the upper bounds of the latency histogram buckets.
+// Percentiles are reported as the bound of the bucket they fall in.
+var latencyBoundsMs = [...]float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// otherConsumers collects consumers beyond a slot's cardinality cap
+const otherConsumers = "(other)"
+
+// RouteAnalytics keeps rolling per-route aggregates in memory for quick
+// triage: request count, status distribution, top consumers and latency
+// percentiles over the last minutes, in one-minute slots
+type RouteAnalytics struct {
+	cfg config.AnalyticsConfig
+
+	mu     sync.Mutex
+	routes map[string]*routeSlots
+}
+
+// routeSlots is a ring of one-minute slots indexed by minute
+type routeSlots [analyticsSlots]analyticsSlot
+
+type analyticsSlot struct {
+	minute    int64
+	requests  int64
+	statuses  map[int]int64
+	consumers map[string]int64
+	latency   [len(latencyBoundsMs) + 1]int64 // the last bucket is overflow
+}
+
+// RouteReport summarizes one route over a window
+type RouteReport struct {
+	Route        string          `json:"route"`
+	Requests     int64           `json:"requests"`
+	Statuses     map[int]int64   `json:"statuses"`
+	TopConsumers []ConsumerCount `json:"topConsumers"`
+	P50Ms        float64         `json:"p50Ms"`
+	P95Ms        float64         `json:"p95Ms"`
+}
+
+// ConsumerCount is a consumer (user ID or IP) and its request count
+type ConsumerCount struct {
+	Consumer string `json:"consumer"`
+	Requests int64  `json:"requests"`
+}
+
+// NewRouteAnalytics creates route analytics
+func NewRouteAnalytics(cfg config.AnalyticsConfig) *RouteAnalytics {
+	return &RouteAnalytics{
+		cfg:    cfg,
+		routes: make(map[string]*routeSlots),
+	}
+}
+
+// Middleware records every routed request. It reads the final status and
+// the authenticated user, so it runs before authentication.
+func (a *RouteAnalytics) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !a.cfg.Enabled {
+			return c.Next()
+		}
+
+		start := time.Now()
+		err := c.Next()
+
+		route, ok := reqctx.Route(c)
+		if !ok {
+			return err
+		}
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		consumer := reqctx.UserID(c)
+		if consumer == "" {
+			consumer = c.IP()
+		}
+		a.record(route.Pattern(), status, consumer, time.Since(start), start)
+		return err
+	}
+}
+
+// record adds a request to the slot of its minute
+func (a *RouteAnalytics) record(route string, status int, consumer string, latency time.Duration, now time.Time) {
+	minute := now.Unix() / 60
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	slots, ok := a.routes[route]
+	if !ok {
+		slots = &routeSlots{}
+		a.routes[route] = slots
+	}
+	slot := &slots[minute%analyticsSlots]
+	if slot.minute != minute {
+		*slot = analyticsSlot{
+			minute:    minute,
+			statuses:  make(map[int]int64),
+			consumers: make(map[string]int64),
+		}
+	}
+
+	slot.requests++
+	slot.statuses[status]++
+	if _, seen := slot.consumers[consumer]; !seen && len(slot.consumers) >= a.cfg.MaxConsumers {
+		consumer = otherConsumers
+	}
+	slot.consumers[consumer]++
+	slot.latency[latencyBucket(latency)]++
+}
+
+// Report summarizes every route seen in the last window, busiest first,
+// listing up to top consumers per route
+func (a *RouteAnalytics) Report(window time.Duration, top int) []RouteReport {
+	now := time.Now()
+
+	a.mu.Lock()
+	reports := make([]RouteReport, 0, len(a.routes))
+	for route, slots := range a.routes {
+		if report := slots.report(route, window, top, now); report.Requests > 0 {
+			reports = append(reports, report)
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Requests != reports[j].Requests {
+			return reports[i].Requests > reports[j].Requests
+		}
+		return reports[i].Route < reports[j].Route
+	})
+	return reports
+}
+
+// report merges the slots inside the window
+func (s *routeSlots) report(route string, window time.Duration, top int, now time.Time) RouteReport {
+	minutes := int64(window / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	if minutes > analyticsSlots {
+		minutes = analyticsSlots
+	}
+	oldest := now.Unix()/60 - minutes + 1
+
+	report := RouteReport{Route: route, Statuses: make(map[int]int64)}
+	consumers := make(map[string]int64)
+	var latency [len(latencyBoundsMs) + 1]int64
+	for i := range s {
+		slot := &s[i]
+		if slot.requests == 0 || slot.minute < oldest {
+			continue
+		}
+		report.Requests += slot.requests
+		for status, n := range slot.statuses {
+			report.Statuses[status] += n
+		}
+		for consumer, n := range slot.consumers {
+			consumers[consumer] += n
+		}
+		for b, n := range slot.latency {
+			latency[b] += n
+		}
+	}
+
+	report.TopConsumers = topConsumers(consumers, top)
+	report.P50Ms = latencyPercentile(latency[:], report.Requests, 0.50)
+	report.P95Ms = latencyPercentile(latency[:], report.Requests, 0.95)
+	return report
+}
+
+// topConsumers returns the n consumers with the most requests
+func topConsumers(consumers map[string]int64, n int) []ConsumerCount {
+	counts := make([]ConsumerCount, 0, len(consumers))
+	for consumer, requests := range consumers {
+		counts = append(counts, ConsumerCount{Consumer: consumer, Requests: requests})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Requests != counts[j].Requests {
+			return counts[i].Requests > counts[j].Requests
+		}
+		return counts[i].Consumer < counts[j].Consumer
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// latencyBucket returns the histogram bucket of a latency
+func latencyBucket(d time.Duration) int {
+	ms := float64(d) / float64(time.Millisecond)
+	return sort.SearchFloat64s(latencyBoundsMs[:], ms)
+}
+
+// latencyPercentile returns the upper bound of the bucket holding the q-th
+// request. Requests slower than the last bound report that bound.
+func latencyPercentile(buckets []int64, total int64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := int64(q*float64(total-1)) + 1
+	var seen int64
+	for i, n := range buckets {
+		seen += n
+		if seen >= rank && i < len(latencyBoundsMs) {
+			return latencyBoundsMs[i]
+		}
+	}
+	return latencyBoundsMs[len(latencyBoundsMs)-1]
+}
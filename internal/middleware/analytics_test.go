@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+func TestRouteAnalyticsReport(t *testing.T) {
+	a := NewRouteAnalytics(config.AnalyticsConfig{Enabled: true, MaxConsumers: 2})
+	now := time.Now()
+
+	for i := 0; i < 18; i++ {
+		a.record("/api/v1/users", 200, "alice", 20*time.Millisecond, now)
+	}
+	a.record("/api/v1/users", 500, "bob", 300*time.Millisecond, now)
+	a.record("/api/v1/users", 404, "carol", 300*time.Millisecond, now)
+	a.record("/api/v1/orders", 200, "alice", time.Millisecond, now)
+	a.record("/api/v1/orders", 200, "alice", time.Millisecond, now.Add(-10*time.Minute))
+
+	reports := a.Report(5*time.Minute, 2)
+	if len(reports) != 2 || reports[0].Route != "/api/v1/users" {
+		t.Fatalf("reports = %+v, want users first", reports)
+	}
+	users := reports[0]
+	if users.Requests != 20 || users.Statuses[200] != 18 || users.Statuses[500] != 1 {
+		t.Errorf("users requests = %d, statuses = %v", users.Requests, users.Statuses)
+	}
+	if users.P50Ms != 25 || users.P95Ms != 500 {
+		t.Errorf("users p50 = %v, p95 = %v, want 25 and 500", users.P50Ms, users.P95Ms)
+	}
+	// carol is past the cardinality cap of two consumers per slot
+	if want := []ConsumerCount{{"alice", 18}, {"(other)", 1}}; len(users.TopConsumers) != 2 ||
+		users.TopConsumers[0] != want[0] || users.TopConsumers[1] != want[1] {
+		t.Errorf("top consumers = %v, want %v", users.TopConsumers, want)
+	}
+
+	if orders := reports[1]; orders.Requests != 1 {
+		t.Errorf("orders in 5m = %d, want 1", orders.Requests)
+	}
+	if orders := a.Report(time.Hour, 10)[1]; orders.Requests != 2 {
+		t.Errorf("orders in 60m = %d, want 2", orders.Requests)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var buckets [len(latencyBoundsMs) + 1]int64
+	buckets[len(buckets)-1] = 3
+	if got := latencyPercentile(buckets[:], 3, 0.5); got != 10000 {
+		t.Errorf("overflow p50 = %v, want last bound", got)
+	}
+	if got := latencyPercentile(buckets[:], 0, 0.5); got != 0 {
+		t.Errorf("empty p50 = %v, want 0", got)
+	}
+	for i, bound := range latencyBoundsMs {
+		if got := latencyBucket(time.Duration(bound * float64(time.Millisecond))); got != i {
+			t.Errorf("bucket of %sms = %d, want %d", strconv.FormatFloat(bound, 'f', -1, 64), got, i)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Audit event types
+const (
+	AuditAuthFailure = "auth_failure"
+	AuditForbidden   = "forbidden"
+	AuditRateLimited = "rate_limited"
+	// AuditBlocked is a request blocked by a filter of the gateway (bots, geo)
+	AuditBlocked     = "blocked"
+	AuditAdminAction = "admin_action"
+)
+
+// AuditEvent is an entry of the security audit log
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	// Actor, Scope and Outcome describe admin API actions: the admin
+	// token's name, the scope needed and whether it was allowed
+	Actor   string `json:"actor,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// auditStatuses maps the statuses audited to event types
+var auditStatuses = map[int]string{
+	fiber.StatusUnauthorized:    AuditAuthFailure,
+	fiber.StatusForbidden:       AuditForbidden,
+	fiber.StatusTooManyRequests: AuditRateLimited,
+}
+
+// maxAuditedBody bounds the response bodies read for an error code
+const maxAuditedBody = 4096
+
+// auditQueueSize bounds the events waiting to be written
+const auditQueueSize = 1024
+
+// AuditLog writes security events as JSON lines to a sink of its own,
+// apart from the access logs, for SIEM ingestion. Events are written in the
+// background, so a slow sink never holds up requests; when it falls too far
+// behind, events are dropped and counted. A nil AuditLog drops events.
+type AuditLog struct {
+	w      io.WriteCloser
+	events chan []byte
+	done   chan struct{}
+	// closed is set under mu before events is closed, so Record never
+	// sends on the closed channel
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditLog opens the audit log sink: stdout, stderr, a file path, or a
+// syslog://host:port (UDP) or syslog+tcp://host:port collector. An empty
+// sink disables the audit log.
+func NewAuditLog(sink string) (*AuditLog, error) {
+	var w io.WriteCloser
+	switch {
+	case sink == "":
+		return nil, nil
+	case sink == "stdout":
+		w = nopCloser{os.Stdout}
+	case sink == "stderr":
+		w = nopCloser{os.Stderr}
+	case strings.HasPrefix(sink, "syslog://"):
+		w = newSyslogWriter("udp", strings.TrimPrefix(sink, "syslog://"))
+	case strings.HasPrefix(sink, "syslog+tcp://"):
+		w = newSyslogWriter("tcp", strings.TrimPrefix(sink, "syslog+tcp://"))
+	default:
+		f, err := os.OpenFile(sink, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("audit log: %w", err)
+		}
+		w = f
+	}
+	a := &AuditLog{w: w, events: make(chan []byte, auditQueueSize), done: make(chan struct{})}
+	go a.run()
+	return a, nil
+}
+
+// run writes queued events until the log is closed
+func (a *AuditLog) run() {
+	defer close(a.done)
+	for line := range a.events {
+		a.w.Write(line)
+	}
+}
+
+// Record writes an event
+func (a *AuditLog) Record(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.events <- append(line, '\n'):
+	default:
+		auditEventsDropped.Inc()
+	}
+}
+
+// RequestEvent returns an event describing the request
+func RequestEvent(c *fiber.Ctx, eventType, reason string) AuditEvent {
+	return AuditEvent{
+		Type:      eventType,
+		Reason:    reason,
+		Status:    c.Response().StatusCode(),
+		Method:    c.Method(),
+		Path:      c.Path(),
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		RequestID: reqctx.RequestID(c),
+		Service:   reqctx.Service(c),
+		UserID:    reqctx.UserID(c),
+		TenantID:  reqctx.TenantID(c),
+	}
+}
+
+// Close writes the queued events and closes the sink; events recorded
+// after it are lost
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return a.w.Close()
+}
+
+// Middleware audits rejected requests: authentication failures (401),
+// forbidden ones (403), rate limited ones (429) and those blocked by the
+// bot and geo filters, with the error code of the response as the reason.
+// It inspects the final status, so it must run before authentication and
+// rate limiting.
+func (a *AuditLog) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if a == nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		eventType, ok := auditStatuses[status]
+		if !ok {
+			return err
+		}
+
+		reason := reqctx.Rejection(c)
+		if reason != "" {
+			eventType = AuditBlocked
+		} else {
+			reason = responseErrorCode(c)
+		}
+		event := RequestEvent(c, eventType, reason)
+		event.Status = status
+		a.Record(event)
+		return err
+	}
+}
+
+// responseErrorCode returns the error field of a JSON error response
+func responseErrorCode(c *fiber.Ctx) string {
+	body := c.Response().Body()
+	if len(body) == 0 || len(body) > maxAuditedBody ||
+		!strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return ""
+	}
+	var response struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &response)
+	return response.Error
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// syslogWriter sends each line to a syslog collector as an RFC 5424
+// message (facility auth, severity notice), redialing after failures
+type syslogWriter struct {
+	network, addr string
+	hostname      string
+	conn          net.Conn
+}
+
+// syslogPriority is facility auth (4) and severity notice (5)
+const syslogPriority = 4*8 + 5
+
+func newSyslogWriter(network, addr string) *syslogWriter {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogWriter{network: network, addr: addr, hostname: hostname}
+}
+
+// Write implements io.Writer
+func (w *syslogWriter) Write(line []byte) (int, error) {
+	msg := fmt.Sprintf("<%d>1 %s %s gateway - audit - %s\n",
+		syslogPriority, time.Now().UTC().Format(time.RFC3339Nano), w.hostname, strings.TrimSuffix(string(line), "\n"))
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+			if err != nil {
+				return 0, err
+			}
+			w.conn = conn
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := w.conn.Write([]byte(msg)); err == nil {
+			return len(line), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, fmt.Errorf("audit log: syslog %s unreachable", w.addr)
+}
+
+// Close implements io.Closer
+func (w *syslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
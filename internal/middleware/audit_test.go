@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bots, err := Bots(config.BotConfig{Mode: "block", Scanners: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(auditLog.Middleware())
+	app.Use(bots)
+	app.Get("/private", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token", "message": "Token expired"})
+	})
+	app.Get("/admin", func(c *fiber.Ctx) error { return fiber.ErrForbidden })
+	app.Get("/public", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	for _, tc := range []struct{ path, agent string }{
+		{"/public", "Mozilla/5.0"},
+		{"/private", "Mozilla/5.0"},
+		{"/admin", "Mozilla/5.0"},
+		{"/public", "sqlmap/1.7.2"},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("User-Agent", tc.agent)
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auditLog.Record(AuditEvent{Type: AuditAdminAction, Path: "/admin/drain", Actor: "deploy", Scope: "drain", Outcome: "allowed"})
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []AuditEvent
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	want := []AuditEvent{
+		{Type: AuditAuthFailure, Reason: "invalid_token", Status: fiber.StatusUnauthorized, Path: "/private"},
+		{Type: AuditForbidden, Status: fiber.StatusForbidden, Path: "/admin"},
+		{Type: AuditBlocked, Reason: "bot:scanner", Status: fiber.StatusForbidden, Path: "/public"},
+		{Type: AuditAdminAction, Path: "/admin/drain", Actor: "deploy", Scope: "drain", Outcome: "allowed"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, event := range events {
+		w := want[i]
+		if event.Type != w.Type || event.Reason != w.Reason || event.Status != w.Status || event.Path != w.Path ||
+			event.Actor != w.Actor || event.Scope != w.Scope || event.Outcome != w.Outcome || event.Time.IsZero() {
+			t.Errorf("event %d = %+v, want %+v", i, event, w)
+		}
+	}
+
+	// Disabled, it lets requests through
+	if disabled, err := NewAuditLog(""); disabled != nil || err != nil {
+		t.Errorf("NewAuditLog(\"\") = %v, %v", disabled, err)
+	}
+}
+
+func TestAuditLogRecordDuringClose(t *testing.T) {
+	auditLog, err := NewAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Handlers still running when shutdown times out keep recording
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				auditLog.Record(AuditEvent{Type: AuditForbidden, Path: "/admin"})
+			}
+		}()
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	auditLog.Record(AuditEvent{Type: AuditForbidden, Path: "/admin"})
+}
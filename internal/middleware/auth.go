@@ -1,32 +1,118 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
 )
 
 // AuthConfig holds authentication middleware configuration
 type AuthConfig struct {
-	JWTSecret    string
-	PublicPaths  map[string][]string // path -> methods
-	HeaderName   string
-	TokenPrefix  string
-	ContextKey   string
+	Tokens TokenConfig
+	// ClaimHeaders are the headers sent upstream with the claims they
+	// carry; routes add their own
+	ClaimHeaders map[string]string
+	// Identity, when set, mints the identity token sent upstream
+	Identity    *IdentityTokens
+	PublicPaths map[string][]string // path -> methods
+	HeaderName  string
+	TokenPrefix string
+	// CookieName, when set, is the cookie browser clients send their token
+	// in instead of the header
+	CookieName   string
 	SkipPrefixes []string
 }
 
+// TokenConfig is how access tokens are verified: the keys they may be
+// signed with and whom they must be issued by and for
+type TokenConfig struct {
+	// Secret verifies HMAC-signed (HS*) tokens
+	Secret string
+	// SecretFunc, when set, returns the current Secret, for secrets rotated
+	// while running
+	SecretFunc func() string
+	// JWKS verifies RSA and ECDSA-signed tokens by their kid
+	JWKS *JWKS
+	// OIDC, when set, provides the key set and algorithms discovered from
+	// an OpenID Connect provider
+	OIDC *OIDC
+	// Algorithms are the accepted alg values; empty accepts those of the
+	// OIDC provider, else the HMAC ones
+	Algorithms []string
+	// Issuers and Audiences, when set, are the accepted iss values and the
+	// aud values of which a token needs at least one, so tokens minted for
+	// other services are rejected
+	Issuers   []string
+	Audiences []string
+	// Revocations, when set, rejects tokens revoked before they expire
+	Revocations *Revocations
+	// Introspector, when set, validates opaque tokens with the
+	// authorization server instead of as JWTs
+	Introspector *Introspector
+	// Tenants, when set, verifies the tokens of tenants with their own
+	// identity provider with its settings instead
+	Tenants *TenantTokens
+}
+
+// key returns the key verifying a token
+func (k TokenConfig) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		secret := k.Secret
+		if k.SecretFunc != nil {
+			secret = k.SecretFunc()
+		}
+		if secret != "" {
+			return []byte(secret), nil
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		if jwks := k.jwks(); jwks != nil {
+			kid, _ := token.Header["kid"].(string)
+			return jwks.Key(kid, token.Method.Alg())
+		}
+	}
+	return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid signing method")
+}
+
+// jwks returns the key set verifying asymmetrically signed tokens
+func (k TokenConfig) jwks() *JWKS {
+	if k.JWKS == nil && k.OIDC != nil {
+		return k.OIDC.JWKS()
+	}
+	return k.JWKS
+}
+
+// methods returns the accepted alg values
+func (k TokenConfig) methods() []string {
+	if len(k.Algorithms) > 0 {
+		return k.Algorithms
+	}
+	if k.OIDC != nil {
+		return k.OIDC.Algorithms()
+	}
+	return []string{"HS256", "HS384", "HS512"}
+}
+
 // DefaultAuthConfig returns default auth configuration
 func DefaultAuthConfig(secret string) AuthConfig {
 	return AuthConfig{
-		JWTSecret:    secret,
+		Tokens:       TokenConfig{Secret: secret},
+		ClaimHeaders: config.DefaultClaimHeaders(),
 		PublicPaths:  make(map[string][]string),
 		HeaderName:   "Authorization",
 		TokenPrefix:  "Bearer ",
-		ContextKey:   "user",
 		SkipPrefixes: []string{"/health", "/ready", "/live", "/metrics"},
 	}
 }
@@ -37,7 +123,139 @@ type Claims struct {
 	TenantID string   `json:"tenant_id"`
 	Email    string   `json:"email"`
 	Roles    []string `json:"roles"`
+	// Scope is the OAuth 2.0 scope claim; Scp is the same claim for
+	// providers naming it scp
+	Scope ScopeClaim `json:"scope,omitempty"`
+	Scp   ScopeClaim `json:"scp,omitempty"`
 	jwt.RegisteredClaims
+
+	// raw holds every claim of the token, for the claims mapped to headers
+	raw map[string]any
+}
+
+// UnmarshalJSON decodes the claims and keeps all of them for Claim
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.raw)
+}
+
+// Claim returns a claim as a header value; path names nested claims with
+// dots (realm_access.roles). Arrays are joined with commas and objects
+// encoded as JSON.
+func (c *Claims) Claim(path string) (string, bool) {
+	raw := c.raw
+	if raw == nil {
+		// Claims built in code rather than decoded from a token
+		data, _ := json.Marshal(c)
+		_ = json.Unmarshal(data, &raw)
+	}
+	value, ok := lookupClaim(raw, strings.Split(path, "."))
+	if !ok || value == nil {
+		return "", false
+	}
+	return claimString(value), true
+}
+
+// lookupClaim resolves a dotted path, preferring the longest key so claim
+// names containing dots (https://example.com/tenant) are found too
+func lookupClaim(claims map[string]any, parts []string) (any, bool) {
+	for i := len(parts); i > 0; i-- {
+		value, ok := claims[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		if i == len(parts) {
+			return value, true
+		}
+		if nested, isMap := value.(map[string]any); isMap {
+			if value, ok := lookupClaim(nested, parts[i:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// claimString formats a claim value for a header
+func claimString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, claimString(item))
+		}
+		return strings.Join(items, ",")
+	case map[string]any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ScopeClaim is a space-separated list of scopes, which tokens may also
+// carry as a JSON array
+type ScopeClaim string
+
+// UnmarshalJSON accepts a space-separated string or an array of scopes
+func (s *ScopeClaim) UnmarshalJSON(data []byte) error {
+	var scopes []string
+	if err := json.Unmarshal(data, &scopes); err == nil {
+		*s = ScopeClaim(strings.Join(scopes, " "))
+		return nil
+	}
+	var scope string
+	if err := json.Unmarshal(data, &scope); err != nil {
+		return err
+	}
+	*s = ScopeClaim(scope)
+	return nil
+}
+
+// Scopes returns the granted OAuth scopes
+func (c *Claims) Scopes() []string {
+	return strings.Fields(string(c.Scope) + " " + string(c.Scp))
+}
+
+// hasAnyRole reports whether the claims carry at least one of roles
+func (c *Claims) hasAnyRole(roles []string) bool {
+	for _, required := range roles {
+		for _, role := range c.Roles {
+			if strings.EqualFold(required, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// missingScope returns the first of scopes the claims don't grant
+func (c *Claims) missingScope(scopes []string) (string, bool) {
+	granted := make(map[string]bool)
+	for _, scope := range c.Scopes() {
+		granted[scope] = true
+	}
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// claimsKey stores the validated JWT claims of the request
+var claimsKey = reqctx.NewKey[*Claims]("user")
+
+// GetClaims returns the validated JWT claims of the request
+func GetClaims(c *fiber.Ctx) (*Claims, bool) {
+	return claimsKey.Get(c)
 }
 
 // Auth creates JWT authentication middleware
@@ -53,8 +271,12 @@ func Auth(cfg AuthConfig) fiber.Handler {
 			}
 		}
 
-		// Check if route is marked as public
-		if isPublic, ok := c.Locals("isPublic").(bool); ok && isPublic {
+		// Check if route is marked as public; signature routes authenticate
+		// callers by their request signature
+		if reqctx.IsPublic(c) {
+			return c.Next()
+		}
+		if route, ok := reqctx.Route(c); ok && route.Signature != nil {
 			return c.Next()
 		}
 
@@ -67,18 +289,21 @@ func Auth(cfg AuthConfig) fiber.Handler {
 			}
 		}
 
-		// Get token from header
+		// Get token from header, else from the session cookie
 		authHeader := c.Get(cfg.HeaderName)
-		if authHeader == "" {
+		tokenString := strings.TrimPrefix(authHeader, cfg.TokenPrefix)
+		if authHeader == "" && cfg.CookieName != "" {
+			tokenString = c.Cookies(cfg.CookieName)
+		}
+		if tokenString == "" && authHeader == "" {
+			bearerChallenge(c, "")
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "unauthorized",
 				"message": "Missing authorization header",
 			})
 		}
-
-		// Extract token
-		tokenString := strings.TrimPrefix(authHeader, cfg.TokenPrefix)
-		if tokenString == authHeader {
+		if authHeader != "" && tokenString == authHeader {
+			bearerChallenge(c, "")
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "unauthorized",
 				"message": "Invalid authorization format",
@@ -86,8 +311,29 @@ func Auth(cfg AuthConfig) fiber.Handler {
 		}
 
 		// Parse and validate token
-		claims, err := validateToken(tokenString, cfg.JWTSecret)
-		if err != nil {
+		start := time.Now()
+		claims, err := validateTenantToken(c.Hostname(), tokenString, cfg.Tokens)
+		if err == nil && cfg.Tokens.Revocations != nil {
+			err = cfg.Tokens.Revocations.check(c.Context(), claims)
+		}
+		reqctx.AddTiming(c, "auth", time.Since(start))
+		var unavailable *fiber.Error
+		switch {
+		case errors.Is(err, errTokenRevoked):
+			bearerChallenge(c, `error="invalid_token", error_description="Token revoked"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "unauthorized",
+				"message": "Token revoked",
+			})
+		case errors.As(err, &unavailable) && unavailable.Code == fiber.StatusServiceUnavailable:
+			// The introspection endpoint or, with JWT_REVOCATION_FAIL_CLOSED,
+			// the revocation store couldn't be reached
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "service_unavailable",
+				"message": unavailable.Message,
+			})
+		case err != nil:
+			bearerChallenge(c, `error="invalid_token", error_description="`+err.Error()+`"`)
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "unauthorized",
 				"message": err.Error(),
@@ -95,38 +341,91 @@ func Auth(cfg AuthConfig) fiber.Handler {
 		}
 
 		// Store claims in context
-		c.Locals(cfg.ContextKey, claims)
-		c.Locals("user_id", claims.UserID)
-		c.Locals("tenant_id", claims.TenantID)
+		claimsKey.Set(c, claims)
+		reqctx.SetUserID(c, claims.UserID)
+		reqctx.SetTenantID(c, claims.TenantID)
 
 		// Add user info to headers for downstream services
-		c.Request().Header.Set("X-User-ID", claims.UserID)
-		c.Request().Header.Set("X-Tenant-ID", claims.TenantID)
-		c.Request().Header.Set("X-User-Email", claims.Email)
-		if len(claims.Roles) > 0 {
-			c.Request().Header.Set("X-User-Roles", strings.Join(claims.Roles, ","))
+		route, routed := reqctx.Route(c)
+		setClaimHeaders(c, claims, cfg.ClaimHeaders, route.ClaimHeaders)
+		if cfg.Identity != nil {
+			if err := cfg.Identity.set(c, claims); err != nil {
+				return err
+			}
+		}
+
+		// Route authorization: any of the required roles, all required scopes
+		if routed {
+			if len(route.RequiredRoles) > 0 && !claims.hasAnyRole(route.RequiredRoles) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":   "forbidden",
+					"message": "Insufficient permissions",
+				})
+			}
+			if scope, missing := claims.missingScope(route.RequiredScopes); missing {
+				bearerChallenge(c, `error="insufficient_scope", scope="`+strings.Join(route.RequiredScopes, " ")+`"`)
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error":   "insufficient_scope",
+					"message": "Token lacks scope " + scope,
+				})
+			}
 		}
 
 		return c.Next()
 	}
 }
 
-// validateToken validates JWT token and returns claims
-func validateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid signing method")
+// setClaimHeaders sends claims upstream in the mapped headers. Headers the
+// client sent under these names, or the default ones, are dropped, so
+// identities can't be forged.
+func setClaimHeaders(c *fiber.Ctx, claims *Claims, global, route map[string]string) {
+	header := &c.Request().Header
+	for name := range config.DefaultClaimHeaders() {
+		header.Del(name)
+	}
+	for _, headers := range []map[string]string{global, route} {
+		for name, claim := range headers {
+			header.Del(name)
+			if claim == "" {
+				continue
+			}
+			if value, ok := claims.Claim(claim); ok && value != "" {
+				header.Set(name, value)
+			}
 		}
-		return []byte(secret), nil
-	})
+	}
+}
 
-	if err != nil {
-		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+// bearerChallenge sets the RFC 6750 WWW-Authenticate challenge of a
+// rejected request; params are its error attributes, if any
+func bearerChallenge(c *fiber.Ctx, params string) {
+	challenge := `Bearer realm="gateway"`
+	if params != "" {
+		challenge += ", " + params
 	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+}
+
+// validateToken validates a JWT, or an opaque token by introspection, and
+// returns its claims
+func validateToken(tokenString string, tokens TokenConfig) (*Claims, error) {
+	var claims *Claims
+	if tokens.Introspector != nil && tokens.Introspector.handles(tokenString) {
+		var err error
+		if claims, err = tokens.Introspector.Introspect(context.Background(), tokenString); err != nil {
+			return nil, err
+		}
+	} else {
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, tokens.key, jwt.WithValidMethods(tokens.methods()))
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+		}
 
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token claims")
+		var ok bool
+		claims, ok = token.Claims.(*Claims)
+		if !ok || !token.Valid {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token claims")
+		}
 	}
 
 	// Check expiration
@@ -134,13 +433,22 @@ func validateToken(tokenString, secret string) (*Claims, error) {
 		return nil, fiber.NewError(fiber.StatusUnauthorized, "Token expired")
 	}
 
+	if len(tokens.Issuers) > 0 && !slices.Contains(tokens.Issuers, claims.Issuer) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Token issuer not accepted")
+	}
+	if len(tokens.Audiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(tokens.Audiences, aud)
+	}) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Token audience not accepted")
+	}
+
 	return claims, nil
 }
 
 // RequireRoles middleware checks if user has required roles
 func RequireRoles(roles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		claims, ok := c.Locals("user").(*Claims)
+		claims, ok := GetClaims(c)
 		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "unauthorized",
@@ -148,12 +456,8 @@ func RequireRoles(roles ...string) fiber.Handler {
 			})
 		}
 
-		for _, requiredRole := range roles {
-			for _, userRole := range claims.Roles {
-				if strings.EqualFold(requiredRole, userRole) {
-					return c.Next()
-				}
-			}
+		if claims.hasAnyRole(roles) {
+			return c.Next()
 		}
 
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
@@ -169,9 +473,7 @@ func TenantExtractor() fiber.Handler {
 		var tenantID string
 
 		// 1. From JWT claims (already set by Auth middleware)
-		if tid := c.Locals("tenant_id"); tid != nil {
-			tenantID = tid.(string)
-		}
+		tenantID = reqctx.TenantID(c)
 
 		// 2. From X-Tenant-ID header (for service-to-service calls)
 		if tenantID == "" {
@@ -180,15 +482,11 @@ func TenantExtractor() fiber.Handler {
 
 		// 3. From subdomain (e.g., tenant1.example.com)
 		if tenantID == "" {
-			host := c.Hostname()
-			parts := strings.Split(host, ".")
-			if len(parts) >= 3 {
-				tenantID = parts[0]
-			}
+			tenantID = subdomain(c.Hostname())
 		}
 
 		if tenantID != "" {
-			c.Locals("tenant_id", tenantID)
+			reqctx.SetTenantID(c, tenantID)
 			c.Request().Header.Set("X-Tenant-ID", tenantID)
 		}
 
@@ -196,16 +494,64 @@ func TenantExtractor() fiber.Handler {
 	}
 }
 
-// NewAuthMiddleware creates auth middleware from config
-func NewAuthMiddleware(cfg *config.Config, routes *config.RouteConfig) fiber.Handler {
-	authCfg := DefaultAuthConfig(cfg.JWT.Secret)
+// NewAuthMiddleware creates auth middleware configured by base (tokens,
+// claim headers, identity tokens...). routes returns the current route
+// table; public paths are rebuilt whenever it changes.
+func NewAuthMiddleware(base AuthConfig, routes func() *config.RouteConfig) fiber.Handler {
+	type routeAuth struct {
+		routes  *config.RouteConfig
+		handler fiber.Handler
+	}
+	var current atomic.Pointer[routeAuth]
+
+	return func(c *fiber.Ctx) error {
+		table := routes()
+		auth := current.Load()
+		if auth == nil || auth.routes != table {
+			auth = &routeAuth{routes: table, handler: Auth(routeAuthConfig(base, table))}
+			current.Store(auth)
+		}
+		return auth.handler(c)
+	}
+}
+
+// routeAuthConfig returns base completed for a route table
+func routeAuthConfig(base AuthConfig, routes *config.RouteConfig) AuthConfig {
+	authCfg := base
+	authCfg.PublicPaths = maps.Clone(base.PublicPaths)
+	if authCfg.PublicPaths == nil {
+		authCfg.PublicPaths = make(map[string][]string)
+	}
 
 	// Build public paths from routes
 	for _, route := range routes.Routes {
-		if route.Public {
+		if route.Public && route.Path != "" {
 			authCfg.PublicPaths[route.Path] = route.Methods
 		}
 	}
 
-	return Auth(authCfg)
+	// Internal endpoints declared in the route table follow their Public
+	// flag like any other route; the skip list only covers undeclared ones
+	var skip []string
+	for _, prefix := range base.SkipPrefixes {
+		if !routeCovers(routes, prefix) {
+			skip = append(skip, prefix)
+		}
+	}
+	authCfg.SkipPrefixes = skip
+
+	return authCfg
+}
+
+// routeCovers reports whether a route in the table matches path
+func routeCovers(routes *config.RouteConfig, path string) bool {
+	for _, route := range routes.Routes {
+		if route.PathRegex != "" {
+			continue
+		}
+		if _, ok := config.MatchPath(route.Path, path); ok {
+			return true
+		}
+	}
+	return false
 }
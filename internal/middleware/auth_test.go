@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestRouteRolesAndScopes(t *testing.T) {
+	const secret = "test-secret"
+	route := config.Route{
+		Path:           "/api/v1/reports",
+		Methods:        []string{"GET"},
+		RequiredRoles:  []string{"admin", "analyst"},
+		RequiredScopes: []string{"reports:read"},
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, route)
+		return c.Next()
+	})
+	app.Use(Auth(DefaultAuthConfig(secret)))
+	app.Get("/api/v1/reports", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	var challenge string
+	status := func(claims jwt.Claims) int {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/api/v1/reports", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		challenge = resp.Header.Get("WWW-Authenticate")
+		return resp.StatusCode
+	}
+
+	if got := status(Claims{UserID: "u1", Roles: []string{"Analyst"}, Scope: "profile reports:read"}); got != fiber.StatusOK {
+		t.Errorf("analyst with scope = %d, want 200", got)
+	}
+	if got := status(Claims{UserID: "u1", Roles: []string{"viewer"}, Scope: "reports:read"}); got != fiber.StatusForbidden {
+		t.Errorf("missing role = %d, want 403", got)
+	}
+	if got := status(Claims{UserID: "u1", Roles: []string{"admin"}, Scope: "profile"}); got != fiber.StatusForbidden {
+		t.Errorf("missing scope = %d, want 403", got)
+	}
+	if want := `Bearer realm="gateway", error="insufficient_scope", scope="reports:read"`; challenge != want {
+		t.Errorf("challenge = %q, want %q", challenge, want)
+	}
+
+	// Providers may send scopes as an array, or in scp
+	if got := status(jwt.MapClaims{"user_id": "u1", "roles": []string{"admin"}, "scope": []string{"profile", "reports:read"}}); got != fiber.StatusOK {
+		t.Errorf("scope array = %d, want 200", got)
+	}
+	if got := status(jwt.MapClaims{"user_id": "u1", "roles": []string{"admin"}, "scp": "reports:read"}); got != fiber.StatusOK {
+		t.Errorf("scp claim = %d, want 200", got)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/reports", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("WWW-Authenticate"); resp.StatusCode != fiber.StatusUnauthorized || got != `Bearer realm="gateway", error="invalid_token", error_description="Invalid token"` {
+		t.Errorf("invalid token = %d with challenge %q", resp.StatusCode, got)
+	}
+}
+
+func TestTokenIssuerAndAudience(t *testing.T) {
+	tokens := TokenConfig{
+		Secret:    "test-secret",
+		Issuers:   []string{"https://id.example.com", "https://id.example.org"},
+		Audiences: []string{"gateway", "api"},
+	}
+	sign := func(iss string, aud ...string) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Issuer: iss, Audience: aud},
+		}).SignedString([]byte(tokens.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"accepted", sign("https://id.example.org", "billing", "api"), ""},
+		{"other issuer", sign("https://evil.example.com", "gateway"), "Token issuer not accepted"},
+		{"no issuer", sign("", "gateway"), "Token issuer not accepted"},
+		{"other service", sign("https://id.example.com", "billing"), "Token audience not accepted"},
+		{"no audience", sign("https://id.example.com"), "Token audience not accepted"},
+	} {
+		_, err := validateToken(tc.token, tokens)
+		if (err == nil) != (tc.err == "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestClaimHeaders(t *testing.T) {
+	const secret = "test-secret"
+	route := config.Route{
+		Path:         "/api/v1/orders",
+		ClaimHeaders: map[string]string{"X-Org": "org.id", "X-User-Email": ""},
+	}
+	cfg := DefaultAuthConfig(secret)
+	cfg.ClaimHeaders = map[string]string{
+		"X-User-ID":    "user_id",
+		"X-User-Email": "email",
+		"X-Groups":     "https://example.com/groups",
+		"X-Expires":    "exp",
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, route)
+		return c.Next()
+	})
+	app.Use(Auth(cfg))
+	got := make(map[string]string)
+	app.Get("/api/v1/orders", func(c *fiber.Ctx) error {
+		for name, values := range c.GetReqHeaders() {
+			got[name] = strings.Join(values, ",")
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":                    "u1",
+		"email":                      "u1@example.com",
+		"org":                        map[string]any{"id": "acme"},
+		"https://example.com/groups": []string{"ops", "billing"},
+		"exp":                        1893456000,
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-User-Email", "spoofed@example.com")
+	req.Header.Set("X-Tenant-ID", "spoofed")
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %v, %v", resp, err)
+	}
+
+	for name, want := range map[string]string{
+		"X-User-Id":    "u1",
+		"X-Org":        "acme",
+		"X-Groups":     "ops,billing",
+		"X-Expires":    "1893456000",
+		"X-User-Email": "",
+		"X-Tenant-Id":  "",
+	} {
+		if value := got[name]; value != want {
+			t.Errorf("%s = %q, want %q", name, value, want)
+		}
+	}
+}
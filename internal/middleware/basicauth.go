@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BasicCredentials returns the user name and password of an Authorization
+// header using the Basic scheme
+func BasicCredentials(c *fiber.Ctx) (username, password string, ok bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) < 6 || !strings.EqualFold(header[:6], "Basic ") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[6:]))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
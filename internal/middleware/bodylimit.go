@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+// BodyLimit returns a fasthttp HeaderReceived hook applying each route's
+// maxBodySize. It runs once the headers are read, so fasthttp rejects an
+// oversized body with 413 before buffering it, from Content-Length or while
+// reading a chunked body. Routes are matched by the path normalized as
+// NormalizePath does with paths, so // or dot-segment variants get the
+// route's limit too. Other requests keep the server's global limit.
+func BodyLimit(paths config.PathConfig, match func(path, method string) *config.Route) func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	return func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+		path, ok := headerPath(header, paths)
+		if !ok {
+			return fasthttp.RequestConfig{}
+		}
+
+		route := match(path, string(header.Method()))
+		if route == nil {
+			return fasthttp.RequestConfig{}
+		}
+		return fasthttp.RequestConfig{MaxRequestBodySize: route.MaxBodySize}
+	}
+}
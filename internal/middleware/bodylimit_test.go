@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestBodyLimit(t *testing.T) {
+	routes := map[string]*config.Route{
+		"/api/v1/uploads": {Path: "/api/v1/uploads", MaxBodySize: 100},
+		"/api/v1/avatars": {Path: "/api/v1/avatars", MaxBodySize: 5},
+	}
+	match := func(path, method string) *config.Route {
+		return routes[path]
+	}
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	app := fiber.New(fiber.Config{BodyLimit: 10, DisableStartupMessage: true})
+	app.Server().HeaderReceived = BodyLimit(config.PathConfig{TrailingSlash: "strip"}, match)
+	app.Post("/*", func(c *fiber.Ctx) error { return nil })
+	go app.Listener(ln)
+	// Paths are sent as written, not normalized by the client
+	client := &fasthttp.Client{Dial: func(string) (net.Conn, error) { return ln.Dial() }, DisablePathNormalizing: true}
+
+	for _, tc := range []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/api/v1/uploads", 50, fasthttp.StatusOK},
+		{"/api/v1/uploads", 200, fasthttp.StatusRequestEntityTooLarge},
+		{"/api/v1/users", 10, fasthttp.StatusOK},
+		{"/api/v1/users", 50, fasthttp.StatusRequestEntityTooLarge},
+		{"/api/v1/avatars", 8, fasthttp.StatusRequestEntityTooLarge},
+		// Variants NormalizePath routes to the same route get its limit
+		{"//api//v1/avatars", 8, fasthttp.StatusRequestEntityTooLarge},
+		{"/api/v1/users/../avatars", 8, fasthttp.StatusRequestEntityTooLarge},
+		{"/api/v1/%2e%2e/v1/./avatars/", 8, fasthttp.StatusRequestEntityTooLarge},
+		{"//api//v1/uploads", 50, fasthttp.StatusOK},
+	} {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		req.SetRequestURI("http://gateway" + tc.path)
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.SetBody(make([]byte, tc.size))
+		if err := client.Do(req, resp); err != nil {
+			t.Fatalf("%s with %d bytes: %v", tc.path, tc.size, err)
+		}
+		if resp.StatusCode() != tc.want {
+			t.Errorf("%s with %d bytes = %d, want %d", tc.path, tc.size, resp.StatusCode(), tc.want)
+		}
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}
+}
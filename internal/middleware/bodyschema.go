@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/schema"
+)
+
+// maxSchemaErrors bounds the problems reported for one body
+const maxSchemaErrors = 20
+
+// schemaMethods are the methods whose bodies are validated
+var schemaMethods = map[string]bool{fiber.MethodPost: true, fiber.MethodPut: true, fiber.MethodPatch: true}
+
+// BodySchema validates the JSON bodies of POST, PUT and PATCH requests to
+// routes with a schema, answering 400 with the mismatches before the
+// backend is called. Schemas are files in dir (see schema.Load), loaded once
+// per route table so a reload picks up edited ones. It must run after route
+// resolution.
+func BodySchema(dir string, routes func() *config.RouteConfig, logger Logger) fiber.Handler {
+	type loaded struct {
+		schema *schema.Schema
+		err    error
+	}
+	type schemaCache struct {
+		routes  *config.RouteConfig
+		mu      sync.Mutex
+		schemas map[string]loaded
+	}
+	var current atomic.Pointer[schemaCache]
+
+	load := func(ref string) (*schema.Schema, error) {
+		table := routes()
+		cache := current.Load()
+		if cache == nil || cache.routes != table {
+			cache = &schemaCache{routes: table, schemas: make(map[string]loaded)}
+			current.Store(cache)
+		}
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		result, ok := cache.schemas[ref]
+		if !ok {
+			result.schema, result.err = schema.Load(dir, ref)
+			cache.schemas[ref] = result
+		}
+		return result.schema, result.err
+	}
+
+	return func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		if !ok || route.Schema == "" || !schemaMethods[c.Method()] {
+			return c.Next()
+		}
+
+		s, err := load(route.Schema)
+		if err != nil {
+			logger.Error("Request schema unavailable", "schema", route.Schema, "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "internal_error",
+				"message": "Request schema unavailable",
+			})
+		}
+
+		if contentType := strings.ToLower(c.Get(fiber.HeaderContentType)); !isJSON(contentType) {
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+				"error":   "unsupported_media_type",
+				"message": "Request body must be JSON",
+			})
+		}
+		var body any
+		if err := schema.Decode(c.Body(), &body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "invalid_request_body",
+				"message": "Request body is not valid JSON",
+			})
+		}
+		if errs := s.Validate(body); len(errs) > 0 {
+			if len(errs) > maxSchemaErrors {
+				errs = errs[:maxSchemaErrors]
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "invalid_request_body",
+				"message": "Request body doesn't match the schema",
+				"details": errs,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// isJSON reports whether a content type is JSON (application/json or a
+// +json type such as application/merge-patch+json)
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == fiber.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestBodySchema(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"type": "object", "required": ["quantity"], "properties": {"quantity": {"type": "integer", "minimum": 1}}}`
+	if err := os.WriteFile(filepath.Join(dir, "order.json"), []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	routes := &config.RouteConfig{Routes: []config.Route{
+		{Path: "/orders", Methods: []string{"GET", "POST"}, Schema: "order.json"},
+		{Path: "/broken", Methods: []string{"POST"}, Schema: "missing.json"},
+	}}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		for _, route := range routes.Routes {
+			if route.Path == c.Path() {
+				reqctx.SetRoute(c, route)
+			}
+		}
+		return c.Next()
+	})
+	app.Use(BodySchema(dir, func() *config.RouteConfig { return routes }, NewLogger(config.LoggingConfig{})))
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	send := func(method, path, contentType, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var answer struct {
+			Details []struct{ Path, Message string }
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&answer)
+		if len(answer.Details) > 0 {
+			return resp.StatusCode, answer.Details[0].Path + ": " + answer.Details[0].Message
+		}
+		return resp.StatusCode, ""
+	}
+
+	if status, _ := send("POST", "/orders", "application/json; charset=utf-8", `{"quantity": 2}`); status != fiber.StatusOK {
+		t.Errorf("valid body = %d", status)
+	}
+	if status, detail := send("POST", "/orders", "application/json", `{"quantity": 0}`); status != fiber.StatusBadRequest || detail != "/quantity: must be at least 1" {
+		t.Errorf("invalid body = %d %q", status, detail)
+	}
+	if status, _ := send("POST", "/orders", "application/json", `{"quantity": `); status != fiber.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", status)
+	}
+	if status, _ := send("POST", "/orders", "text/plain", `quantity=2`); status != fiber.StatusUnsupportedMediaType {
+		t.Errorf("form body = %d, want 415", status)
+	}
+	if status, _ := send("GET", "/orders", "", ""); status != fiber.StatusOK {
+		t.Errorf("GET = %d, want it unchecked", status)
+	}
+	if status, _ := send("POST", "/broken", "application/json", `{}`); status != fiber.StatusInternalServerError {
+		t.Errorf("missing schema = %d, want 500", status)
+	}
+}
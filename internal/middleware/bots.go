@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// scannerAgents matches the User-Agents of well-known vulnerability
+// scanners, which announce themselves by default
+var scannerAgents = regexp.MustCompile(`(?i)sqlmap|nikto|nmap|masscan|zgrab|nuclei|wpscan|dirbuster|gobuster|feroxbuster|acunetix|nessus|openvas|qualys|netsparker|w3af|havij|jorgee|zmeu`)
+
+// botFilter classifies requests by their User-Agent
+type botFilter struct {
+	allow        []*regexp.Regexp
+	deny         []*regexp.Regexp
+	missingAgent bool
+	scanners     bool
+}
+
+// reason returns why a User-Agent is a bot's, or "" if it isn't one
+func (f *botFilter) reason(agent string) string {
+	matches := func(patterns []*regexp.Regexp) bool {
+		return slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool { return re.MatchString(agent) })
+	}
+	switch {
+	case matches(f.allow):
+		return ""
+	case agent == "":
+		if f.missingAgent {
+			return "missing_user_agent"
+		}
+		return ""
+	case f.scanners && scannerAgents.MatchString(agent):
+		return "scanner"
+	case matches(f.deny):
+		return "denied"
+	}
+	return ""
+}
+
+// compileAgents compiles User-Agent patterns case-insensitively
+func compileAgents(env string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Bots filters automated clients by their User-Agent: agents matching
+// BOT_DENY_AGENTS, known scanners and requests without one, unless they
+// match BOT_ALLOW_AGENTS. Depending on the route's bots setting (BOT_FILTER
+// by default) bots are blocked with a 403, only counted, or let through
+// uncounted. It must run after route resolution.
+func Bots(cfg config.BotConfig) (fiber.Handler, error) {
+	if !slices.Contains(config.BotModes, cfg.Mode) {
+		return nil, fmt.Errorf("BOT_FILTER must be off, monitor or block, not %q", cfg.Mode)
+	}
+	filter := &botFilter{missingAgent: cfg.MissingAgent, scanners: cfg.Scanners}
+	var err error
+	if filter.allow, err = compileAgents("BOT_ALLOW_AGENTS", cfg.AllowAgents); err != nil {
+		return nil, err
+	}
+	if filter.deny, err = compileAgents("BOT_DENY_AGENTS", cfg.DenyAgents); err != nil {
+		return nil, err
+	}
+
+	return func(c *fiber.Ctx) error {
+		mode := cfg.Mode
+		if route, ok := reqctx.Route(c); ok && route.Bots != "" {
+			mode = route.Bots
+		}
+		if mode == "off" {
+			return c.Next()
+		}
+		reason := filter.reason(c.Get(fiber.HeaderUserAgent))
+		if reason == "" {
+			return c.Next()
+		}
+
+		blocked := mode == "block"
+		botRequests.WithLabelValues(reason, reqctx.Service(c), strconv.FormatBool(blocked)).Inc()
+		if !blocked {
+			return c.Next()
+		}
+		reqctx.SetRejection(c, "bot:"+reason)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "forbidden",
+			"message": "Automated clients are not allowed",
+		})
+	}, nil
+}
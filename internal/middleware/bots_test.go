@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestBots(t *testing.T) {
+	routes := map[string]config.Route{
+		"/api":     {Path: "/api"},
+		"/monitor": {Path: "/monitor", Bots: "monitor"},
+		"/open":    {Path: "/open", Bots: "off"},
+	}
+	bots, err := Bots(config.BotConfig{
+		Mode:         "block",
+		AllowAgents:  []string{`^kube-probe/`},
+		DenyAgents:   []string{`scrapy`, `^curl/`},
+		MissingAgent: true,
+		Scanners:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(bots)
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	for _, tc := range []struct {
+		path, agent string
+		want        int
+	}{
+		{"/api", "Mozilla/5.0 (X11; Linux x86_64)", fiber.StatusOK},
+		{"/api", "", fiber.StatusForbidden},
+		{"/api", "sqlmap/1.7.2#stable (https://sqlmap.org)", fiber.StatusForbidden},
+		{"/api", "Mozilla/5.0 (compatible; Nmap Scripting Engine)", fiber.StatusForbidden},
+		{"/api", "Scrapy/2.11 (+https://scrapy.org)", fiber.StatusForbidden},
+		{"/api", "curl/8.4.0", fiber.StatusForbidden},
+		{"/api", "kube-probe/1.29", fiber.StatusOK},
+		{"/monitor", "", fiber.StatusOK},
+		{"/open", "nikto", fiber.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("User-Agent", tc.agent) // an empty one isn't sent
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s with %q = %d, want %d", tc.path, tc.agent, resp.StatusCode, tc.want)
+		}
+	}
+
+	if _, err := Bots(config.BotConfig{Mode: "log"}); err == nil {
+		t.Error("unknown BOT_FILTER accepted")
+	}
+	if _, err := Bots(config.BotConfig{Mode: "off", DenyAgents: []string{"("}}); err == nil {
+		t.Error("invalid BOT_DENY_AGENTS pattern accepted")
+	}
+}
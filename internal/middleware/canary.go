@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+// Rollback defaults for experiments that don't set them
+const (
+	defaultRollbackWindow      = time.Minute
+	defaultRollbackMinRequests = 20
+)
+
+// CanaryRollback is logged when a canary variant is rolled back
+type CanaryRollback struct {
+	Experiment        string
+	Variant           string
+	Baseline          string
+	ErrorRate         float64
+	BaselineErrorRate float64
+	Requests          int
+	// Reason explains the rollback in the event log
+	Reason string
+}
+
+// canaryGuard tracks per-variant error rates of experiments with a rollback
+// budget in fixed windows, and remembers which variants were rolled back
+type canaryGuard struct {
+	mu         sync.Mutex
+	windows    map[string]*variantWindow
+	rolledBack map[string]bool
+}
+
+type variantWindow struct {
+	start    time.Time
+	requests map[string]int
+	errors   map[string]int
+}
+
+func newCanaryGuard() *canaryGuard {
+	return &canaryGuard{
+		windows:    make(map[string]*variantWindow),
+		rolledBack: make(map[string]bool),
+	}
+}
+
+// isRolledBack reports whether variant's traffic goes to the baseline
+func (g *canaryGuard) isRolledBack(exp *config.ExperimentConfig, variant string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rolledBack[exp.Name+"|"+variant]
+}
+
+// observe records a response served by variant and returns a rollback when
+// this response pushes a canary over its error budget
+func (g *canaryGuard) observe(exp *config.ExperimentConfig, variant string, failed bool, now time.Time) *CanaryRollback {
+	rb := exp.Rollback
+	window, _ := time.ParseDuration(rb.Window)
+	if window <= 0 {
+		window = defaultRollbackWindow
+	}
+	minRequests := rb.MinRequests
+	if minRequests == 0 {
+		minRequests = defaultRollbackMinRequests
+	}
+	baseline := exp.BaselineVariant().Name
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	w, ok := g.windows[exp.Name]
+	if !ok || now.Sub(w.start) >= window {
+		w = &variantWindow{start: now, requests: make(map[string]int), errors: make(map[string]int)}
+		g.windows[exp.Name] = w
+	}
+	w.requests[variant]++
+	if failed {
+		w.errors[variant]++
+	}
+
+	key := exp.Name + "|" + variant
+	if variant == baseline || g.rolledBack[key] {
+		return nil
+	}
+	if w.requests[variant] < minRequests || w.requests[baseline] < minRequests {
+		return nil
+	}
+
+	rate := float64(w.errors[variant]) / float64(w.requests[variant])
+	baseRate := float64(w.errors[baseline]) / float64(w.requests[baseline])
+	if rate-baseRate <= rb.MaxErrorRateDelta {
+		return nil
+	}
+
+	g.rolledBack[key] = true
+	return &CanaryRollback{
+		Experiment:        exp.Name,
+		Variant:           variant,
+		Baseline:          baseline,
+		ErrorRate:         rate,
+		BaselineErrorRate: baseRate,
+		Requests:          w.requests[variant],
+		Reason: fmt.Sprintf("error rate %.1f%% is %.1f points above %s (%.1f%%), budget is %.1f points",
+			rate*100, (rate-baseRate)*100, baseline, baseRate*100, rb.MaxErrorRateDelta*100),
+	}
+}
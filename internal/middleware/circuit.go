@@ -6,6 +6,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
 	"github.com/sony/gobreaker"
 )
 
@@ -14,13 +15,23 @@ type CircuitBreakerManager struct {
 	breakers map[string]*gobreaker.CircuitBreaker
 	mu       sync.RWMutex
 	cfg      config.CircuitConfig
+
+	// stateSince tracks when each breaker entered its current state. It has
+	// its own lock because OnStateChange can fire while mu is held.
+	stateSince map[string]time.Time
+	sinceMu    sync.Mutex
+
+	// hasFallback reports whether a service has a healthy fallback upstream
+	// that can take requests while its breaker is open
+	hasFallback func(service string) bool
 }
 
 // NewCircuitBreakerManager creates a new circuit breaker manager
 func NewCircuitBreakerManager(cfg config.CircuitConfig) *CircuitBreakerManager {
 	return &CircuitBreakerManager{
-		breakers: make(map[string]*gobreaker.CircuitBreaker),
-		cfg:      cfg,
+		breakers:   make(map[string]*gobreaker.CircuitBreaker),
+		cfg:        cfg,
+		stateSince: make(map[string]time.Time),
 	}
 }
 
@@ -52,16 +63,51 @@ func (m *CircuitBreakerManager) GetBreaker(serviceName string) *gobreaker.Circui
 			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
 			return counts.Requests >= uint32(m.cfg.FailureThreshold) && failureRatio >= 0.5
 		},
-		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			// Log state changes (integrate with your logging)
-			// This is where you'd send metrics about circuit state changes
-		},
+		OnStateChange: m.onStateChange,
 	})
 
 	m.breakers[serviceName] = cb
+	m.resetStateSince(serviceName)
+	UpdateCircuitBreakerMetric(serviceName, int(gobreaker.StateClosed))
 	return cb
 }
 
+// onStateChange records time-in-state and transition metrics
+func (m *CircuitBreakerManager) onStateChange(name string, from gobreaker.State, to gobreaker.State) {
+	now := time.Now()
+
+	m.sinceMu.Lock()
+	since, ok := m.stateSince[name]
+	m.stateSince[name] = now
+	m.sinceMu.Unlock()
+
+	var timeInState time.Duration
+	if ok {
+		timeInState = now.Sub(since)
+	}
+
+	RecordCircuitBreakerTransition(name, from.String(), to.String(), int(to), timeInState, now)
+
+	// Half-open is only reachable from open, so closing from half-open
+	// completes an open -> half-open -> closed cycle
+	if from == gobreaker.StateHalfOpen && to == gobreaker.StateClosed {
+		RecordCircuitBreakerCycle(name)
+	}
+}
+
+// resetStateSince marks the breaker as having just entered its current state
+func (m *CircuitBreakerManager) resetStateSince(name string) {
+	m.sinceMu.Lock()
+	defer m.sinceMu.Unlock()
+	m.stateSince[name] = time.Now()
+}
+
+// SetFallbackCheck registers the function used to decide whether requests
+// rejected by an open breaker can be failed over instead
+func (m *CircuitBreakerManager) SetFallbackCheck(hasFallback func(service string) bool) {
+	m.hasFallback = hasFallback
+}
+
 // GetState returns the current state of a circuit breaker
 func (m *CircuitBreakerManager) GetState(serviceName string) gobreaker.State {
 	m.mu.RLock()
@@ -74,6 +120,20 @@ func (m *CircuitBreakerManager) GetState(serviceName string) gobreaker.State {
 	return cb.State()
 }
 
+// Reset discards a service's breaker so the next request starts with a
+// fresh, closed one. It reports whether a breaker existed.
+func (m *CircuitBreakerManager) Reset(serviceName string) bool {
+	m.mu.Lock()
+	cb, exists := m.breakers[serviceName]
+	delete(m.breakers, serviceName)
+	m.mu.Unlock()
+
+	if exists && cb.State() != gobreaker.StateClosed {
+		m.onStateChange(serviceName, cb.State(), gobreaker.StateClosed)
+	}
+	return exists
+}
+
 // GetAllStates returns states of all circuit breakers
 func (m *CircuitBreakerManager) GetAllStates() map[string]string {
 	m.mu.RLock()
@@ -94,13 +154,13 @@ func (m *CircuitBreakerManager) Middleware() fiber.Handler {
 		}
 
 		// Get service name from context (set by router)
-		serviceName, ok := c.Locals("service").(string)
-		if !ok || serviceName == "" || serviceName == "gateway" {
+		serviceName := reqctx.Service(c)
+		if serviceName == "" || serviceName == "gateway" {
 			return c.Next()
 		}
 
 		// Check route config for circuit breaker flag
-		if route, ok := c.Locals("route").(config.Route); ok {
+		if route, ok := reqctx.Route(c); ok {
 			if !route.CircuitBreaker {
 				return c.Next()
 			}
@@ -125,6 +185,11 @@ func (m *CircuitBreakerManager) Middleware() fiber.Handler {
 		if err != nil {
 			// Circuit is open
 			if err == gobreaker.ErrOpenState {
+				// Fail over without counting against the primary's breaker
+				if m.hasFallback != nil && m.hasFallback(serviceName) {
+					reqctx.SetUseFallback(c)
+					return c.Next()
+				}
 				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
 					"error":   "service_unavailable",
 					"message": "Service temporarily unavailable, please try again later",
@@ -183,7 +248,7 @@ func (rm *RetryMiddleware) Middleware() fiber.Handler {
 		var maxAttempts int
 		var waitTime time.Duration
 
-		if route, ok := c.Locals("route").(config.Route); ok && route.Retry != nil {
+		if route, ok := reqctx.Route(c); ok && route.Retry != nil {
 			maxAttempts = route.Retry.MaxAttempts
 			if d, err := time.ParseDuration(route.Retry.WaitTime); err == nil {
 				waitTime = d
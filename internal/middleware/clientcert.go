@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Client certificate headers forwarded to upstreams
+const (
+	ClientCertIdentityHeader    = "X-Client-Cert-Identity"
+	ClientCertSubjectHeader     = "X-Client-Cert-Subject"
+	ClientCertFingerprintHeader = "X-Client-Cert-Fingerprint"
+)
+
+// ClientCert maps the verified TLS client certificate of mTLS requests into
+// the request context and the X-Client-Cert-* headers, which callers can't
+// set themselves. Routes with clientCert reject requests without a verified
+// certificate (401) or with one whose identity isn't admitted (403). It
+// must run after route resolution.
+func ClientCert() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := &c.Request().Header
+		header.Del(ClientCertIdentityHeader)
+		header.Del(ClientCertSubjectHeader)
+		header.Del(ClientCertFingerprintHeader)
+
+		var cert *x509.Certificate
+		if state := c.Context().TLSConnectionState(); state != nil && len(state.VerifiedChains) > 0 {
+			cert = state.VerifiedChains[0][0]
+			identity := certIdentities(cert)[0]
+			fingerprint := sha256.Sum256(cert.Raw)
+			reqctx.SetClientCert(c, identity)
+			header.Set(ClientCertIdentityHeader, identity)
+			header.Set(ClientCertSubjectHeader, cert.Subject.String())
+			header.Set(ClientCertFingerprintHeader, hex.EncodeToString(fingerprint[:]))
+		}
+
+		route, ok := reqctx.Route(c)
+		if !ok || route.ClientCert == nil {
+			return c.Next()
+		}
+		if cert == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "client_certificate_required",
+				"message": "A verified client certificate is required",
+			})
+		}
+		if identities := route.ClientCert.Identities; len(identities) > 0 &&
+			!slices.ContainsFunc(certIdentities(cert), func(id string) bool { return slices.Contains(identities, id) }) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "forbidden",
+				"message": "Client certificate not accepted",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// certIdentities returns a certificate's identities, the primary one first:
+// URI SANs (e.g. SPIFFE IDs), DNS SANs, email SANs, then the common name
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	if cn := strings.TrimSpace(cert.Subject.CommonName); cn != "" || len(ids) == 0 {
+		ids = append(ids, cn)
+	}
+	return ids
+}
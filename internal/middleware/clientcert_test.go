@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/listener"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// issueCert returns a certificate for template signed by parent (self-signed
+// when parent is nil)
+func issueCert(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	issuer, signer := template, any(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestClientCert(t *testing.T) {
+	ca := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test CA"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "gateway"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	billing := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, URIs: []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+	reports := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "reports"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+
+	routes := map[string]config.Route{
+		"/billing": {Path: "/billing", ClientCert: &config.RouteClientCert{Identities: []string{"spiffe://example.org/billing"}}},
+		"/any":     {Path: "/any", ClientCert: &config.RouteClientCert{}},
+		"/open":    {Path: "/open"},
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(middleware.ClientCert())
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString(reqctx.ClientCert(c) + "|" + c.Get(middleware.ClientCertIdentityHeader))
+	})
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	// The gateway's listener, with every connection wrapper in place
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listener.New(tcp, listener.Options{
+		TLS: &tls.Config{Certificates: []tls.Certificate{server},
+			ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven},
+		ReadStallTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	defer app.Shutdown()
+
+	get := func(path string, cert *tls.Certificate) (int, string) {
+		t.Helper()
+		tlsConfig := &tls.Config{RootCAs: pool}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		req, _ := http.NewRequest("GET", "https://"+ln.Addr().String()+path, nil)
+		req.Header.Set(middleware.ClientCertIdentityHeader, "spoofed")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/billing", &billing); status != fiber.StatusOK || body != "spiffe://example.org/billing|spiffe://example.org/billing" {
+		t.Errorf("admitted identity = %d %q", status, body)
+	}
+	if status, _ := get("/billing", &reports); status != fiber.StatusForbidden {
+		t.Errorf("other identity = %d, want 403", status)
+	}
+	if status, body := get("/any", &reports); status != fiber.StatusOK || body != "reports|reports" {
+		t.Errorf("any identity = %d %q", status, body)
+	}
+	if status, _ := get("/any", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("no certificate = %d, want 401", status)
+	}
+	if status, body := get("/open", nil); status != fiber.StatusOK || body != "|" {
+		t.Errorf("route without clientCert = %d %q, want the spoofed header dropped", status, body)
+	}
+}
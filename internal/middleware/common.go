@@ -1,15 +1,22 @@
 package middleware
 
 import (
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
 )
 
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
 // RequestID adds a unique request ID to each request
-func RequestID() fiber.Handler {
+func RequestID(cfg config.RequestIDConfig) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Check for existing request ID
-		requestID := c.Get("X-Request-ID")
+		requestID := inboundRequestID(c, cfg)
 		if requestID == "" {
 			requestID = uuid.New().String()
 		}
@@ -18,12 +25,51 @@ func RequestID() fiber.Handler {
 		c.Set("X-Request-ID", requestID)
 
 		// Store in context for logging
-		c.Locals("request_id", requestID)
+		reqctx.SetRequestID(c, requestID)
 
 		return c.Next()
 	}
 }
 
+// inboundRequestID returns the client-supplied request ID if the trust
+// policy allows it and it is safe to log
+func inboundRequestID(c *fiber.Ctx, cfg config.RequestIDConfig) string {
+	switch cfg.Trust {
+	case "never":
+		return ""
+	case "trusted":
+		if !c.IsProxyTrusted() {
+			return ""
+		}
+	}
+
+	for _, header := range cfg.Headers {
+		if id := strings.TrimSpace(c.Get(header)); id != "" {
+			if validRequestID(id) {
+				return id
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// validRequestID rejects IDs that could forge or break log lines
+func validRequestID(id string) bool {
+	if len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // SecurityHeaders adds security headers to responses
 func SecurityHeaders() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -42,26 +88,62 @@ func SecurityHeaders() fiber.Handler {
 	}
 }
 
-// CORS handles Cross-Origin Resource Sharing
-func CORS(allowedOrigins []string) fiber.Handler {
-	originsMap := make(map[string]bool)
-	for _, origin := range allowedOrigins {
-		originsMap[origin] = true
-	}
+// defaultCORSHeaders are the request headers allowed unless a route overrides them
+const defaultCORSHeaders = "Origin, Content-Type, Accept, Authorization, X-Request-ID, X-Tenant-ID"
 
+// CORS handles Cross-Origin Resource Sharing. Routes may override the
+// allowed origins, methods, headers and credentials; preflights are matched
+// to a route by their Access-Control-Request-Method.
+func CORS(allowedOrigins []string, allowedMethods func(path string) []string, routeFor func(path, method string) *config.Route) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		origin := c.Get("Origin")
+		var policy *config.CORSConfig
+		if c.Method() == "OPTIONS" {
+			if route := routeFor(c.Path(), c.Get("Access-Control-Request-Method")); route != nil {
+				policy = route.CORS
+			}
+		} else if route, ok := reqctx.Route(c); ok {
+			policy = route.CORS
+		}
+
+		origins, credentials := allowedOrigins, true
+		if policy != nil {
+			if len(policy.AllowOrigins) > 0 {
+				origins = policy.AllowOrigins
+			}
+			if policy.AllowCredentials != nil {
+				credentials = *policy.AllowCredentials
+			}
+		}
 
 		// Check if origin is allowed
-		if origin != "" && (len(allowedOrigins) == 0 || originsMap[origin] || originsMap["*"]) {
+		origin := c.Get("Origin")
+		if origin != "" && (len(origins) == 0 || containsOrigin(origins, origin)) {
 			c.Set("Access-Control-Allow-Origin", origin)
-			c.Set("Access-Control-Allow-Credentials", "true")
+			c.Vary("Origin")
+			if credentials {
+				c.Set("Access-Control-Allow-Credentials", "true")
+			}
 		}
 
-		// Handle preflight requests
+		// Handle preflight requests, advertising only the methods the
+		// route table accepts for this path
 		if c.Method() == "OPTIONS" {
-			c.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			c.Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID, X-Tenant-ID")
+			methods := allowedMethods(c.Path())
+			if len(methods) == 0 {
+				return c.SendStatus(fiber.StatusNotFound)
+			}
+			allow := strings.Join(methods, ", ")
+			c.Set(fiber.HeaderAllow, allow)
+
+			headers := defaultCORSHeaders
+			if policy != nil && len(policy.AllowMethods) > 0 {
+				allow = strings.Join(policy.AllowMethods, ", ")
+			}
+			if policy != nil && len(policy.AllowHeaders) > 0 {
+				headers = strings.Join(policy.AllowHeaders, ", ")
+			}
+			c.Set("Access-Control-Allow-Methods", allow)
+			c.Set("Access-Control-Allow-Headers", headers)
 			c.Set("Access-Control-Max-Age", "86400") // 24 hours
 			return c.SendStatus(fiber.StatusNoContent)
 		}
@@ -70,9 +152,23 @@ func CORS(allowedOrigins []string) fiber.Handler {
 	}
 }
 
+// containsOrigin reports whether origin is in the list or the list has "*"
+func containsOrigin(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
 // ContentType validates and enforces content type
 func ContentType() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if route, ok := reqctx.Route(c); ok && route.Skip.ContentType {
+			return c.Next()
+		}
+
 		// For POST/PUT/PATCH requests, validate content type
 		method := c.Method()
 		if method == "POST" || method == "PUT" || method == "PATCH" {
@@ -136,7 +232,7 @@ func Recover() fiber.Handler {
 		defer func() {
 			if r := recover(); r != nil {
 				// Log the panic
-				requestID, _ := c.Locals("request_id").(string)
+				requestID := reqctx.RequestID(c)
 				_ = requestID // Use for logging
 
 				c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestRouteCORS(t *testing.T) {
+	noCredentials := false
+	admin := &config.Route{
+		Path:    "/admin",
+		Methods: []string{"GET", "DELETE"},
+		CORS: &config.CORSConfig{
+			AllowOrigins:     []string{"https://console.example.com"},
+			AllowHeaders:     []string{"Authorization"},
+			AllowCredentials: &noCredentials,
+		},
+	}
+	routeFor := func(path, method string) *config.Route {
+		if path == "/admin" {
+			return admin
+		}
+		return nil
+	}
+	methods := func(path string) []string { return []string{"GET", "HEAD", "DELETE", "OPTIONS"} }
+
+	app := fiber.New()
+	app.Use(CORS([]string{"*"}, methods, routeFor))
+
+	preflight := func(path, origin string) map[string]string {
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "DELETE")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]string{
+			"origin":      resp.Header.Get("Access-Control-Allow-Origin"),
+			"credentials": resp.Header.Get("Access-Control-Allow-Credentials"),
+			"headers":     resp.Header.Get("Access-Control-Allow-Headers"),
+		}
+	}
+
+	if got := preflight("/admin", "https://evil.example.com"); got["origin"] != "" {
+		t.Errorf("admin route allowed foreign origin: %v", got)
+	}
+	got := preflight("/admin", "https://console.example.com")
+	if got["origin"] != "https://console.example.com" || got["credentials"] != "" || got["headers"] != "Authorization" {
+		t.Errorf("admin preflight = %v", got)
+	}
+	if got := preflight("/public", "https://evil.example.com"); got["origin"] != "https://evil.example.com" || got["credentials"] != "true" {
+		t.Errorf("public preflight = %v", got)
+	}
+}
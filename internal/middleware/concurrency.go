@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+)
+
+// concurrencyAllKey is the semaphore of all services together
+const concurrencyAllKey = "concurrency:all"
+
+// ConcurrencyLimiter caps the requests in flight to the services, overall
+// and per service. Slots are held in the store when it implements
+// store.Semaphore, so a fleet of gateway instances collectively respects
+// the backends' capacity; otherwise, and on store errors, each instance
+// counts its own requests.
+type ConcurrencyLimiter struct {
+	cfg config.ConcurrencyConfig
+	// services are the caps of the services that have one
+	services map[string]int
+	shared   store.Semaphore
+
+	mu    sync.Mutex
+	local map[string]int
+}
+
+// NewConcurrencyLimiter creates a concurrency limiter for the services'
+// MaxInFlight caps
+func NewConcurrencyLimiter(cfg config.ConcurrencyConfig, services *config.ServicesConfig, kv store.KV) *ConcurrencyLimiter {
+	limits := make(map[string]int)
+	for name, svc := range services.Additional {
+		if svc.MaxInFlight > 0 {
+			limits[name] = svc.MaxInFlight
+		}
+	}
+	for name, svc := range map[string]config.ServiceConfig{"auth": services.Auth, "notifier": services.Notifier} {
+		if svc.MaxInFlight > 0 {
+			limits[name] = svc.MaxInFlight
+		}
+	}
+
+	shared, _ := kv.(store.Semaphore)
+	return &ConcurrencyLimiter{
+		cfg:      cfg,
+		services: limits,
+		shared:   shared,
+		local:    make(map[string]int),
+	}
+}
+
+// Middleware rejects requests with a 503 while their service, or all
+// services together, are at their cap. Slots are held until the rest of
+// the chain returns, or until a streamed response has been written, so it
+// runs right before the proxy.
+func (l *ConcurrencyLimiter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !l.cfg.Enabled {
+			return c.Next()
+		}
+		service := reqctx.Service(c)
+		if service == "" || service == "gateway" {
+			return c.Next()
+		}
+
+		id := uuid.NewString()
+		var held []func()
+		release := func() {
+			for _, release := range held {
+				release()
+			}
+		}
+		for _, semaphore := range []struct {
+			key, reason string
+			limit       int
+		}{
+			{concurrencyAllKey, "concurrency", l.cfg.MaxInFlight},
+			{"concurrency:service:" + service, "service_concurrency", l.services[service]},
+		} {
+			if semaphore.limit <= 0 {
+				continue
+			}
+			slot, ok := l.acquire(semaphore.key, id, semaphore.limit)
+			if !ok {
+				release()
+				RecordShed(service, semaphore.reason, reqctx.Priority(c).String())
+				c.Set(fiber.HeaderRetryAfter, "1")
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error":   "concurrency_limit_exceeded",
+					"message": "Too many requests in progress, please retry later",
+					"service": service,
+				})
+			}
+			held = append(held, slot)
+		}
+
+		// A streamed response still reads from the upstream once the chain
+		// returns, so its slots are freed when the stream is done
+		reqctx.OnStreamDone(c, release)
+		err := c.Next()
+		if !reqctx.StreamTaken(c) {
+			release()
+		}
+		return err
+	}
+}
+
+// acquire takes a slot at key and returns the function freeing it, in the
+// store or locally, wherever it was taken
+func (l *ConcurrencyLimiter) acquire(key, id string, limit int) (func(), bool) {
+	if l.shared != nil {
+		ok, err := l.shared.Acquire(context.Background(), key, id, limit, l.cfg.LeaseTTL)
+		if err == nil {
+			return func() { _ = l.shared.Release(context.Background(), key, id) }, ok
+		}
+		// Fall back to counting locally on store errors
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.local[key] >= limit {
+		return nil, false
+	}
+	l.local[key]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.local[key]--; l.local[key] <= 0 {
+			delete(l.local, key)
+		}
+	}, true
+}
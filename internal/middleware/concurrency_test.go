@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	kv := store.NewMemory(time.Minute)
+	defer kv.Close()
+	services := &config.ServicesConfig{
+		Auth:       config.ServiceConfig{MaxInFlight: 1},
+		Additional: map[string]config.ServiceConfig{"orders": {}},
+	}
+	limiter := NewConcurrencyLimiter(config.ConcurrencyConfig{Enabled: true, MaxInFlight: 2, LeaseTTL: time.Minute}, services, kv)
+
+	// Requests to /hold stay in flight until release is closed
+	entered, release := make(chan struct{}, 4), make(chan struct{})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetService(c, c.Query("service"))
+		return c.Next()
+	})
+	app.Use(limiter.Middleware())
+	app.Get("/hold", func(c *fiber.Ctx) error {
+		entered <- struct{}{}
+		<-release
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	status := func(path string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		return resp.StatusCode
+	}
+	hold := func(service string) chan int {
+		done := make(chan int, 1)
+		go func() { done <- status("/hold?service=" + service) }()
+		<-entered
+		return done
+	}
+
+	auth := hold("auth")
+	if got := status("/?service=auth"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("auth at its cap = %d, want 503", got)
+	}
+	if got := status("/?service=orders"); got != fiber.StatusOK {
+		t.Errorf("orders = %d, want 200", got)
+	}
+
+	orders := hold("orders")
+	if got := status("/?service=orders"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("orders at the overall cap = %d, want 503", got)
+	}
+	if got := status("/?service=gateway"); got != fiber.StatusOK {
+		t.Errorf("gateway routes = %d, want them uncapped", got)
+	}
+
+	close(release)
+	for _, done := range []chan int{auth, orders} {
+		if got := <-done; got != fiber.StatusOK {
+			t.Errorf("held request = %d", got)
+		}
+	}
+	if got := status("/?service=auth"); got != fiber.StatusOK {
+		t.Errorf("auth after release = %d, want 200", got)
+	}
+}
+
+// slowBody stands in for the proxy's clientStream: it relays an upstream
+// body that ends when upstream is closed and runs the done functions once
+// fasthttp closes it
+type slowBody struct {
+	upstream chan struct{}
+	done     []func()
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	<-b.upstream
+	return 0, io.EOF
+}
+
+func (b *slowBody) Close() error {
+	for _, done := range b.done {
+		done()
+	}
+	return nil
+}
+
+func TestConcurrencyLimiterStream(t *testing.T) {
+	kv := store.NewMemory(time.Minute)
+	defer kv.Close()
+	services := &config.ServicesConfig{Additional: map[string]config.ServiceConfig{"events": {MaxInFlight: 1}}}
+	limiter := NewConcurrencyLimiter(config.ConcurrencyConfig{Enabled: true, LeaseTTL: time.Minute}, services, kv)
+
+	upstream, returned := make(chan struct{}), make(chan struct{}, 1)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetService(c, "events")
+		return c.Next()
+	})
+	app.Use(limiter.Middleware())
+	app.Get("/stream", func(c *fiber.Ctx) error {
+		c.Response().SetBodyStream(&slowBody{upstream: upstream, done: reqctx.TakeStreamDone(c)}, -1)
+		returned <- struct{}{}
+		return nil
+	})
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	status := func(path string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		return resp.StatusCode
+	}
+
+	streamed := make(chan int, 1)
+	go func() { streamed <- status("/stream") }()
+	<-returned
+	if got := status("/"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("while streaming = %d, want the slot held", got)
+	}
+
+	close(upstream)
+	if got := <-streamed; got != fiber.StatusOK {
+		t.Errorf("streamed request = %d", got)
+	}
+	if got := status("/"); got != fiber.StatusOK {
+		t.Errorf("after the stream = %d, want the slot released", got)
+	}
+}
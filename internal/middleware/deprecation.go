@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Deprecation announces deprecated routes to clients: Deprecation: true,
+// Sunset (RFC 8594) with the retirement date, and a Link to the successor
+// version. Headers are set after the handler so they apply to every
+// response of the route, upstream or not.
+func Deprecation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		route, ok := reqctx.Route(c)
+		if !ok {
+			return err
+		}
+		if route.Deprecated {
+			c.Set("Deprecation", "true")
+		}
+		if sunset, ok := route.Sunset(); ok {
+			c.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if route.SuccessorLink != "" {
+			c.Append(fiber.HeaderLink, "<"+route.SuccessorLink+`>; rel="successor-version"`)
+		}
+		return err
+	}
+}
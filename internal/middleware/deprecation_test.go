@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestDeprecation(t *testing.T) {
+	routes := map[string]config.Route{
+		"/v1/orders": {
+			Path:          "/v1/orders",
+			Deprecated:    true,
+			SunsetDate:    "2027-01-31",
+			SuccessorLink: "https://api.minisource.io/v2/orders",
+		},
+		"/v2/orders": {Path: "/v2/orders"},
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(Deprecation())
+	app.Get("/*", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderLink, `</v1/orders?page=2>; rel="next"`)
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/orders", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q", got)
+	}
+	if got, want := resp.Header.Get("Sunset"), "Sun, 31 Jan 2027 00:00:00 GMT"; got != want {
+		t.Errorf("Sunset = %q, want %q", got, want)
+	}
+	if got, want := resp.Header.Get(fiber.HeaderLink), `</v1/orders?page=2>; rel="next", <https://api.minisource.io/v2/orders>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/v2/orders", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Deprecation") != "" || resp.Header.Get("Sunset") != "" {
+		t.Errorf("current route got deprecation headers: %v", resp.Header)
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"fmt"
+	"net/textproto"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// DuplicateHeaders guards against header smuggling: a request carrying a
+// security-relevant header twice (two Authorization or X-Tenant-ID
+// headers) could be checked by the gateway with one value and served by
+// the upstream with the other. Depending on policy such requests are
+// rejected with a 400 ("reject"), reduced to the header's first value,
+// which the gateway reads ("first"), or let through ("off"). It must run
+// before anything reads these headers.
+func DuplicateHeaders(policy string, names []string) (fiber.Handler, error) {
+	switch policy {
+	case "off":
+		return func(c *fiber.Ctx) error { return c.Next() }, nil
+	case "reject", "first":
+	default:
+		return nil, fmt.Errorf("SERVER_DUPLICATE_HEADERS must be reject, first or off, not %q", policy)
+	}
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			headers = append(headers, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		header := &c.Request().Header
+		var repeated map[string]bool
+		for _, name := range headers {
+			if len(header.PeekAll(name)) < 2 {
+				continue
+			}
+			if policy == "reject" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "duplicate_header",
+					"message": fmt.Sprintf("Request has more than one %s header", name),
+				})
+			}
+			if repeated == nil {
+				repeated = make(map[string]bool)
+			}
+			repeated[name] = true
+		}
+		if repeated != nil {
+			keepFirst(header, repeated)
+		}
+		return c.Next()
+	}, nil
+}
+
+// singleHeaders are kept by fasthttp apart from its list of headers, with
+// a single value
+var singleHeaders = map[string]bool{
+	fiber.HeaderHost:             true,
+	fiber.HeaderContentType:      true,
+	fiber.HeaderContentLength:    true,
+	fiber.HeaderUserAgent:        true,
+	fiber.HeaderCookie:           true,
+	fiber.HeaderConnection:       true,
+	fiber.HeaderTrailer:          true,
+	fiber.HeaderTransferEncoding: true,
+}
+
+// keepFirst drops all but the first value of the repeated headers.
+// Deleting a header reorders fasthttp's list, which would change the
+// order of others sent several times (X-Forwarded-For), so the whole list
+// is rebuilt in its original order.
+func keepFirst(header *fasthttp.RequestHeader, repeated map[string]bool) {
+	type field struct{ name, value string }
+	var fields []field
+	seen := make(map[string]bool)
+	for key, value := range header.All() {
+		name := string(key)
+		if singleHeaders[name] || (repeated[name] && seen[name]) {
+			continue
+		}
+		seen[name] = true
+		fields = append(fields, field{name, string(value)})
+	}
+	for name := range seen {
+		header.Del(name)
+	}
+	for _, f := range fields {
+		header.Add(f.name, f.value)
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestDuplicateHeaders(t *testing.T) {
+	send := func(policy string, headers map[string][]string) (int, string) {
+		t.Helper()
+		duplicates, err := DuplicateHeaders(policy, config.DefaultDuplicateHeaderNames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := fiber.New()
+		app.Use(duplicates)
+		// Echoes what an upstream would receive
+		app.Get("/", func(c *fiber.Ctx) error {
+			var values []string
+			for _, name := range []string{"Authorization", "X-Tenant-ID", "X-Forwarded-For"} {
+				for _, value := range c.Request().Header.PeekAll(name) {
+					values = append(values, name+"="+string(value))
+				}
+			}
+			return c.SendString(strings.Join(values, " "))
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		for name, values := range headers {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	twice := map[string][]string{
+		"Authorization":   {"Bearer first", "Bearer second"},
+		"X-Tenant-Id":     {"t1", "t2"},
+		"X-Forwarded-For": {"203.0.113.7", "10.0.0.1", "10.0.0.2"},
+	}
+	const forwarded = " X-Forwarded-For=203.0.113.7 X-Forwarded-For=10.0.0.1 X-Forwarded-For=10.0.0.2"
+	if status, body := send("reject", twice); status != fiber.StatusBadRequest || !strings.Contains(body, "duplicate_header") {
+		t.Errorf("reject = %d %s", status, body)
+	}
+	if status, body := send("first", twice); status != fiber.StatusOK || body != "Authorization=Bearer first X-Tenant-ID=t1"+forwarded {
+		t.Errorf("first = %d %q, want only the first values", status, body)
+	}
+	if status, body := send("off", twice); status != fiber.StatusOK || body != "Authorization=Bearer first Authorization=Bearer second X-Tenant-ID=t1 X-Tenant-ID=t2"+forwarded {
+		t.Errorf("off = %d %q", status, body)
+	}
+
+	// Headers outside the list may repeat
+	chain := map[string][]string{"X-Forwarded-For": twice["X-Forwarded-For"], "Authorization": {"Bearer only"}}
+	if status, body := send("reject", chain); status != fiber.StatusOK || body != "Authorization=Bearer only"+forwarded {
+		t.Errorf("repeated X-Forwarded-For = %d %q", status, body)
+	}
+
+	if _, err := DuplicateHeaders("merge", nil); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
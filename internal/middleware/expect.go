@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+// ExpectContinueConfig holds the checks run before accepting an upload body
+type ExpectContinueConfig struct {
+	Tokens TokenConfig
+	// CookieName is the session cookie browser clients send their token
+	// in, as for Auth
+	CookieName string
+	// Match resolves the route for a path and method
+	Match func(path, method string) *config.Route
+	// Fallback reports whether the route table's fallback serves paths no
+	// route covers for a method
+	Fallback func(method string) bool
+	// Available reports whether a service can currently take requests
+	Available func(service string) bool
+}
+
+// ExpectContinue returns a fasthttp ContinueHandler for requests sent with
+// "Expect: 100-continue". Bodies are buffered before the middleware stack
+// runs, so uploads that are certain to be rejected (unknown route without
+// a fallback, missing or invalid token, unavailable service) are answered with 417 before the
+// client sends the body, instead of after it has been fully uploaded.
+func ExpectContinue(cfg ExpectContinueConfig) func(header *fasthttp.RequestHeader) bool {
+	return func(header *fasthttp.RequestHeader) bool {
+		var uri fasthttp.URI
+		if err := uri.Parse(nil, header.RequestURI()); err != nil {
+			RecordExpectContinueRejected("bad_request")
+			return false
+		}
+
+		route := cfg.Match(string(uri.Path()), string(header.Method()))
+		if route == nil && cfg.Fallback != nil && cfg.Fallback(string(header.Method())) {
+			// The fallback (a service, redirect or response) handles it
+			return true
+		}
+		if route == nil {
+			RecordExpectContinueRejected("no_route")
+			return false
+		}
+
+		if !route.Public && route.Signature == nil {
+			authHeader := string(header.Peek("Authorization"))
+			token, ok := strings.CutPrefix(authHeader, "Bearer ")
+			if authHeader == "" && cfg.CookieName != "" {
+				token = string(header.Cookie(cfg.CookieName))
+				ok = token != ""
+			}
+			if !ok {
+				RecordExpectContinueRejected("unauthorized")
+				return false
+			}
+			if _, err := validateTenantToken(string(header.Host()), token, cfg.Tokens); err != nil {
+				RecordExpectContinueRejected("unauthorized")
+				return false
+			}
+		}
+
+		service := route.ServiceFor(string(header.Method()))
+		if route.Response == nil && route.Redirect == nil && service != "gateway" && !cfg.Available(service) {
+			RecordExpectContinueRejected("service_unavailable")
+			return false
+		}
+
+		return true
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+func TestExpectContinue(t *testing.T) {
+	const secret = "test-secret"
+	routes := map[string]*config.Route{
+		"/upload": {Path: "/upload", Service: "files"},
+		"/public": {Path: "/public", Service: "files", Public: true},
+	}
+	tenants := NewTenantTokens(&config.TenantsConfig{Tenants: []config.Tenant{
+		{ID: "acme", Subdomain: "acme", Issuer: "acme-auth", Secret: "acme-secret", Algorithms: []string{"HS256"}},
+	}}, 0, NewLogger(config.LoggingConfig{}))
+	cfg := ExpectContinueConfig{
+		Tokens:     TokenConfig{Secret: secret, Tenants: tenants},
+		CookieName: "session",
+		Match:      func(path, method string) *config.Route { return routes[path] },
+		Available:  func(service string) bool { return true },
+	}
+	accepts := ExpectContinue(cfg)
+	cfg.Fallback = func(method string) bool { return method == "POST" }
+	withFallback := ExpectContinue(cfg)
+
+	sign := func(secret string, issuer ...string) string {
+		t.Helper()
+		claims := Claims{UserID: "u1"}
+		if len(issuer) > 0 {
+			claims.Issuer = issuer[0]
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	token := sign(secret)
+
+	for _, tc := range []struct {
+		name, uri string
+		headers   map[string]string
+		cookie    string
+		want      bool
+	}{
+		{"bearer token", "/upload", map[string]string{"Authorization": "Bearer " + token}, "", true},
+		{"session cookie", "/upload", nil, token, true},
+		{"no token", "/upload", nil, "", false},
+		{"invalid cookie", "/upload", nil, sign("other-secret"), false},
+		{"tenant token", "/upload", map[string]string{"Authorization": "Bearer " + sign("acme-secret", "acme-auth")}, "", true},
+		{"tenant token on its subdomain", "/upload", map[string]string{"Host": "acme.example.com", "Authorization": "Bearer " + sign("acme-secret", "acme-auth")}, "", true},
+		{"global token on a tenant subdomain", "/upload", map[string]string{"Host": "acme.example.com", "Authorization": "Bearer " + token}, "", false},
+		{"public route", "/public", nil, "", true},
+		{"unknown route", "/missing", map[string]string{"Authorization": "Bearer " + token}, "", false},
+	} {
+		var header fasthttp.RequestHeader
+		header.SetMethod("POST")
+		header.SetRequestURI(tc.uri)
+		for name, value := range tc.headers {
+			header.Set(name, value)
+		}
+		if tc.cookie != "" {
+			header.SetCookie("session", tc.cookie)
+		}
+		if got := accepts(&header); got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// A fallback serves the paths no route covers
+	var header fasthttp.RequestHeader
+	header.SetMethod("POST")
+	header.SetRequestURI("/missing")
+	if !withFallback(&header) {
+		t.Error("unknown route with a fallback rejected")
+	}
+	header.SetMethod("PUT")
+	if withFallback(&header) {
+		t.Error("unknown route with a fallback for other methods accepted")
+	}
+}
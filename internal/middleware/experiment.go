@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// ExperimentHeader tells the upstream which experiment variant served the request
+const ExperimentHeader = "X-Experiment-Variant"
+
+// Experiments assigns requests on experiment routes to a variant, routes them
+// to the variant's service and logs an exposure event that analytics can join
+// with outcomes on experiment, variant and consumer. It must run after
+// authentication so signed-in consumers are assigned by user ID.
+//
+// Experiments with a rollback budget send a canary variant's consumers to
+// the baseline variant once the canary's error rate exceeds the baseline's by
+// more than the budget.
+func Experiments(logger Logger) fiber.Handler {
+	guard := newCanaryGuard()
+
+	return func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		if !ok || route.Experiment == nil {
+			return c.Next()
+		}
+		exp := route.Experiment
+
+		consumer := reqctx.UserID(c)
+		if consumer == "" {
+			consumer = c.IP()
+		}
+
+		variant := assignVariant(exp, consumer)
+		if exp.Rollback != nil && guard.isRolledBack(exp, variant.Name) {
+			variant = exp.BaselineVariant()
+		}
+		if variant.Service != "" {
+			reqctx.SetService(c, variant.Service)
+		}
+		reqctx.SetVariant(c, variant.Name)
+		c.Request().Header.Set(ExperimentHeader, exp.Name+"="+variant.Name)
+
+		RecordExperimentExposure(exp.Name, variant.Name)
+		logger.Info("Experiment exposure",
+			"experiment", exp.Name,
+			"variant", variant.Name,
+			"consumer", consumer,
+			"tenant_id", reqctx.TenantID(c),
+			"request_id", reqctx.RequestID(c),
+			"route", route.Pattern(),
+		)
+
+		err := c.Next()
+		if exp.Rollback == nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		if rollback := guard.observe(exp, variant.Name, status >= fiber.StatusInternalServerError, time.Now()); rollback != nil {
+			RecordExperimentRollback(rollback.Experiment, rollback.Variant)
+			logger.Warn("Experiment rollback",
+				"experiment", rollback.Experiment,
+				"variant", rollback.Variant,
+				"baseline", rollback.Baseline,
+				"error_rate", rollback.ErrorRate,
+				"baseline_error_rate", rollback.BaselineErrorRate,
+				"requests", rollback.Requests,
+				"reason", rollback.Reason,
+			)
+		}
+		return err
+	}
+}
+
+// assignVariant deterministically picks a variant for a consumer, weighted by
+// variant weight. Hashing the experiment name in keeps assignments of
+// different experiments independent.
+func assignVariant(exp *config.ExperimentConfig, consumer string) config.ExperimentVariant {
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(exp.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(consumer))
+	bucket := int(h.Sum32() % uint32(total))
+
+	for _, v := range exp.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return exp.Variants[len(exp.Variants)-1]
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+func TestAssignVariant(t *testing.T) {
+	exp := &config.ExperimentConfig{
+		Name: "checkout",
+		Variants: []config.ExperimentVariant{
+			{Name: "control", Weight: 75},
+			{Name: "treatment", Weight: 25},
+		},
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		consumer := fmt.Sprintf("user-%d", i)
+		v := assignVariant(exp, consumer)
+		if again := assignVariant(exp, consumer); again.Name != v.Name {
+			t.Fatalf("consumer %s assigned %s then %s", consumer, v.Name, again.Name)
+		}
+		counts[v.Name]++
+	}
+
+	if share := float64(counts["treatment"]) / 10000; share < 0.22 || share > 0.28 {
+		t.Errorf("treatment share = %.3f, want about 0.25", share)
+	}
+}
+
+func TestCanaryRollback(t *testing.T) {
+	exp := &config.ExperimentConfig{
+		Name: "checkout",
+		Variants: []config.ExperimentVariant{
+			{Name: "control", Weight: 90},
+			{Name: "canary", Weight: 10},
+		},
+		Rollback: &config.RollbackConfig{MaxErrorRateDelta: 0.1, MinRequests: 10},
+	}
+	guard := newCanaryGuard()
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		guard.observe(exp, "control", i == 0, now)
+	}
+	var rollback *CanaryRollback
+	for i := 0; i < 10 && rollback == nil; i++ {
+		// 20% canary errors vs 10% baseline is within budget
+		rollback = guard.observe(exp, "canary", i < 2, now)
+	}
+	if rollback != nil {
+		t.Fatalf("rolled back within budget: %+v", rollback)
+	}
+
+	for i := 0; i < 5 && rollback == nil; i++ {
+		rollback = guard.observe(exp, "canary", true, now)
+	}
+	if rollback == nil || rollback.Baseline != "control" || !guard.isRolledBack(exp, "canary") {
+		t.Fatalf("expected canary rollback, got %+v", rollback)
+	}
+	if guard.isRolledBack(exp, "control") {
+		t.Error("baseline must never be rolled back")
+	}
+}
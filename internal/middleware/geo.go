@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/geoip"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Location headers forwarded to upstreams
+const (
+	CountryHeader = "X-Country-Code"
+	ASNHeader     = "X-ASN"
+)
+
+// Locator locates client addresses; *geoip.Locator is one
+type Locator interface {
+	Locate(addr netip.Addr) geoip.Location
+}
+
+// Geo locates clients by IP: their country and autonomous system go into
+// the request context (and so the logs) and the X-Country-Code and X-ASN
+// headers, which callers can't set themselves. Routes with geo reject
+// clients from elsewhere with a 403. With metrics, requests are counted by
+// country. locator may be nil, leaving every client unlocated. It must run
+// after route resolution.
+func Geo(locator Locator, metrics bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := &c.Request().Header
+		header.Del(CountryHeader)
+		header.Del(ASNHeader)
+
+		var loc geoip.Location
+		if addr, err := netip.ParseAddr(c.IP()); err == nil && locator != nil {
+			loc = locator.Locate(addr)
+		}
+		reqctx.SetLocation(c, loc.Country, loc.ASN)
+		if loc.Country != "" {
+			header.Set(CountryHeader, loc.Country)
+		}
+		if loc.ASN != 0 {
+			header.Set(ASNHeader, strconv.FormatUint(uint64(loc.ASN), 10))
+		}
+
+		var err error
+		if route, ok := reqctx.Route(c); ok && route.Geo != nil && !geoAllowed(route.Geo, loc) {
+			reqctx.SetRejection(c, "geo")
+			err = c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "forbidden",
+				"message": "Not available in your location",
+			})
+		} else {
+			err = c.Next()
+		}
+		if metrics {
+			country := loc.Country
+			if country == "" {
+				country = "unknown"
+			}
+			requestsByCountry.WithLabelValues(country, reqctx.Service(c)).Inc()
+		}
+		return err
+	}
+}
+
+// geoAllowed applies a route's geo restrictions to a location
+func geoAllowed(geo *config.RouteGeo, loc geoip.Location) bool {
+	if len(geo.AllowCountries) > 0 && !slices.Contains(geo.AllowCountries, loc.Country) {
+		return false
+	}
+	if loc.Country != "" && slices.Contains(geo.DenyCountries, loc.Country) {
+		return false
+	}
+	return loc.ASN == 0 || !slices.Contains(geo.DenyASNs, loc.ASN)
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/geoip"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// fixedLocator locates every client at one place
+type fixedLocator geoip.Location
+
+func (l *fixedLocator) Locate(netip.Addr) geoip.Location {
+	return geoip.Location(*l)
+}
+
+func TestGeo(t *testing.T) {
+	routes := map[string]config.Route{
+		"/eu":     {Path: "/eu", Geo: &config.RouteGeo{AllowCountries: []string{"DE", "FR"}}},
+		"/open":   {Path: "/open", Geo: &config.RouteGeo{DenyCountries: []string{"KP"}, DenyASNs: []uint{16509}}},
+		"/anyone": {Path: "/anyone"},
+	}
+	locator := &fixedLocator{}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(Geo(locator, true))
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString(c.Get(CountryHeader) + "|" + c.Get(ASNHeader))
+	})
+
+	get := func(path string, loc geoip.Location) (int, string) {
+		t.Helper()
+		*locator = fixedLocator(loc)
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(CountryHeader, "XX")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/eu", geoip.Location{Country: "DE", ASN: 3320}); status != fiber.StatusOK || body != "DE|3320" {
+		t.Errorf("allowed country = %d %q", status, body)
+	}
+	if status, _ := get("/eu", geoip.Location{Country: "US"}); status != fiber.StatusForbidden {
+		t.Errorf("other country = %d, want 403", status)
+	}
+	if status, _ := get("/eu", geoip.Location{}); status != fiber.StatusForbidden {
+		t.Errorf("unknown country on an allow list = %d, want 403", status)
+	}
+	if status, _ := get("/open", geoip.Location{Country: "US", ASN: 16509}); status != fiber.StatusForbidden {
+		t.Errorf("denied ASN = %d, want 403", status)
+	}
+	if status, body := get("/open", geoip.Location{}); status != fiber.StatusOK || body != "|" {
+		t.Errorf("unknown location on a deny list = %d %q, want 200 without the spoofed header", status, body)
+	}
+	if status, _ := get("/anyone", geoip.Location{Country: "KP"}); status != fiber.StatusOK {
+		t.Errorf("unrestricted route = %d", status)
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// IdentityTokenHeader carries the identity token of authenticated requests
+const IdentityTokenHeader = "X-Gateway-Identity"
+
+// IdentityTokens mints the short-lived JWTs (HS256) asserting the identity
+// of authenticated requests to upstreams. Unlike the claim headers, which
+// anyone able to reach an upstream can set, they can only come from a
+// holder of the secret.
+type IdentityTokens struct {
+	cfg config.IdentityTokenConfig
+}
+
+// IdentityClaims are the claims of identity tokens: sub is the user, aud
+// the service the request is sent to and jti the request ID
+type IdentityClaims struct {
+	TenantID string   `json:"tenant_id,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewIdentityTokens creates the identity token minter
+func NewIdentityTokens(cfg config.IdentityTokenConfig) *IdentityTokens {
+	return &IdentityTokens{cfg: cfg}
+}
+
+// Mint signs an identity token for claims, sent to service
+func (t *IdentityTokens) Mint(claims *Claims, service, requestID string, now time.Time) (string, error) {
+	expires := now.Add(t.cfg.TTL)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(expires) {
+		expires = claims.ExpiresAt.Time
+	}
+	identity := IdentityClaims{
+		TenantID: claims.TenantID,
+		Email:    claims.Email,
+		Roles:    claims.Roles,
+		Scope:    strings.Join(claims.Scopes(), " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.cfg.Issuer,
+			Subject:   claims.UserID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+			ID:        requestID,
+		},
+	}
+	if service != "" {
+		identity.Audience = jwt.ClaimStrings{service}
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, identity).SignedString([]byte(t.cfg.Secret))
+}
+
+// set sends the request's identity token upstream
+func (t *IdentityTokens) set(c *fiber.Ctx, claims *Claims) error {
+	token, err := t.Mint(claims, reqctx.Service(c), reqctx.RequestID(c), time.Now())
+	if err != nil {
+		return err
+	}
+	c.Request().Header.Set(IdentityTokenHeader, token)
+	return nil
+}
+
+// StripIdentityHeaders removes the identity headers the gateway sets for
+// upstreams (the identity token, the default claim headers, claimHeaders
+// and every route's claimHeaders) from requests outside the internal
+// network, so callers of public routes can't impersonate users. Internal
+// callers (cidrs, or the internal listener port) keep theirs for
+// service-to-service calls. It must run before anything reads these
+// headers, such as TenantExtractor.
+func StripIdentityHeaders(cidrs []string, internalPort string, claimHeaders map[string]string, routes func() *config.RouteConfig) (fiber.Handler, error) {
+	network, err := newInternalNetwork(cidrs, internalPort)
+	if err != nil {
+		return nil, err
+	}
+
+	type identityHeaders struct {
+		routes *config.RouteConfig
+		names  []string
+	}
+	var current atomic.Pointer[identityHeaders]
+
+	return func(c *fiber.Ctx) error {
+		if network.contains(c) {
+			return c.Next()
+		}
+
+		table := routes()
+		headers := current.Load()
+		if headers == nil || headers.routes != table {
+			headers = &identityHeaders{routes: table, names: identityHeaderNames(claimHeaders, table)}
+			current.Store(headers)
+		}
+		for _, name := range headers.names {
+			c.Request().Header.Del(name)
+		}
+		return c.Next()
+	}, nil
+}
+
+// identityHeaderNames lists the headers claims may be sent upstream in
+func identityHeaderNames(claimHeaders map[string]string, routes *config.RouteConfig) []string {
+	seen := make(map[string]bool)
+	names := []string{IdentityTokenHeader}
+	seen[strings.ToLower(IdentityTokenHeader)] = true
+	add := func(headers map[string]string) {
+		for name := range headers {
+			if key := strings.ToLower(name); !seen[key] {
+				seen[key] = true
+				names = append(names, name)
+			}
+		}
+	}
+	add(config.DefaultClaimHeaders())
+	add(claimHeaders)
+	for _, route := range routes.Routes {
+		add(route.ClaimHeaders)
+	}
+	return names
+}
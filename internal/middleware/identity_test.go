@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestStripIdentityHeaders(t *testing.T) {
+	routes := &config.RouteConfig{Routes: []config.Route{
+		{Path: "/api/v1/orders", ClaimHeaders: map[string]string{"X-Org-ID": "org.id"}},
+	}}
+	claimHeaders := map[string]string{"X-User-ID": "sub", "X-Groups": "groups"}
+
+	forwarded := func(cidrs []string) string {
+		t.Helper()
+		strip, err := StripIdentityHeaders(cidrs, "", claimHeaders, func() *config.RouteConfig { return routes })
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := fiber.New()
+		app.Use(strip)
+		app.Get("/*", func(c *fiber.Ctx) error {
+			return c.SendString(c.Get("X-User-ID") + "|" + c.Get("X-Tenant-ID") + "|" + c.Get("X-Groups") + "|" + c.Get("X-Org-ID") + "|" + c.Get("X-Trace"))
+		})
+
+		req := httptest.NewRequest("GET", "/public", nil)
+		for _, name := range []string{"X-User-ID", "X-Tenant-ID", "X-Groups", "X-Org-ID", "X-Trace"} {
+			req.Header.Set(name, "spoofed")
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := forwarded(nil); got != "||||spoofed" {
+		t.Errorf("external caller forwarded %q, want only the non-identity header", got)
+	}
+	// app.Test requests come from 0.0.0.0
+	if got := forwarded([]string{"0.0.0.0"}); got != "spoofed|spoofed|spoofed|spoofed|spoofed" {
+		t.Errorf("internal caller forwarded %q, want its identity headers kept", got)
+	}
+}
+
+func TestIdentityToken(t *testing.T) {
+	const secret, identitySecret = "test-secret", "identity-secret"
+	cfg := DefaultAuthConfig(secret)
+	cfg.Identity = NewIdentityTokens(config.IdentityTokenConfig{Secret: identitySecret, TTL: time.Minute, Issuer: "gateway"})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, config.Route{Path: "/api/v1/orders", Service: "orders"})
+		reqctx.SetRequestID(c, "req-1")
+		return c.Next()
+	})
+	app.Use(Auth(cfg))
+	var forwarded string
+	app.Get("/api/v1/orders", func(c *fiber.Ctx) error {
+		forwarded = c.Get(IdentityTokenHeader)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	expires := time.Now().Add(20 * time.Second)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID: "u1", TenantID: "t1", Roles: []string{"admin"}, Scope: "orders:read",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expires)},
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/api/v1/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %v, %v", resp, err)
+	}
+
+	var identity IdentityClaims
+	if _, err := jwt.ParseWithClaims(forwarded, &identity, func(*jwt.Token) (interface{}, error) {
+		return []byte(identitySecret), nil
+	}, jwt.WithAudience("orders"), jwt.WithIssuer("gateway"), jwt.WithValidMethods([]string{"HS256"})); err != nil {
+		t.Fatalf("identity token %q: %v", forwarded, err)
+	}
+	if identity.Subject != "u1" || identity.TenantID != "t1" || identity.Scope != "orders:read" || identity.ID != "req-1" {
+		t.Errorf("identity = %+v", identity)
+	}
+	// The identity doesn't outlive the caller's token
+	if !identity.ExpiresAt.Equal(expires.Truncate(time.Second)) {
+		t.Errorf("expires %v, want the caller's %v", identity.ExpiresAt, expires)
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// internalNetwork recognizes callers on the internal network: clients in
+// its CIDRs and requests arriving on the internal listener port
+type internalNetwork struct {
+	nets []*net.IPNet
+	port string
+}
+
+// newInternalNetwork parses cidrs; bare addresses are single hosts
+func newInternalNetwork(cidrs []string, internalPort string) (*internalNetwork, error) {
+	network := &internalNetwork{port: internalPort}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid internal CIDR %q: %w", cidr, err)
+		}
+		network.nets = append(network.nets, ipNet)
+	}
+	return network, nil
+}
+
+// contains reports whether the request comes from the internal network
+func (n *internalNetwork) contains(c *fiber.Ctx) bool {
+	if n.port != "" {
+		if _, port, err := net.SplitHostPort(c.Context().LocalAddr().String()); err == nil && port == n.port {
+			return true
+		}
+	}
+	if ip := net.ParseIP(c.IP()); ip != nil {
+		for _, ipNet := range n.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InternalOnly restricts internalOnly routes to clients in cidrs and to
+// requests arriving on the internal listener port. Other callers get the
+// same 404 as for an unknown path, so the routes can't be discovered from
+// outside. It must run right after route resolution.
+func InternalOnly(cidrs []string, internalPort string) (fiber.Handler, error) {
+	network, err := newInternalNetwork(cidrs, internalPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		if !ok || !route.InternalOnly || network.contains(c) {
+			return c.Next()
+		}
+
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "not_found",
+			"message": "The requested resource was not found",
+			"path":    c.Path(),
+		})
+	}, nil
+}
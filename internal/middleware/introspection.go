@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+// introspectionCacheSize bounds the cached introspection results
+const introspectionCacheSize = 10000
+
+// Introspector validates opaque bearer tokens with the authorization
+// server's OAuth 2.0 token introspection endpoint (RFC 7662). Results,
+// inactive tokens included, are cached for a short while so a busy client
+// doesn't cost an introspection call per request.
+type Introspector struct {
+	cfg    config.IntrospectionConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]introspection
+}
+
+// introspection is a cached introspection result; claims is nil for
+// inactive tokens
+type introspection struct {
+	claims  *Claims
+	expires time.Time
+}
+
+// NewIntrospector creates an introspector calling cfg.URL
+func NewIntrospector(cfg config.IntrospectionConfig) *Introspector {
+	return &Introspector{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cache:  make(map[[sha256.Size]byte]introspection),
+	}
+}
+
+// handles reports whether the token is introspected rather than verified
+// as a JWT: every token in mode all, else those that aren't JWTs
+func (i *Introspector) handles(token string) bool {
+	return i.cfg.Mode == "all" || strings.Count(token, ".") != 2
+}
+
+// Introspect returns the claims of an active token
+func (i *Introspector) Introspect(ctx context.Context, token string) (*Claims, error) {
+	// Tokens are credentials; only their digest is kept
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	i.mu.Lock()
+	cached, ok := i.cache[key]
+	i.mu.Unlock()
+	if !ok || now.After(cached.expires) {
+		claims, err := i.introspect(ctx, token)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusServiceUnavailable, "Token introspection unavailable")
+		}
+		cached = introspection{claims: claims, expires: now.Add(i.cfg.CacheTTL)}
+		if claims != nil && claims.ExpiresAt != nil && claims.ExpiresAt.Before(cached.expires) {
+			cached.expires = claims.ExpiresAt.Time
+		}
+		i.store(key, cached, now)
+	}
+
+	if cached.claims == nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Token inactive")
+	}
+	return cached.claims, nil
+}
+
+// store caches a result, first dropping expired ones when the cache is full
+func (i *Introspector) store(key [sha256.Size]byte, result introspection, now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.cache) >= introspectionCacheSize {
+		for k, v := range i.cache {
+			if now.After(v.expires) {
+				delete(i.cache, k)
+			}
+		}
+		if len(i.cache) >= introspectionCacheSize {
+			clear(i.cache)
+		}
+	}
+	i.cache[key] = result
+}
+
+// introspect calls the introspection endpoint; inactive tokens have nil
+// claims
+func (i *Introspector) introspect(ctx context.Context, token string) (*Claims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.cfg.ClientID), url.QueryEscape(i.cfg.ClientSecret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: %s answered %d", i.cfg.URL, resp.StatusCode)
+	}
+
+	// The response carries the standard claims (sub, scope, exp, iss,
+	// aud...) and, from the auth service, the gateway's own ones
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Active bool `json:"active"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("introspection: %w", err)
+	}
+	if !result.Active {
+		return nil, nil
+	}
+	var claims Claims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("introspection: %w", err)
+	}
+	if claims.UserID == "" {
+		claims.UserID = claims.Subject
+		claims.raw["user_id"] = claims.Subject
+	}
+	return &claims, nil
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+)
+
+func TestIntrospection(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	down := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if down {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case "opaque-active":
+			_ = json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "u1",
+				"scope": "orders:read", "iss": "auth", "aud": "gateway", "exp": time.Now().Add(time.Hour).Unix()})
+		case "opaque-other-audience":
+			_ = json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "u2", "aud": []string{"billing"}})
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]any{"active": false})
+		}
+	}))
+	defer server.Close()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	introspector := NewIntrospector(config.IntrospectionConfig{URL: server.URL, ClientID: "gateway",
+		ClientSecret: "s3cret", Mode: "opaque", CacheTTL: time.Minute, Timeout: time.Second})
+	tokens := TokenConfig{Secret: "test-secret", Audiences: []string{"gateway"}, Introspector: introspector}
+
+	claims, err := validateToken("opaque-active", tokens)
+	if err != nil || claims.UserID != "u1" || claims.Scope != "orders:read" {
+		t.Fatalf("active token: %+v, %v", claims, err)
+	}
+	if _, err := validateToken("opaque-active", tokens); err != nil || count() != 1 {
+		t.Errorf("cached token: %v (%d calls)", err, count())
+	}
+	if _, err := validateToken("opaque-other-audience", tokens); err == nil {
+		t.Error("token for another audience accepted")
+	}
+
+	// JWTs are still verified locally in opaque mode
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "u3",
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"gateway"}}}).SignedString([]byte("test-secret"))
+	before := count()
+	if claims, err := validateToken(signed, tokens); err != nil || claims.UserID != "u3" || count() != before {
+		t.Errorf("JWT in opaque mode: %v (%d calls)", err, count()-before)
+	}
+
+	app := fiber.New()
+	app.Use(Auth(AuthConfig{Tokens: tokens, HeaderName: "Authorization", TokenPrefix: "Bearer "}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	status := func(token string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("opaque-active"); got != fiber.StatusOK {
+		t.Errorf("active token = %d, want 200", got)
+	}
+	if got := status("opaque-inactive"); got != fiber.StatusUnauthorized {
+		t.Errorf("inactive token = %d, want 401", got)
+	}
+	mu.Lock()
+	down = true
+	mu.Unlock()
+	if got := status("opaque-unknown"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("endpoint down = %d, want 503", got)
+	}
+	if got := status("opaque-active"); got != fiber.StatusOK {
+		t.Errorf("cached active token with the endpoint down = %d, want 200", got)
+	}
+}
@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// jwksFetchTimeout bounds a single key set download
+	jwksFetchTimeout = 10 * time.Second
+	// jwksMissRefresh is how often unknown key IDs may trigger a download,
+	// so tokens with made-up kids can't hammer the identity provider
+	jwksMissRefresh = time.Minute
+)
+
+// JWKS is the key set of an identity provider, fetched from its JWKS URL.
+// Keys are refreshed periodically and, when a token names a key ID the set
+// doesn't have (the provider rotated its keys), on demand.
+type JWKS struct {
+	interval    time.Duration
+	missRefresh time.Duration
+	client      *http.Client
+	logger      Logger
+
+	keys atomic.Pointer[map[string]jwk]
+
+	// mu serializes downloads and guards url; fetched is when the last
+	// download started
+	mu      sync.Mutex
+	url     string
+	fetched time.Time
+}
+
+// jwk is a verification key and the algorithm it is restricted to, if any
+type jwk struct {
+	key any
+	alg string
+}
+
+// NewJWKS creates a key set read from url and refreshed every interval
+func NewJWKS(url string, interval time.Duration, logger Logger) *JWKS {
+	return &JWKS{
+		url:         url,
+		interval:    interval,
+		missRefresh: jwksMissRefresh,
+		client:      &http.Client{Timeout: jwksFetchTimeout},
+		logger:      logger,
+	}
+}
+
+// Start fetches the keys, then refreshes them in the background until ctx
+// is done. A failed first fetch is logged and retried by the refreshes;
+// tokens are rejected until keys are available.
+func (k *JWKS) Start(ctx context.Context) {
+	if err := k.Refresh(ctx); err != nil {
+		k.logger.Warn("Failed to fetch JWKS", "url", k.URL(), "error", err)
+	}
+	go func() {
+		ticker := time.NewTicker(k.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := k.Refresh(ctx); err != nil {
+					k.logger.Warn("Failed to refresh JWKS, keeping the current keys", "url", k.URL(), "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Refresh downloads the key set. On failure the current keys stay in use.
+func (k *JWKS) Refresh(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.refresh(ctx)
+}
+
+// URL returns where the key set is downloaded from
+func (k *JWKS) URL() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.url
+}
+
+// SetURL changes where the key set is downloaded from, e.g. when an OIDC
+// provider moves its keys; it reports whether the URL changed
+func (k *JWKS) SetURL(url string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if url == k.url {
+		return false
+	}
+	k.url = url
+	return true
+}
+
+// refresh downloads the key set; k.mu must be held
+func (k *JWKS) refresh(ctx context.Context) error {
+	k.fetched = time.Now()
+	if k.url == "" {
+		return errors.New("jwks: no URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: %s answered %d", k.url, resp.StatusCode)
+	}
+
+	keys, err := parseJWKS(resp.Body)
+	if err != nil {
+		return err
+	}
+	k.keys.Store(&keys)
+	return nil
+}
+
+// Key returns the key a token signed with alg and the key ID kid is
+// verified with. Tokens without a kid use the only key of single-key sets.
+func (k *JWKS) Key(kid, alg string) (any, error) {
+	key, ok := k.lookup(kid)
+	if !ok {
+		// The provider may have rotated its keys since the last refresh
+		k.mu.Lock()
+		if key, ok = k.lookup(kid); !ok && time.Since(k.fetched) >= k.missRefresh {
+			if err := k.refresh(context.Background()); err != nil {
+				k.logger.Warn("Failed to refresh JWKS", "url", k.url, "error", err)
+			}
+			key, ok = k.lookup(kid)
+		}
+		k.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("jwks: unknown key %q", kid)
+	}
+	if key.alg != "" && key.alg != alg {
+		return nil, fmt.Errorf("jwks: key %q is for %s, not %s", kid, key.alg, alg)
+	}
+	return key.key, nil
+}
+
+// lookup finds a key in the current set
+func (k *JWKS) lookup(kid string) (jwk, bool) {
+	keys := k.keys.Load()
+	if keys == nil {
+		return jwk{}, false
+	}
+	if kid == "" && len(*keys) == 1 {
+		for _, key := range *keys {
+			return key, true
+		}
+	}
+	key, ok := (*keys)[kid]
+	return key, ok
+}
+
+// parseJWKS reads the RSA and EC signature keys of a JSON Web Key Set
+// (RFC 7517). Encryption keys, unsupported key types and invalid keys are
+// skipped, so one bad key doesn't make the provider's other keys unusable.
+func parseJWKS(r io.Reader) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+	var invalid error
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		var key any
+		var err error
+		switch raw.Kty {
+		case "RSA":
+			key, err = rsaKey(raw.N, raw.E)
+		case "EC":
+			key, err = ecKey(raw.Crv, raw.X, raw.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			invalid = fmt.Errorf("jwks: key %q: %w", raw.Kid, err)
+			continue
+		}
+		keys[raw.Kid] = jwk{key: key, alg: raw.Alg}
+	}
+	if len(keys) == 0 {
+		if invalid != nil {
+			return nil, invalid
+		}
+		return nil, errors.New("jwks: no signature keys")
+	}
+	return keys, nil
+}
+
+// rsaKey decodes an RSA public key from its base64url modulus and exponent
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	E := new(big.Int).SetBytes(exponent)
+	if len(modulus) == 0 || !E.IsInt64() || E.Int64() < 3 || E.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(E.Int64())}, nil
+}
+
+// ecKey decodes an EC public key from its curve and base64url coordinates,
+// checking that the point is on the curve
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var check ecdh.Curve
+	switch crv {
+	case "P-256":
+		curve, check = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, check = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, check = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	X, errX := base64.RawURLEncoding.DecodeString(x)
+	Y, errY := base64.RawURLEncoding.DecodeString(y)
+	if errX != nil || errY != nil || len(X) != size || len(Y) != size {
+		return nil, errors.New("invalid EC coordinates")
+	}
+	point := append(append([]byte{4}, X...), Y...)
+	if _, err := check.NewPublicKey(point); err != nil {
+		return nil, errors.New("EC point is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(X), Y: new(big.Int).SetBytes(Y)}, nil
+}
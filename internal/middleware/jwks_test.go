@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+)
+
+// jwkJSON returns the JWK of a public key
+func jwkJSON(kid string, key any) map[string]string {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+			"x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32)))}
+	}
+	return nil
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	keys := []map[string]string{jwkJSON("rsa-1", &rsaKey.PublicKey), jwkJSON("ec-1", &ecKey.PublicKey)}
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer server.Close()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	jwks := NewJWKS(server.URL, time.Hour, NewLogger(config.LoggingConfig{}))
+	if err := jwks.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tokenConfig := TokenConfig{Secret: "shared", JWKS: jwks, Algorithms: []string{"RS256", "ES256"}}
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, Claims{UserID: "u1"})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	for name, token := range map[string]string{
+		"RS256": sign(jwt.SigningMethodRS256, "rsa-1", rsaKey),
+		"ES256": sign(jwt.SigningMethodES256, "ec-1", ecKey),
+	} {
+		if claims, err := validateToken(token, tokenConfig); err != nil || claims.UserID != "u1" {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+
+	for name, token := range map[string]string{
+		"HMAC with the shared secret": sign(jwt.SigningMethodHS256, "", []byte("shared")),
+		"wrong key for the kid":       sign(jwt.SigningMethodES256, "ec-1", rotated),
+		"algorithm the key isn't for": sign(jwt.SigningMethodRS384, "rsa-1", rsaKey),
+		"unknown kid":                 sign(jwt.SigningMethodES256, "ec-2", rotated),
+	} {
+		if _, err := validateToken(token, tokenConfig); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+
+	// A rotated key is fetched when a token names it, once per miss interval
+	mu.Lock()
+	keys = append(keys, jwkJSON("ec-2", &rotated.PublicKey))
+	mu.Unlock()
+	before := count()
+	token := sign(jwt.SigningMethodES256, "ec-2", rotated)
+	if _, err := validateToken(token, tokenConfig); err == nil || count() != before {
+		t.Errorf("unknown kid refetched within the miss interval (err %v, %d fetches)", err, count()-before)
+	}
+	jwks.missRefresh = 0
+	if _, err := validateToken(token, tokenConfig); err != nil || count() != before+1 {
+		t.Errorf("rotated key: %v (%d fetches)", err, count()-before)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	for name, body := range map[string]string{
+		"no keys":           `{"keys": []}`,
+		"encryption only":   `{"keys": [{"kty": "RSA", "kid": "a", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		"point off curve":   `{"keys": [{"kty": "EC", "kid": "a", "crv": "P-256", "x": "` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `", "y": "` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `"}]}`,
+		"unsupported curve": `{"keys": [{"kty": "EC", "kid": "a", "crv": "secp256k1", "x": "AA", "y": "AA"}]}`,
+	} {
+		if _, err := parseJWKS(strings.NewReader(body)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	keys, err := parseJWKS(strings.NewReader(`{"keys": [
+		{"kty": "EC", "kid": "bad", "crv": "secp256k1", "x": "AA", "y": "AA"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+		{"kty": "RSA", "kid": "good", "n": "AQAB", "e": "AQAB"}]}`))
+	if err != nil || len(keys) != 1 || keys["good"].key == nil {
+		t.Errorf("keys = %v, %v; want only the valid key", keys, err)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestLimits rejects requests whose URI is longer than maxURILength
+// with 414 and those with more than maxHeaderCount headers with 431, before
+// anything parses them further. Their total size is bounded by the server's
+// read buffer (SERVER_MAX_HEADER_BYTES). A limit of 0 is disabled.
+func RequestLimits(maxURILength, maxHeaderCount int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if n := len(c.Request().Header.RequestURI()); maxURILength > 0 && n > maxURILength {
+			return c.Status(fiber.StatusRequestURITooLong).JSON(fiber.Map{
+				"error":   "uri_too_long",
+				"message": fmt.Sprintf("Request URI is longer than %d bytes", maxURILength),
+			})
+		}
+		if n := c.Request().Header.Len(); maxHeaderCount > 0 && n > maxHeaderCount {
+			return c.Status(fiber.StatusRequestHeaderFieldsTooLarge).JSON(fiber.Map{
+				"error":   "header_fields_too_large",
+				"message": fmt.Sprintf("Request has more than %d headers", maxHeaderCount),
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestRequestLimits(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorLogger(NewLogger(config.LoggingConfig{}))})
+	app.Use(RequestLimits(64, 10))
+	// What the server reports for headers larger than its read buffer
+	app.Get("/oversized", func(c *fiber.Ctx) error { return fiber.ErrRequestHeaderFieldsTooLarge })
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	send := func(path string, headers int, value string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		for i := range headers {
+			req.Header.Set(fmt.Sprintf("X-Header-%d", i), value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct{ Error string }
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Error
+	}
+
+	if status, _ := send("/users?page=2", 3, "x"); status != fiber.StatusOK {
+		t.Errorf("small request = %d", status)
+	}
+	if status, name := send("/users?q="+strings.Repeat("a", 64), 0, ""); status != fiber.StatusRequestURITooLong || name != "uri_too_long" {
+		t.Errorf("long URI = %d %q, want 414 uri_too_long", status, name)
+	}
+	if status, name := send("/users", 20, "x"); status != fiber.StatusRequestHeaderFieldsTooLarge || name != "header_fields_too_large" {
+		t.Errorf("many headers = %d %q, want 431 header_fields_too_large", status, name)
+	}
+	if status, name := send("/oversized", 0, ""); status != fiber.StatusRequestHeaderFieldsTooLarge || name != "header_fields_too_large" {
+		t.Errorf("oversized headers = %d %q, want 431 header_fields_too_large", status, name)
+	}
+}
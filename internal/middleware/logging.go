@@ -2,11 +2,14 @@ package middleware
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
 )
 
 // Logger interface for structured logging
@@ -86,6 +89,10 @@ func (l *SimpleLogger) log(level, msg string, fields ...interface{}) {
 // RequestLogger logs HTTP requests
 func RequestLogger(logger Logger) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if route, ok := reqctx.Route(c); ok && route.Skip.Logging {
+			return c.Next()
+		}
+
 		start := time.Now()
 
 		// Process request
@@ -95,10 +102,10 @@ func RequestLogger(logger Logger) fiber.Handler {
 		duration := time.Since(start)
 
 		// Get request info
-		requestID, _ := c.Locals("request_id").(string)
-		userID, _ := c.Locals("user_id").(string)
-		tenantID, _ := c.Locals("tenant_id").(string)
-		service, _ := c.Locals("service").(string)
+		requestID := reqctx.RequestID(c)
+		userID := reqctx.UserID(c)
+		tenantID := reqctx.TenantID(c)
+		service := reqctx.Service(c)
 
 		status := c.Response().StatusCode()
 
@@ -110,7 +117,7 @@ func RequestLogger(logger Logger) fiber.Handler {
 			logFn = logger.Warn
 		}
 
-		logFn("HTTP Request",
+		fields := []interface{}{
 			"method", c.Method(),
 			"path", c.Path(),
 			"status", status,
@@ -121,7 +128,22 @@ func RequestLogger(logger Logger) fiber.Handler {
 			"tenant_id", tenantID,
 			"service", service,
 			"user_agent", c.Get("User-Agent"),
-		)
+		}
+		if identity := reqctx.ClientCert(c); identity != "" {
+			fields = append(fields, "client_cert", identity)
+		}
+		if country := reqctx.Country(c); country != "" {
+			fields = append(fields, "country", country)
+		}
+		if asn := reqctx.ASN(c); asn != 0 {
+			fields = append(fields, "asn", asn)
+		}
+		// Route tags attribute the request to its owner, e.g. tag_team
+		tags := reqctx.Tags(c)
+		for _, name := range slices.Sorted(maps.Keys(tags)) {
+			fields = append(fields, "tag_"+name, tags[name])
+		}
+		logFn("HTTP Request", fields...)
 
 		return err
 	}
@@ -148,7 +170,7 @@ type AccessLog struct {
 // ErrorLogger logs errors with context
 func ErrorLogger(logger Logger) fiber.ErrorHandler {
 	return func(c *fiber.Ctx, err error) error {
-		requestID, _ := c.Locals("request_id").(string)
+		requestID := reqctx.RequestID(c)
 
 		// Get status code from error
 		code := fiber.StatusInternalServerError
@@ -166,8 +188,13 @@ func ErrorLogger(logger Logger) fiber.ErrorHandler {
 		)
 
 		// Return error response
+		name := "error"
+		if code == fiber.StatusRequestHeaderFieldsTooLarge {
+			// The headers didn't fit SERVER_MAX_HEADER_BYTES
+			name = "header_fields_too_large"
+		}
 		return c.Status(code).JSON(fiber.Map{
-			"error":      "error",
+			"error":      name,
 			"message":    err.Error(),
 			"request_id": requestID,
 		})
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Maintenance answers routes in maintenance with a 503 and Retry-After
+// without calling the backend. Routes are put in maintenance by their
+// maintenance flag, which the admin API can override per route at runtime.
+type Maintenance struct {
+	cfg config.MaintenanceConfig
+
+	mu sync.RWMutex
+	// overrides replace the configured flag, by route pattern
+	overrides map[string]bool
+}
+
+// NewMaintenance creates the maintenance switch
+func NewMaintenance(cfg config.MaintenanceConfig) *Maintenance {
+	return &Maintenance{
+		cfg:       cfg,
+		overrides: make(map[string]bool),
+	}
+}
+
+// Set puts a route (by pattern) in or out of maintenance, overriding its
+// configured flag
+func (m *Maintenance) Set(route string, enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides[route] = enabled
+}
+
+// Clear restores a route's configured maintenance flag
+func (m *Maintenance) Clear(route string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.overrides, route)
+}
+
+// Overrides returns the runtime overrides in effect
+func (m *Maintenance) Overrides() map[string]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	overrides := make(map[string]bool, len(m.overrides))
+	for route, enabled := range m.overrides {
+		overrides[route] = enabled
+	}
+	return overrides
+}
+
+// Active reports whether a route is in maintenance
+func (m *Maintenance) Active(route config.Route) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if enabled, ok := m.overrides[route.Pattern()]; ok {
+		return enabled
+	}
+	return route.Maintenance
+}
+
+// Middleware returns the maintenance middleware. It must run after route
+// resolution.
+func (m *Maintenance) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		if !ok || !m.Active(route) {
+			return c.Next()
+		}
+
+		if m.cfg.RetryAfter > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(m.cfg.RetryAfter.Seconds())))
+		}
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "maintenance",
+			"message": m.cfg.Message,
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestMaintenance(t *testing.T) {
+	m := NewMaintenance(config.MaintenanceConfig{Message: "Back soon", RetryAfter: 2 * time.Minute})
+	routes := map[string]config.Route{
+		"/billing": {Path: "/billing", Maintenance: true},
+		"/users":   {Path: "/users"},
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(m.Middleware())
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("backend") })
+
+	get := func(path string) (int, string, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter), string(body)
+	}
+
+	status, retryAfter, body := get("/billing")
+	if status != fiber.StatusServiceUnavailable || retryAfter != "120" || !strings.Contains(body, "Back soon") {
+		t.Errorf("configured maintenance = %d %q %s", status, retryAfter, body)
+	}
+	if status, _, _ := get("/users"); status != fiber.StatusOK {
+		t.Errorf("/users = %d, want 200", status)
+	}
+
+	m.Set("/users", true)
+	m.Set("/billing", false)
+	if status, _, _ := get("/users"); status != fiber.StatusServiceUnavailable {
+		t.Errorf("/users after Set = %d, want 503", status)
+	}
+	if status, _, _ := get("/billing"); status != fiber.StatusOK {
+		t.Errorf("/billing after override = %d, want 200", status)
+	}
+
+	m.Clear("/billing")
+	if status, _, _ := get("/billing"); status != fiber.StatusServiceUnavailable {
+		t.Errorf("/billing after Clear = %d, want configured 503", status)
+	}
+}
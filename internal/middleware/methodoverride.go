@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+// overridableMethods are the methods a POST request may be overridden to
+var overridableMethods = map[string]bool{
+	fasthttp.MethodPut:    true,
+	fasthttp.MethodPatch:  true,
+	fasthttp.MethodDelete: true,
+}
+
+// MethodOverride returns a hook applying the method override header (e.g.
+// X-HTTP-Method-Override: DELETE) of POST requests. It runs once the
+// headers are read, before routing, so the request is matched, handled and
+// proxied with the overridden method. Only routes with methodOverride accept
+// it: elsewhere the request stays a POST. The header is removed when applied.
+func MethodOverride(header string, match func(path, method string) *config.Route) func(header *fasthttp.RequestHeader) {
+	return func(h *fasthttp.RequestHeader) {
+		if !h.IsPost() {
+			return
+		}
+		method := strings.ToUpper(strings.TrimSpace(string(h.Peek(header))))
+		if !overridableMethods[method] {
+			return
+		}
+
+		var uri fasthttp.URI
+		if err := uri.Parse(nil, h.RequestURI()); err != nil {
+			return
+		}
+		route := match(string(uri.Path()), method)
+		if route == nil || !route.MethodOverride {
+			return
+		}
+		h.SetMethod(method)
+		h.Del(header)
+	}
+}
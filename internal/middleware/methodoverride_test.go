@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestMethodOverride(t *testing.T) {
+	orders := &config.Route{Path: "/api/v1/orders", Methods: []string{"POST", "DELETE"}, MethodOverride: true}
+	users := &config.Route{Path: "/api/v1/users", Methods: []string{"POST", "DELETE"}}
+	match := func(path, method string) *config.Route {
+		for _, route := range []*config.Route{orders, users} {
+			if strings.HasPrefix(path, route.Path) {
+				return route
+			}
+		}
+		return nil
+	}
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	override := MethodOverride("X-HTTP-Method-Override", match)
+	app.Server().HeaderReceived = func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+		override(header)
+		return fasthttp.RequestConfig{}
+	}
+	app.Use(func(c *fiber.Ctx) error {
+		return c.SendString(c.Method() + " " + c.Get("X-HTTP-Method-Override"))
+	})
+	go app.Listener(ln)
+	client := &fasthttp.Client{Dial: func(string) (net.Conn, error) { return ln.Dial() }}
+
+	for _, tc := range []struct {
+		method, path, override string
+		want                   string
+	}{
+		{"POST", "/api/v1/orders/1", "delete", "DELETE "},
+		{"POST", "/api/v1/orders/1", "GET", "POST GET"},
+		{"GET", "/api/v1/orders/1", "DELETE", "GET DELETE"},
+		{"POST", "/api/v1/users/1", "DELETE", "POST DELETE"},
+		{"POST", "/api/v1/orders/1", "", "POST "},
+	} {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		req.SetRequestURI("http://gateway" + tc.path)
+		req.Header.SetMethod(tc.method)
+		if tc.override != "" {
+			req.Header.Set("X-HTTP-Method-Override", tc.override)
+		}
+		if err := client.Do(req, resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(resp.Body()); got != tc.want {
+			t.Errorf("%s %s overridden to %q = %q, want %q", tc.method, tc.path, tc.override, got, tc.want)
+		}
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}
+}
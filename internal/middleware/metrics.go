@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -63,6 +67,38 @@ var (
 		[]string{"service"},
 	)
 
+	circuitBreakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state transitions",
+		},
+		[]string{"service", "from", "to"},
+	)
+
+	circuitBreakerTimeInState = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_state_seconds_total",
+			Help: "Total seconds spent in each circuit breaker state, recorded on leaving the state",
+		},
+		[]string{"service", "state"},
+	)
+
+	circuitBreakerLastTransition = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_circuit_breaker_last_transition_timestamp_seconds",
+			Help: "Unix time of the last circuit breaker state transition",
+		},
+		[]string{"service"},
+	)
+
+	circuitBreakerCycles = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_cycles_total",
+			Help: "Total number of completed open -> half-open -> closed recovery cycles",
+		},
+		[]string{"service"},
+	)
+
 	// Rate limiter metrics
 	rateLimitExceeded = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -89,17 +125,299 @@ var (
 		},
 		[]string{"service"},
 	)
+
+	// Connection metrics
+	connectionsAccepted = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_connections_accepted_total",
+			Help: "Total number of client connections accepted",
+		},
+	)
+
+	connectionAcceptErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_connection_accept_errors_total",
+			Help: "Total number of failed accepts on the listener",
+		},
+	)
+
+	connectionsActive = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_connections_active",
+			Help: "Number of open client connections",
+		},
+	)
+
+	connectionsClosed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_connections_closed_total",
+			Help: "Total number of client connections closed, by reason (closed, timeout)",
+		},
+		[]string{"reason"},
+	)
+
+	tlsHandshakeErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_tls_handshake_errors_total",
+			Help: "Total number of failed TLS handshakes",
+		},
+	)
+
+	proxyProtocolErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_proxy_protocol_errors_total",
+			Help: "Total number of connections with a missing or malformed PROXY protocol header",
+		},
+	)
+
+	slowConnections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_slow_connections_total",
+			Help: "Total number of connections closed for sending requests too slowly, by limit (stall, rate)",
+		},
+		[]string{"reason"},
+	)
+
+	auditEventsDropped = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_audit_events_dropped_total",
+			Help: "Total number of audit log events dropped because the sink fell behind",
+		},
+	)
+
+	clientDisconnects = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_client_disconnects_total",
+			Help: "Total number of proxied requests abandoned because the client disconnected first",
+		},
+		[]string{"service"},
+	)
+
+	securityAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_security_alerts_total",
+			Help: "Total number of security alerts raised for spikes of rejected requests",
+		},
+		[]string{"kind", "key_type"},
+	)
+
+	clusterEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cluster_events_total",
+			Help: "Total number of cluster events published by or applied on this instance",
+		},
+		[]string{"type", "direction"},
+	)
+
+	syntheticCheckDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_synthetic_check_duration_seconds",
+			Help:    "Latency of synthetic transaction checks",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"check"},
+	)
+
+	syntheticCheckStatus = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_synthetic_check_status",
+			Help: "Latest synthetic check outcome (0=ok, 1=slow, 2=failing)",
+		},
+		[]string{"check"},
+	)
+
+	quotaThresholds = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_quota_thresholds_crossed_total",
+			Help: "Total number of quota warning thresholds crossed",
+		},
+		[]string{"consumer_type", "threshold"},
+	)
+
+	requestsByCountry = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_requests_by_country_total",
+			Help: "Total number of requests by client country (with GEOIP_METRICS)",
+		},
+		[]string{"country", "service"},
+	)
+
+	botRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_bot_requests_total",
+			Help: "Total number of requests from bots by reason and whether they were blocked",
+		},
+		[]string{"reason", "service", "blocked"},
+	)
+
+	experimentExposures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_experiment_exposures_total",
+			Help: "Total number of requests exposed to an experiment variant",
+		},
+		[]string{"experiment", "variant"},
+	)
+
+	// Tracing exporter metrics
+	tracingSpansDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_tracing_spans_dropped_total",
+			Help: "Total number of spans dropped before reaching the collector",
+		},
+		[]string{"reason"},
+	)
+
+	// Route configuration, for joining traffic metrics with route properties
+	routeInfoOpts = prometheus.GaugeOpts{
+		Name: "gateway_route_info",
+		Help: "Route configuration; always 1, properties are in the labels",
+	}
+	routeInfoLabels = []string{"path", "methods", "service", "public", "internal_only", "circuit_breaker", "rate_limited", "cached", "stream"}
+	routeInfo       = prometheus.NewGaugeVec(routeInfoOpts, routeInfoLabels)
+	// routeInfoTags are the route tags also exported as routeInfo labels
+	routeInfoTags []string
+
+	tracingExporterHealthy = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_tracing_exporter_healthy",
+			Help: "Whether the last span export succeeded (1) or failed (0)",
+		},
+	)
+
+	tracingSampleRate = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_tracing_sample_rate",
+			Help: "Effective trace sample rate after backpressure reductions",
+		},
+	)
+
+	experimentRollbacks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_experiment_rollbacks_total",
+			Help: "Total number of canary variants rolled back for exceeding their error budget",
+		},
+		[]string{"experiment", "variant"},
+	)
+
+	upstreamFailovers = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_failovers_total",
+			Help: "Total number of requests sent to a service's fallback upstream",
+		},
+		[]string{"service", "reason"},
+	)
+
+	// Upstream connection pool metrics
+	upstreamConns = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_connections",
+			Help: "Upstream connections by state (open, idle, waiting for a connection)",
+		},
+		[]string{"service", "state"},
+	)
+
+	upstreamTrafficShare = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_traffic_share",
+			Help: "Share of traffic a service warming up after recovery is ramped to (1 when fully ramped)",
+		},
+		[]string{"service"},
+	)
+
+	upstreamDials = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_dials_total",
+			Help: "Total number of upstream connection attempts",
+		},
+		[]string{"service", "result"},
+	)
+
+	upstreamPoolExhausted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_pool_exhausted_total",
+			Help: "Total number of requests that found no free upstream connection",
+		},
+		[]string{"service"},
+	)
+
+	upstreamClientResets = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_client_resets_total",
+			Help: "Total number of upstream clients recreated to force DNS re-resolution",
+		},
+		[]string{"service"},
+	)
+
+	cacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_requests_total",
+			Help: "Total number of cacheable requests by route and result (hit, miss)",
+		},
+		[]string{"route", "result"},
+	)
+
+	expectContinueRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_expect_continue_rejected_total",
+			Help: "Total number of Expect: 100-continue uploads rejected before the body was read",
+		},
+		[]string{"reason"},
+	)
+
+	// Streaming metrics
+	slowClientAborts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_slow_client_aborts_total",
+			Help: "Total number of streamed responses aborted because the client read too slowly",
+		},
+		[]string{"service", "reason"},
+	)
+
+	ingestRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_ingest_requests_total",
+			Help: "Total number of requests on ingest routes, by outcome (accepted, rejected, delivered, retried, dead_lettered)",
+		},
+		[]string{"service", "result"},
+	)
+
+	shedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_shed_requests_total",
+			Help: "Total number of requests shed under load, by reason and request priority",
+		},
+		[]string{"service", "reason", "priority"},
+	)
+
+	ingestQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_ingest_queue_depth",
+			Help: "Number of ingest requests waiting for delivery",
+		},
+	)
+
+	routeReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_route_reloads_total",
+			Help: "Total number of route table updates from a watched source, by result (applied, failed)",
+		},
+		[]string{"source", "result"},
+	)
 )
 
 // Metrics returns Prometheus metrics middleware
 func Metrics() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if route, ok := reqctx.Route(c); ok && route.Skip.Metrics {
+			return c.Next()
+		}
+
 		start := time.Now()
 		activeConnections.Inc()
 
 		// Get service name (set by router)
 		serviceName := "gateway"
-		if svc, ok := c.Locals("service").(string); ok && svc != "" {
+		if svc := reqctx.Service(c); svc != "" {
 			serviceName = svc
 		}
 
@@ -110,17 +428,18 @@ func Metrics() fiber.Handler {
 		duration := time.Since(start).Seconds()
 		status := strconv.Itoa(c.Response().StatusCode())
 		method := c.Method()
+		// Label by the route's path template to keep cardinality low
 		path := c.Route().Path
-
-		// Normalize path for metrics (avoid high cardinality)
-		if path == "" {
+		if route, ok := reqctx.Route(c); ok {
+			path = route.Pattern()
+		} else if path == "" {
 			path = c.Path()
 		}
 
 		httpRequestsTotal.WithLabelValues(method, path, serviceName, status).Inc()
 		httpRequestDuration.WithLabelValues(method, path, serviceName).Observe(duration)
 		httpRequestSize.WithLabelValues(method, path).Observe(float64(len(c.Body())))
-		httpResponseSize.WithLabelValues(method, path).Observe(float64(len(c.Response().Body())))
+		httpResponseSize.WithLabelValues(method, path).Observe(float64(responseSize(c)))
 
 		activeConnections.Dec()
 
@@ -142,11 +461,249 @@ func Metrics() fiber.Handler {
 	}
 }
 
+// responseSize returns the response body size without draining streamed bodies
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return max(c.Response().Header.ContentLength(), 0)
+	}
+	return len(c.Response().Body())
+}
+
 // UpdateCircuitBreakerMetric updates circuit breaker state metric
 func UpdateCircuitBreakerMetric(service string, state int) {
 	circuitBreakerState.WithLabelValues(service).Set(float64(state))
 }
 
+// RecordCircuitBreakerTransition records a breaker leaving one state for another
+// after spending timeInState in it
+func RecordCircuitBreakerTransition(service, from, to string, state int, timeInState time.Duration, at time.Time) {
+	circuitBreakerTransitions.WithLabelValues(service, from, to).Inc()
+	circuitBreakerTimeInState.WithLabelValues(service, from).Add(timeInState.Seconds())
+	circuitBreakerLastTransition.WithLabelValues(service).Set(float64(at.Unix()))
+	circuitBreakerState.WithLabelValues(service).Set(float64(state))
+}
+
+// RecordCircuitBreakerCycle counts a completed breaker recovery cycle
+func RecordCircuitBreakerCycle(service string) {
+	circuitBreakerCycles.WithLabelValues(service).Inc()
+}
+
+// RecordConnAccepted counts an accepted connection
+func RecordConnAccepted() {
+	connectionsAccepted.Inc()
+	connectionsActive.Inc()
+}
+
+// RecordConnAcceptError counts a failed accept
+func RecordConnAcceptError() {
+	connectionAcceptErrors.Inc()
+}
+
+// RecordConnClosed counts a closed connection
+func RecordConnClosed(reason string) {
+	connectionsActive.Dec()
+	connectionsClosed.WithLabelValues(reason).Inc()
+}
+
+// RecordTLSHandshakeError counts a failed TLS handshake
+func RecordTLSHandshakeError() {
+	tlsHandshakeErrors.Inc()
+}
+
+// RecordProxyProtocolError counts a connection rejected for its PROXY header
+func RecordProxyProtocolError() {
+	proxyProtocolErrors.Inc()
+}
+
+// RecordSlowConnection counts a connection closed for a slow request
+func RecordSlowConnection(reason string) {
+	slowConnections.WithLabelValues(reason).Inc()
+}
+
+// RecordClientDisconnect counts an upstream call abandoned by its client
+func RecordClientDisconnect(service string) {
+	clientDisconnects.WithLabelValues(service).Inc()
+}
+
+// RecordSecurityAlert counts a raised security alert
+func RecordSecurityAlert(kind, keyType string) {
+	securityAlerts.WithLabelValues(kind, keyType).Inc()
+}
+
+// RecordClusterEvent counts a published or applied cluster event
+func RecordClusterEvent(eventType, direction string) {
+	clusterEvents.WithLabelValues(eventType, direction).Inc()
+}
+
+// RecordSyntheticCheck records the outcome of a synthetic check run
+func RecordSyntheticCheck(check, status string, latency time.Duration) {
+	if latency > 0 {
+		syntheticCheckDuration.WithLabelValues(check).Observe(latency.Seconds())
+	}
+	value := 0.0
+	switch status {
+	case "slow":
+		value = 1
+	case "failing":
+		value = 2
+	}
+	syntheticCheckStatus.WithLabelValues(check).Set(value)
+}
+
+// RecordQuotaThreshold counts a consumer crossing a quota threshold
+func RecordQuotaThreshold(consumerType string, threshold int) {
+	quotaThresholds.WithLabelValues(consumerType, strconv.Itoa(threshold)).Inc()
+}
+
+// RecordExperimentExposure counts a request assigned to an experiment variant
+func RecordExperimentExposure(experiment, variant string) {
+	experimentExposures.WithLabelValues(experiment, variant).Inc()
+}
+
+// RecordTracingSpansDropped counts spans that won't reach the collector
+func RecordTracingSpansDropped(reason string, n int) {
+	tracingSpansDropped.WithLabelValues(reason).Add(float64(n))
+}
+
+// RecordTracingExporter updates the exporter health and sample rate gauges
+func RecordTracingExporter(healthy bool, sampleRate float64) {
+	if healthy {
+		tracingExporterHealthy.Set(1)
+	} else {
+		tracingExporterHealthy.Set(0)
+	}
+	tracingSampleRate.Set(sampleRate)
+}
+
+// RecordRouteInfo publishes one gateway_route_info series per route. path
+// is the route template, the same value as the path label of the request
+// metrics.
+func RecordRouteInfo(routes []config.Route) {
+	routeInfo.Reset()
+	for _, route := range routes {
+		values := []string{
+			route.Pattern(),
+			strings.ToUpper(strings.Join(route.Methods, ",")),
+			route.Service,
+			strconv.FormatBool(route.Public),
+			strconv.FormatBool(route.InternalOnly),
+			strconv.FormatBool(route.CircuitBreaker),
+			strconv.FormatBool(route.RateLimit != nil),
+			strconv.FormatBool(route.Cache != nil && route.Cache.Enabled),
+			strconv.FormatBool(route.Stream),
+		}
+		for _, name := range routeInfoTags {
+			values = append(values, route.Tags[name])
+		}
+		routeInfo.WithLabelValues(values...).Set(1)
+	}
+}
+
+// SetRouteInfoTags adds a tag_<name> label to gateway_route_info for each
+// of the route tags (see METRICS_ROUTE_TAGS), valued by the route's tag or
+// empty. Only listed tags are exported, since any label multiplies the
+// series of queries joining on it. Call it before RecordRouteInfo.
+func SetRouteInfoTags(names []string) {
+	names = slices.Compact(slices.Sorted(slices.Values(names)))
+	labels := slices.Clone(routeInfoLabels)
+	for _, name := range names {
+		labels = append(labels, "tag_"+name)
+	}
+	routeInfo = prometheus.NewGaugeVec(routeInfoOpts, labels)
+	routeInfoTags = names
+}
+
+// routeInfoCollector serves routeInfo, whose labels SetRouteInfoTags
+// changes. It describes nothing, making it an unchecked collector: the
+// registry wouldn't let a registered metric change its labels.
+type routeInfoCollector struct{}
+
+func (routeInfoCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (routeInfoCollector) Collect(ch chan<- prometheus.Metric) {
+	routeInfo.Collect(ch)
+}
+
+func init() {
+	prometheus.MustRegister(routeInfoCollector{})
+}
+
+// RecordExperimentRollback counts a canary variant rolled back to the baseline
+func RecordExperimentRollback(experiment, variant string) {
+	experimentRollbacks.WithLabelValues(experiment, variant).Inc()
+}
+
+// RecordUpstreamFailover counts a request sent to a fallback upstream
+func RecordUpstreamFailover(service, reason string) {
+	upstreamFailovers.WithLabelValues(service, reason).Inc()
+}
+
+// RecordUpstreamPool updates the connection pool gauges of a service
+func RecordUpstreamPool(service string, open, idle, waiting int64) {
+	upstreamConns.WithLabelValues(service, "open").Set(float64(open))
+	upstreamConns.WithLabelValues(service, "idle").Set(float64(idle))
+	upstreamConns.WithLabelValues(service, "waiting").Set(float64(waiting))
+}
+
+// RecordUpstreamTrafficShare records the slow-start traffic share of a service
+func RecordUpstreamTrafficShare(service string, share float64) {
+	upstreamTrafficShare.WithLabelValues(service).Set(share)
+}
+
+// RecordUpstreamDial counts an upstream connection attempt
+func RecordUpstreamDial(service string, ok bool) {
+	result := "success"
+	if !ok {
+		result = "error"
+	}
+	upstreamDials.WithLabelValues(service, result).Inc()
+}
+
+// RecordUpstreamPoolExhausted counts a request rejected for lack of connections
+func RecordUpstreamPoolExhausted(service string) {
+	upstreamPoolExhausted.WithLabelValues(service).Inc()
+}
+
+// RecordUpstreamClientReset counts an upstream client reset
+func RecordUpstreamClientReset(service string) {
+	upstreamClientResets.WithLabelValues(service).Inc()
+}
+
+// RecordCacheResult counts a response cache lookup
+func RecordCacheResult(route, result string) {
+	cacheRequests.WithLabelValues(route, result).Inc()
+}
+
+// RecordExpectContinueRejected counts an upload rejected before its body was sent
+func RecordExpectContinueRejected(reason string) {
+	expectContinueRejected.WithLabelValues(reason).Inc()
+}
+
+// RecordSlowClientAbort counts a streamed response aborted for a slow client
+func RecordSlowClientAbort(service, reason string) {
+	slowClientAborts.WithLabelValues(service, reason).Inc()
+}
+
+// RecordIngest counts an ingest request outcome
+func RecordIngest(service, result string) {
+	ingestRequests.WithLabelValues(service, result).Inc()
+}
+
+// RecordShed counts a request shed under load
+func RecordShed(service, reason, priority string) {
+	shedRequests.WithLabelValues(service, reason, priority).Inc()
+}
+
+// RecordIngestQueueDepth records the number of queued ingest requests
+func RecordIngestQueueDepth(n int) {
+	ingestQueueDepth.Set(float64(n))
+}
+
+// RecordRouteReload counts a route table update from a watched source
+func RecordRouteReload(source, result string) {
+	routeReloads.WithLabelValues(source, result).Inc()
+}
+
 // GetMetricsHandler returns handler for /metrics endpoint
 func GetMetricsHandler() fiber.Handler {
 	return func(c *fiber.Ctx) error {
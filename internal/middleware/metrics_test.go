@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/minisource/gateway/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// routeInfoSeries collects the gateway_route_info series
+func routeInfoSeries(t *testing.T) []*dto.Metric {
+	ch := make(chan prometheus.Metric, 16)
+	routeInfo.Collect(ch)
+	close(ch)
+
+	var series []*dto.Metric
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		series = append(series, &m)
+	}
+	return series
+}
+
+func TestRecordRouteInfo(t *testing.T) {
+	RecordRouteInfo([]config.Route{
+		{Path: "/api/v1/auth/login", Service: "auth", Methods: []string{"post"}, Public: true},
+		{Path: "/api/v1/users/:id", Service: "auth", Methods: []string{"GET", "PUT"}, CircuitBreaker: true,
+			RateLimit: &config.RouteLimit{RequestsPerSec: 10, BurstSize: 20}},
+	})
+
+	series := routeInfoSeries(t)
+	if len(series) != 2 {
+		t.Fatalf("series = %d, want 2", len(series))
+	}
+	for _, m := range series {
+		labels := make(map[string]string)
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if m.GetGauge().GetValue() != 1 {
+			t.Errorf("%s = %v, want 1", labels["path"], m.GetGauge().GetValue())
+		}
+		if labels["path"] == "/api/v1/auth/login" && (labels["methods"] != "POST" || labels["public"] != "true") {
+			t.Errorf("login labels = %v", labels)
+		}
+		if labels["path"] == "/api/v1/users/:id" && (labels["rate_limited"] != "true" || labels["circuit_breaker"] != "true") {
+			t.Errorf("users labels = %v", labels)
+		}
+	}
+
+	// Re-recording replaces the previous route table
+	RecordRouteInfo(nil)
+	if series := routeInfoSeries(t); len(series) != 0 {
+		t.Errorf("series after reset = %d, want 0", len(series))
+	}
+}
+
+func TestRecordRouteInfoTags(t *testing.T) {
+	SetRouteInfoTags([]string{"team", "tier", "team"})
+	defer SetRouteInfoTags(nil)
+	RecordRouteInfo([]config.Route{
+		{Path: "/api/v1/orders", Service: "orders", Tags: map[string]string{"team": "commerce", "cost_center": "cc-42"}},
+	})
+
+	series := routeInfoSeries(t)
+	if len(series) != 1 {
+		t.Fatalf("series = %d, want 1", len(series))
+	}
+	labels := make(map[string]string)
+	for _, label := range series[0].GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	if labels["tag_team"] != "commerce" {
+		t.Errorf("tag_team = %q, want commerce", labels["tag_team"])
+	}
+	if value, ok := labels["tag_tier"]; !ok || value != "" {
+		t.Errorf("tag_tier = %q (%v), want an empty label", value, ok)
+	}
+	if _, ok := labels["tag_cost_center"]; ok {
+		t.Error("unlisted tag cost_center exported")
+	}
+}
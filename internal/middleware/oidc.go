@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// oidcAlgorithms are the signature algorithms a provider may advertise that
+// tokens are accepted with; HMAC and none never are
+var oidcAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDC is an OpenID Connect provider whose key set and token algorithms are
+// discovered from its issuer's .well-known/openid-configuration and
+// refreshed periodically.
+type OIDC struct {
+	issuer   string
+	interval time.Duration
+	client   *http.Client
+	logger   Logger
+
+	jwks       *JWKS
+	algorithms atomic.Pointer[[]string]
+}
+
+// NewOIDC creates a provider discovered from issuer and refreshed every
+// interval
+func NewOIDC(issuer string, interval time.Duration, logger Logger) *OIDC {
+	return &OIDC{
+		issuer:   issuer,
+		interval: interval,
+		client:   &http.Client{Timeout: jwksFetchTimeout},
+		logger:   logger,
+		jwks:     NewJWKS("", interval, logger),
+	}
+}
+
+// JWKS returns the provider's key set
+func (o *OIDC) JWKS() *JWKS {
+	return o.jwks
+}
+
+// Algorithms returns the accepted token algorithms: those the provider
+// advertises, RS256 (which every provider supports) until discovered
+func (o *OIDC) Algorithms() []string {
+	if algorithms := o.algorithms.Load(); algorithms != nil {
+		return *algorithms
+	}
+	return []string{"RS256"}
+}
+
+// Start discovers the provider and fetches its keys, then refreshes both in
+// the background until ctx is done. Failures are logged and retried by the
+// refreshes; tokens are rejected until keys are available.
+func (o *OIDC) Start(ctx context.Context) {
+	o.refresh(ctx)
+	go func() {
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				o.refresh(ctx)
+			}
+		}
+	}()
+}
+
+// refresh rediscovers the provider and downloads its keys
+func (o *OIDC) refresh(ctx context.Context) {
+	if err := o.Discover(ctx); err != nil {
+		o.logger.Warn("Failed to discover OIDC provider, keeping the current configuration", "issuer", o.issuer, "error", err)
+	}
+	if o.jwks.URL() == "" {
+		return
+	}
+	if err := o.jwks.Refresh(ctx); err != nil {
+		o.logger.Warn("Failed to refresh JWKS, keeping the current keys", "url", o.jwks.URL(), "error", err)
+	}
+}
+
+// Discover reads the provider configuration: its key set URL and token
+// algorithms. The issuer it names must be the configured one.
+func (o *OIDC) Discover(ctx context.Context) error {
+	url := strings.TrimSuffix(o.issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s answered %d", url, resp.StatusCode)
+	}
+
+	var doc struct {
+		Issuer     string   `json:"issuer"`
+		JWKSURI    string   `json:"jwks_uri"`
+		Algorithms []string `json:"id_token_signing_alg_values_supported"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	if doc.Issuer != o.issuer {
+		return fmt.Errorf("oidc: configuration is for issuer %q", doc.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return errors.New("oidc: configuration has no jwks_uri")
+	}
+
+	var algorithms []string
+	for _, alg := range doc.Algorithms {
+		if slices.Contains(oidcAlgorithms, alg) {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	if len(algorithms) == 0 {
+		algorithms = []string{"RS256"}
+	}
+	o.algorithms.Store(&algorithms)
+	if o.jwks.SetURL(doc.JWKSURI) {
+		o.logger.Info("OIDC provider discovered", "issuer", o.issuer, "jwks", doc.JWKSURI, "algorithms", algorithms)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+)
+
+func TestOIDCDiscovery(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer,
+			"jwks_uri":                              "http://" + r.Host + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256", "HS256", "none", "ES256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{jwkJSON("ec-1", &key.PublicKey)}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The configuration must be for the issuer it was discovered from
+	oidc := NewOIDC(server.URL, time.Hour, NewLogger(config.LoggingConfig{}))
+	issuer = "https://elsewhere.example.com"
+	if err := oidc.Discover(context.Background()); err == nil {
+		t.Error("configuration of another issuer accepted")
+	}
+
+	issuer = server.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	oidc.Start(ctx)
+	if got := oidc.Algorithms(); len(got) != 2 || got[0] != "RS256" || got[1] != "ES256" {
+		t.Errorf("algorithms = %v, want [RS256 ES256]", got)
+	}
+
+	tokens := TokenConfig{Secret: "shared", OIDC: oidc, Issuers: []string{server.URL}}
+	sign := func(method jwt.SigningMethod, iss string, key any) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{Issuer: iss}})
+		token.Header["kid"] = "ec-1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if claims, err := validateToken(sign(jwt.SigningMethodES256, server.URL, key), tokens); err != nil || claims.UserID != "u1" {
+		t.Errorf("provider token: %v", err)
+	}
+	if _, err := validateToken(sign(jwt.SigningMethodHS256, server.URL, []byte("shared")), tokens); err == nil {
+		t.Error("HMAC token accepted though the provider advertises it")
+	}
+	if _, err := validateToken(sign(jwt.SigningMethodES256, "https://elsewhere.example.com", key), tokens); err == nil {
+		t.Error("token of another issuer accepted")
+	}
+}
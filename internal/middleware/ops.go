@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+// OpsGuard protects the operational endpoints (/metrics, /circuit-breakers,
+// /health/services, /health/synthetic), which reveal the gateway's
+// internals. Callers outside OPS_ALLOW_CIDRS, or off the internal listener
+// with OPS_INTERNAL_PORT_ONLY, get a 404. With INTERNAL_AUTH_* or
+// OPS_BEARER_TOKEN set, the others need the basic auth credentials or the
+// bearer token. Unconfigured, it lets every request through.
+func OpsGuard(cfg config.ServerConfig) (fiber.Handler, error) {
+	if cfg.OpsInternalPortOnly && cfg.InternalPort == "" {
+		return nil, errors.New("OPS_INTERNAL_PORT_ONLY needs SERVER_INTERNAL_PORT")
+	}
+	var allowed *internalNetwork
+	switch {
+	case cfg.OpsInternalPortOnly:
+		allowed = &internalNetwork{port: cfg.InternalPort}
+	case len(cfg.OpsAllowCIDRs) > 0:
+		network, err := newInternalNetwork(cfg.OpsAllowCIDRs, cfg.InternalPort)
+		if err != nil {
+			return nil, err
+		}
+		allowed = network
+	}
+
+	// Digests have a fixed length, so the comparisons take constant time
+	digest := func(s string) []byte {
+		sum := sha256.Sum256([]byte(s))
+		return sum[:]
+	}
+	wantUser, wantPass, wantToken := digest(cfg.InternalUsername), digest(cfg.InternalPassword), digest(cfg.OpsToken)
+	authenticated := func(c *fiber.Ctx) bool {
+		if cfg.InternalUsername != "" {
+			if user, pass, ok := BasicCredentials(c); ok &&
+				subtle.ConstantTimeCompare(digest(user), wantUser)&subtle.ConstantTimeCompare(digest(pass), wantPass) == 1 {
+				return true
+			}
+		}
+		if cfg.OpsToken != "" {
+			header := c.Get(fiber.HeaderAuthorization)
+			if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") &&
+				subtle.ConstantTimeCompare(digest(strings.TrimSpace(header[7:])), wantToken) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) error {
+		if allowed != nil && !allowed.contains(c) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "not_found",
+				"message": "The requested resource was not found",
+				"path":    c.Path(),
+			})
+		}
+		if (cfg.InternalUsername == "" && cfg.OpsToken == "") || authenticated(c) {
+			return c.Next()
+		}
+
+		if cfg.InternalUsername != "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="gateway", charset="UTF-8"`)
+		} else {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="gateway"`)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "unauthorized",
+			"message": "Invalid credentials",
+		})
+	}, nil
+}
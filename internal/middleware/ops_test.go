@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestOpsGuard(t *testing.T) {
+	status := func(cfg config.ServerConfig, auth func(req *http.Request)) int {
+		t.Helper()
+		guard, err := OpsGuard(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := fiber.New()
+		app.Get("/metrics", guard, func(c *fiber.Ctx) error { return c.SendString("ok") })
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if auth != nil {
+			auth(req)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	basic := func(user, pass string) func(req *http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(user, pass) }
+	}
+	bearer := func(token string) func(req *http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	// Test requests come from 0.0.0.0
+	credentials := config.ServerConfig{InternalUsername: "prometheus", InternalPassword: "scrape", OpsToken: "t0ken"}
+	for _, tc := range []struct {
+		name string
+		cfg  config.ServerConfig
+		auth func(req *http.Request)
+		want int
+	}{
+		{"unguarded", config.ServerConfig{}, nil, fiber.StatusOK},
+		{"allowed network", config.ServerConfig{OpsAllowCIDRs: []string{"0.0.0.0/32"}}, nil, fiber.StatusOK},
+		{"other network", config.ServerConfig{OpsAllowCIDRs: []string{"10.0.0.0/8"}}, nil, fiber.StatusNotFound},
+		{"other network with credentials", config.ServerConfig{OpsAllowCIDRs: []string{"10.0.0.0/8"}, OpsToken: "t0ken"}, bearer("t0ken"), fiber.StatusNotFound},
+		{"no credentials", credentials, nil, fiber.StatusUnauthorized},
+		{"basic auth", credentials, basic("prometheus", "scrape"), fiber.StatusOK},
+		{"wrong password", credentials, basic("prometheus", "guess"), fiber.StatusUnauthorized},
+		{"bearer token", credentials, bearer("t0ken"), fiber.StatusOK},
+		{"wrong token", credentials, bearer("guess"), fiber.StatusUnauthorized},
+		{"token only", config.ServerConfig{OpsToken: "t0ken"}, bearer("t0ken"), fiber.StatusOK},
+		{"basic auth without INTERNAL_AUTH_*", config.ServerConfig{OpsToken: "t0ken"}, basic("", "t0ken"), fiber.StatusUnauthorized},
+	} {
+		if got := status(tc.cfg, tc.auth); got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := OpsGuard(config.ServerConfig{OpsInternalPortOnly: true}); err == nil {
+		t.Error("OPS_INTERNAL_PORT_ONLY accepted without an internal port")
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+// NormalizePath makes the request path canonical before routing, so route
+// matching, public-path and role checks see the path upstreams receive.
+// Upstream paths are always percent-decoded with repeated slashes merged
+// and dot segments resolved; without this step a path such as
+// /api/v1/auth/login/../../admin would be authorized as the public login
+// route and forwarded as /api/v1/admin. Repeated slashes and dot segments
+// can be rejected instead, and trailing slashes stripped or redirected.
+func NormalizePath(cfg config.PathConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		raw := c.Path()
+		decoded, err := url.PathUnescape(raw)
+		if err != nil {
+			decoded = raw
+		}
+		if cfg.DoubleSlashes == "reject" && strings.Contains(decoded, "//") {
+			return badPath(c, "Request paths must not contain repeated slashes")
+		}
+		if cfg.DotSegments == "reject" && hasDotSegment(decoded) {
+			return badPath(c, "Request paths must not contain . or .. segments")
+		}
+
+		path := string(c.Request().URI().Path())
+		if cfg.TrailingSlash == "redirect" && len(path) > 1 && strings.HasSuffix(path, "/") {
+			target := strings.TrimRight(path, "/")
+			if target == "" {
+				target = "/"
+			}
+			if query := c.Request().URI().QueryString(); len(query) > 0 {
+				target += "?" + string(query)
+			}
+			return c.Redirect(target, fiber.StatusPermanentRedirect)
+		}
+		path = trimTrailingSlash(path, cfg)
+		if path != raw {
+			c.Path(path)
+		}
+		return c.Next()
+	}
+}
+
+// trimTrailingSlash strips a trailing slash from a normalized path when the
+// policy says so
+func trimTrailingSlash(path string, cfg config.PathConfig) string {
+	if cfg.TrailingSlash != "strip" || len(path) < 2 || !strings.HasSuffix(path, "/") {
+		return path
+	}
+	if path = strings.TrimRight(path, "/"); path == "" {
+		return "/"
+	}
+	return path
+}
+
+// headerPath returns the path NormalizePath will route a request by, from
+// its headers alone, for hooks running before the request is read. The
+// Host header is passed on so a request URI starting with // stays a path,
+// as the server parses it.
+func headerPath(header *fasthttp.RequestHeader, cfg config.PathConfig) (string, bool) {
+	var uri fasthttp.URI
+	if err := uri.Parse(header.Host(), header.RequestURI()); err != nil {
+		return "", false
+	}
+	return trimTrailingSlash(string(uri.Path()), cfg), true
+}
+
+// hasDotSegment reports whether a path has a . or .. segment
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// badPath answers a request with a path the normalization policy rejects
+func badPath(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   "bad_request",
+		"message": message,
+	})
+}
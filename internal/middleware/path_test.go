@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestNormalizePath(t *testing.T) {
+	request := func(cfg config.PathConfig, path string) (int, string, string) {
+		t.Helper()
+		app := fiber.New()
+		app.Use(NormalizePath(cfg))
+		app.Use(func(c *fiber.Ctx) error {
+			// The path routing sees and the path the proxy forwards
+			return c.SendString(c.Path() + " " + string(c.Request().URI().Path()))
+		})
+		req := httptest.NewRequest(fiber.MethodGet, "http://gateway/", nil)
+		req.URL.Path, req.URL.RawPath, req.RequestURI = path, path, path
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), resp.Header.Get(fiber.HeaderLocation)
+	}
+
+	normalize := config.PathConfig{DoubleSlashes: "normalize", DotSegments: "normalize", TrailingSlash: "keep"}
+	for path, want := range map[string]string{
+		"/api/v1/auth/login/../../admin":       "/api/v1/admin /api/v1/admin",
+		"/api/v1/auth/login%2F..%2F..%2Fadmin": "/api/v1/admin /api/v1/admin",
+		"/api//v1/./users/":                    "/api/v1/users/ /api/v1/users/",
+		"/api/v1/%75sers":                      "/api/v1/users /api/v1/users",
+	} {
+		if status, body, _ := request(normalize, path); status != fiber.StatusOK || body != want {
+			t.Errorf("%s = %d %q, want %q", path, status, body, want)
+		}
+	}
+
+	reject := config.PathConfig{DoubleSlashes: "reject", DotSegments: "reject", TrailingSlash: "strip"}
+	for _, path := range []string{"/api//v1/users", "/api/v1/auth/login/../../admin", "/api/v1/%2e%2e/admin"} {
+		if status, _, _ := request(reject, path); status != fiber.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", path, status)
+		}
+	}
+	if _, body, _ := request(reject, "/api/v1/users/"); body != "/api/v1/users /api/v1/users" {
+		t.Errorf("stripped trailing slash = %q", body)
+	}
+
+	redirect := config.PathConfig{TrailingSlash: "redirect"}
+	if status, _, location := request(redirect, "/api/v1/users/?page=2"); status != fiber.StatusPermanentRedirect || location != "/api/v1/users?page=2" {
+		t.Errorf("redirect = %d %s", status, location)
+	}
+	if status, _, _ := request(redirect, "/"); status != fiber.StatusOK {
+		t.Errorf("root = %d", status)
+	}
+}
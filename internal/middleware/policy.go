@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Policy authorizes requests with Open Policy Agent: the request's
+// attributes are sent as input to the route's decision through OPA's Data
+// API, so authorization rules change in Rego instead of gateway code.
+type Policy struct {
+	cfg    config.PolicyConfig
+	client *http.Client
+	logger Logger
+}
+
+// PolicyInput is the input document of policy decisions
+type PolicyInput struct {
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Route      string            `json:"route"`
+	Service    string            `json:"service"`
+	Params     map[string]string `json:"params,omitempty"`
+	Query      map[string]string `json:"query,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	ClientIP   string            `json:"clientIp"`
+	ClientCert string            `json:"clientCert,omitempty"`
+	TenantID   string            `json:"tenantId,omitempty"`
+	Claims     *Claims           `json:"claims,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// policyHiddenHeaders are credentials left out of the policy input
+var policyHiddenHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+}
+
+// NewPolicy creates the OPA authorization
+func NewPolicy(cfg config.PolicyConfig, logger Logger) *Policy {
+	return &Policy{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}, logger: logger}
+}
+
+// Middleware enforces the decision of the route's policy (or, on
+// authenticated routes, OPA_POLICY). Denied requests get a 403 with the
+// policy's reason; when OPA can't be queried they get a 503 unless FailOpen
+// is set. It must run after authentication, so the decision can use the
+// claims.
+func (p *Policy) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		if !ok {
+			return c.Next()
+		}
+		// Public routes such as /health only follow their own policy
+		policy := route.Policy
+		if policy == "" && !route.Public {
+			policy = p.cfg.DefaultPolicy
+		}
+		if policy == "" {
+			return c.Next()
+		}
+
+		start := time.Now()
+		allowed, reason, err := p.Decide(c.Context(), policy, policyInput(c, route))
+		reqctx.AddTiming(c, "policy", time.Since(start))
+		if err != nil {
+			if p.cfg.FailOpen {
+				p.logger.Warn("Policy decision failed, allowing the request", "policy", policy, "error", err)
+				return c.Next()
+			}
+			p.logger.Error("Policy decision failed", "policy", policy, "error", err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "service_unavailable",
+				"message": "Authorization policy unavailable",
+			})
+		}
+		if !allowed {
+			if reason == "" {
+				reason = "Denied by policy"
+			}
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "forbidden",
+				"message": reason,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// Decide queries a decision. It may be a boolean or an object with allow
+// and an optional reason; an undefined decision denies.
+func (p *Policy) Decide(ctx context.Context, policy string, input PolicyInput) (bool, string, error) {
+	body, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return false, "", err
+	}
+	url := strings.TrimSuffix(p.cfg.URL, "/") + "/v1/data/" + policy
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("opa: %s answered %d", url, resp.StatusCode)
+	}
+
+	var decision struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, "", fmt.Errorf("opa: %w", err)
+	}
+	if len(decision.Result) == 0 {
+		return false, "", nil
+	}
+	var allowed bool
+	if err := json.Unmarshal(decision.Result, &allowed); err == nil {
+		return allowed, "", nil
+	}
+	var result struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(decision.Result, &result); err != nil {
+		return false, "", fmt.Errorf("opa: decision %s is neither a boolean nor an object with allow", policy)
+	}
+	return result.Allow, result.Reason, nil
+}
+
+// policyInput collects the request attributes a policy decides on
+func policyInput(c *fiber.Ctx, route config.Route) PolicyInput {
+	input := PolicyInput{
+		Method:     c.Method(),
+		Path:       c.Path(),
+		Route:      route.Pattern(),
+		Service:    reqctx.Service(c),
+		Params:     reqctx.PathParams(c),
+		Query:      c.Queries(),
+		Headers:    make(map[string]string),
+		ClientIP:   c.IP(),
+		ClientCert: reqctx.ClientCert(c),
+		TenantID:   reqctx.TenantID(c),
+		Tags:       route.Tags,
+	}
+	if claims, ok := GetClaims(c); ok {
+		input.Claims = claims
+	}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		name := strings.ToLower(string(key))
+		if !policyHiddenHeaders[name] {
+			input.Headers[name] = string(value)
+		}
+	})
+	return input
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestPolicy(t *testing.T) {
+	var inputs []PolicyInput
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input PolicyInput `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		inputs = append(inputs, body.Input)
+
+		switch r.URL.Path {
+		case "/v1/data/gateway/authz/allow":
+			// Tenants may only reach their own orders
+			own := body.Input.Claims != nil && body.Input.Claims.TenantID == body.Input.Params["tenant"]
+			_ = json.NewEncoder(w).Encode(map[string]any{"result": own})
+		case "/v1/data/gateway/reports/decision":
+			_, _ = w.Write([]byte(`{"result": {"allow": false, "reason": "Reports are closed for month-end"}}`))
+		case "/v1/data/gateway/missing":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer opa.Close()
+
+	routes := map[string]config.Route{
+		"/tenants/t1/orders": {Path: "/tenants/:tenant/orders"},
+		"/reports":           {Path: "/reports", Policy: "gateway/reports/decision"},
+		"/undefined":         {Path: "/undefined", Policy: "gateway/missing"},
+		"/broken":            {Path: "/broken", Policy: "gateway/broken"},
+		"/health":            {Path: "/health", Public: true},
+	}
+	newApp := func(failOpen bool) *fiber.App {
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			reqctx.SetRoute(c, routes[c.Path()])
+			if c.Path() == "/tenants/t1/orders" {
+				reqctx.SetPathParams(c, map[string]string{"tenant": "t1"})
+			}
+			if tenant := c.Get("X-Test-Tenant"); tenant != "" {
+				claimsKey.Set(c, &Claims{UserID: "u1", TenantID: tenant})
+			}
+			return c.Next()
+		})
+		app.Use(NewPolicy(config.PolicyConfig{URL: opa.URL, DefaultPolicy: "gateway/authz/allow", FailOpen: failOpen},
+			NewLogger(config.LoggingConfig{})).Middleware())
+		app.All("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+		return app
+	}
+	app := newApp(false)
+	status := func(app *fiber.App, path, tenant string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret-token")
+		if tenant != "" {
+			req.Header.Set("X-Test-Tenant", tenant)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status(app, "/tenants/t1/orders", "t1"); got != fiber.StatusOK {
+		t.Errorf("own tenant = %d, want 200", got)
+	}
+	in := inputs[len(inputs)-1]
+	if in.Method != "GET" || in.Route != "/tenants/:tenant/orders" || in.Claims == nil || in.Claims.UserID != "u1" {
+		t.Errorf("input = %+v", in)
+	}
+	if _, leaked := in.Headers["authorization"]; leaked {
+		t.Error("Authorization header sent to the policy")
+	}
+
+	for _, tc := range []struct {
+		path, tenant string
+		want         int
+	}{
+		{"/tenants/t1/orders", "t2", fiber.StatusForbidden},
+		{"/reports", "t1", fiber.StatusForbidden},
+		{"/undefined", "t1", fiber.StatusForbidden},
+		{"/broken", "t1", fiber.StatusServiceUnavailable},
+	} {
+		if got := status(app, tc.path, tc.tenant); got != tc.want {
+			t.Errorf("%s (tenant %s) = %d, want %d", tc.path, tc.tenant, got, tc.want)
+		}
+	}
+
+	before := len(inputs)
+	if got := status(app, "/health", ""); got != fiber.StatusOK || len(inputs) != before {
+		t.Errorf("public route = %d, %d decisions; want 200 without a decision", got, len(inputs)-before)
+	}
+	if got := status(newApp(true), "/broken", "t1"); got != fiber.StatusOK {
+		t.Errorf("fail open = %d, want 200", got)
+	}
+}
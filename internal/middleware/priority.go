@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// Priority assigns each request its load-shedding priority and forwards it
+// upstream in the priority header, so the services behind the gateway can
+// prioritize consistently. It needs the authenticated caller, so it runs
+// after auth.
+func Priority(cfg config.PriorityConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		priority := derivedPriority(c, cfg)
+
+		// Unknown values are ignored
+		if requested, ok := config.ParsePriority(c.Get(cfg.Header)); ok {
+			if requested <= priority || headerTrusted(c, cfg.Trust) {
+				priority = requested
+			}
+		}
+
+		reqctx.SetPriority(c, priority)
+		c.Request().Header.Set(cfg.Header, priority.String())
+		return c.Next()
+	}
+}
+
+// derivedPriority returns the priority from the route and the caller's roles
+func derivedPriority(c *fiber.Ctx, cfg config.PriorityConfig) config.RequestPriority {
+	priority := config.PriorityNormal
+	if route, ok := reqctx.Route(c); ok {
+		if p, ok := config.ParsePriority(route.RequestPriority); ok {
+			priority = p
+		}
+	}
+
+	if claims, ok := claimsKey.Get(c); ok {
+		switch {
+		case claims.hasAnyRole(cfg.HighRoles):
+			priority = config.PriorityHigh
+		case claims.hasAnyRole(cfg.LowRoles):
+			priority = config.PriorityLow
+		}
+	}
+	return priority
+}
+
+// headerTrusted applies a client header trust policy: "any", "trusted"
+// (only from TRUSTED_PROXIES) or "never"
+func headerTrusted(c *fiber.Ctx, trust string) bool {
+	switch trust {
+	case "any":
+		return true
+	case "trusted":
+		return c.IsProxyTrusted()
+	}
+	return false
+}
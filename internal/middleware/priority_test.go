@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestPriority(t *testing.T) {
+	cfg := config.PriorityConfig{Header: "X-Request-Priority", Trust: "never", HighRoles: []string{"service"}}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, config.Route{Path: "/", RequestPriority: c.Query("route")})
+		if c.Query("role") != "" {
+			claimsKey.Set(c, &Claims{Roles: []string{c.Query("role")}})
+		}
+		return c.Next()
+	})
+	app.Use(Priority(cfg))
+	app.Get("/", func(c *fiber.Ctx) error {
+		// The upstream sees the resolved priority
+		if got := string(c.Request().Header.Peek(cfg.Header)); got != reqctx.Priority(c).String() {
+			t.Errorf("forwarded %q, resolved %s", got, reqctx.Priority(c))
+		}
+		return c.SendString(reqctx.Priority(c).String())
+	})
+
+	tests := []struct {
+		query  string
+		header string
+		want   string
+	}{
+		{"", "", "normal"},
+		{"route=low", "", "low"},
+		{"route=low&role=service", "", "high"},
+		{"", "high", "normal"}, // raising needs trust
+		{"", "LOW", "low"},     // lowering is always allowed
+		{"role=service", "low", "low"},
+		{"route=high", "urgent", "high"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/?"+tt.query, nil)
+		if tt.header != "" {
+			req.Header.Set(cfg.Header, tt.header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := make([]byte, 16)
+		n, _ := resp.Body.Read(body)
+		if got := string(body[:n]); got != tt.want {
+			t.Errorf("%q with header %q: priority %s, want %s", tt.query, tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+	"github.com/valyala/fasthttp"
+)
+
+// QuotaEvent is posted to the quota webhook when a consumer's usage crosses
+// one of the configured thresholds
+type QuotaEvent struct {
+	Event        string    `json:"event"`
+	Consumer     string    `json:"consumer"`
+	ConsumerType string    `json:"consumer_type"`
+	Threshold    int       `json:"threshold_percent"`
+	Used         int64     `json:"used"`
+	Limit        int       `json:"limit"`
+	WindowStart  time.Time `json:"window_start"`
+	WindowEnd    time.Time `json:"window_end"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// QuotaTracker counts requests per consumer over fixed windows
+type QuotaTracker struct {
+	cfg    config.QuotaConfig
+	kv     store.KV
+	logger Logger
+	client *fasthttp.Client
+
+	mu     sync.Mutex
+	counts map[string]*quotaCounter
+}
+
+type quotaCounter struct {
+	window time.Time
+	used   int64
+}
+
+// NewQuotaTracker creates a quota tracker. Counts are kept in kv when one is
+// given, so instances sharing a Redis store share them.
+func NewQuotaTracker(cfg config.QuotaConfig, kv store.KV, logger Logger) *QuotaTracker {
+	return &QuotaTracker{
+		cfg:    cfg,
+		kv:     kv,
+		logger: logger,
+		client: &fasthttp.Client{
+			ReadTimeout:  cfg.WebhookTimeout,
+			WriteTimeout: cfg.WebhookTimeout,
+		},
+		counts: make(map[string]*quotaCounter),
+	}
+}
+
+// Middleware returns the quota middleware. It must run after authentication
+// and tenant extraction; anonymous requests are not counted.
+func (q *QuotaTracker) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !q.cfg.Enabled || q.cfg.Limit <= 0 {
+			return c.Next()
+		}
+
+		consumer, consumerType := reqctx.TenantID(c), "tenant"
+		if consumer == "" {
+			consumer, consumerType = reqctx.UserID(c), "user"
+		}
+		if consumer == "" {
+			return c.Next()
+		}
+
+		window := time.Now().Truncate(q.cfg.Period)
+		used := q.increment(consumerType+":"+consumer, window)
+
+		// Counts grow by one, so each threshold is hit exactly once per window
+		for _, pct := range q.cfg.Thresholds {
+			if used == q.thresholdCount(pct) {
+				go q.notify(QuotaEvent{
+					Event:        "quota.threshold_crossed",
+					Consumer:     consumer,
+					ConsumerType: consumerType,
+					Threshold:    pct,
+					Used:         used,
+					Limit:        q.cfg.Limit,
+					WindowStart:  window,
+					WindowEnd:    window.Add(q.cfg.Period),
+					Timestamp:    time.Now(),
+				})
+			}
+		}
+
+		remaining := max(int64(q.cfg.Limit)-used, 0)
+		c.Set("X-Quota-Limit", strconv.Itoa(q.cfg.Limit))
+		c.Set("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+		c.Set("X-Quota-Reset", strconv.FormatInt(window.Add(q.cfg.Period).Unix(), 10))
+
+		if q.cfg.Enforce && used > int64(q.cfg.Limit) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":   "quota_exceeded",
+				"message": "Request quota exhausted for the current period",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// thresholdCount returns the request count at which pct percent of the
+// limit is reached
+func (q *QuotaTracker) thresholdCount(pct int) int64 {
+	return (int64(q.cfg.Limit)*int64(pct) + 99) / 100
+}
+
+// increment counts a request in the window and returns the new total
+func (q *QuotaTracker) increment(key string, window time.Time) int64 {
+	if q.kv != nil {
+		storeKey := fmt.Sprintf("quota:%s:%d", key, window.Unix())
+		ttl := time.Until(window.Add(2 * q.cfg.Period))
+		if used, err := q.kv.Incr(context.Background(), storeKey, ttl); err == nil {
+			return used
+		}
+		// Fall back to local counting on store errors
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counter, ok := q.counts[key]
+	if !ok || !counter.window.Equal(window) {
+		// A new window replaces the old count; stale consumers are pruned here
+		if ok {
+			q.pruneLocked(window)
+		}
+		counter = &quotaCounter{window: window}
+		q.counts[key] = counter
+	}
+	counter.used++
+	return counter.used
+}
+
+// pruneLocked drops counters from previous windows
+func (q *QuotaTracker) pruneLocked(window time.Time) {
+	for key, counter := range q.counts {
+		if counter.window.Before(window) {
+			delete(q.counts, key)
+		}
+	}
+}
+
+// notify posts an event to the webhook and logs it either way
+func (q *QuotaTracker) notify(event QuotaEvent) {
+	RecordQuotaThreshold(event.ConsumerType, event.Threshold)
+	q.logger.Warn("Quota threshold crossed",
+		"consumer", event.Consumer,
+		"consumer_type", event.ConsumerType,
+		"threshold", event.Threshold,
+		"used", event.Used,
+		"limit", event.Limit,
+	)
+
+	if q.cfg.WebhookURL == "" {
+		return
+	}
+	if err := postWebhook(q.client, q.cfg.WebhookURL, q.cfg.WebhookTimeout, event); err != nil {
+		q.logger.Error("Quota webhook failed", "consumer", event.Consumer, "error", err)
+	}
+}
@@ -3,20 +3,29 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/config"
-	"github.com/redis/go-redis/v9"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
 )
 
 // RateLimiter handles rate limiting
 type RateLimiter struct {
-	redis    *redis.Client
-	cfg      config.RateLimitConfig
-	local    *LocalLimiter
-	useRedis bool
+	// shared runs buckets in the store when it supports it, so limits hold
+	// across gateway instances; nil means only local buckets are used
+	shared store.TokenBucket
+	// windows does the same for the other algorithms
+	windows store.RateWindows
+	cfg     config.RateLimitConfig
+	local   *LocalLimiter
+
+	// overrides replace route and default limits for individual consumers
+	overrides   map[string]config.RouteLimit
+	overridesMu sync.RWMutex
 }
 
 // LocalLimiter is an in-memory rate limiter fallback
@@ -29,14 +38,30 @@ type LocalLimiter struct {
 type rateBucket struct {
 	tokens    float64
 	lastCheck time.Time
+	// reset is when the bucket no longer limits anyone: the end of a fixed
+	// window or sliding window, or the theoretical arrival time of gcra
+	reset time.Time
+	// log holds the times of the requests in a sliding window
+	log []time.Time
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(cfg config.RateLimitConfig, redisClient *redis.Client) *RateLimiter {
+// NewRateLimiter creates a new rate limiter. Buckets are kept in kv when it
+// implements store.TokenBucket (and store.RateWindows for the other
+// algorithms), and in process otherwise.
+func NewRateLimiter(cfg config.RateLimitConfig, kv store.KV) (*RateLimiter, error) {
+	if !slices.Contains(config.RateLimitAlgorithms, cfg.Algorithm) {
+		return nil, fmt.Errorf("RATE_LIMIT_ALGORITHM must be token_bucket, fixed_window, sliding_window or gcra, not %q", cfg.Algorithm)
+	}
+	if cfg.Enabled && (cfg.RequestsPerSec <= 0 || cfg.BurstSize <= 0) {
+		return nil, fmt.Errorf("RATE_LIMIT_RPS and RATE_LIMIT_BURST must be positive")
+	}
+	shared, _ := kv.(store.TokenBucket)
+	windows, _ := kv.(store.RateWindows)
 	limiter := &RateLimiter{
-		cfg:      cfg,
-		redis:    redisClient,
-		useRedis: redisClient != nil,
+		cfg:       cfg,
+		shared:    shared,
+		windows:   windows,
+		overrides: make(map[string]config.RouteLimit),
 		local: &LocalLimiter{
 			requests: make(map[string]*rateBucket),
 			cfg:      cfg,
@@ -44,11 +69,11 @@ func NewRateLimiter(cfg config.RateLimitConfig, redisClient *redis.Client) *Rate
 	}
 
 	// Start cleanup goroutine for local limiter
-	if !limiter.useRedis {
+	if limiter.shared == nil || limiter.windows == nil {
 		go limiter.local.cleanup(cfg.CleanupInterval)
 	}
 
-	return limiter
+	return limiter, nil
 }
 
 // Middleware returns the rate limiting middleware
@@ -61,19 +86,28 @@ func (rl *RateLimiter) Middleware() fiber.Handler {
 		// Get rate limit config (use route-specific if available)
 		rps := rl.cfg.RequestsPerSec
 		burst := rl.cfg.BurstSize
+		algorithm := rl.cfg.Algorithm
 
-		if route, ok := c.Locals("route").(config.Route); ok {
+		if route, ok := reqctx.Route(c); ok {
 			if route.RateLimit != nil {
 				rps = route.RateLimit.RequestsPerSec
 				burst = route.RateLimit.BurstSize
+				if route.RateLimit.Algorithm != "" {
+					algorithm = route.RateLimit.Algorithm
+				}
 			}
 		}
 
+		if limit, ok := rl.Override(rl.consumer(c)); ok {
+			rps = limit.RequestsPerSec
+			burst = limit.BurstSize
+		}
+
 		// Create key (IP + optional user ID)
 		key := rl.createKey(c)
 
 		// Check rate limit
-		allowed, remaining, resetTime := rl.allow(key, rps, burst)
+		allowed, remaining, resetTime := rl.allow(key, algorithm, rps, burst)
 
 		// Set rate limit headers
 		c.Set("X-RateLimit-Limit", fmt.Sprintf("%d", rps))
@@ -92,78 +126,115 @@ func (rl *RateLimiter) Middleware() fiber.Handler {
 	}
 }
 
-// createKey creates a unique rate limit key
-func (rl *RateLimiter) createKey(c *fiber.Ctx) string {
-	// Use user ID if authenticated, otherwise IP
-	if userID := c.Locals("user_id"); userID != nil {
-		return fmt.Sprintf("ratelimit:%s:%s", userID, c.Path())
+// consumer identifies the client limits apply to: user ID, or IP if anonymous
+func (rl *RateLimiter) consumer(c *fiber.Ctx) string {
+	if userID := reqctx.UserID(c); userID != "" {
+		return userID
 	}
-	return fmt.Sprintf("ratelimit:ip:%s:%s", c.IP(), c.Path())
+	return c.IP()
 }
 
-// allow checks if request is allowed (token bucket algorithm)
-func (rl *RateLimiter) allow(key string, rps, burst int) (bool, int, int64) {
-	if rl.useRedis {
-		return rl.redisAllow(key, rps, burst)
-	}
-	return rl.local.allow(key, rps, burst)
+// SetOverride replaces the limits of a consumer (user ID or IP)
+func (rl *RateLimiter) SetOverride(consumer string, limit config.RouteLimit) {
+	rl.overridesMu.Lock()
+	defer rl.overridesMu.Unlock()
+	rl.overrides[consumer] = limit
 }
 
-// redisAllow implements rate limiting with Redis
-func (rl *RateLimiter) redisAllow(key string, rps, burst int) (bool, int, int64) {
-	ctx := context.Background()
-	now := time.Now()
-
-	// Token bucket with Redis
-	script := redis.NewScript(`
-		local key = KEYS[1]
-		local rate = tonumber(ARGV[1])
-		local burst = tonumber(ARGV[2])
-		local now = tonumber(ARGV[3])
-		local window = 1
+// ClearOverride restores the normal limits of a consumer
+func (rl *RateLimiter) ClearOverride(consumer string) {
+	rl.overridesMu.Lock()
+	defer rl.overridesMu.Unlock()
+	delete(rl.overrides, consumer)
+}
 
-		local data = redis.call('HMGET', key, 'tokens', 'last')
-		local tokens = tonumber(data[1]) or burst
-		local last = tonumber(data[2]) or now
+// Override returns the override of a consumer, if any
+func (rl *RateLimiter) Override(consumer string) (config.RouteLimit, bool) {
+	rl.overridesMu.RLock()
+	defer rl.overridesMu.RUnlock()
+	limit, ok := rl.overrides[consumer]
+	return limit, ok
+}
 
-		local elapsed = now - last
-		tokens = math.min(burst, tokens + (elapsed * rate))
+// Overrides returns all consumer overrides
+func (rl *RateLimiter) Overrides() map[string]config.RouteLimit {
+	rl.overridesMu.RLock()
+	defer rl.overridesMu.RUnlock()
 
-		local allowed = 0
-		if tokens >= 1 then
-			tokens = tokens - 1
-			allowed = 1
-		end
+	overrides := make(map[string]config.RouteLimit, len(rl.overrides))
+	for consumer, limit := range rl.overrides {
+		overrides[consumer] = limit
+	}
+	return overrides
+}
 
-		redis.call('HMSET', key, 'tokens', tokens, 'last', now)
-		redis.call('EXPIRE', key, window * 2)
+// createKey creates a unique rate limit key
+func (rl *RateLimiter) createKey(c *fiber.Ctx) string {
+	// Use user ID if authenticated, otherwise IP
+	if userID := reqctx.UserID(c); userID != "" {
+		return fmt.Sprintf("ratelimit:%s:%s", userID, c.Path())
+	}
+	return fmt.Sprintf("ratelimit:ip:%s:%s", c.IP(), c.Path())
+}
 
-		return {allowed, math.floor(tokens), now + (1 / rate)}
-	`)
+// allow checks if request is allowed by the algorithm
+func (rl *RateLimiter) allow(key, algorithm string, rps, burst int) (bool, int, int64) {
+	if algorithm != "token_bucket" {
+		// Keeps the state of the algorithms apart when a route switches
+		key += ":" + algorithm
+	}
+	ctx := context.Background()
 
-	result, err := script.Run(ctx, rl.redis, []string{key}, rps, burst, now.Unix()).Int64Slice()
+	var (
+		allowed   bool
+		remaining int
+		reset     int64
+		err       error
+	)
+	switch {
+	case algorithm == "token_bucket" && rl.shared != nil:
+		allowed, remaining, reset, err = rl.shared.Take(ctx, key, rps, burst)
+	case algorithm == "fixed_window" && rl.windows != nil:
+		allowed, remaining, reset, err = rl.windows.FixedWindow(ctx, key, burst, rateWindow(rps, burst))
+	case algorithm == "sliding_window" && rl.windows != nil:
+		allowed, remaining, reset, err = rl.windows.SlidingWindow(ctx, key, burst, rateWindow(rps, burst))
+	case algorithm == "gcra" && rl.windows != nil:
+		allowed, remaining, reset, err = rl.windows.GCRA(ctx, key, rps, burst)
+	default:
+		return rl.local.allow(key, algorithm, rps, burst)
+	}
 	if err != nil {
-		// Fallback to local limiter on Redis error
-		return rl.local.allow(key, rps, burst)
+		// Fall back to the local limiter on store errors
+		return rl.local.allow(key, algorithm, rps, burst)
 	}
+	return allowed, remaining, reset
+}
 
-	return result[0] == 1, int(result[1]), result[2]
+// rateWindow is the window in which the window algorithms allow burst
+// requests, so clients average rps
+func rateWindow(rps, burst int) time.Duration {
+	return time.Duration(burst) * time.Second / time.Duration(rps)
 }
 
 // allow implements local in-memory rate limiting
-func (ll *LocalLimiter) allow(key string, rps, burst int) (bool, int, int64) {
+func (ll *LocalLimiter) allow(key, algorithm string, rps, burst int) (bool, int, int64) {
 	ll.mu.Lock()
 	defer ll.mu.Unlock()
 
 	now := time.Now()
 	bucket, exists := ll.requests[key]
-
 	if !exists {
-		ll.requests[key] = &rateBucket{
-			tokens:    float64(burst - 1),
-			lastCheck: now,
-		}
-		return true, burst - 1, now.Add(time.Second).Unix()
+		bucket = &rateBucket{tokens: float64(burst), lastCheck: now}
+		ll.requests[key] = bucket
+	}
+
+	switch algorithm {
+	case "fixed_window":
+		return bucket.fixedWindow(now, burst, rateWindow(rps, burst))
+	case "sliding_window":
+		return bucket.slidingWindow(now, burst, rateWindow(rps, burst))
+	case "gcra":
+		return bucket.gcra(now, rps, burst)
 	}
 
 	// Add tokens based on elapsed time
@@ -179,14 +250,71 @@ func (ll *LocalLimiter) allow(key string, rps, burst int) (bool, int, int64) {
 	return false, 0, now.Add(time.Second / time.Duration(rps)).Unix()
 }
 
+// fixedWindow allows limit requests per window, counting them in tokens
+func (b *rateBucket) fixedWindow(now time.Time, limit int, window time.Duration) (bool, int, int64) {
+	b.lastCheck = now
+	if !now.Before(b.reset) {
+		b.reset = now.Truncate(window).Add(window)
+		b.tokens = float64(limit)
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, int(b.tokens), b.reset.Unix()
+	}
+	return false, 0, b.reset.Unix()
+}
+
+// slidingWindow allows limit requests in the window before now
+func (b *rateBucket) slidingWindow(now time.Time, limit int, window time.Duration) (bool, int, int64) {
+	b.lastCheck = now
+	cutoff := now.Add(-window)
+	expired := 0
+	for expired < len(b.log) && !b.log[expired].After(cutoff) {
+		expired++
+	}
+	b.log = slices.Delete(b.log, 0, expired)
+
+	allowed := len(b.log) < limit
+	if allowed {
+		b.log = append(b.log, now)
+		b.reset = now.Add(window)
+	}
+	// The oldest request leaving the window frees a slot
+	reset := now.Add(window)
+	if len(b.log) > 0 {
+		reset = b.log[0].Add(window)
+	}
+	return allowed, limit - len(b.log), reset.Unix()
+}
+
+// gcra spaces requests rps per second, letting burst of them through at
+// once. reset is the theoretical arrival time: when the next request
+// would be due if clients used their rate evenly.
+func (b *rateBucket) gcra(now time.Time, rps, burst int) (bool, int, int64) {
+	b.lastCheck = now
+	interval := time.Second / time.Duration(rps)
+	tat := b.reset
+	if tat.Before(now) {
+		tat = now
+	}
+
+	allowAt := tat.Add(interval - time.Duration(burst)*interval)
+	if now.Before(allowAt) {
+		return false, 0, allowAt.Unix()
+	}
+	b.reset = tat.Add(interval)
+	return true, int(now.Sub(allowAt) / interval), now.Add(interval).Unix()
+}
+
 // cleanup periodically removes old entries
 func (ll *LocalLimiter) cleanup(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	for range ticker.C {
 		ll.mu.Lock()
-		threshold := time.Now().Add(-interval)
+		now := time.Now()
+		threshold := now.Add(-interval)
 		for key, bucket := range ll.requests {
-			if bucket.lastCheck.Before(threshold) {
+			if bucket.lastCheck.Before(threshold) && !bucket.reset.After(now) {
 				delete(ll.requests, key)
 			}
 		}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// bucketSnapshot is the persisted form of a rateBucket
+type bucketSnapshot struct {
+	Tokens    float64     `json:"tokens"`
+	LastCheck time.Time   `json:"last_check"`
+	Reset     time.Time   `json:"reset,omitzero"`
+	Log       []time.Time `json:"log,omitempty"`
+}
+
+// Snapshot writes the in-memory buckets to the configured snapshot file so
+// limits survive a restart instead of every client starting with a full burst
+func (rl *RateLimiter) Snapshot() error {
+	if rl.cfg.SnapshotFile == "" {
+		return nil
+	}
+
+	rl.local.mu.RLock()
+	buckets := make(map[string]bucketSnapshot, len(rl.local.requests))
+	for key, bucket := range rl.local.requests {
+		buckets[key] = bucketSnapshot{
+			Tokens:    bucket.tokens,
+			LastCheck: bucket.lastCheck,
+			Reset:     bucket.reset,
+			Log:       slices.Clone(bucket.log),
+		}
+	}
+	rl.local.mu.RUnlock()
+
+	data, err := json.Marshal(buckets)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a torn snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(rl.cfg.SnapshotFile), ".ratelimit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), rl.cfg.SnapshotFile)
+}
+
+// Restore loads buckets from the snapshot file. Entries idle for longer than
+// the cleanup interval whose window is over are skipped since they would
+// have refilled anyway.
+func (rl *RateLimiter) Restore() error {
+	if rl.cfg.SnapshotFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(rl.cfg.SnapshotFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var buckets map[string]bucketSnapshot
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	threshold := now.Add(-rl.cfg.CleanupInterval)
+
+	rl.local.mu.Lock()
+	defer rl.local.mu.Unlock()
+	for key, snap := range buckets {
+		if snap.LastCheck.Before(threshold) && !snap.Reset.After(now) {
+			continue
+		}
+		rl.local.requests[key] = &rateBucket{
+			tokens:    snap.Tokens,
+			lastCheck: snap.LastCheck,
+			reset:     snap.Reset,
+			log:       snap.Log,
+		}
+	}
+	return nil
+}
+
+// StartSnapshots periodically snapshots the buckets so a crash loses at most
+// one interval of state
+func (rl *RateLimiter) StartSnapshots(logger Logger) {
+	if rl.cfg.SnapshotFile == "" || rl.cfg.SnapshotInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(rl.cfg.SnapshotInterval)
+	go func() {
+		for range ticker.C {
+			if err := rl.Snapshot(); err != nil {
+				logger.Warn("Failed to snapshot rate limiter", "error", err)
+			}
+		}
+	}()
+}
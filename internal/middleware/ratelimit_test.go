@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+)
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	// 2 requests per second with bursts of 4: a 2s window, or one request
+	// every 500ms for gcra
+	const rps, burst = 2, 4
+	start := time.Unix(1000, 0)
+	take := func(algorithm string, b *rateBucket, at time.Duration) bool {
+		now := start.Add(at)
+		var allowed bool
+		switch algorithm {
+		case "fixed_window":
+			allowed, _, _ = b.fixedWindow(now, burst, rateWindow(rps, burst))
+		case "sliding_window":
+			allowed, _, _ = b.slidingWindow(now, burst, rateWindow(rps, burst))
+		case "gcra":
+			allowed, _, _ = b.gcra(now, rps, burst)
+		}
+		return allowed
+	}
+
+	for _, tc := range []struct {
+		algorithm string
+		// allowed of a burst at 1.9s, one more request and requests at 2s
+		// and 2.5s
+		atBurst, burstEnd, atWindow, later int
+	}{
+		// The window boundary lets twice the burst through
+		{"fixed_window", 4, 0, 4, 0},
+		{"sliding_window", 4, 0, 0, 0},
+		{"gcra", 4, 0, 0, 1},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			b := &rateBucket{}
+			count := func(at time.Duration, n int) int {
+				allowed := 0
+				for range n {
+					if take(tc.algorithm, b, at) {
+						allowed++
+					}
+				}
+				return allowed
+			}
+			if got := count(1900*time.Millisecond, burst); got != tc.atBurst {
+				t.Errorf("burst: %d allowed, want %d", got, tc.atBurst)
+			}
+			if got := count(1900*time.Millisecond, 1); got != tc.burstEnd {
+				t.Errorf("over burst: %d allowed, want %d", got, tc.burstEnd)
+			}
+			if got := count(2*time.Second, burst); got != tc.atWindow {
+				t.Errorf("next window: %d allowed, want %d", got, tc.atWindow)
+			}
+			if got := count(2500*time.Millisecond, burst); got != tc.later {
+				t.Errorf("at 2.5s: %d allowed, want %d", got, tc.later)
+			}
+		})
+	}
+
+	// Sliding windows free slots as requests leave them
+	b := &rateBucket{}
+	for _, at := range []time.Duration{0, 500 * time.Millisecond, time.Second, 1500 * time.Millisecond} {
+		take("sliding_window", b, at)
+	}
+	if !take("sliding_window", b, 2001*time.Millisecond) || take("sliding_window", b, 2001*time.Millisecond) {
+		t.Error("sliding window should allow one request once the first left it")
+	}
+}
+
+func TestRateLimiterRouteAlgorithm(t *testing.T) {
+	kv := store.NewMemory(time.Minute)
+	defer kv.Close()
+	limiter, err := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true, RequestsPerSec: 100, BurstSize: 100, CleanupInterval: time.Minute, Algorithm: "token_bucket",
+	}, kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]config.Route{
+		"/login": {Path: "/login", RateLimit: &config.RouteLimit{RequestsPerSec: 1, BurstSize: 2, Algorithm: "sliding_window"}},
+		"/data":  {Path: "/data"},
+	}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(limiter.Middleware())
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	statuses := func(path string, n int) []int {
+		var got []int
+		for range n {
+			resp, err := app.Test(httptest.NewRequest("POST", path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, resp.StatusCode)
+		}
+		return got
+	}
+	if got := statuses("/login", 3); got[1] != fiber.StatusOK || got[2] != fiber.StatusTooManyRequests {
+		t.Errorf("/login = %v, want the third request limited", got)
+	}
+	if got := statuses("/data", 3); got[2] != fiber.StatusOK {
+		t.Errorf("/data = %v, want the default limit", got)
+	}
+
+	if _, err := NewRateLimiter(config.RateLimitConfig{Algorithm: "leaky_bucket"}, kv); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+	if _, err := NewRateLimiter(config.RateLimitConfig{Enabled: true, BurstSize: 10, Algorithm: "token_bucket"}, kv); err == nil {
+		t.Error("zero requests per second accepted")
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+)
+
+// Replays rejects reused tokens on routes with replayProtection: a token
+// is accepted once, by its issuer and jti, which are remembered in the
+// store until it expires. With Redis, a token used on one gateway instance
+// is rejected by the others.
+type Replays struct {
+	cfg    config.ReplayConfig
+	kv     store.KV
+	logger Logger
+}
+
+// NewReplays creates the replay checks over kv
+func NewReplays(cfg config.ReplayConfig, kv store.KV, logger Logger) *Replays {
+	return &Replays{cfg: cfg, kv: kv, logger: logger}
+}
+
+// Middleware rejects tokens without a jti, or already used, on routes with
+// replayProtection. It must run after authentication; requests without
+// claims (signature routes, which reject replayed signatures themselves)
+// pass through.
+func (r *Replays) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		if !ok || !route.ReplayProtection {
+			return c.Next()
+		}
+		claims, ok := GetClaims(c)
+		if !ok {
+			return c.Next()
+		}
+		if claims.ID == "" {
+			bearerChallenge(c, `error="invalid_token", error_description="Token has no jti"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "unauthorized",
+				"message": "Token has no jti",
+			})
+		}
+
+		ttl := r.cfg.TTL
+		if claims.ExpiresAt != nil {
+			ttl = time.Until(claims.ExpiresAt.Time)
+		}
+		seen, err := r.kv.Incr(c.Context(), "replay:jti:"+claims.Issuer+":"+claims.ID, ttl)
+		switch {
+		case err != nil && r.cfg.FailClosed:
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "service_unavailable",
+				"message": "Token replay status unavailable",
+			})
+		case err != nil:
+			r.logger.Warn("Token replay check failed, accepting the token", "error", err)
+		case seen > 1:
+			bearerChallenge(c, `error="invalid_token", error_description="Token already used"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "token_replayed",
+				"message": "Token already used",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+)
+
+func TestReplays(t *testing.T) {
+	const secret = "test-secret"
+	kv := store.NewMemory(time.Minute)
+	defer kv.Close()
+	replays := NewReplays(config.ReplayConfig{FailClosed: true, TTL: time.Hour}, kv, NewLogger(config.LoggingConfig{}))
+
+	routes := map[string]config.Route{
+		"/transfers": {Path: "/transfers", ReplayProtection: true},
+		"/accounts":  {Path: "/accounts"},
+	}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(Auth(DefaultAuthConfig(secret)))
+	app.Use(replays.Middleware())
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	status := func(path string, claims Claims) int {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	token := func(iss, jti string) Claims {
+		return Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: iss, ID: jti, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+	}
+
+	for _, tc := range []struct {
+		name, path string
+		claims     Claims
+		want       int
+	}{
+		{"first use", "/transfers", token("auth", "t1"), fiber.StatusOK},
+		{"reuse", "/transfers", token("auth", "t1"), fiber.StatusUnauthorized},
+		{"another issuer's jti", "/transfers", token("partner", "t1"), fiber.StatusOK},
+		{"without jti", "/transfers", token("auth", ""), fiber.StatusUnauthorized},
+		{"unprotected route", "/accounts", token("auth", "t2"), fiber.StatusOK},
+		{"unprotected route again", "/accounts", token("auth", "t2"), fiber.StatusOK},
+	} {
+		if got := status(tc.path, tc.claims); got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// A store outage rejects tokens unless the check fails open
+	replays.kv = failingKV{}
+	if got := status("/transfers", token("auth", "t3")); got != fiber.StatusServiceUnavailable {
+		t.Errorf("store down, failing closed = %d, want 503", got)
+	}
+	replays.cfg.FailClosed = false
+	if got := status("/transfers", token("auth", "t3")); got != fiber.StatusOK {
+		t.Errorf("store down, failing open = %d, want 200", got)
+	}
+}
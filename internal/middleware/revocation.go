@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/store"
+)
+
+// Revocations are the tokens revoked before they expire, e.g. on logout or
+// compromise. They are kept in the store, so with Redis every gateway
+// instance honors them and the auth service can revoke tokens by writing:
+//
+//	revoked:jti:<jti>   any value, expiring with the token
+//	revoked:user:<id>   Unix time; the user's tokens issued until then
+type Revocations struct {
+	cfg    config.RevocationConfig
+	kv     store.KV
+	logger Logger
+}
+
+// errTokenRevoked rejects revoked tokens
+var errTokenRevoked = errors.New("token revoked")
+
+// NewRevocations creates the revocation checks over kv
+func NewRevocations(cfg config.RevocationConfig, kv store.KV, logger Logger) *Revocations {
+	return &Revocations{cfg: cfg, kv: kv, logger: logger}
+}
+
+// RevokeToken revokes the token with the jti until it expires
+func (r *Revocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.kv.Set(ctx, "revoked:jti:"+jti, []byte("1"), ttl)
+}
+
+// RevokeUser revokes the tokens issued to the user until now. It is kept
+// for the longest token lifetime (JWT_REVOCATION_USER_TTL).
+func (r *Revocations) RevokeUser(ctx context.Context, userID string) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return r.kv.Set(ctx, "revoked:user:"+userID, []byte(now), r.cfg.UserTTL)
+}
+
+// check returns errTokenRevoked for revoked tokens: by jti, or issued to
+// a revoked user no later than the revocation (tokens without iat
+// included). Store failures are logged and let tokens through unless
+// FailClosed is set, which rejects them with a 503.
+func (r *Revocations) check(ctx context.Context, claims *Claims) error {
+	err := r.revoked(ctx, claims)
+	if err == nil || errors.Is(err, errTokenRevoked) {
+		return err
+	}
+	if r.cfg.FailClosed {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Token revocation status unavailable")
+	}
+	r.logger.Warn("Token revocation check failed, accepting the token", "error", err)
+	return nil
+}
+
+func (r *Revocations) revoked(ctx context.Context, claims *Claims) error {
+	if claims.ID != "" {
+		_, found, err := r.kv.Get(ctx, "revoked:jti:"+claims.ID)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errTokenRevoked
+		}
+	}
+
+	if claims.UserID == "" {
+		return nil
+	}
+	value, found, err := r.kv.Get(ctx, "revoked:user:"+claims.UserID)
+	if err != nil || !found {
+		return err
+	}
+	revokedAt, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return err
+	}
+	if claims.IssuedAt == nil || claims.IssuedAt.Unix() <= revokedAt {
+		return errTokenRevoked
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/store"
+)
+
+// failingKV is a store that is down
+type failingKV struct{ store.KV }
+
+func (failingKV) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("store down")
+}
+
+func (failingKV) Incr(context.Context, string, time.Duration) (int64, error) {
+	return 0, errors.New("store down")
+}
+
+func TestRevocations(t *testing.T) {
+	const secret = "test-secret"
+	kv := store.NewMemory(time.Minute)
+	defer kv.Close()
+	logger := NewLogger(config.LoggingConfig{})
+	revocations := NewRevocations(config.RevocationConfig{Enabled: true, UserTTL: time.Hour}, kv, logger)
+
+	tokens := TokenConfig{Secret: secret, Revocations: revocations}
+	app := fiber.New()
+	app.Use(Auth(AuthConfig{Tokens: tokens, TokenPrefix: "Bearer ", HeaderName: "Authorization"}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	issued := time.Now().Add(-time.Minute)
+	status := func(claims Claims) int {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	claims := func(user, jti string, iat time.Time) Claims {
+		return Claims{UserID: user, RegisteredClaims: jwt.RegisteredClaims{ID: jti, IssuedAt: jwt.NewNumericDate(iat)}}
+	}
+
+	ctx := context.Background()
+	if err := revocations.RevokeToken(ctx, "t1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(claims("u1", "t1", issued)); got != fiber.StatusUnauthorized {
+		t.Errorf("revoked jti = %d, want 401", got)
+	}
+	if got := status(claims("u1", "t2", issued)); got != fiber.StatusOK {
+		t.Errorf("other jti = %d, want 200", got)
+	}
+
+	if err := revocations.RevokeUser(ctx, "u2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(claims("u2", "t3", issued)); got != fiber.StatusUnauthorized {
+		t.Errorf("token of revoked user = %d, want 401", got)
+	}
+	if got := status(Claims{UserID: "u2"}); got != fiber.StatusUnauthorized {
+		t.Errorf("token of revoked user without iat = %d, want 401", got)
+	}
+	if got := status(claims("u2", "t4", time.Now().Add(time.Minute))); got != fiber.StatusOK {
+		t.Errorf("token issued after the revocation = %d, want 200", got)
+	}
+
+	// A store outage accepts tokens unless the check fails closed
+	revocations.kv = failingKV{}
+	if got := status(claims("u1", "t1", issued)); got != fiber.StatusOK {
+		t.Errorf("fail open = %d, want 200", got)
+	}
+	revocations.cfg.FailClosed = true
+	if got := status(claims("u1", "t2", issued)); got != fiber.StatusServiceUnavailable {
+		t.Errorf("fail closed = %d, want 503", got)
+	}
+}
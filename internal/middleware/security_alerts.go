@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/valyala/fasthttp"
+)
+
+// SecurityAlert is logged and posted to the security webhook when a client's
+// rate of rejected requests spikes
+type SecurityAlert struct {
+	Event     string    `json:"event"`
+	Kind      string    `json:"kind"`
+	KeyType   string    `json:"key_type"`
+	Key       string    `json:"key"`
+	Count     float64   `json:"count"`
+	Baseline  float64   `json:"baseline"`
+	Window    string    `json:"window"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// securityKinds maps the statuses worth watching to alert kinds
+var securityKinds = map[int]string{
+	fiber.StatusUnauthorized:    "unauthorized",
+	fiber.StatusForbidden:       "forbidden",
+	fiber.StatusTooManyRequests: "rate_limited",
+}
+
+// SecurityMonitor watches 401/403/429 responses per IP and tenant and raises
+// an alert when their rate jumps well above the key's own baseline, an early
+// sign of credential stuffing or scraping
+type SecurityMonitor struct {
+	cfg      config.SecurityAlertsConfig
+	logger   Logger
+	client   *fasthttp.Client
+	detector *spikeDetector
+}
+
+// NewSecurityMonitor creates a security monitor
+func NewSecurityMonitor(cfg config.SecurityAlertsConfig, logger Logger) *SecurityMonitor {
+	return &SecurityMonitor{
+		cfg:    cfg,
+		logger: logger,
+		client: &fasthttp.Client{
+			ReadTimeout:  cfg.WebhookTimeout,
+			WriteTimeout: cfg.WebhookTimeout,
+		},
+		detector: newSpikeDetector(cfg.Window, cfg.MinEvents, cfg.SpikeFactor, cfg.Cooldown),
+	}
+}
+
+// Middleware returns the monitoring middleware. It inspects the final status,
+// so it must run before authentication and rate limiting.
+func (m *SecurityMonitor) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if !m.cfg.Enabled {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		kind, ok := securityKinds[status]
+		if !ok {
+			return err
+		}
+
+		now := time.Now()
+		m.observe(kind, "ip", c.IP(), now)
+		if tenant := reqctx.TenantID(c); tenant != "" {
+			m.observe(kind, "tenant", tenant, now)
+		}
+		return err
+	}
+}
+
+// observe records an event and raises an alert if it completes a spike
+func (m *SecurityMonitor) observe(kind, keyType, key string, now time.Time) {
+	count, baseline, spike := m.detector.observe(kind+"|"+keyType+"|"+key, now)
+	if !spike {
+		return
+	}
+
+	alert := SecurityAlert{
+		Event:     "security.anomaly",
+		Kind:      kind,
+		KeyType:   keyType,
+		Key:       key,
+		Count:     count,
+		Baseline:  baseline,
+		Window:    m.cfg.Window.String(),
+		Timestamp: now,
+	}
+	go m.raise(alert)
+}
+
+// raise logs an alert, counts it and posts it to the webhook
+func (m *SecurityMonitor) raise(alert SecurityAlert) {
+	RecordSecurityAlert(alert.Kind, alert.KeyType)
+	m.logger.Warn("Security alert",
+		"kind", alert.Kind,
+		"key_type", alert.KeyType,
+		"key", alert.Key,
+		"count", alert.Count,
+		"baseline", alert.Baseline,
+		"window", alert.Window,
+	)
+
+	if m.cfg.WebhookURL == "" {
+		return
+	}
+	if err := postWebhook(m.client, m.cfg.WebhookURL, m.cfg.WebhookTimeout, alert); err != nil {
+		m.logger.Error("Security alert webhook failed", "key", alert.Key, "error", err)
+	}
+}
+
+// spikeDetector counts events per key in a sliding window (approximated by
+// weighting the previous fixed window) and keeps an exponentially weighted
+// baseline of past windows. A spike is a window count of at least minEvents
+// and factor times the baseline; each key alerts at most once per cooldown.
+type spikeDetector struct {
+	window    time.Duration
+	minEvents float64
+	factor    float64
+	cooldown  time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*eventWindow
+	pruned  time.Time
+}
+
+type eventWindow struct {
+	start     time.Time
+	current   float64
+	previous  float64
+	baseline  float64
+	lastAlert time.Time
+}
+
+// baselineWeight is how much each completed window moves the baseline
+const baselineWeight = 0.2
+
+func newSpikeDetector(window time.Duration, minEvents int, factor float64, cooldown time.Duration) *spikeDetector {
+	return &spikeDetector{
+		window:    window,
+		minEvents: float64(minEvents),
+		factor:    factor,
+		cooldown:  cooldown,
+		windows:   make(map[string]*eventWindow),
+	}
+}
+
+// observe records one event and returns the sliding count, the baseline and
+// whether this event triggers an alert
+func (d *spikeDetector) observe(key string, now time.Time) (float64, float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pruneLocked(now)
+
+	start := now.Truncate(d.window)
+	w, ok := d.windows[key]
+	if !ok {
+		w = &eventWindow{start: start}
+		d.windows[key] = w
+	}
+
+	// Roll the finished window into the baseline; any windows skipped since
+	// had no events and only decay it
+	if n := int(start.Sub(w.start) / d.window); n > 0 {
+		w.baseline = (1-baselineWeight)*w.baseline + baselineWeight*w.current
+		w.baseline *= math.Pow(1-baselineWeight, float64(n-1))
+		w.previous = 0
+		if n == 1 {
+			w.previous = w.current
+		}
+		w.current, w.start = 0, start
+	}
+	w.current++
+
+	elapsed := float64(now.Sub(start)) / float64(d.window)
+	count := w.current + w.previous*(1-elapsed)
+
+	spike := count >= d.minEvents && count >= d.factor*w.baseline &&
+		now.Sub(w.lastAlert) >= d.cooldown
+	if spike {
+		w.lastAlert = now
+	}
+	return count, w.baseline, spike
+}
+
+// pruneLocked drops keys that have been quiet for a while, at most once per window
+func (d *spikeDetector) pruneLocked(now time.Time) {
+	if now.Sub(d.pruned) < d.window {
+		return
+	}
+	d.pruned = now
+
+	idle := max(10*d.window, d.cooldown)
+	for key, w := range d.windows {
+		if now.Sub(w.start) > idle {
+			delete(d.windows, key)
+		}
+	}
+}
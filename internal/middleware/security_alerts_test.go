@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpikeDetector(t *testing.T) {
+	d := newSpikeDetector(time.Minute, 10, 5, 10*time.Minute)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// A steady trickle of 3 failures a minute builds a baseline without alerting
+	for minute := 0; minute < 20; minute++ {
+		for i := 0; i < 3; i++ {
+			now := start.Add(time.Duration(minute)*time.Minute + time.Duration(i)*time.Second)
+			if _, _, spike := d.observe("ip|203.0.113.7", now); spike {
+				t.Fatalf("unexpected alert at minute %d", minute)
+			}
+		}
+	}
+
+	// A burst well above the baseline alerts once
+	alerts := 0
+	burst := start.Add(20 * time.Minute)
+	for i := 0; i < 50; i++ {
+		if _, _, spike := d.observe("ip|203.0.113.7", burst.Add(time.Duration(i)*time.Second)); spike {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("got %d alerts for the burst, want 1", alerts)
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/valyala/fasthttp"
+)
+
+// SessionCookie enforces the attributes of the token cookie upstreams set
+// for browser clients: HttpOnly, so scripts can't read the token, Secure
+// and SameSite, which keeps other sites from sending it. Without a cookie
+// name it does nothing.
+func SessionCookie(cfg config.SessionCookieConfig) (fiber.Handler, error) {
+	var sameSite fasthttp.CookieSameSite
+	switch strings.ToLower(cfg.SameSite) {
+	case "strict":
+		sameSite = fasthttp.CookieSameSiteStrictMode
+	case "lax":
+		sameSite = fasthttp.CookieSameSiteLaxMode
+	case "none":
+		if !cfg.Secure {
+			return nil, fmt.Errorf("JWT_COOKIE_SAME_SITE=None needs JWT_COOKIE_SECURE")
+		}
+		sameSite = fasthttp.CookieSameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("JWT_COOKIE_SAME_SITE must be Strict, Lax or None, not %q", cfg.SameSite)
+	}
+
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if cfg.Name == "" {
+			return err
+		}
+
+		cookie := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(cookie)
+		cookie.SetKey(cfg.Name)
+		if header := &c.Response().Header; header.Cookie(cookie) {
+			cookie.SetHTTPOnly(true)
+			cookie.SetSecure(cfg.Secure)
+			cookie.SetSameSite(sameSite)
+			header.SetCookie(cookie)
+		}
+		return err
+	}, nil
+}
+
+// CookieOrigin protects requests authenticated by the token cookie from
+// cross-site request forgery: browsers send the cookie with requests any
+// site makes, so unsafe methods (all but GET, HEAD and OPTIONS) carrying it
+// without an Authorization header must come from the gateway's own origin,
+// one of origins or the route's CORS allowOrigins, going by their Origin
+// (or Referer) header. With a cookie name, origins must list the allowed
+// origins rather than "*". Without one it does nothing.
+func CookieOrigin(cfg config.SessionCookieConfig, origins []string) (fiber.Handler, error) {
+	if cfg.Name != "" && (len(origins) == 0 || slices.Contains(origins, "*")) {
+		return nil, fmt.Errorf("JWT_COOKIE_NAME needs CORS_ALLOW_ORIGINS to list the allowed origins instead of *")
+	}
+
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+		if cfg.Name == "" || c.Get(fiber.HeaderAuthorization) != "" || c.Cookies(cfg.Name) == "" {
+			return c.Next()
+		}
+
+		origin := requestOrigin(c)
+		allowed := origin != "" && (origin == c.Protocol()+"://"+string(c.Request().Host()) || slices.Contains(origins, origin))
+		if route, ok := reqctx.Route(c); ok && !allowed && route.CORS != nil && origin != "" {
+			// Only origins the route lists; its "*" admits no cookie requests
+			allowed = slices.Contains(route.CORS.AllowOrigins, origin)
+		}
+		if allowed {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "forbidden",
+			"message": "Cross-origin request authenticated by the session cookie",
+		})
+	}, nil
+}
+
+// requestOrigin returns the Origin header, else the origin of the Referer
+func requestOrigin(c *fiber.Ctx) string {
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" && origin != "null" {
+		return origin
+	}
+	referer, err := url.Parse(c.Get(fiber.HeaderReferer))
+	if err != nil || referer.Scheme == "" || referer.Host == "" {
+		return ""
+	}
+	return referer.Scheme + "://" + referer.Host
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestSessionCookie(t *testing.T) {
+	const secret = "test-secret"
+	session, err := SessionCookie(config.SessionCookieConfig{Name: "session", Secure: true, SameSite: "Strict"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultAuthConfig(secret)
+	cfg.CookieName = "session"
+
+	app := fiber.New()
+	app.Use(session)
+	app.Post("/login", func(c *fiber.Ctx) error {
+		// An upstream setting the token cookie without protecting it
+		c.Cookie(&fiber.Cookie{Name: "session", Value: "token", Path: "/"})
+		c.Cookie(&fiber.Cookie{Name: "theme", Value: "dark"})
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Use(Auth(cfg))
+	app.Get("/me", func(c *fiber.Ctx) error { return c.SendString(reqctx.UserID(c)) })
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) != 2 {
+		t.Fatalf("Set-Cookie = %q", cookies)
+	}
+	for _, cookie := range cookies {
+		protected := strings.Contains(cookie, "HttpOnly") && strings.Contains(cookie, "secure") && strings.Contains(cookie, "SameSite=Strict")
+		if strings.HasPrefix(cookie, "session=") != protected {
+			t.Errorf("Set-Cookie %q", cookie)
+		}
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "u1"}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Cookie", "session="+token)
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("cookie token = %v, %v", resp, err)
+	}
+	req = httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Cookie", "other="+token)
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("other cookie = %v, %v", resp, err)
+	}
+
+	if _, err := SessionCookie(config.SessionCookieConfig{Name: "session", SameSite: "None"}); err == nil {
+		t.Error("SameSite=None without Secure accepted")
+	}
+}
+
+func TestCookieOrigin(t *testing.T) {
+	cookie := config.SessionCookieConfig{Name: "session", Secure: true, SameSite: "None"}
+	if _, err := CookieOrigin(cookie, []string{"*"}); err == nil {
+		t.Error("session cookie with any CORS origin accepted")
+	}
+	if _, err := CookieOrigin(config.SessionCookieConfig{}, []string{"*"}); err != nil {
+		t.Errorf("without a session cookie: %v", err)
+	}
+
+	guard, err := CookieOrigin(cookie, []string{"https://app.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, config.Route{Path: "/api/v1/widgets", CORS: &config.CORSConfig{AllowOrigins: []string{"https://partner.example.com", "*"}}})
+		return c.Next()
+	})
+	app.Use(guard)
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	status := func(method string, headers map[string]string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, "http://gateway.example.com/api/v1/widgets", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"allowed origin", "POST", map[string]string{"Cookie": "session=t", "Origin": "https://app.example.com"}, fiber.StatusOK},
+		{"route origin", "DELETE", map[string]string{"Cookie": "session=t", "Origin": "https://partner.example.com"}, fiber.StatusOK},
+		{"same origin referer", "PUT", map[string]string{"Cookie": "session=t", "Referer": "http://gateway.example.com/app"}, fiber.StatusOK},
+		{"other site", "POST", map[string]string{"Cookie": "session=t", "Origin": "https://evil.example"}, fiber.StatusForbidden},
+		{"no origin", "POST", map[string]string{"Cookie": "session=t"}, fiber.StatusForbidden},
+		{"safe method", "GET", map[string]string{"Cookie": "session=t", "Origin": "https://evil.example"}, fiber.StatusOK},
+		{"header token", "POST", map[string]string{"Cookie": "session=t", "Authorization": "Bearer t", "Origin": "https://evil.example"}, fiber.StatusOK},
+		{"no cookie", "POST", map[string]string{"Origin": "https://evil.example"}, fiber.StatusOK},
+	} {
+		if got := status(tc.method, tc.headers); got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/minisource/gateway/internal/store"
+)
+
+func TestRequestSigning(t *testing.T) {
+	clients := &config.SigningClientsConfig{Clients: []config.SigningClient{
+		{ID: "billing-worker", Secret: "billing-secret"},
+		{ID: "reports", Secret: "reports-secret"},
+	}}
+	signing := NewRequestSigning(config.SignatureConfig{MaxSkew: time.Minute}, clients,
+		store.NewMemory(time.Minute), NewLogger(config.LoggingConfig{}))
+
+	routes := map[string]config.Route{
+		"/hooks/payments": {Path: "/hooks/payments", Signature: &config.RouteSignature{Clients: []string{"billing-worker"}}},
+		"/hooks/any":      {Path: "/hooks/any", Signature: &config.RouteSignature{}},
+		"/open":           {Path: "/open", Public: true},
+	}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, routes[c.Path()])
+		return c.Next()
+	})
+	app.Use(signing.Middleware())
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	type request struct {
+		path, client, secret, body string
+		timestamp                  time.Time
+		signature                  string
+	}
+	send := func(r request) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", r.path, strings.NewReader(r.body))
+		if r.client != "" {
+			req.Header.Set(SignatureClientHeader, r.client)
+			req.Header.Set(SignatureTimestampHeader, strconv.FormatInt(r.timestamp.Unix(), 10))
+			signature := r.signature
+			if signature == "" {
+				signature = "sha256=" + Sign([]byte(r.secret), "POST", r.path, r.timestamp.Unix(), []byte(r.body))
+			}
+			req.Header.Set(SignatureHeader, signature)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	now := time.Now()
+	signed := request{path: "/hooks/payments?id=1", client: "billing-worker", secret: "billing-secret", body: `{"paid":true}`, timestamp: now}
+	if got := send(signed); got != fiber.StatusOK {
+		t.Errorf("signed request = %d, want 200", got)
+	}
+	if got := send(signed); got != fiber.StatusUnauthorized {
+		t.Errorf("replayed request = %d, want 401", got)
+	}
+
+	for name, r := range map[string]request{
+		"unsigned":            {path: "/hooks/payments"},
+		"client not admitted": {path: "/hooks/payments", client: "reports", secret: "reports-secret", timestamp: now},
+		"unknown client":      {path: "/hooks/any", client: "intruder", secret: "guess", timestamp: now},
+		"wrong secret":        {path: "/hooks/any", client: "reports", secret: "billing-secret", timestamp: now},
+		"tampered signature":  {path: "/hooks/any", client: "reports", timestamp: now, signature: "sha256=00"},
+		"timestamp too old":   {path: "/hooks/any", client: "reports", secret: "reports-secret", timestamp: now.Add(-2 * time.Minute)},
+		"timestamp in future": {path: "/hooks/any", client: "reports", secret: "reports-secret", timestamp: now.Add(2 * time.Minute)},
+	} {
+		if got := send(r); got != fiber.StatusUnauthorized {
+			t.Errorf("%s = %d, want 401", name, got)
+		}
+	}
+
+	if got := send(request{path: "/hooks/any", client: "reports", secret: "reports-secret", body: "x", timestamp: now}); got != fiber.StatusOK {
+		t.Errorf("any client = %d, want 200", got)
+	}
+	if got := send(request{path: "/open"}); got != fiber.StatusOK {
+		t.Errorf("route without signature = %d, want 200", got)
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+)
+
+// TenantTokens is how the access tokens of tenants with their own identity
+// provider are verified, from the tenant registry
+type TenantTokens struct {
+	bySubdomain map[string]*tenantTokens
+	byIssuer    map[string]*tenantTokens
+}
+
+// tenantTokens is the token configuration of a tenant
+type tenantTokens struct {
+	id     string
+	tokens TokenConfig
+}
+
+// NewTenantTokens creates the token configurations of the registry's
+// tenants; key sets are refreshed every interval once started
+func NewTenantTokens(cfg *config.TenantsConfig, interval time.Duration, logger Logger) *TenantTokens {
+	t := &TenantTokens{
+		bySubdomain: make(map[string]*tenantTokens),
+		byIssuer:    make(map[string]*tenantTokens),
+	}
+	for _, tenant := range cfg.Tenants {
+		entry := &tenantTokens{id: tenant.ID, tokens: TokenConfig{
+			Secret:     tenant.Secret,
+			Algorithms: tenant.Algorithms,
+			Issuers:    []string{tenant.Issuer},
+			Audiences:  tenant.Audiences,
+		}}
+		if tenant.JWKSURL != "" {
+			entry.tokens.JWKS = NewJWKS(tenant.JWKSURL, interval, logger)
+		}
+		if tenant.Discovery {
+			entry.tokens.OIDC = NewOIDC(tenant.Issuer, interval, logger)
+		}
+		t.bySubdomain[tenant.Subdomain] = entry
+		t.byIssuer[tenant.Issuer] = entry
+	}
+	return t
+}
+
+// Start fetches the tenants' key sets, then refreshes them in the
+// background until ctx is done
+func (t *TenantTokens) Start(ctx context.Context) {
+	for _, entry := range t.byIssuer {
+		if entry.tokens.JWKS != nil {
+			entry.tokens.JWKS.Start(ctx)
+		}
+		if entry.tokens.OIDC != nil {
+			entry.tokens.OIDC.Start(ctx)
+		}
+	}
+}
+
+// resolve returns the tenant a request's token belongs to: the one of its
+// host's subdomain, else the one of the token's iss. The iss is read
+// unverified; it only selects the keys the token is then verified with.
+func (t *TenantTokens) resolve(host, tokenString string) (*tenantTokens, bool) {
+	if t == nil {
+		return nil, false
+	}
+	if entry, ok := t.bySubdomain[subdomain(host)]; ok {
+		return entry, true
+	}
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil || claims.Issuer == "" {
+		return nil, false
+	}
+	entry, ok := t.byIssuer[claims.Issuer]
+	return entry, ok
+}
+
+// validateTenantToken validates a token with the settings of the tenant
+// the host or the token's issuer names, else with tokens, and binds the
+// claims to that tenant
+func validateTenantToken(host, tokenString string, tokens TokenConfig) (*Claims, error) {
+	tenant, ok := tokens.Tenants.resolve(host, tokenString)
+	if ok {
+		tokens = tenant.tokens
+	}
+	claims, err := validateToken(tokenString, tokens)
+	if err == nil && tenant != nil {
+		err = claims.bindTenant(tenant.id)
+	}
+	return claims, err
+}
+
+// subdomain returns the first label of a host with at least three
+// (tenant1 in tenant1.example.com)
+func subdomain(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 3 {
+		return parts[0]
+	}
+	return ""
+}
+
+// bindTenant ties the claims to the tenant whose identity provider issued
+// them; a token claiming another tenant is rejected
+func (c *Claims) bindTenant(id string) error {
+	if c.TenantID != "" && c.TenantID != id {
+		return fiber.NewError(fiber.StatusUnauthorized, "Token tenant not accepted")
+	}
+	c.TenantID = id
+	if c.raw != nil {
+		c.raw["tenant_id"] = id
+	}
+	return nil
+}
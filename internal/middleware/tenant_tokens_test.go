@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestTenantTokens(t *testing.T) {
+	tenants := NewTenantTokens(&config.TenantsConfig{Tenants: []config.Tenant{
+		{ID: "acme", Subdomain: "acme", Issuer: "https://acme.example.com", Secret: "acme-secret", Algorithms: []string{"HS256"}},
+		{ID: "globex", Subdomain: "globex", Issuer: "globex-auth", Secret: "globex-secret", Algorithms: []string{"HS256"}, Audiences: []string{"gateway"}},
+	}}, 0, NewLogger(config.LoggingConfig{}))
+
+	authCfg := DefaultAuthConfig("global-secret")
+	authCfg.Tokens.Tenants = tenants
+	app := fiber.New()
+	app.Use(Auth(authCfg))
+	app.Get("/orders", func(c *fiber.Ctx) error {
+		return c.SendString(reqctx.TenantID(c) + " " + c.Get("X-Tenant-ID"))
+	})
+
+	sign := func(secret string, claims Claims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	issued := func(iss string, aud ...string) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{Issuer: iss, Audience: aud}
+	}
+
+	for _, tc := range []struct {
+		name, host, token string
+		want              int
+		tenant            string
+	}{
+		{"tenant subdomain", "acme.example.com", sign("acme-secret", Claims{UserID: "u1", RegisteredClaims: issued("https://acme.example.com")}), fiber.StatusOK, "acme acme"},
+		{"tenant issuer", "api.example.com", sign("acme-secret", Claims{UserID: "u1", RegisteredClaims: issued("https://acme.example.com")}), fiber.StatusOK, "acme acme"},
+		{"tenant audience", "globex.example.com", sign("globex-secret", Claims{UserID: "u1", RegisteredClaims: issued("globex-auth", "gateway")}), fiber.StatusOK, "globex globex"},
+		{"missing tenant audience", "globex.example.com", sign("globex-secret", Claims{UserID: "u1", RegisteredClaims: issued("globex-auth")}), fiber.StatusUnauthorized, ""},
+		{"another tenant's token", "acme.example.com", sign("globex-secret", Claims{UserID: "u1", RegisteredClaims: issued("globex-auth", "gateway")}), fiber.StatusUnauthorized, ""},
+		{"forged issuer", "api.example.com", sign("global-secret", Claims{UserID: "u1", RegisteredClaims: issued("https://acme.example.com")}), fiber.StatusUnauthorized, ""},
+		{"claimed other tenant", "acme.example.com", sign("acme-secret", Claims{UserID: "u1", TenantID: "globex", RegisteredClaims: issued("https://acme.example.com")}), fiber.StatusUnauthorized, ""},
+		{"global token", "api.example.com", sign("global-secret", Claims{UserID: "u1", TenantID: "t1"}), fiber.StatusOK, "t1 t1"},
+		{"global token on a tenant subdomain", "acme.example.com", sign("global-secret", Claims{UserID: "u1"}), fiber.StatusUnauthorized, ""},
+	} {
+		req := httptest.NewRequest("GET", "http://"+tc.host+"/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, resp.StatusCode, tc.want)
+			continue
+		}
+		if tc.tenant != "" {
+			body := make([]byte, 64)
+			n, _ := resp.Body.Read(body)
+			if got := string(body[:n]); got != tc.tenant {
+				t.Errorf("%s: tenant %q, want %q", tc.name, got, tc.tenant)
+			}
+		}
+	}
+}
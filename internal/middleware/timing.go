@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// ServerTiming reports request phase durations in a Server-Timing header:
+// "gateway" is the time spent in the gateway itself (total minus upstream),
+// "auth" token validation and "upstream" the upstream calls. An upstream's
+// own Server-Timing entries are kept. It must run early to cover the whole
+// middleware stack.
+func ServerTiming(cfg config.ServerTimingConfig) fiber.Handler {
+	phases := make(map[string]bool, len(cfg.Phases))
+	for _, phase := range cfg.Phases {
+		phases[strings.TrimSpace(phase)] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !cfg.Enabled {
+			return c.Next()
+		}
+
+		start := time.Now()
+		err := c.Next()
+		total := time.Since(start)
+
+		var entries []string
+		for _, timing := range reqctx.Timings(c) {
+			if timing.Name == "upstream" {
+				total -= timing.Duration
+			}
+			if phases[timing.Name] {
+				entries = append(entries, serverTimingEntry(timing.Name, timing.Duration))
+			}
+		}
+		if phases["gateway"] {
+			entries = append([]string{serverTimingEntry("gateway", total)}, entries...)
+		}
+		if len(entries) > 0 {
+			c.Append("Server-Timing", strings.Join(entries, ", "))
+		}
+		return err
+	}
+}
+
+// serverTimingEntry formats a duration as a Server-Timing metric in milliseconds
+func serverTimingEntry(name string, d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	return name + ";dur=" + strconv.FormatFloat(ms, 'f', 1, 64)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+func TestServerTiming(t *testing.T) {
+	app := fiber.New()
+	app.Use(ServerTiming(config.ServerTimingConfig{Enabled: true, Phases: []string{"gateway", "upstream"}}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		reqctx.AddTiming(c, "auth", time.Millisecond)
+		reqctx.AddTiming(c, "upstream", 5*time.Millisecond)
+		reqctx.AddTiming(c, "upstream", 5*time.Millisecond)
+		c.Set("Server-Timing", "db;dur=3")
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := strings.Join(resp.Header.Values("Server-Timing"), ", ")
+	if !strings.Contains(header, "db;dur=3") || !strings.Contains(header, "upstream;dur=10.0") ||
+		!strings.Contains(header, "gateway;dur=") || strings.Contains(header, "auth") {
+		t.Errorf("Server-Timing = %q", header)
+	}
+}
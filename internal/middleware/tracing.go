@@ -6,6 +6,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/reqctx"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -20,6 +21,9 @@ import (
 // TracerProvider holds the tracer provider
 var tracerProvider *sdktrace.TracerProvider
 
+// spanKey stores the server span of the request
+var spanKey = reqctx.NewKey[trace.Span]("span")
+
 // InitTracer initializes OpenTelemetry tracer
 func InitTracer(cfg config.TracingConfig) (func(context.Context) error, error) {
 	if !cfg.Enabled {
@@ -28,10 +32,18 @@ func InitTracer(cfg config.TracingConfig) (func(context.Context) error, error) {
 
 	ctx := context.Background()
 
-	// Create OTLP exporter
+	// Create OTLP exporter. Retries are bounded so an unreachable collector
+	// holds a batch for at most ExportRetryMax.
 	exporter, err := otlptracehttp.New(ctx,
 		otlptracehttp.WithEndpoint(cfg.Endpoint),
 		otlptracehttp.WithInsecure(),
+		otlptracehttp.WithTimeout(cfg.ExportTimeout),
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{
+			Enabled:         cfg.ExportRetryMax > 0,
+			InitialInterval: time.Second,
+			MaxInterval:     5 * time.Second,
+			MaxElapsedTime:  cfg.ExportRetryMax,
+		}),
 	)
 	if err != nil {
 		return nil, err
@@ -48,11 +60,18 @@ func InitTracer(cfg config.TracingConfig) (func(context.Context) error, error) {
 		return nil, err
 	}
 
-	// Create tracer provider
+	// Create tracer provider. The guard bounds the export queue and lowers
+	// the sample rate under exporter backpressure.
+	guard := newExportGuard(cfg.MaxQueueSize, cfg.SampleRate)
+	batcher := sdktrace.NewBatchSpanProcessor(
+		&guardedExporter{SpanExporter: exporter, guard: guard},
+		sdktrace.WithMaxQueueSize(cfg.MaxQueueSize),
+		sdktrace.WithExportTimeout(cfg.ExportTimeout),
+	)
 	tracerProvider = sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSpanProcessor(&guardedProcessor{SpanProcessor: batcher, guard: guard}),
 		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.TraceIDRatioBased(cfg.SampleRate)),
+		sdktrace.WithSampler(guard),
 	)
 
 	// Set global tracer provider
@@ -93,22 +112,22 @@ func Tracing(serviceName string) fiber.Handler {
 		)
 
 		// Add custom attributes
-		if requestID, ok := c.Locals("request_id").(string); ok {
+		if requestID := reqctx.RequestID(c); requestID != "" {
 			span.SetAttributes(attribute.String("request.id", requestID))
 		}
-		if tenantID, ok := c.Locals("tenant_id").(string); ok {
+		if tenantID := reqctx.TenantID(c); tenantID != "" {
 			span.SetAttributes(attribute.String("tenant.id", tenantID))
 		}
-		if userID, ok := c.Locals("user_id").(string); ok {
+		if userID := reqctx.UserID(c); userID != "" {
 			span.SetAttributes(attribute.String("user.id", userID))
 		}
-		if service, ok := c.Locals("service").(string); ok {
+		if service := reqctx.Service(c); service != "" {
 			span.SetAttributes(attribute.String("upstream.service", service))
 		}
 
 		// Store context and span in Fiber context
 		c.SetUserContext(ctx)
-		c.Locals("span", span)
+		spanKey.Set(c, span)
 
 		// Inject trace context for downstream propagation
 		otel.GetTextMapPropagator().Inject(ctx, &fiberRequestCarrier{c})
@@ -122,7 +141,7 @@ func Tracing(serviceName string) fiber.Handler {
 		statusCode := c.Response().StatusCode()
 		span.SetAttributes(
 			semconv.HTTPStatusCode(statusCode),
-			attribute.Int64("http.response_content_length", int64(len(c.Response().Body()))),
+			attribute.Int64("http.response_content_length", int64(responseSize(c))),
 			attribute.Float64("http.duration_ms", float64(duration.Milliseconds())),
 		)
 
@@ -192,7 +211,7 @@ func CreateSpan(ctx context.Context, name string, opts ...trace.SpanStartOption)
 
 // GetSpanFromContext extracts span from Fiber context
 func GetSpanFromContext(c *fiber.Ctx) trace.Span {
-	if span, ok := c.Locals("span").(trace.Span); ok {
+	if span, ok := spanKey.Get(c); ok {
 		return span
 	}
 	return nil
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Sampling is halved per level of exporter backpressure, down to
+// 1/2^maxSamplingLevel of the configured rate
+const (
+	maxSamplingLevel      = 4
+	samplingAdjustBackoff = 10 * time.Second
+)
+
+// exportGuard keeps tracing cheap while the collector is unreachable. It
+// bounds the spans waiting for export, counts the ones it drops, reports
+// exporter health and lowers the sample rate while exports fail or the
+// queue is filling up, restoring it step by step once exports succeed.
+type exportGuard struct {
+	maxQueue int64
+	baseRate float64
+
+	queued  atomic.Int64
+	sampler atomic.Value // samplerBox
+
+	mu         sync.Mutex
+	level      int
+	healthy    bool
+	lastAdjust time.Time
+}
+
+// samplerBox gives the stored samplers one concrete type, as atomic.Value
+// requires; TraceIDRatioBased returns different types depending on the rate
+type samplerBox struct {
+	sdktrace.Sampler
+}
+
+func newExportGuard(maxQueue int, sampleRate float64) *exportGuard {
+	g := &exportGuard{
+		maxQueue: int64(maxQueue),
+		baseRate: sampleRate,
+		healthy:  true,
+	}
+	g.sampler.Store(samplerBox{sdktrace.TraceIDRatioBased(sampleRate)})
+	RecordTracingExporter(true, sampleRate)
+	return g
+}
+
+// ShouldSample implements sdktrace.Sampler with the current reduced rate
+func (g *exportGuard) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return g.sampler.Load().(samplerBox).ShouldSample(p)
+}
+
+// Description implements sdktrace.Sampler
+func (g *exportGuard) Description() string {
+	return "BackpressureSampler{" + g.sampler.Load().(samplerBox).Description() + "}"
+}
+
+// exported records the outcome of an export of n spans
+func (g *exportGuard) exported(n int, err error) {
+	g.queued.Add(-int64(n))
+	if err != nil {
+		RecordTracingSpansDropped("export_failed", n)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.healthy = err == nil
+	g.adjustLocked(time.Now())
+}
+
+// enqueue reserves a queue slot for a span, or reports it dropped
+func (g *exportGuard) enqueue() bool {
+	if g.queued.Add(1) <= g.maxQueue {
+		return true
+	}
+	g.queued.Add(-1)
+	RecordTracingSpansDropped("queue_full", 1)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.adjustLocked(time.Now())
+	return false
+}
+
+// adjustLocked moves the sampling level one step towards the current
+// pressure, at most once per backoff period
+func (g *exportGuard) adjustLocked(now time.Time) {
+	defer func() { RecordTracingExporter(g.healthy, g.rate()) }()
+	if now.Sub(g.lastAdjust) < samplingAdjustBackoff {
+		return
+	}
+
+	queued := g.queued.Load()
+	level := g.level
+	switch {
+	case (!g.healthy || queued > g.maxQueue/2) && level < maxSamplingLevel:
+		level++
+	case g.healthy && queued < g.maxQueue/4 && level > 0:
+		level--
+	}
+	if level != g.level {
+		g.level, g.lastAdjust = level, now
+		g.sampler.Store(samplerBox{sdktrace.TraceIDRatioBased(g.rate())})
+	}
+}
+
+// rate is the sample rate at the current level
+func (g *exportGuard) rate() float64 {
+	return g.baseRate / float64(int(1)<<g.level)
+}
+
+// guardedExporter reports export outcomes to the guard
+type guardedExporter struct {
+	sdktrace.SpanExporter
+	guard *exportGuard
+}
+
+func (e *guardedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.guard.exported(len(spans), err)
+	return err
+}
+
+// guardedProcessor drops spans instead of queueing them once the guard's
+// queue is full
+type guardedProcessor struct {
+	sdktrace.SpanProcessor
+	guard *exportGuard
+}
+
+func (p *guardedProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() || !p.guard.enqueue() {
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExportGuardFullRate(t *testing.T) {
+	// At rate 1 the SDK returns a different sampler type than for fractions
+	g := newExportGuard(4, 1)
+	g.exported(0, errors.New("connection refused"))
+	if g.rate() != 0.5 || g.Description() == "" {
+		t.Fatalf("rate after failed export = %v", g.rate())
+	}
+}
+
+func TestExportGuard(t *testing.T) {
+	g := newExportGuard(4, 0.8)
+
+	for i := 0; i < 4; i++ {
+		if !g.enqueue() {
+			t.Fatalf("span %d dropped below the queue limit", i)
+		}
+	}
+	if g.enqueue() {
+		t.Fatal("expected span to be dropped with a full queue")
+	}
+	// A full queue is backpressure on its own
+	if got := g.rate(); got != 0.4 {
+		t.Fatalf("rate with full queue = %v, want 0.4", got)
+	}
+
+	g.lastAdjust = time.Time{}
+	g.exported(4, errors.New("connection refused"))
+	if g.healthy || g.rate() != 0.2 {
+		t.Fatalf("after failed export healthy=%v rate=%v", g.healthy, g.rate())
+	}
+
+	// Recovery lowers the level one step per backoff period
+	g.exported(0, nil)
+	if g.rate() != 0.2 {
+		t.Fatalf("rate recovered within backoff: %v", g.rate())
+	}
+	g.lastAdjust = time.Time{}
+	g.exported(0, nil)
+	if !g.healthy || g.rate() != 0.4 {
+		t.Fatalf("after successful export healthy=%v rate=%v", g.healthy, g.rate())
+	}
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// srvLookupTimeout bounds a single SRV resolution
+const srvLookupTimeout = 5 * time.Second
+
+// StartDiscovery starts periodic DNS SRV resolution for every service that
+// has an SRV name configured, including those SyncServices adds later.
+// Resolution stops when ctx is done.
+func (p *ServiceProxy) StartDiscovery(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.discovery = ctx
+	for _, svc := range p.services {
+		p.startDiscovery(svc)
+	}
+}
+
+// startDiscovery starts resolving the service's SRV name once discovery
+// is running. The caller holds p.mu.
+func (p *ServiceProxy) startDiscovery(svc *ServiceClient) {
+	if svc.SRVName == "" || p.discovery == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(p.discovery)
+	svc.stopDiscovery = cancel
+	go p.discover(ctx, svc)
+}
+
+// endDiscovery stops resolving the service's SRV name, if it was started
+func (s *ServiceClient) endDiscovery() {
+	if s.stopDiscovery != nil {
+		s.stopDiscovery()
+	}
+}
+
+// discover resolves the service's SRV name now and then on every refresh
+// until ctx is done
+func (p *ServiceProxy) discover(ctx context.Context, svc *ServiceClient) {
+	interval := svc.SRVRefresh
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	p.resolveSRV(ctx, svc)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.resolveSRV(ctx, svc)
+		}
+	}
+}
+
+// resolveSRV refreshes the instance list of a service from DNS. A failed or
+// empty lookup keeps the previous instances so a DNS blip doesn't drop traffic.
+func (p *ServiceProxy) resolveSRV(ctx context.Context, svc *ServiceClient) {
+	ctx, cancel := context.WithTimeout(ctx, srvLookupTimeout)
+	defer cancel()
+
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", svc.SRVName)
+	if err != nil || len(records) == 0 {
+		log.Printf("SRV lookup for %s (%s) failed: %v", svc.Name, svc.SRVName, err)
+		return
+	}
+
+	scheme := "http"
+	if u, err := url.Parse(svc.URL); err == nil && u.Scheme != "" {
+		scheme = u.Scheme
+	}
+
+	// Records come sorted by priority; only the most preferred tier is used
+	instances := make([]string, 0, len(records))
+	for _, rec := range records {
+		if rec.Priority != records[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(rec.Target, ".")
+		instances = append(instances, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(rec.Port))))
+	}
+
+	p.mu.Lock()
+	svc.instances = instances
+	p.mu.Unlock()
+}
+
+// baseURL returns the URL to send the next request to, round-robining over
+// discovered instances and falling back to the configured URL
+func (p *ServiceProxy) baseURL(svc *ServiceClient) string {
+	p.mu.RLock()
+	instances := svc.instances
+	p.mu.RUnlock()
+
+	if len(instances) == 0 {
+		return svc.URL
+	}
+	n := svc.next.Add(1)
+	return instances[n%uint64(len(instances))]
+}
+
+// Instances returns the currently discovered instances of a service
+func (p *ServiceProxy) Instances(serviceName string) []string {
+	svc, ok := p.GetService(serviceName)
+	if !ok {
+		return nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string(nil), svc.instances...)
+}
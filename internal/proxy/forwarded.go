@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// setForwardingHeaders extends the X-Forwarded-For chain with the client's
+// address and, if enabled, the RFC 7239 Forwarded header. Inbound chains are
+// only kept from trusted proxies, since anyone else can forge them.
+func (p *ServiceProxy) setForwardingHeaders(c *fiber.Ctx, req *fasthttp.Request) {
+	trusted := c.IsProxyTrusted()
+
+	var chain []string
+	if trusted {
+		chain = trimChain(splitForwardedFor(c.Get(fiber.HeaderXForwardedFor)), p.cfg.ForwardedForDepth)
+	}
+	req.Header.Set(fiber.HeaderXForwardedFor, strings.Join(append(chain, c.IP()), ", "))
+
+	if !p.cfg.ForwardedHeader {
+		return
+	}
+
+	element := "for=" + forwardedNode(c.IP()) +
+		";host=" + quoteForwarded(string(c.Request().Host())) +
+		";proto=" + c.Protocol()
+
+	if inbound := c.Get("Forwarded"); trusted && inbound != "" {
+		element = inbound + ", " + element
+	}
+	req.Header.Set("Forwarded", element)
+}
+
+// splitForwardedFor splits an X-Forwarded-For value into its entries
+func splitForwardedFor(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// trimChain keeps the depth right-most entries, those added by the proxies
+// closest to the gateway. A depth of 0 keeps the whole chain.
+func trimChain(chain []string, depth int) []string {
+	if depth > 0 && len(chain) > depth {
+		return chain[len(chain)-depth:]
+	}
+	return chain
+}
+
+// forwardedNode formats an address as an RFC 7239 node; IPv6 addresses must
+// be bracketed and quoted
+func forwardedNode(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// quoteForwarded quotes a value when it contains characters that aren't
+// allowed in an RFC 7239 token (e.g. the colon of host:port)
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, `:[]" ;,=`) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
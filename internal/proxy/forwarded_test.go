@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrimChain(t *testing.T) {
+	chain := splitForwardedFor("203.0.113.7, 10.0.0.1 ,, 10.0.0.2")
+
+	if want := []string{"203.0.113.7", "10.0.0.1", "10.0.0.2"}; !reflect.DeepEqual(chain, want) {
+		t.Fatalf("splitForwardedFor = %v, want %v", chain, want)
+	}
+	if got := trimChain(chain, 0); len(got) != 3 {
+		t.Errorf("depth 0 kept %v, want whole chain", got)
+	}
+	if got, want := trimChain(chain, 2), []string{"10.0.0.1", "10.0.0.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("depth 2 kept %v, want %v", got, want)
+	}
+}
+
+func TestForwardedNode(t *testing.T) {
+	if got := forwardedNode("192.0.2.60"); got != "192.0.2.60" {
+		t.Errorf("IPv4 node = %s", got)
+	}
+	if got, want := forwardedNode("2001:db8::1"), `"[2001:db8::1]"`; got != want {
+		t.Errorf("IPv6 node = %s, want %s", got, want)
+	}
+	if got, want := quoteForwarded("example.com:8080"), `"example.com:8080"`; got != want {
+		t.Errorf("host = %s, want %s", got, want)
+	}
+}
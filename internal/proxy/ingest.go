@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/valyala/fasthttp"
+)
+
+// errIngestAborted is recorded for requests still queued when shutdown ran out of time
+var errIngestAborted = errors.New("gateway shut down before delivery")
+
+// Ingester delivers requests of ingest routes in the background. The client
+// gets a 202 once its request is queued; deliveries failing with an error,
+// 429 or 5xx are retried with backoff, and requests that can't be delivered
+// are written to the dead-letter log.
+//
+// Interceptors don't run for ingest routes since there is no response to
+// hand back to the client.
+type Ingester struct {
+	proxy  *ServiceProxy
+	cfg    config.IngestConfig
+	logger middleware.Logger
+	queue  chan *ingestJob
+
+	// mu guards closing the queue against concurrent sends
+	mu        sync.RWMutex
+	closed    bool
+	abort     chan struct{}
+	abortOnce sync.Once
+	workers   sync.WaitGroup
+
+	deadMu     sync.Mutex
+	deadLetter *os.File
+}
+
+// ingestJob is a queued request; target is the upstream path and query
+type ingestJob struct {
+	svc    *ServiceClient
+	target string
+	req    *fasthttp.Request
+}
+
+// deadLetterRecord is a dead-letter log line. Credentials are left out.
+type deadLetterRecord struct {
+	Time     time.Time         `json:"time"`
+	Service  string            `json:"service"`
+	Method   string            `json:"method"`
+	Target   string            `json:"target"`
+	Headers  map[string]string `json:"headers"`
+	Body     []byte            `json:"body"`
+	Attempts int               `json:"attempts"`
+	Error    string            `json:"error"`
+}
+
+// NewIngester creates an ingester delivering through p
+func NewIngester(p *ServiceProxy, cfg config.IngestConfig, logger middleware.Logger) *Ingester {
+	return &Ingester{
+		proxy:  p,
+		cfg:    cfg,
+		logger: logger,
+		queue:  make(chan *ingestJob, max(cfg.QueueSize, 1)),
+		abort:  make(chan struct{}),
+	}
+}
+
+// Start opens the dead-letter file and starts the delivery workers
+func (in *Ingester) Start() error {
+	if in.cfg.DeadLetterFile != "" {
+		f, err := os.OpenFile(in.cfg.DeadLetterFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return fmt.Errorf("open ingest dead-letter file: %w", err)
+		}
+		in.deadLetter = f
+	}
+
+	for range max(in.cfg.Workers, 1) {
+		in.workers.Add(1)
+		go in.work()
+	}
+	return nil
+}
+
+// Stop stops accepting requests and waits for the queued ones to be
+// delivered. Once ctx is done, the rest are dead-lettered without further
+// attempts.
+func (in *Ingester) Stop(ctx context.Context) error {
+	in.mu.Lock()
+	if !in.closed {
+		in.closed = true
+		close(in.queue)
+	}
+	in.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		in.workers.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		in.abortOnce.Do(func() { close(in.abort) })
+		<-done
+		err = ctx.Err()
+	}
+
+	if in.deadLetter != nil {
+		err = errors.Join(err, in.deadLetter.Close())
+	}
+	return err
+}
+
+// Forward queues the request for delivery to the service and answers 202,
+// or 503 when the queue is full (half full for low-priority requests)
+func (in *Ingester) Forward(c *fiber.Ctx, serviceName string, opts ForwardOptions) error {
+	svc, ok := in.proxy.GetService(serviceName)
+	if !ok {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": fmt.Sprintf("service %s not found", serviceName),
+		})
+	}
+
+	job := &ingestJob{svc: svc, target: upstreamTarget(c, opts), req: fasthttp.AcquireRequest()}
+	job.req.SetRequestURI(svc.URL + job.target)
+	in.proxy.buildRequest(c, svc, opts, job.req)
+
+	priority := reqctx.Priority(c)
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if !in.closed && in.admits(priority) {
+		select {
+		case in.queue <- job:
+			middleware.RecordIngest(svc.Name, "accepted")
+			middleware.RecordIngestQueueDepth(len(in.queue))
+			return c.SendStatus(fiber.StatusAccepted)
+		default:
+		}
+	}
+
+	fasthttp.ReleaseRequest(job.req)
+	middleware.RecordIngest(svc.Name, "rejected")
+	middleware.RecordShed(svc.Name, "ingest_queue", priority.String())
+	c.Set(fiber.HeaderRetryAfter, "1")
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error":   "ingest_queue_full",
+		"message": "Too many requests are waiting for delivery, please retry later",
+	})
+}
+
+// lowPriorityQueueShare is the part of the queue low-priority requests may
+// fill, keeping the rest for normal and high-priority ones
+const lowPriorityQueueShare = 0.5
+
+// admits reports whether a request of the given priority may be queued now
+func (in *Ingester) admits(priority config.RequestPriority) bool {
+	if priority >= config.PriorityNormal {
+		return true
+	}
+	return float64(len(in.queue)) < float64(cap(in.queue))*lowPriorityQueueShare
+}
+
+// work delivers queued requests until the queue is closed and drained
+func (in *Ingester) work() {
+	defer in.workers.Done()
+	for job := range in.queue {
+		middleware.RecordIngestQueueDepth(len(in.queue))
+		in.deliver(job)
+		fasthttp.ReleaseRequest(job.req)
+	}
+}
+
+// deliver sends a job, retrying failures, and dead-letters it when it
+// can't be delivered
+func (in *Ingester) deliver(job *ingestJob) {
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	backoff := in.cfg.RetryBackoff
+	attempts := 0
+	for {
+		select {
+		case <-in.abort:
+			in.deadLetterJob(job, attempts, errIngestAborted)
+			return
+		default:
+		}
+
+		job.req.SetRequestURI(in.deliveryBase(job.svc) + job.target)
+		resp.Reset()
+		err := job.svc.send(job.req, resp)
+		attempts++
+
+		status := resp.StatusCode()
+		if err == nil && status < fiber.StatusBadRequest {
+			middleware.RecordIngest(job.svc.Name, "delivered")
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("upstream returned status %d", status)
+			if status != fiber.StatusTooManyRequests && status < fiber.StatusInternalServerError {
+				// The upstream rejected the request itself; retrying won't help
+				in.deadLetterJob(job, attempts, err)
+				return
+			}
+		}
+		if attempts > in.cfg.MaxRetries {
+			in.deadLetterJob(job, attempts, err)
+			return
+		}
+
+		middleware.RecordIngest(job.svc.Name, "retried")
+		select {
+		case <-time.After(backoff):
+		case <-in.abort:
+		}
+		backoff *= 2
+	}
+}
+
+// deliveryBase returns the base URL for a delivery attempt, using the
+// fallback while the primary is unhealthy
+func (in *Ingester) deliveryBase(svc *ServiceClient) string {
+	if healthy, _ := in.proxy.serviceAvailability(svc); !healthy && in.proxy.FallbackAvailable(svc.Name) {
+		return svc.FallbackURL
+	}
+	return in.proxy.baseURL(svc)
+}
+
+// deadLetterJob records an undeliverable request in the dead-letter file,
+// or logs it when there is none
+func (in *Ingester) deadLetterJob(job *ingestJob, attempts int, cause error) {
+	middleware.RecordIngest(job.svc.Name, "dead_lettered")
+
+	record := deadLetterRecord{
+		Time:     time.Now(),
+		Service:  job.svc.Name,
+		Method:   string(job.req.Header.Method()),
+		Target:   job.target,
+		Headers:  make(map[string]string),
+		Body:     job.req.Body(),
+		Attempts: attempts,
+		Error:    cause.Error(),
+	}
+	job.req.Header.VisitAll(func(key, value []byte) {
+		switch http.CanonicalHeaderKey(string(key)) {
+		case fiber.HeaderAuthorization, fiber.HeaderCookie:
+			return
+		}
+		record.Headers[string(key)] = string(value)
+	})
+
+	if in.deadLetter == nil {
+		in.logger.Error("Ingest request dead-lettered",
+			"service", record.Service,
+			"method", record.Method,
+			"target", record.Target,
+			"attempts", record.Attempts,
+			"error", record.Error,
+		)
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	in.deadMu.Lock()
+	defer in.deadMu.Unlock()
+	if _, err := in.deadLetter.Write(append(line, '\n')); err != nil {
+		in.logger.Error("Failed to write ingest dead letter", "service", record.Service, "target", record.Target, "error", err)
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/valyala/fasthttp"
+)
+
+// ingestUpstream answers with the given statuses in turn (the last one
+// repeating) and records the bodies it received
+type ingestUpstream struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+}
+
+func (u *ingestUpstream) serve(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		status := u.statuses[min(len(u.bodies), len(u.statuses)-1)]
+		u.bodies = append(u.bodies, string(ctx.PostBody()))
+		ctx.SetStatusCode(status)
+	}}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+func newTestIngester(t *testing.T, url string, cfg config.IngestConfig) (*Ingester, *fiber.App) {
+	p := NewServiceProxy(&config.ServicesConfig{
+		Additional: map[string]config.ServiceConfig{
+			"telemetry": {URL: url, Timeout: time.Second},
+		},
+	}, config.ProxyConfig{})
+	in := NewIngester(p, cfg, middleware.NewLogger(config.LoggingConfig{}))
+
+	app := fiber.New()
+	app.Post("/events", func(c *fiber.Ctx) error {
+		return in.Forward(c, "telemetry", ForwardOptions{})
+	})
+	return in, app
+}
+
+func postEvent(t *testing.T, app *fiber.App, body string) int {
+	req := httptest.NewRequest(fiber.MethodPost, "/events", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestIngesterRetriesUntilDelivered(t *testing.T) {
+	upstream := &ingestUpstream{statuses: []int{503, 502, 200}}
+	in, app := newTestIngester(t, upstream.serve(t), config.IngestConfig{
+		QueueSize: 10, Workers: 1, MaxRetries: 3, RetryBackoff: time.Millisecond,
+	})
+	if err := in.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := postEvent(t, app, `{"event":"click"}`); status != fiber.StatusAccepted {
+		t.Fatalf("status = %d, want 202", status)
+	}
+	if err := in.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(upstream.bodies) != 3 || upstream.bodies[2] != `{"event":"click"}` {
+		t.Errorf("upstream received %q, want the event on the third attempt", upstream.bodies)
+	}
+}
+
+func TestIngesterDeadLetters(t *testing.T) {
+	deadLetters := filepath.Join(t.TempDir(), "dead.jsonl")
+	upstream := &ingestUpstream{statuses: []int{500}}
+	in, app := newTestIngester(t, upstream.serve(t), config.IngestConfig{
+		QueueSize: 10, Workers: 2, MaxRetries: 1, RetryBackoff: time.Millisecond, DeadLetterFile: deadLetters,
+	})
+	if err := in.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	postEvent(t, app, `{"event":"view"}`)
+	if err := in.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(deadLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record deadLetterRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("dead letter %q: %v", data, err)
+	}
+	if record.Service != "telemetry" || record.Target != "/events" || record.Attempts != 2 || string(record.Body) != `{"event":"view"}` {
+		t.Errorf("dead letter = %+v", record)
+	}
+	if _, ok := record.Headers["Authorization"]; ok {
+		t.Error("dead letter kept the Authorization header")
+	}
+}
+
+func TestIngesterRejectsWhenFull(t *testing.T) {
+	// Not started, so nothing drains the queue
+	in, app := newTestIngester(t, "http://127.0.0.1:1", config.IngestConfig{QueueSize: 1})
+
+	if status := postEvent(t, app, "a"); status != fiber.StatusAccepted {
+		t.Errorf("first status = %d, want 202", status)
+	}
+	if status := postEvent(t, app, "b"); status != fiber.StatusServiceUnavailable {
+		t.Errorf("second status = %d, want 503", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	in.Stop(ctx)
+	if status := postEvent(t, app, "c"); status != fiber.StatusServiceUnavailable {
+		t.Errorf("status after stop = %d, want 503", status)
+	}
+}
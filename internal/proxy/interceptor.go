@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrHandled is returned by an interceptor that has written the client
+// response itself (e.g. a cache hit); the upstream call is skipped.
+var ErrHandled = errors.New("proxy: response handled by interceptor")
+
+// Interceptor observes or mutates proxied traffic.
+//
+// Interceptors run in registration order for requests and in reverse order
+// for responses, so the first registered interceptor wraps all the others.
+type Interceptor interface {
+	// OnRequest is called after the upstream request has been built and
+	// before it is sent. Returning ErrHandled skips the upstream call;
+	// any other error fails the request with 502.
+	OnRequest(c *fiber.Ctx, service string, req *fasthttp.Request) error
+	// OnResponse is called after the upstream response has been received and
+	// before it is copied to the client. For streamed routes the body is
+	// still unread, so interceptors must not consume resp.BodyStream().
+	OnResponse(c *fiber.Ctx, service string, resp *fasthttp.Response) error
+}
+
+// InterceptorFuncs adapts plain functions to the Interceptor interface.
+// Nil functions are skipped.
+type InterceptorFuncs struct {
+	Request  func(c *fiber.Ctx, service string, req *fasthttp.Request) error
+	Response func(c *fiber.Ctx, service string, resp *fasthttp.Response) error
+}
+
+// OnRequest implements Interceptor
+func (f InterceptorFuncs) OnRequest(c *fiber.Ctx, service string, req *fasthttp.Request) error {
+	if f.Request == nil {
+		return nil
+	}
+	return f.Request(c, service, req)
+}
+
+// OnResponse implements Interceptor
+func (f InterceptorFuncs) OnResponse(c *fiber.Ctx, service string, resp *fasthttp.Response) error {
+	if f.Response == nil {
+		return nil
+	}
+	return f.Response(c, service, resp)
+}
+
+// Use registers an interceptor for all proxied requests
+func (p *ServiceProxy) Use(interceptor Interceptor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interceptors = append(p.interceptors, interceptor)
+}
+
+// runRequestInterceptors calls OnRequest on every interceptor in order
+func (p *ServiceProxy) runRequestInterceptors(c *fiber.Ctx, service string, req *fasthttp.Request) error {
+	p.mu.RLock()
+	interceptors := p.interceptors
+	p.mu.RUnlock()
+
+	for _, interceptor := range interceptors {
+		if err := interceptor.OnRequest(c, service, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runResponseInterceptors calls OnResponse on every interceptor in reverse order
+func (p *ServiceProxy) runResponseInterceptors(c *fiber.Ctx, service string, resp *fasthttp.Response) error {
+	p.mu.RLock()
+	interceptors := p.interceptors
+	p.mu.RUnlock()
+
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if err := interceptors[i].OnResponse(c, service, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/valyala/fasthttp"
+)
+
+// poolStats tracks a service's upstream connections. fasthttp doesn't expose
+// its pool, so open connections are counted at dial/close and requests in
+// flight around each call; an HTTP/1.1 connection serves one request at a
+// time, which gives idle and waiting counts from the two.
+type poolStats struct {
+	open     atomic.Int64
+	inflight atomic.Int64
+}
+
+// publish updates the pool gauges of a service
+func (s *poolStats) publish(service string) {
+	open, inflight := s.open.Load(), s.inflight.Load()
+	middleware.RecordUpstreamPool(service, open, max(open-inflight, 0), max(inflight-open, 0))
+}
+
+// dial wraps a dialer so connections are counted while open
+func (s *ServiceClient) dial(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		middleware.RecordUpstreamDial(s.Name, err == nil)
+		if err != nil {
+			return nil, err
+		}
+
+		s.pool.open.Add(1)
+		s.pool.publish(s.Name)
+		return &countedConn{Conn: conn, svc: s}, nil
+	}
+}
+
+// send performs an upstream call, tracking it as in flight
+func (s *ServiceClient) send(req *fasthttp.Request, resp *fasthttp.Response) error {
+	s.pool.inflight.Add(1)
+	s.pool.publish(s.Name)
+	defer func() {
+		s.pool.inflight.Add(-1)
+		s.pool.publish(s.Name)
+	}()
+
+	err := s.HTTPClient().Do(req, resp)
+	if errors.Is(err, fasthttp.ErrNoFreeConns) {
+		middleware.RecordUpstreamPoolExhausted(s.Name)
+	}
+	return err
+}
+
+// countedConn decrements the open count once when closed
+type countedConn struct {
+	net.Conn
+	svc  *ServiceClient
+	once sync.Once
+}
+
+// Close implements net.Conn
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		c.svc.pool.open.Add(-1)
+		c.svc.pool.publish(c.svc.Name)
+	})
+	return c.Conn.Close()
+}
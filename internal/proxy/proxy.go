@@ -1,65 +1,163 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/compress"
+	"github.com/minisource/gateway/internal/listener"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/reqctx"
 	"github.com/valyala/fasthttp"
 )
 
 // ServiceProxy handles proxying requests to backend services
 type ServiceProxy struct {
-	services map[string]*ServiceClient
-	mu       sync.RWMutex
+	services     map[string]*ServiceClient
+	cfg          config.ProxyConfig
+	interceptors []Interceptor
+	encoder      *compress.Encoder
+	// dynamic names the services added by SyncServices
+	dynamic map[string]bool
+	// discovery is the context SRV discovery runs under once started
+	discovery context.Context
+	mu        sync.RWMutex
 }
 
 // ServiceClient represents a connection to a backend service
 type ServiceClient struct {
 	Name       string
 	URL        string
-	Client     *fasthttp.Client
 	HealthPath string
 	Healthy    bool
 	LastCheck  time.Time
+	// HealthySince is when the service last recovered from unhealthy
+	HealthySince time.Time
+	// SlowStart is the window over which a recovered service ramps up to full traffic
+	SlowStart time.Duration
+	// SRVName and SRVRefresh configure DNS SRV discovery of instances
+	SRVName    string
+	SRVRefresh time.Duration
+	// FallbackURL is used while the primary is unavailable; its health is
+	// tracked separately
+	FallbackURL       string
+	FallbackHealthy   bool
+	FallbackLastCheck time.Time
+
+	cfg          config.ServiceConfig
+	client       atomic.Pointer[fasthttp.Client]
+	dialFailures atomic.Int32
+	instances    []string
+	next         atomic.Uint64
+	pool         poolStats
+	// stopDiscovery ends SRV resolution when the service is replaced
+	stopDiscovery context.CancelFunc
+}
+
+// newServiceClient creates a service client from its configuration
+func newServiceClient(name string, cfg config.ServiceConfig) *ServiceClient {
+	svc := &ServiceClient{
+		Name:       name,
+		URL:        cfg.URL,
+		HealthPath: cfg.HealthPath,
+		Healthy:    true,
+		SlowStart:  cfg.SlowStart,
+		SRVName:    cfg.SRVName,
+		SRVRefresh: cfg.SRVRefresh,
+		cfg:        cfg,
+
+		FallbackURL:     cfg.FallbackURL,
+		FallbackHealthy: cfg.FallbackURL != "",
+	}
+	svc.client.Store(svc.newHTTPClient())
+	return svc
+}
+
+// newHTTPClient creates an upstream client. Each client gets its own dialer
+// so replacing the client also drops its DNS cache.
+func (s *ServiceClient) newHTTPClient() *fasthttp.Client {
+	dialer := &fasthttp.TCPDialer{Concurrency: 1000}
+	return &fasthttp.Client{
+		MaxConnsPerHost:     s.cfg.MaxConnsPerHost,
+		MaxIdleConnDuration: s.cfg.IdleConnTimeout,
+		MaxConnWaitTimeout:  s.cfg.MaxConnWaitTimeout,
+		ReadBufferSize:      s.cfg.ReadBufferSize,
+		WriteBufferSize:     s.cfg.WriteBufferSize,
+		ReadTimeout:         s.cfg.Timeout,
+		WriteTimeout:        s.cfg.Timeout,
+		Dial:                s.dial(dialer.Dial),
+	}
+}
+
+// HTTPClient returns the current upstream client
+func (s *ServiceClient) HTTPClient() *fasthttp.Client {
+	return s.client.Load()
+}
+
+// slowStartMinShare is the traffic share a service receives right after recovering
+const slowStartMinShare = 0.1
+
+// TrafficShare returns the fraction of requests the service should receive,
+// ramping linearly from slowStartMinShare to 1 over the slow-start window
+func (s *ServiceClient) TrafficShare(now time.Time) float64 {
+	if s.SlowStart <= 0 || s.HealthySince.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(s.HealthySince)
+	if elapsed >= s.SlowStart {
+		return 1
+	}
+	return max(slowStartMinShare, float64(elapsed)/float64(s.SlowStart))
+}
+
+// ForwardOptions controls how a single request is proxied
+type ForwardOptions struct {
+	StripPrefix string
+	// PrefixRewrite replaces the stripped prefix
+	PrefixRewrite string
+	// Stream relays the upstream body to the client as it arrives instead
+	// of buffering it, applying the slow-client limits from ProxyConfig
+	Stream bool
+	// Rewrite, when set, replaces the upstream path using RewriteTarget
+	Rewrite       *regexp.Regexp
+	RewriteTarget string
+	// NormalizeEncoding decodes compressed upstream responses and
+	// re-encodes them per client, so stored copies are encoding-neutral
+	NormalizeEncoding bool
+	// PreserveHost and Host override the service's Host header settings
+	PreserveHost bool
+	Host         string
+	// RequestHeaders and ResponseHeaders are the route's header transforms
+	RequestHeaders  *config.HeaderTransformConfig
+	ResponseHeaders *config.HeaderTransformConfig
+	// SetResponseHeaders are set on the client response after the copy
+	SetResponseHeaders []config.ResponseHeader
+	// RequestQuery is the route's query transform, with Add values expanded
+	RequestQuery *config.QueryTransformConfig
 }
 
 // NewServiceProxy creates a new service proxy
-func NewServiceProxy(cfg *config.ServicesConfig) *ServiceProxy {
+func NewServiceProxy(cfg *config.ServicesConfig, proxyCfg config.ProxyConfig) *ServiceProxy {
 	proxy := &ServiceProxy{
 		services: make(map[string]*ServiceClient),
+		cfg:      proxyCfg,
+		encoder:  compress.NewEncoder(proxyCfg.Compression),
 	}
 
-	// Initialize auth service
-	proxy.services["auth"] = &ServiceClient{
-		Name:       "auth",
-		URL:        cfg.Auth.URL,
-		HealthPath: cfg.Auth.HealthPath,
-		Healthy:    true,
-		Client: &fasthttp.Client{
-			MaxConnsPerHost:     cfg.Auth.MaxConnsPerHost,
-			MaxIdleConnDuration: 30 * time.Second,
-			ReadTimeout:         cfg.Auth.Timeout,
-			WriteTimeout:        cfg.Auth.Timeout,
-		},
-	}
-
-	// Initialize notifier service
-	proxy.services["notifier"] = &ServiceClient{
-		Name:       "notifier",
-		URL:        cfg.Notifier.URL,
-		HealthPath: cfg.Notifier.HealthPath,
-		Healthy:    true,
-		Client: &fasthttp.Client{
-			MaxConnsPerHost:     cfg.Notifier.MaxConnsPerHost,
-			MaxIdleConnDuration: 30 * time.Second,
-			ReadTimeout:         cfg.Notifier.Timeout,
-			WriteTimeout:        cfg.Notifier.Timeout,
-		},
+	proxy.services["auth"] = newServiceClient("auth", cfg.Auth)
+	proxy.services["notifier"] = newServiceClient("notifier", cfg.Notifier)
+	for name, svcCfg := range cfg.Additional {
+		proxy.services[name] = newServiceClient(name, svcCfg)
 	}
 
 	return proxy
@@ -73,8 +171,42 @@ func (p *ServiceProxy) GetService(name string) (*ServiceClient, bool) {
 	return svc, ok
 }
 
+// SyncServices replaces the services added at runtime (e.g. from Kubernetes
+// backends) with services. Services from the configuration are never
+// replaced or removed; a service is only rebuilt when its configuration
+// changed, so unchanged ones keep their connections and health. SRV
+// discovery of the services it adds starts once StartDiscovery has run.
+func (p *ServiceProxy) SyncServices(services map[string]config.ServiceConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dynamic == nil {
+		p.dynamic = make(map[string]bool)
+	}
+	for name := range p.dynamic {
+		if _, ok := services[name]; !ok {
+			p.services[name].endDiscovery()
+			delete(p.services, name)
+			delete(p.dynamic, name)
+		}
+	}
+	for name, cfg := range services {
+		existing, ok := p.services[name]
+		if ok && (!p.dynamic[name] || existing.cfg == cfg) {
+			continue
+		}
+		if ok {
+			existing.endDiscovery()
+		}
+		svc := newServiceClient(name, cfg)
+		p.services[name] = svc
+		p.dynamic[name] = true
+		p.startDiscovery(svc)
+	}
+}
+
 // Forward proxies a request to the target service
-func (p *ServiceProxy) Forward(c *fiber.Ctx, serviceName string, stripPrefix string) error {
+func (p *ServiceProxy) Forward(c *fiber.Ctx, serviceName string, opts ForwardOptions) error {
 	svc, ok := p.GetService(serviceName)
 	if !ok {
 		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
@@ -82,35 +214,263 @@ func (p *ServiceProxy) Forward(c *fiber.Ctx, serviceName string, stripPrefix str
 		})
 	}
 
-	if !svc.Healthy {
+	// The circuit breaker asks for the fallback when the primary's breaker is open
+	useFallback, failoverReason := reqctx.UseFallback(c), "circuit_open"
+
+	healthy, share := p.serviceAvailability(svc)
+	if !healthy {
+		useFallback, failoverReason = true, "unhealthy"
+	}
+
+	// Send the excess to the fallback while a recovered service warms up.
+	// Without one the service is the only place the traffic can go, so it
+	// gets all of it.
+	if svc.SlowStart > 0 {
+		middleware.RecordUpstreamTrafficShare(svc.Name, share)
+	}
+	priority := reqctx.Priority(c)
+	if share = priorityShare(share, priority); !useFallback && share < 1 && rand.Float64() >= share && p.FallbackAvailable(serviceName) {
+		useFallback, failoverReason = true, "slow_start"
+	}
+
+	if useFallback && !p.FallbackAvailable(serviceName) {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
 			"error": fmt.Sprintf("service %s is unavailable", serviceName),
 		})
 	}
 
-	// Build target URL
-	path := string(c.Request().URI().Path())
-	if stripPrefix != "" {
-		path = strings.TrimPrefix(path, stripPrefix)
+	base := svc.FallbackURL
+	if useFallback {
+		middleware.RecordUpstreamFailover(svc.Name, failoverReason)
+	} else {
+		base = p.baseURL(svc)
+	}
+
+	// Create upstream request
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	abandoned := false
+	defer func() {
+		if !abandoned {
+			fasthttp.ReleaseRequest(req)
+		}
+	}()
+	resp.StreamBody = opts.Stream
+
+	req.SetRequestURI(base + upstreamTarget(c, opts))
+	p.buildRequest(c, svc, opts, req)
+
+	normalize := opts.NormalizeEncoding && !opts.Stream
+	if normalize {
+		req.Header.Set(fiber.HeaderAcceptEncoding, compress.UpstreamAcceptEncoding)
+	}
+
+	if err := p.runRequestInterceptors(c, svc.Name, req); err != nil {
+		fasthttp.ReleaseResponse(resp)
+		if errors.Is(err, ErrHandled) {
+			transformHeaders(&c.Response().Header, opts.ResponseHeaders)
+			setResponseHeaders(&c.Response().Header, opts.SetResponseHeaders)
+			return nil
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "upstream request rejected",
+			"details": err.Error(),
+		})
+	}
+
+	// Execute request
+	start := time.Now()
+	err := p.do(c, svc, req, resp)
+	reqctx.AddTiming(c, "upstream", time.Since(start))
+	if errors.Is(err, errClientGone) {
+		// req and resp now belong to the abandoned upstream call
+		abandoned = true
+		middleware.RecordClientDisconnect(svc.Name)
+		return c.SendStatus(StatusClientClosedRequest)
+	}
+	if !useFallback {
+		svc.recordDial(err)
+	}
+	if err != nil {
+		fasthttp.ReleaseResponse(resp)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "upstream request failed",
+			"details": err.Error(),
+		})
+	}
+
+	if normalize {
+		err := compress.Normalize(resp, p.cfg.MaxDecodedBodySize)
+		if errors.Is(err, compress.ErrTooLarge) {
+			// Relayed as the upstream encoded it; the cache skips encoded bodies
+			normalize = false
+		} else if err != nil {
+			fasthttp.ReleaseResponse(resp)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error":   "upstream response could not be decoded",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	if err := p.runResponseInterceptors(c, svc.Name, resp); err != nil {
+		fasthttp.ReleaseResponse(resp)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "upstream response rejected",
+			"details": err.Error(),
+		})
+	}
+
+	transformHeaders(&resp.Header, opts.ResponseHeaders)
+
+	// Copy response headers
+	resp.Header.VisitAll(func(key, value []byte) {
+		keyStr := string(key)
+		if isHopByHopHeader(keyStr) {
+			return
+		}
+		c.Set(keyStr, string(value))
+	})
+	setResponseHeaders(&c.Response().Header, opts.SetResponseHeaders)
+
+	// Copy response
+	c.Status(resp.StatusCode())
+	if body := resp.BodyStream(); opts.Stream && body != nil {
+		// The upstream response is released once the client has been served
+		c.Response().SetBodyStream(newClientStream(c, svc.Name, resp, p.cfg), resp.Header.ContentLength())
+		return nil
+	}
+
+	defer fasthttp.ReleaseResponse(resp)
+	if normalize {
+		return c.Send(p.encoder.Apply(c, resp.Body()))
+	}
+	return c.Send(resp.Body())
+}
+
+// priorityShare adjusts a service's traffic share for the request priority:
+// high-priority requests are never shed and low-priority ones ramp up last
+func priorityShare(share float64, priority config.RequestPriority) float64 {
+	switch {
+	case priority > config.PriorityNormal:
+		return 1
+	case priority < config.PriorityNormal:
+		return share * share
+	}
+	return share
+}
+
+// StatusClientClosedRequest is recorded when the client went away before the
+// upstream answered (the nginx convention; it is never sent)
+const StatusClientClosedRequest = 499
+
+// errClientGone is returned by do when the client disconnected first
+var errClientGone = errors.New("proxy: client disconnected")
+
+// do sends the upstream request, giving up as soon as the client disconnects.
+// fasthttp can't abort a request in flight, so an abandoned call finishes in
+// the background (bounded by the service timeout) and releases req and resp
+// itself; the handler and client connection are freed right away.
+func (p *ServiceProxy) do(c *fiber.Ctx, svc *ServiceClient, req *fasthttp.Request, resp *fasthttp.Response) error {
+	gone, stop := listener.WatchClose(c.Context().Conn())
+	if gone == nil {
+		return svc.send(req, resp)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.send(req, resp)
+	}()
+
+	select {
+	case err := <-done:
+		stop()
+		return err
+	case <-gone:
+		stop()
+		go func() {
+			<-done
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(resp)
+		}()
+		return errClientGone
+	}
+}
+
+// upstreamTarget returns the upstream path and query for the request
+func upstreamTarget(c *fiber.Ctx, opts ForwardOptions) string {
+	return UpstreamTarget(string(c.Request().URI().Path()), string(c.Request().URI().QueryString()), opts)
+}
+
+// UpstreamTarget returns the upstream path and query for a request path and
+// query string, after the prefix stripping and rewriting of opts
+func UpstreamTarget(path, query string, opts ForwardOptions) string {
+	if opts.StripPrefix != "" {
+		path = strings.TrimPrefix(path, opts.StripPrefix)
+		if opts.PrefixRewrite != "" {
+			path = strings.TrimSuffix(opts.PrefixRewrite, "/") + path
+		}
 		if path == "" {
 			path = "/"
 		}
 	}
+	if opts.Rewrite != nil && opts.Rewrite.MatchString(path) {
+		path = opts.Rewrite.ReplaceAllString(path, opts.RewriteTarget)
+	}
 
-	queryString := string(c.Request().URI().QueryString())
-	targetURL := svc.URL + path
-	if queryString != "" {
-		targetURL += "?" + queryString
+	if opts.RequestQuery != nil {
+		query = transformQuery(query, opts.RequestQuery)
+	}
+	if query != "" {
+		path += "?" + query
 	}
+	return path
+}
 
-	// Create upstream request
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+// transformQuery applies a query transform to a query string
+func transformQuery(query string, t *config.QueryTransformConfig) string {
+	var args fasthttp.Args
+	args.Parse(query)
+	for _, name := range t.Remove {
+		prefix, wildcard := strings.CutSuffix(name, "*")
+		if !wildcard {
+			args.Del(name)
+			continue
+		}
+		var matched []string
+		args.VisitAll(func(key, _ []byte) {
+			if strings.HasPrefix(string(key), prefix) {
+				matched = append(matched, string(key))
+			}
+		})
+		for _, key := range matched {
+			args.Del(key)
+		}
+	}
+	for from, to := range t.Rename {
+		values := args.PeekMulti(from)
+		if len(values) == 0 {
+			continue
+		}
+		renamed := make([]string, len(values))
+		for i, value := range values {
+			renamed[i] = string(value)
+		}
+		args.Del(from)
+		for _, value := range renamed {
+			args.Add(to, value)
+		}
+	}
+	for key, value := range t.Add {
+		args.Set(key, value)
+	}
+	return string(args.QueryString())
+}
 
-	// Copy request
-	req.SetRequestURI(targetURL)
+// buildRequest copies the client request's method, headers and body into
+// req, with forwarding headers and the route's request header transforms.
+// The caller sets the URI first.
+func (p *ServiceProxy) buildRequest(c *fiber.Ctx, svc *ServiceClient, opts ForwardOptions, req *fasthttp.Request) {
 	req.Header.SetMethod(string(c.Request().Header.Method()))
 
 	// Copy headers
@@ -123,72 +483,132 @@ func (p *ServiceProxy) Forward(c *fiber.Ctx, serviceName string, stripPrefix str
 		req.Header.SetBytesKV(key, value)
 	})
 
+	if host := upstreamHost(c, svc, opts); host != "" {
+		req.Header.SetHost(host)
+		req.UseHostHeader = true
+	}
+
 	// Set forwarding headers
-	req.Header.Set("X-Forwarded-For", c.IP())
+	p.setForwardingHeaders(c, req)
 	req.Header.Set("X-Forwarded-Host", string(c.Request().Host()))
 	req.Header.Set("X-Forwarded-Proto", c.Protocol())
 	req.Header.Set("X-Real-IP", c.IP())
 	req.Header.Set("X-Request-ID", c.GetRespHeader("X-Request-ID"))
 
+	transformHeaders(&req.Header, opts.RequestHeaders)
+
 	// Copy body
 	if len(c.Body()) > 0 {
 		req.SetBody(c.Body())
 	}
+}
 
-	// Execute request
-	if err := svc.Client.Do(req, resp); err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"error":   "upstream request failed",
-			"details": err.Error(),
-		})
+// upstreamHost returns the Host header to send upstream, or "" to use the
+// upstream URL's host. Route options take precedence over the service's.
+func upstreamHost(c *fiber.Ctx, svc *ServiceClient, opts ForwardOptions) string {
+	switch {
+	case opts.Host != "":
+		return opts.Host
+	case opts.PreserveHost:
+		return string(c.Request().Host())
+	case svc.cfg.HostHeader != "":
+		return svc.cfg.HostHeader
+	case svc.cfg.PreserveHost:
+		return string(c.Request().Host())
 	}
-
-	// Copy response headers
-	resp.Header.VisitAll(func(key, value []byte) {
-		keyStr := string(key)
-		if isHopByHopHeader(keyStr) {
-			return
-		}
-		c.Set(keyStr, string(value))
-	})
-
-	// Copy response
-	c.Status(resp.StatusCode())
-	return c.Send(resp.Body())
+	return ""
 }
 
-// HealthCheck checks the health of a service
+// HealthCheck checks the health of a service, and of its fallback if configured
 func (p *ServiceProxy) HealthCheck(serviceName string) bool {
 	svc, ok := p.GetService(serviceName)
 	if !ok {
 		return false
 	}
 
+	if svc.FallbackURL != "" {
+		p.setFallbackHealth(serviceName, p.checkEndpoint(svc, svc.FallbackURL))
+	}
+	if svc.HealthPath == "" {
+		// Not probed: the service is assumed healthy
+		return true
+	}
+
+	healthy := p.checkEndpoint(svc, svc.URL)
+	p.setServiceHealth(serviceName, healthy)
+	return healthy
+}
+
+// checkEndpoint probes the health path of one upstream base URL
+func (p *ServiceProxy) checkEndpoint(svc *ServiceClient, baseURL string) bool {
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseRequest(req)
 	defer fasthttp.ReleaseResponse(resp)
 
-	req.SetRequestURI(svc.URL + svc.HealthPath)
+	req.SetRequestURI(baseURL + svc.HealthPath)
 	req.Header.SetMethod("GET")
 
-	if err := svc.Client.DoTimeout(req, resp, 5*time.Second); err != nil {
-		p.setServiceHealth(serviceName, false)
+	err := svc.HTTPClient().DoTimeout(req, resp, 5*time.Second)
+	if baseURL == svc.URL {
+		svc.recordDial(err)
+	}
+	if err != nil {
 		return false
 	}
+	return resp.StatusCode() >= 200 && resp.StatusCode() < 300
+}
 
-	healthy := resp.StatusCode() >= 200 && resp.StatusCode() < 300
-	p.setServiceHealth(serviceName, healthy)
+// FallbackAvailable reports whether a service has a healthy fallback upstream
+func (p *ServiceProxy) FallbackAvailable(serviceName string) bool {
+	svc, ok := p.GetService(serviceName)
+	if !ok {
+		return false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return svc.FallbackURL != "" && svc.FallbackHealthy
+}
+
+// IsAvailable reports whether a service exists and is healthy
+func (p *ServiceProxy) IsAvailable(serviceName string) bool {
+	svc, ok := p.GetService(serviceName)
+	if !ok {
+		return false
+	}
+	healthy, _ := p.serviceAvailability(svc)
 	return healthy
 }
 
+// serviceAvailability returns the service health and current traffic share
+func (p *ServiceProxy) serviceAvailability(svc *ServiceClient) (bool, float64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return svc.Healthy, svc.TrafficShare(time.Now())
+}
+
 // setServiceHealth updates service health status
 func (p *ServiceProxy) setServiceHealth(name string, healthy bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if svc, ok := p.services[name]; ok {
+		now := time.Now()
+		if healthy && !svc.Healthy {
+			svc.HealthySince = now
+		}
 		svc.Healthy = healthy
-		svc.LastCheck = time.Now()
+		svc.LastCheck = now
+	}
+}
+
+// setFallbackHealth updates fallback health status
+func (p *ServiceProxy) setFallbackHealth(name string, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if svc, ok := p.services[name]; ok {
+		svc.FallbackHealthy = healthy
+		svc.FallbackLastCheck = time.Now()
 	}
 }
 
@@ -197,13 +617,24 @@ func (p *ServiceProxy) StartHealthChecks(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
 		for range ticker.C {
-			for name := range p.services {
+			for _, name := range p.ServiceNames() {
 				p.HealthCheck(name)
 			}
 		}
 	}()
 }
 
+// ServiceNames lists the services, which SyncServices may change at runtime
+func (p *ServiceProxy) ServiceNames() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.services))
+	for name := range p.services {
+		names = append(names, name)
+	}
+	return names
+}
+
 // GetServicesHealth returns health status of all services
 func (p *ServiceProxy) GetServicesHealth() map[string]bool {
 	p.mu.RLock()
@@ -216,6 +647,46 @@ func (p *ServiceProxy) GetServicesHealth() map[string]bool {
 	return health
 }
 
+// headerEditor is implemented by fasthttp request and response headers
+type headerEditor interface {
+	Peek(key string) []byte
+	Set(key, value string)
+	Del(key string)
+}
+
+// transformHeaders applies a route's header transform: remove, then rename,
+// then add
+func transformHeaders(h headerEditor, t *config.HeaderTransformConfig) {
+	if t == nil {
+		return
+	}
+	for _, key := range t.Remove {
+		h.Del(key)
+	}
+	for from, to := range t.Rename {
+		if value := h.Peek(from); len(value) > 0 {
+			v := string(value)
+			h.Del(from)
+			h.Set(to, v)
+		}
+	}
+	for key, value := range t.Add {
+		h.Set(key, value)
+	}
+}
+
+// setResponseHeaders applies a route's setResponseHeaders: override
+// replaces the header, append adds the value as another header line
+func setResponseHeaders(h *fasthttp.ResponseHeader, headers []config.ResponseHeader) {
+	for _, header := range headers {
+		if header.Mode == "append" {
+			h.Add(header.Name, header.Value)
+		} else {
+			h.Set(header.Name, header.Value)
+		}
+	}
+}
+
 // isHopByHopHeader checks if header should not be forwarded
 func isHopByHopHeader(header string) bool {
 	hopByHopHeaders := map[string]bool{
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTransformHeaders(t *testing.T) {
+	var h fasthttp.RequestHeader
+	h.Set("Cookie", "session=1")
+	h.Set("X-Tenant-ID", "acme")
+	h.Set("X-Keep", "yes")
+
+	transformHeaders(&h, &config.HeaderTransformConfig{
+		Add:    map[string]string{"X-Api-Version": "1"},
+		Remove: []string{"Cookie"},
+		Rename: map[string]string{"X-Tenant-ID": "X-Legacy-Tenant", "X-Missing": "X-Other"},
+	})
+
+	for key, want := range map[string]string{
+		"Cookie":          "",
+		"X-Tenant-ID":     "",
+		"X-Legacy-Tenant": "acme",
+		"X-Api-Version":   "1",
+		"X-Keep":          "yes",
+		"X-Other":         "",
+	} {
+		if got := string(h.Peek(key)); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	transformHeaders(&h, nil)
+	if got := string(h.Peek("X-Keep")); got != "yes" {
+		t.Errorf("nil transform changed headers")
+	}
+}
+
+func TestSetResponseHeaders(t *testing.T) {
+	var h fasthttp.ResponseHeader
+	h.Set("Cache-Control", "max-age=60")
+	h.Set("Vary", "Accept-Encoding")
+
+	setResponseHeaders(&h, []config.ResponseHeader{
+		{Name: "Cache-Control", Value: "no-store"},
+		{Name: "Vary", Value: "Accept-Language", Mode: "append"},
+		{Name: "X-Service-Tier", Value: "gold", Mode: "override"},
+	})
+
+	if got := string(h.Peek("Cache-Control")); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+	if got := string(h.Peek("X-Service-Tier")); got != "gold" {
+		t.Errorf("X-Service-Tier = %q, want gold", got)
+	}
+	var vary []string
+	for _, value := range h.PeekAll("Vary") {
+		vary = append(vary, string(value))
+	}
+	if len(vary) != 2 || vary[0] != "Accept-Encoding" || vary[1] != "Accept-Language" {
+		t.Errorf("Vary = %q, want both values", vary)
+	}
+}
+
+func TestUpstreamTargetQuery(t *testing.T) {
+	opts := ForwardOptions{RequestQuery: &config.QueryTransformConfig{
+		Add:    map[string]string{"api_key": "internal"},
+		Remove: []string{"utm_*", "debug"},
+		Rename: map[string]string{"q": "search"},
+	}}
+
+	got := UpstreamTarget("/search", "q=a&q=b&utm_source=x&utm_medium=y&debug=1&page=2&api_key=client", opts)
+	if got != "/search?page=2&api_key=internal&search=a&search=b" {
+		t.Errorf("target = %s", got)
+	}
+	if got := UpstreamTarget("/search", "", opts); got != "/search?api_key=internal" {
+		t.Errorf("target without query = %s", got)
+	}
+	if got := UpstreamTarget("/search", "utm_source=x", ForwardOptions{RequestQuery: &config.QueryTransformConfig{Remove: []string{"utm_*"}}}); got != "/search" {
+		t.Errorf("target with every parameter removed = %s", got)
+	}
+}
+
+func TestPriorityShare(t *testing.T) {
+	for _, tt := range []struct {
+		priority config.RequestPriority
+		want     float64
+	}{
+		{config.PriorityHigh, 1},
+		{config.PriorityNormal, 0.5},
+		{config.PriorityLow, 0.25},
+	} {
+		if got := priorityShare(0.5, tt.priority); got != tt.want {
+			t.Errorf("priorityShare(0.5, %s) = %v, want %v", tt.priority, got, tt.want)
+		}
+	}
+}
+
+func TestSyncServices(t *testing.T) {
+	p := NewServiceProxy(&config.ServicesConfig{Auth: config.ServiceConfig{URL: "http://auth"}}, config.ProxyConfig{})
+
+	p.SyncServices(map[string]config.ServiceConfig{
+		"orders": {URL: "http://orders"},
+		"auth":   {URL: "http://elsewhere"},
+	})
+	orders, ok := p.GetService("orders")
+	if !ok {
+		t.Fatal("orders not added")
+	}
+	if auth, _ := p.GetService("auth"); auth.URL != "http://auth" {
+		t.Errorf("configured service replaced with %s", auth.URL)
+	}
+
+	p.SyncServices(map[string]config.ServiceConfig{"orders": {URL: "http://orders"}})
+	if same, _ := p.GetService("orders"); same != orders {
+		t.Error("unchanged service rebuilt")
+	}
+	p.SyncServices(map[string]config.ServiceConfig{"orders": {URL: "http://orders-v2"}})
+	if changed, _ := p.GetService("orders"); changed.URL != "http://orders-v2" {
+		t.Errorf("URL = %s", changed.URL)
+	}
+
+	p.SyncServices(nil)
+	if _, ok := p.GetService("orders"); ok {
+		t.Error("orders not removed")
+	}
+	if _, ok := p.GetService("auth"); !ok {
+		t.Error("configured service removed")
+	}
+}
+
+func TestSlowStartWithoutFallback(t *testing.T) {
+	upstream := &ingestUpstream{statuses: []int{200}}
+	p := NewServiceProxy(&config.ServicesConfig{
+		Additional: map[string]config.ServiceConfig{
+			"orders": {URL: upstream.serve(t), Timeout: time.Second, SlowStart: time.Hour},
+		},
+	}, config.ProxyConfig{})
+	// Just recovered: the ramp is at its minimum share
+	p.setServiceHealth("orders", false)
+	p.setServiceHealth("orders", true)
+
+	app := fiber.New()
+	app.Get("/orders", func(c *fiber.Ctx) error {
+		return p.Forward(c, "orders", ForwardOptions{})
+	})
+	for i := range 20 {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/orders", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("request %d = %d, want the warming service to take all traffic without a fallback", i, resp.StatusCode)
+		}
+	}
+}
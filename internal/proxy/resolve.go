@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"net"
+
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/valyala/fasthttp"
+)
+
+// recordDial tracks consecutive dial failures and replaces the client once
+// DNSResetAfter is reached. fasthttp caches resolved addresses per dialer, so
+// when an upstream hostname moves (e.g. a recreated Kubernetes service) a
+// fresh client is the only way to stop dialing the stale IP.
+func (s *ServiceClient) recordDial(err error) {
+	if !isDialError(err) {
+		s.dialFailures.Store(0)
+		return
+	}
+
+	threshold := int32(s.cfg.DNSResetAfter)
+	// Only the failure that reaches the threshold performs the reset
+	if threshold <= 0 || s.dialFailures.Add(1) != threshold {
+		return
+	}
+
+	old := s.client.Swap(s.newHTTPClient())
+	s.dialFailures.Store(0)
+	old.CloseIdleConnections()
+
+	middleware.RecordUpstreamClientReset(s.Name)
+	log.Printf("Reset upstream client for %s after %d dial failures", s.Name, threshold)
+}
+
+// isDialError reports whether err happened while establishing a connection
+func isDialError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, fasthttp.ErrDialTimeout) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
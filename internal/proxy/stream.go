@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/reqctx"
+	"github.com/valyala/fasthttp"
+)
+
+// errSlowClient is returned when a client reads below the configured minimum rate
+var errSlowClient = errors.New("client read rate below minimum")
+
+// Draining an aborted stream gives up after drainMaxBytes or drainTimeout
+// and closes the upstream connection instead of reusing it, so an endless
+// stream (SSE, long-poll) doesn't hold it forever
+const (
+	drainMaxBytes = 1 << 20
+	drainTimeout  = 5 * time.Second
+)
+
+// clientStream relays an upstream body stream to the client.
+//
+// fasthttp pulls from the stream and writes each chunk to the client
+// connection, so every chunk read pushes the write deadline forward. A
+// client that stops reading makes the next write time out instead of
+// letting the gateway buffer the whole upstream body in memory. Waiting on
+// the upstream isn't held against the client: the deadline is only set
+// once a chunk arrives, and the rate only counts time spent writing.
+type clientStream struct {
+	conn    net.Conn
+	service string
+	resp    *fasthttp.Response
+	body    io.Reader
+	cfg     config.ProxyConfig
+	start   time.Time
+	written int64
+	// handed is when the last chunk was handed to fasthttp to write, and
+	// writing the time spent writing chunks so far
+	handed  time.Time
+	writing time.Duration
+	aborted bool
+	// eof is set once the upstream body has been read to the end
+	eof bool
+	// done runs once the upstream body is released (reqctx.OnStreamDone)
+	done []func()
+}
+
+// newClientStream wraps the upstream response body for streaming to c
+func newClientStream(c *fiber.Ctx, service string, resp *fasthttp.Response, cfg config.ProxyConfig) *clientStream {
+	return &clientStream{
+		conn:    c.Context().Conn(),
+		service: service,
+		resp:    resp,
+		body:    resp.BodyStream(),
+		cfg:     cfg,
+		start:   time.Now(),
+		done:    reqctx.TakeStreamDone(c),
+	}
+}
+
+// Read implements io.Reader
+func (s *clientStream) Read(p []byte) (int, error) {
+	// fasthttp has written the previous chunk by the time it reads again
+	if !s.handed.IsZero() {
+		s.writing += time.Since(s.handed)
+		s.handed = time.Time{}
+	}
+	if s.cfg.StreamMinRate > 0 && s.writing > 0 && time.Since(s.start) > s.cfg.StreamMinRateGrace &&
+		float64(s.written)/s.writing.Seconds() < float64(s.cfg.StreamMinRate) {
+		s.abort("min_rate")
+		return 0, errSlowClient
+	}
+
+	n, err := s.body.Read(p)
+	s.eof = err == io.EOF
+	if n > 0 {
+		if s.conn != nil && s.cfg.StreamWriteTimeout > 0 {
+			_ = s.conn.SetWriteDeadline(time.Now().Add(s.cfg.StreamWriteTimeout))
+		}
+		s.handed = time.Now()
+	}
+	s.written += int64(n)
+	return n, err
+}
+
+// CloseWithError is called by fasthttp once the response has been written,
+// with the error that interrupted the write (if any)
+func (s *clientStream) CloseWithError(err error) error {
+	if err != nil && !s.aborted {
+		reason := "client_error"
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			reason = "write_timeout"
+		}
+		s.abort(reason)
+	}
+
+	if s.conn != nil && !s.aborted {
+		// Clear our deadline so it doesn't leak into the next keep-alive response
+		_ = s.conn.SetWriteDeadline(time.Time{})
+	}
+
+	if s.aborted && s.cfg.SlowClientPolicy == "drain" {
+		// Drain in the background so the upstream connection can be reused
+		go s.release(true)
+		return nil
+	}
+
+	s.release(false)
+	return nil
+}
+
+// abort records a slow-client abort once
+func (s *clientStream) abort(reason string) {
+	if s.aborted {
+		return
+	}
+	s.aborted = true
+	middleware.RecordSlowClientAbort(s.service, reason)
+}
+
+// release closes the upstream body and returns the response to the pool
+func (s *clientStream) release(drain bool) {
+	if drain {
+		s.drain()
+	}
+	if length := s.resp.Header.ContentLength(); !s.eof && (length < 0 || s.written < int64(length)) {
+		// The rest of the body is still on the connection, so it can't
+		// be reused
+		s.resp.SetConnectionClose()
+	}
+	_ = s.resp.CloseBodyStream()
+	fasthttp.ReleaseResponse(s.resp)
+	for _, done := range s.done {
+		done()
+	}
+}
+
+// drain reads what is left of the upstream body so its connection can be
+// reused, within drainMaxBytes and drainTimeout
+func (s *clientStream) drain() {
+	deadline := time.Now().Add(drainTimeout)
+	buf := make([]byte, 32*1024)
+	for drained := 0; drained < drainMaxBytes && time.Now().Before(deadline); {
+		n, err := s.body.Read(buf)
+		drained += n
+		if err != nil {
+			s.eof = err == io.EOF
+			return
+		}
+	}
+}
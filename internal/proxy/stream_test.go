@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+// deadlineConn records the write deadline the stream sets
+type deadlineConn struct {
+	net.Conn
+	deadline time.Time
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+// pausingBody is an upstream body sending a few bytes after every pause
+type pausingBody struct {
+	chunks int
+	pause  time.Duration
+}
+
+func (b *pausingBody) Read(p []byte) (int, error) {
+	if b.chunks == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(b.pause)
+	b.chunks--
+	return copy(p, "data"), nil
+}
+
+func TestClientStreamUpstreamPause(t *testing.T) {
+	cfg := config.ProxyConfig{StreamWriteTimeout: 20 * time.Millisecond, StreamMinRate: 1000}
+	stream := func(pause time.Duration) (*clientStream, *deadlineConn) {
+		conn := &deadlineConn{}
+		return &clientStream{conn: conn, body: &pausingBody{chunks: 3, pause: pause}, cfg: cfg, start: time.Now()}, conn
+	}
+	buf := make([]byte, 16)
+
+	// An upstream pausing longer than the write timeout, with a client
+	// keeping up, is neither a write timeout nor a slow client
+	s, conn := stream(50 * time.Millisecond)
+	for {
+		n, err := s.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read = %v", err)
+		}
+		if n > 0 && time.Until(conn.deadline) < 10*time.Millisecond {
+			t.Fatal("write deadline set before the upstream sent the chunk")
+		}
+	}
+
+	// A client taking long to write each chunk is below the minimum rate
+	s, _ = stream(0)
+	var err error
+	for range 3 {
+		if _, err = s.Read(buf); err != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !errors.Is(err, errSlowClient) || !s.aborted {
+		t.Errorf("slow client = %v, want errSlowClient", err)
+	}
+}
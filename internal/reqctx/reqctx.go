@@ -0,0 +1,282 @@
+// Package reqctx provides typed access to per-request values shared between
+// the router, middleware and proxy.
+//
+// Values are stored in fiber Locals; going through a Key keeps the name and
+// type of each value in one place instead of scattering string keys and type
+// assertions across packages.
+package reqctx
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+// Key is a typed key for a per-request value
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates a key. Names must be unique across the gateway.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// Name returns the underlying Locals key
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Get returns the value stored for the request, if any
+func (k Key[T]) Get(c *fiber.Ctx) (T, bool) {
+	v, ok := c.Locals(k.name).(T)
+	return v, ok
+}
+
+// Value returns the stored value or the zero value of T
+func (k Key[T]) Value(c *fiber.Ctx) T {
+	v, _ := k.Get(c)
+	return v
+}
+
+// Set stores the value for the request
+func (k Key[T]) Set(c *fiber.Ctx, v T) {
+	c.Locals(k.name, v)
+}
+
+// Keys for values shared across packages
+var (
+	routeKey      = NewKey[config.Route]("route")
+	serviceKey    = NewKey[string]("service")
+	tagsKey       = NewKey[map[string]string]("route_tags")
+	requestIDKey  = NewKey[string]("request_id")
+	userIDKey     = NewKey[string]("user_id")
+	tenantIDKey   = NewKey[string]("tenant_id")
+	fallbackKey   = NewKey[bool]("use_fallback")
+	variantKey    = NewKey[string]("experiment_variant")
+	paramsKey     = NewKey[map[string]string]("path_params")
+	timingsKey    = NewKey[*[]Timing]("timings")
+	priorityKey   = NewKey[config.RequestPriority]("priority")
+	clientCertKey = NewKey[string]("client_cert")
+	countryKey    = NewKey[string]("country")
+	asnKey        = NewKey[uint]("asn")
+	rejectionKey  = NewKey[string]("rejection")
+	streamKey     = NewKey[*streamDone]("stream_done")
+)
+
+// SetRoute records the matched route and the service that will serve it
+func SetRoute(c *fiber.Ctx, route config.Route) {
+	routeKey.Set(c, route)
+	serviceKey.Set(c, route.ServiceFor(c.Method()))
+	tagsKey.Set(c, route.Tags)
+}
+
+// Route returns the matched route
+func Route(c *fiber.Ctx) (config.Route, bool) {
+	return routeKey.Get(c)
+}
+
+// Tags returns the matched route's tags, also stored in the route_tags Locals
+func Tags(c *fiber.Ctx) map[string]string {
+	return tagsKey.Value(c)
+}
+
+// IsPublic reports whether the matched route skips authentication
+func IsPublic(c *fiber.Ctx) bool {
+	route, ok := routeKey.Get(c)
+	return ok && route.Public
+}
+
+// SetService overrides the service that will serve the request
+func SetService(c *fiber.Ctx, service string) {
+	serviceKey.Set(c, service)
+}
+
+// Service returns the service that will serve the request
+func Service(c *fiber.Ctx) string {
+	return serviceKey.Value(c)
+}
+
+// SetRequestID records the request ID
+func SetRequestID(c *fiber.Ctx, id string) {
+	requestIDKey.Set(c, id)
+}
+
+// RequestID returns the request ID
+func RequestID(c *fiber.Ctx) string {
+	return requestIDKey.Value(c)
+}
+
+// SetUserID records the authenticated user ID
+func SetUserID(c *fiber.Ctx, id string) {
+	userIDKey.Set(c, id)
+}
+
+// UserID returns the authenticated user ID
+func UserID(c *fiber.Ctx) string {
+	return userIDKey.Value(c)
+}
+
+// SetClientCert records the identity of the verified client certificate
+func SetClientCert(c *fiber.Ctx, identity string) {
+	clientCertKey.Set(c, identity)
+}
+
+// ClientCert returns the identity of the verified client certificate, if
+// the request came over mTLS
+func ClientCert(c *fiber.Ctx) string {
+	return clientCertKey.Value(c)
+}
+
+// SetLocation records the client's country (ISO 3166-1 alpha-2) and
+// autonomous system number
+func SetLocation(c *fiber.Ctx, country string, asn uint) {
+	countryKey.Set(c, country)
+	asnKey.Set(c, asn)
+}
+
+// Country returns the client's country code, if located
+func Country(c *fiber.Ctx) string {
+	return countryKey.Value(c)
+}
+
+// ASN returns the client's autonomous system number, if located
+func ASN(c *fiber.Ctx) uint {
+	return asnKey.Value(c)
+}
+
+// SetRejection records why a filter of the gateway (bots, geo) blocked the
+// request, e.g. bot:scanner
+func SetRejection(c *fiber.Ctx, reason string) {
+	rejectionKey.Set(c, reason)
+}
+
+// Rejection returns why a filter blocked the request, if one did
+func Rejection(c *fiber.Ctx) string {
+	return rejectionKey.Value(c)
+}
+
+// SetTenantID records the tenant ID
+func SetTenantID(c *fiber.Ctx, id string) {
+	tenantIDKey.Set(c, id)
+}
+
+// TenantID returns the tenant ID
+func TenantID(c *fiber.Ctx) string {
+	return tenantIDKey.Value(c)
+}
+
+// SetUseFallback asks the proxy to send the request to the service's fallback
+// upstream, e.g. because the primary's circuit is open
+func SetUseFallback(c *fiber.Ctx) {
+	fallbackKey.Set(c, true)
+}
+
+// UseFallback reports whether the request should go to the fallback upstream
+func UseFallback(c *fiber.Ctx) bool {
+	return fallbackKey.Value(c)
+}
+
+// SetVariant records the experiment variant assigned to the request
+func SetVariant(c *fiber.Ctx, variant string) {
+	variantKey.Set(c, variant)
+}
+
+// Variant returns the assigned experiment variant, if any
+func Variant(c *fiber.Ctx) string {
+	return variantKey.Value(c)
+}
+
+// SetPathParams records the values of the matched route's :name segments
+func SetPathParams(c *fiber.Ctx, params map[string]string) {
+	paramsKey.Set(c, params)
+}
+
+// PathParam returns the value of a :name segment of the matched route
+func PathParam(c *fiber.Ctx, name string) string {
+	return paramsKey.Value(c)[name]
+}
+
+// PathParams returns the values of the matched route's :name segments
+func PathParams(c *fiber.Ctx) map[string]string {
+	return paramsKey.Value(c)
+}
+
+// SetPriority records the request's load-shedding priority
+func SetPriority(c *fiber.Ctx, p config.RequestPriority) {
+	priorityKey.Set(c, p)
+}
+
+// Priority returns the request's priority, normal unless set
+func Priority(c *fiber.Ctx) config.RequestPriority {
+	return priorityKey.Value(c)
+}
+
+// Timing is the time spent in one phase of the request
+type Timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// AddTiming adds d to the named phase, e.g. once per upstream attempt
+func AddTiming(c *fiber.Ctx, name string, d time.Duration) {
+	timings, ok := timingsKey.Get(c)
+	if !ok {
+		timings = &[]Timing{}
+		timingsKey.Set(c, timings)
+	}
+	for i := range *timings {
+		if (*timings)[i].Name == name {
+			(*timings)[i].Duration += d
+			return
+		}
+	}
+	*timings = append(*timings, Timing{Name: name, Duration: d})
+}
+
+// Timings returns the recorded phase durations in the order first recorded
+func Timings(c *fiber.Ctx) []Timing {
+	if timings, ok := timingsKey.Get(c); ok {
+		return *timings
+	}
+	return nil
+}
+
+// streamDone holds what runs once a streamed response has been written
+type streamDone struct {
+	funcs []func()
+	taken bool
+}
+
+// OnStreamDone registers f to run once the response body has been written,
+// if a handler streams it. Middleware holding resources for the upstream
+// call runs f itself when StreamTaken reports no stream after the chain
+// returns.
+func OnStreamDone(c *fiber.Ctx, f func()) {
+	done, ok := streamKey.Get(c)
+	if !ok {
+		done = &streamDone{}
+		streamKey.Set(c, done)
+	}
+	done.funcs = append(done.funcs, f)
+}
+
+// TakeStreamDone returns the functions registered with OnStreamDone, for
+// the handler streaming the response body to run once it is written
+func TakeStreamDone(c *fiber.Ctx) []func() {
+	done, ok := streamKey.Get(c)
+	if !ok {
+		done = &streamDone{}
+		streamKey.Set(c, done)
+	}
+	done.taken = true
+	return done.funcs
+}
+
+// StreamTaken reports whether a streaming handler took the OnStreamDone
+// functions
+func StreamTaken(c *fiber.Ctx) bool {
+	done, ok := streamKey.Get(c)
+	return ok && done.taken
+}
@@ -0,0 +1,63 @@
+package reqctx
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+)
+
+func TestRouteAndService(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if _, ok := Route(c); ok {
+			t.Error("expected no route before SetRoute")
+		}
+		if IsPublic(c) {
+			t.Error("expected request without route to be non-public")
+		}
+
+		SetRoute(c, config.Route{Path: "/", Service: "auth", Public: true, Tags: map[string]string{"team": "identity"}})
+		if !IsPublic(c) {
+			t.Error("expected public route")
+		}
+		if tags, _ := c.Locals("route_tags").(map[string]string); Tags(c)["team"] != "identity" || tags["team"] != "identity" {
+			t.Errorf("Tags() = %v, Locals = %v", Tags(c), tags)
+		}
+		if got := Service(c); got != "auth" {
+			t.Errorf("Service() = %q, want auth", got)
+		}
+
+		SetService(c, "auth-replica")
+		if got := Service(c); got != "auth-replica" {
+			t.Errorf("Service() after override = %q, want auth-replica", got)
+		}
+		return nil
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyTypeMismatch(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals("user_id", 42)
+		if got := UserID(c); got != "" {
+			t.Errorf("UserID() with wrong type = %q, want empty", got)
+		}
+
+		key := NewKey[[]string]("variants")
+		key.Set(c, []string{"a", "b"})
+		if got, ok := key.Get(c); !ok || len(got) != 2 {
+			t.Errorf("Get() = %v, %v", got, ok)
+		}
+		return nil
+	})
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
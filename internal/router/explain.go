@@ -0,0 +1,184 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/proxy"
+)
+
+// MatchRequest describes a request to explain the routing of
+type MatchRequest struct {
+	Method string
+	// Path may carry a query string, which query predicates are checked against
+	Path    string
+	Headers map[string]string
+}
+
+// MatchCandidate is a route whose path matches the request, with the reason
+// it was or wasn't chosen
+type MatchCandidate struct {
+	Index   int
+	Pattern string
+	Matched bool
+	Reason  string
+}
+
+// MatchExplanation is the routing decision for a request: the route the
+// gateway serves it with, the routes considered, and where it is sent
+type MatchExplanation struct {
+	// Route is nil when no route matches
+	Route *config.Route
+	Index int
+	// Fallback is set when Route is the fallback (Index is then -1)
+	Fallback bool
+	// Params holds the values of the route's :name segments or named groups
+	Params map[string]string
+	// Path is the path the route matched, normalized for legacy routes
+	Path       string
+	Candidates []MatchCandidate
+	// Handler is how the route is served: proxy, static, redirect or gateway
+	Handler string
+	// Service and Upstream are the service and URL proxied routes call;
+	// experiments may send a share of requests to their variants instead
+	Service  string
+	Upstream string
+}
+
+// Explain reports how the current route table routes a request, the same
+// way Match and dispatch do, without serving it
+func (r *Router) Explain(req MatchRequest) MatchExplanation {
+	t := r.table.Load()
+	method := strings.ToUpper(req.Method)
+	if method == "HEAD" {
+		method = "GET"
+	}
+	path, query, _ := strings.Cut(req.Path, "?")
+	values, _ := url.ParseQuery(query)
+	headers := make(map[string]string, len(req.Headers))
+	for name, value := range req.Headers {
+		headers[strings.ToLower(name)] = value
+	}
+
+	exp := MatchExplanation{Index: -1, Path: path}
+	for i, route := range t.routes.Routes {
+		params, ok := t.matchPath(path, route)
+		if !ok {
+			continue
+		}
+		candidate := MatchCandidate{Index: i, Pattern: route.Pattern()}
+		switch reason := mismatch(route, method, headers, values); {
+		case exp.Route != nil:
+			candidate.Reason = fmt.Sprintf("route %d matched first", exp.Index)
+		case reason != "":
+			candidate.Reason = reason
+		default:
+			candidate.Matched, candidate.Reason = true, matchReason(route, params)
+			exp.Route, exp.Index, exp.Params = &route, i, params
+		}
+		exp.Candidates = append(exp.Candidates, candidate)
+	}
+
+	// Paths only legacy routes accept once normalized, like legacyRouteForRequest
+	if exp.Route == nil {
+		for i, route := range t.routes.Routes {
+			if route.Legacy == nil {
+				continue
+			}
+			normalized, _ := route.Legacy.NormalizePath(path)
+			if normalized == path {
+				continue
+			}
+			if params, ok := t.matchPath(normalized, route); ok && mismatch(route, method, headers, values) == "" {
+				exp.Route, exp.Index, exp.Params, exp.Path = &route, i, params, normalized
+				exp.Candidates = append(exp.Candidates, MatchCandidate{
+					Index:   i,
+					Pattern: route.Pattern(),
+					Matched: true,
+					Reason:  "legacy normalized path " + normalized + " " + matchReason(route, params),
+				})
+				break
+			}
+		}
+	}
+
+	if exp.Route == nil && t.servesFallback(method) && !t.coversPath(path) {
+		exp.Route, exp.Fallback = t.fallback, true
+	}
+
+	if exp.Route != nil {
+		r.explainUpstream(&exp, method, query)
+	}
+	return exp
+}
+
+// explainUpstream sets how the matched route is served
+func (r *Router) explainUpstream(exp *MatchExplanation, method, query string) {
+	route := *exp.Route
+	switch {
+	case route.Service == "gateway":
+		exp.Handler = "gateway"
+		return
+	case route.Response != nil:
+		exp.Handler = "static"
+		return
+	case route.Redirect != nil:
+		exp.Handler = "redirect"
+		return
+	}
+
+	exp.Handler = "proxy"
+	exp.Service = route.ServiceFor(method)
+	opts := forwardOptions(route)
+	// Added query parameters may hold credentials from the environment
+	opts.RequestQuery = route.RequestQuery
+	if opts.StripPrefix != "" && config.HasPathParams(route.Path) {
+		opts.StripPrefix = config.MatchedPrefix(route.Path, exp.Path)
+	}
+	target := proxy.UpstreamTarget(exp.Path, query, opts)
+	if r.proxy == nil {
+		exp.Upstream = target
+		return
+	}
+	if svc, ok := r.proxy.GetService(exp.Service); ok {
+		exp.Upstream = strings.TrimSuffix(svc.URL, "/") + target
+	}
+}
+
+// mismatch returns why a route whose path matches doesn't match the
+// request's method or predicates, or "" when it matches
+func mismatch(route config.Route, method string, headers map[string]string, query url.Values) string {
+	if !containsMethod(route.Methods, method) {
+		return fmt.Sprintf("method %s not in %s", method, strings.Join(route.Methods, ", "))
+	}
+	for name, want := range route.Headers {
+		if got := headers[strings.ToLower(name)]; got != want {
+			return fmt.Sprintf("header %s is %q, want %q", name, got, want)
+		}
+	}
+	for name, want := range route.Query {
+		if got := query.Get(name); got != want {
+			return fmt.Sprintf("query parameter %s is %q, want %q", name, got, want)
+		}
+	}
+	return ""
+}
+
+// matchReason describes why a route matches
+func matchReason(route config.Route, params map[string]string) string {
+	var reason string
+	switch {
+	case route.PathRegex != "":
+		reason = "path matches " + route.PathRegex
+	case len(params) > 0:
+		reason = "path matches parameters of " + route.Path
+	default:
+		reason = "path is " + route.Path + " or below it"
+	}
+	if len(route.Headers) > 0 || len(route.Query) > 0 {
+		reason += ", with matching predicates"
+	}
+	return reason
+}
@@ -1,40 +1,95 @@
 package router
 
 import (
+	"encoding/json"
+	"html"
+	"log"
+	"os"
+	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/minisource/gateway/config"
 	"github.com/minisource/gateway/internal/proxy"
+	"github.com/minisource/gateway/internal/reqctx"
 )
 
 // Router manages API gateway routing
 type Router struct {
-	app    *fiber.App
-	proxy  *proxy.ServiceProxy
+	app   *fiber.App
+	proxy *proxy.ServiceProxy
+	cfg   *config.Config
+	// table is swapped as a whole when routes change
+	table atomic.Pointer[routeTable]
+	// ingester delivers the requests of ingest routes
+	ingester *proxy.Ingester
+}
+
+// routeTable is a route configuration with its compiled patterns and handlers
+type routeTable struct {
 	routes *config.RouteConfig
-	cfg    *config.Config
+	// pathRegexes holds the compiled pathRegex of each route, by pattern
+	pathRegexes map[string]*regexp.Regexp
+	// handlers serve the routes by index; nil for routes the router doesn't
+	// serve (gateway routes)
+	handlers []fiber.Handler
+	// fallback serves paths no route covers, when configured
+	fallback        *config.Route
+	fallbackHandler fiber.Handler
 }
 
 // New creates a new router
 func New(app *fiber.App, proxy *proxy.ServiceProxy, routes *config.RouteConfig, cfg *config.Config) *Router {
-	return &Router{
-		app:    app,
-		proxy:  proxy,
-		routes: routes,
-		cfg:    cfg,
+	r := &Router{
+		app:   app,
+		proxy: proxy,
+		cfg:   cfg,
 	}
+	r.table.Store(r.compile(routes))
+	return r
+}
+
+// SetIngester sets the ingester serving ingest routes. Without one they
+// are proxied synchronously.
+func (r *Router) SetIngester(ingester *proxy.Ingester) {
+	r.ingester = ingester
+}
+
+// Routes returns the current route table
+func (r *Router) Routes() *config.RouteConfig {
+	return r.table.Load().routes
+}
+
+// SetRoutes replaces the route table. Requests already being served finish
+// with the routes they were matched against.
+func (r *Router) SetRoutes(routes *config.RouteConfig) {
+	t := r.compile(routes)
+	r.table.Store(t)
+	r.checkInternalRoutes(t)
 }
 
 // SetupRoutes configures all routes
 func (r *Router) SetupRoutes() {
-	// Setup routes from configuration
-	for _, route := range r.routes.Routes {
-		r.setupRoute(route)
-	}
+	r.checkInternalRoutes(r.table.Load())
+
+	// Routes are served from the current table rather than registered with
+	// fiber, so the table can change at runtime
+	r.app.Use(r.dispatch)
 
 	// Catch-all for unmatched routes
 	r.app.Use(func(c *fiber.Ctx) error {
+		if allowed := r.AllowedMethods(c.Path()); len(allowed) > 0 {
+			c.Set(fiber.HeaderAllow, strings.Join(allowed, ", "))
+			return c.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{
+				"error":   "method_not_allowed",
+				"message": "The requested method is not supported for this resource",
+				"path":    c.Path(),
+			})
+		}
+		if t := r.table.Load(); t.servesFallback(c.Method()) {
+			return t.fallbackHandler(c)
+		}
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error":   "not_found",
 			"message": "The requested resource was not found",
@@ -43,68 +98,273 @@ func (r *Router) SetupRoutes() {
 	})
 }
 
-// setupRoute configures a single route
-func (r *Router) setupRoute(route config.Route) {
-	// Handle gateway internal routes
-	if route.Service == "gateway" {
-		return // These are handled by health/metrics handlers
+// compile builds the table of a route configuration
+func (r *Router) compile(routes *config.RouteConfig) *routeTable {
+	t := &routeTable{
+		routes:      routes,
+		pathRegexes: make(map[string]*regexp.Regexp),
+		handlers:    make([]fiber.Handler, len(routes.Routes)),
+	}
+	for i, route := range routes.Routes {
+		if route.PathRegex != "" {
+			// Patterns are checked by RouteConfig.Validate when routes are loaded
+			t.pathRegexes[route.PathRegex] = regexp.MustCompile(route.PathRegex)
+		}
+		// Gateway internal routes are served by the gateway's own handlers
+		if route.Service != "gateway" {
+			t.handlers[i] = r.createHandler(route)
+		}
+	}
+	if routes.Fallback != nil {
+		fallback := *routes.Fallback
+		fallback.Path = config.FallbackPattern
+		t.fallback = &fallback
+		t.fallbackHandler = r.createFallbackHandler(fallback)
+	}
+	return t
+}
+
+// createHandler creates the handler serving a route
+func (r *Router) createHandler(route config.Route) fiber.Handler {
+	if route.Response != nil {
+		return r.createStaticHandler(route)
+	}
+	if route.Redirect != nil {
+		return r.createRedirectHandler(route)
+	}
+	return r.createProxyHandler(route)
+}
+
+// servedMethods are the methods routes are served for; HEAD is served by
+// GET routes
+var servedMethods = map[string]bool{
+	"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true, "OPTIONS": true,
+}
+
+// routeMethod returns the method routes are matched with: HEAD requests
+// are served by GET routes
+func routeMethod(method string) string {
+	if method == fiber.MethodHead {
+		return fiber.MethodGet
+	}
+	return method
+}
+
+// dispatch serves the request with the first route of the current table
+// matching its path, method and predicates, and passes it on otherwise
+func (r *Router) dispatch(c *fiber.Ctx) error {
+	t := r.table.Load()
+	path, method := c.Path(), routeMethod(c.Method())
+	if !servedMethods[method] {
+		return c.Next()
+	}
+
+	for i, route := range t.routes.Routes {
+		if t.handlers[i] != nil && containsMethod(route.Methods, method) && t.matchesPath(path, route) && matchesPredicates(c, route) {
+			return t.handlers[i](c)
+		}
+	}
+	return c.Next()
+}
+
+// Match resolves the route for each request before the middleware stack
+// runs, so route-aware middleware (auth, rate limiting, circuit breaking,
+// skip flags) sees the same route the proxy handler will serve
+func (r *Router) Match() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		t := r.table.Load()
+		route := t.routeForRequest(c)
+		if route == nil {
+			route = t.legacyRouteForRequest(c)
+		}
+		if route == nil && t.servesFallback(c.Method()) && !t.coversPath(c.Path()) {
+			route = t.fallback
+		}
+		if route != nil {
+			if route.Legacy != nil {
+				normalizeLegacy(c, route.Legacy)
+			}
+			reqctx.SetRoute(c, *route)
+			if params, _ := t.matchPath(c.Path(), *route); len(params) > 0 {
+				reqctx.SetPathParams(c, params)
+			}
+		}
+		return c.Next()
 	}
+}
 
-	// Create route pattern (supports wildcards)
-	pattern := route.Path
-	if !strings.HasSuffix(pattern, "*") {
-		pattern = pattern + "/*"
+// checkInternalRoutes reports gateway routes without an internal handler.
+// Match has already attached these routes to the request, so auth, rate
+// limiting and metrics apply their flags the same way as for proxied routes.
+func (r *Router) checkInternalRoutes(t *routeTable) {
+	registered := make(map[string]bool)
+	for _, rt := range r.app.GetRoutes(true) {
+		registered[rt.Method+" "+rt.Path] = true
 	}
 
-	handler := r.createProxyHandler(route)
+	for _, route := range t.routes.Routes {
+		if route.Service != "gateway" {
+			continue
+		}
+		for _, method := range route.Methods {
+			method = strings.ToUpper(method)
+			if !registered[method+" "+route.Path] && !registered[method+" "+route.Path+"/*"] {
+				log.Printf("Gateway route %s %s has no internal handler", method, route.Path)
+			}
+		}
+	}
+}
 
-	// Register for all specified methods
-	for _, method := range route.Methods {
-		switch strings.ToUpper(method) {
-		case "GET":
-			r.app.Get(pattern, handler)
-			r.app.Get(route.Path, handler) // Exact match
-		case "POST":
-			r.app.Post(pattern, handler)
-			r.app.Post(route.Path, handler)
-		case "PUT":
-			r.app.Put(pattern, handler)
-			r.app.Put(route.Path, handler)
-		case "DELETE":
-			r.app.Delete(pattern, handler)
-			r.app.Delete(route.Path, handler)
-		case "PATCH":
-			r.app.Patch(pattern, handler)
-			r.app.Patch(route.Path, handler)
-		case "OPTIONS":
-			r.app.Options(pattern, handler)
-			r.app.Options(route.Path, handler)
+// forwardOptions returns the options proxying a route's requests
+func forwardOptions(route config.Route) proxy.ForwardOptions {
+	opts := proxy.ForwardOptions{
+		Stream:             route.Stream,
+		NormalizeEncoding:  route.Cache != nil && route.Cache.Enabled,
+		PreserveHost:       route.PreserveHost,
+		Host:               route.HostHeader,
+		RequestHeaders:     route.RequestHeaders,
+		ResponseHeaders:    route.ResponseHeaders,
+		SetResponseHeaders: route.SetResponseHeaders,
+	}
+	if q := route.RequestQuery; q != nil {
+		expanded := *q
+		expanded.Add = make(map[string]string, len(q.Add))
+		for key, value := range q.Add {
+			expanded.Add[key] = os.ExpandEnv(value)
 		}
+		opts.RequestQuery = &expanded
+	}
+	if route.StripPrefix || route.PrefixRewrite != "" {
+		opts.StripPrefix, opts.PrefixRewrite = route.Path, route.PrefixRewrite
 	}
+	if route.Rewrite != nil {
+		// Patterns are checked by RouteConfig.Validate when routes are loaded
+		opts.Rewrite = regexp.MustCompile(route.Rewrite.Pattern)
+		opts.RewriteTarget = route.Rewrite.Target
+	}
+	return opts
 }
 
 // createProxyHandler creates a handler that proxies to the target service
 func (r *Router) createProxyHandler(route config.Route) fiber.Handler {
+	opts := forwardOptions(route)
+
+	return func(c *fiber.Ctx) error {
+		forward := r.proxy.Forward
+		if route.Ingest && r.ingester != nil {
+			forward = r.ingester.Forward
+		}
+
+		// Match has normally resolved the route already, and middleware may
+		// have overridden the service since (e.g. experiment variants)
+		if _, ok := reqctx.Route(c); !ok {
+			reqctx.SetRoute(c, route)
+		}
+
+		if opts.StripPrefix != "" && config.HasPathParams(route.Path) {
+			opts := opts
+			opts.StripPrefix = config.MatchedPrefix(route.Path, c.Path())
+			return forward(c, reqctx.Service(c), opts)
+		}
+		return forward(c, reqctx.Service(c), opts)
+	}
+}
+
+// createFallbackHandler creates the handler of the route table's fallback.
+// Its response defaults to a 404, and {path} and {method} in the body are
+// replaced by the request's, escaped for JSON and HTML bodies.
+func (r *Router) createFallbackHandler(route config.Route) fiber.Handler {
+	if route.Response == nil {
+		return r.createHandler(route)
+	}
+	status := route.Response.Status
+	if status == 0 {
+		status = fiber.StatusNotFound
+	}
+	var contentType string
+	for key, value := range route.Response.Headers {
+		if strings.EqualFold(key, fiber.HeaderContentType) {
+			contentType = value
+		}
+	}
+	escape := func(s string) string { return s }
+	switch {
+	case strings.Contains(contentType, "json"):
+		escape = func(s string) string {
+			quoted, _ := json.Marshal(s)
+			return string(quoted[1 : len(quoted)-1])
+		}
+	case strings.Contains(contentType, "html"):
+		escape = html.EscapeString
+	}
+
+	return func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, route)
+
+		for key, value := range route.Response.Headers {
+			c.Set(key, value)
+		}
+		body := strings.NewReplacer("{path}", escape(c.Path()), "{method}", escape(c.Method())).Replace(route.Response.Body)
+		return c.Status(status).SendString(body)
+	}
+}
+
+// createStaticHandler creates a handler that serves the route's fixed response
+func (r *Router) createStaticHandler(route config.Route) fiber.Handler {
+	status := route.Response.Status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	body := []byte(route.Response.Body)
+
 	return func(c *fiber.Ctx) error {
-		// Store route info in context for middleware
-		c.Locals("route", route)
-		c.Locals("isPublic", route.Public)
-		c.Locals("service", route.Service)
+		reqctx.SetRoute(c, route)
 
-		// Determine strip prefix
-		stripPrefix := ""
-		if route.StripPrefix {
-			stripPrefix = route.Path
+		for key, value := range route.Response.Headers {
+			c.Set(key, value)
 		}
+		return c.Status(status).Send(body)
+	}
+}
 
-		return r.proxy.Forward(c, route.Service, stripPrefix)
+// createRedirectHandler creates a handler that redirects to the route's target
+func (r *Router) createRedirectHandler(route config.Route) fiber.Handler {
+	status := route.Redirect.Status
+	switch status {
+	case fiber.StatusMovedPermanently, fiber.StatusFound, fiber.StatusTemporaryRedirect, fiber.StatusPermanentRedirect:
+	default:
+		status = fiber.StatusFound
+	}
+	keepsQuery := strings.Contains(route.Redirect.Target, "{query}")
+
+	return func(c *fiber.Ctx) error {
+		reqctx.SetRoute(c, route)
+
+		path := c.Path()
+		query := string(c.Request().URI().QueryString())
+		target := strings.NewReplacer(
+			"{path}", path,
+			"{rest}", strings.TrimPrefix(path, route.Path),
+			"{query}", query,
+		).Replace(route.Redirect.Target)
+
+		if !keepsQuery && query != "" {
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + query
+		}
+
+		return c.Redirect(target, status)
 	}
 }
 
 // IsPublicRoute checks if a path is a public route
 func (r *Router) IsPublicRoute(path string, method string) bool {
-	for _, route := range r.routes.Routes {
-		if matchesPath(path, route.Path) && containsMethod(route.Methods, method) {
+	t := r.table.Load()
+	for _, route := range t.routes.Routes {
+		if t.matchesPath(path, route) && containsMethod(route.Methods, method) {
 			return route.Public
 		}
 	}
@@ -113,33 +373,194 @@ func (r *Router) IsPublicRoute(path string, method string) bool {
 
 // GetRouteForPath returns the route config for a given path
 func (r *Router) GetRouteForPath(path string, method string) *config.Route {
-	for _, route := range r.routes.Routes {
-		if matchesPath(path, route.Path) && containsMethod(route.Methods, method) {
+	t := r.table.Load()
+	method = routeMethod(method)
+	for _, route := range t.routes.Routes {
+		if t.matchesPath(path, route) && containsMethod(route.Methods, method) {
 			return &route
 		}
 	}
 	return nil
 }
 
-// matchesPath checks if a request path matches a route pattern
-func matchesPath(requestPath, routePath string) bool {
-	// Exact match
-	if requestPath == routePath {
-		return true
+// HasFallback reports whether the route table's fallback serves requests
+// with method that no route matches
+func (r *Router) HasFallback(method string) bool {
+	return r.table.Load().servesFallback(method)
+}
+
+// allowOrder is the order methods are listed in Allow headers
+var allowOrder = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// AllowedMethods returns the methods some route accepts for path, in a stable
+// order, or nil when no route covers the path. HEAD is implied by GET and
+// OPTIONS is always answered by the CORS middleware.
+func (r *Router) AllowedMethods(path string) []string {
+	t := r.table.Load()
+	accepted := make(map[string]bool)
+	for _, route := range t.routes.Routes {
+		if !t.matchesPath(path, route) {
+			continue
+		}
+		for _, method := range route.Methods {
+			accepted[strings.ToUpper(method)] = true
+		}
+	}
+	if len(accepted) == 0 {
+		return nil
+	}
+	if accepted["GET"] {
+		accepted["HEAD"] = true
+	}
+	accepted["OPTIONS"] = true
+
+	methods := make([]string, 0, len(accepted))
+	for _, method := range allowOrder {
+		if accepted[method] {
+			methods = append(methods, method)
+		}
 	}
+	return methods
+}
 
-	// Prefix match (route path is prefix of request path)
-	if strings.HasPrefix(requestPath, routePath) {
-		// Make sure it's a proper prefix (followed by / or end)
-		remaining := strings.TrimPrefix(requestPath, routePath)
-		if remaining == "" || strings.HasPrefix(remaining, "/") {
+// coversPath reports whether some route accepts path, with any method
+func (t *routeTable) coversPath(path string) bool {
+	for _, route := range t.routes.Routes {
+		if len(route.Methods) > 0 && t.matchesPath(path, route) {
 			return true
 		}
 	}
-
 	return false
 }
 
+// servesFallback reports whether the table has a fallback serving method
+// (any method when it lists none)
+func (t *routeTable) servesFallback(method string) bool {
+	if t.fallback == nil {
+		return false
+	}
+	method = routeMethod(method)
+	return len(t.fallback.Methods) == 0 || containsMethod(t.fallback.Methods, method)
+}
+
+// GetRouteForRequest returns the route config matching the request's path,
+// method and header/query predicates
+func (r *Router) GetRouteForRequest(c *fiber.Ctx) *config.Route {
+	return r.table.Load().routeForRequest(c)
+}
+
+// routeForRequest returns the route matching the request's path, method and
+// header/query predicates
+func (t *routeTable) routeForRequest(c *fiber.Ctx) *config.Route {
+	path, method := c.Path(), routeMethod(c.Method())
+	for _, route := range t.routes.Routes {
+		if t.matchesPath(path, route) && containsMethod(route.Methods, method) && matchesPredicates(c, route) {
+			return &route
+		}
+	}
+	return nil
+}
+
+// legacyRouteForRequest matches the request against routes with legacy
+// normalization, using each route's normalized form of the path, for paths
+// that only match once normalized (e.g. /api//v1/users;jsessionid=...)
+func (t *routeTable) legacyRouteForRequest(c *fiber.Ctx) *config.Route {
+	method := routeMethod(c.Method())
+	for _, route := range t.routes.Routes {
+		if route.Legacy == nil {
+			continue
+		}
+		path, _ := route.Legacy.NormalizePath(c.Path())
+		if path != c.Path() && t.matchesPath(path, route) && containsMethod(route.Methods, method) && matchesPredicates(c, route) {
+			return &route
+		}
+	}
+	return nil
+}
+
+// normalizeLegacy rewrites the request path and query for a legacy route.
+// Path parameters become query parameters (unless the query already has
+// them), then legacy query parameter names are mapped to the new ones.
+func normalizeLegacy(c *fiber.Ctx, legacy *config.LegacyConfig) {
+	// c.Path aliases a buffer that setting the path overwrites
+	path, params := legacy.NormalizePath(strings.Clone(c.Path()))
+	if path != c.Path() {
+		c.Path(path)
+	}
+	if len(params) == 0 && len(legacy.QueryParams) == 0 {
+		return
+	}
+
+	uri := c.Request().URI()
+	args := uri.QueryArgs()
+	for _, param := range params {
+		if !args.Has(param.Name) {
+			args.Add(param.Name, param.Value)
+		}
+	}
+	for from, to := range legacy.QueryParams {
+		values := args.PeekMulti(from)
+		if len(values) == 0 {
+			continue
+		}
+		renamed := make([]string, len(values))
+		for i, value := range values {
+			renamed[i] = string(value)
+		}
+		args.Del(from)
+		for _, value := range renamed {
+			args.Add(to, value)
+		}
+	}
+	uri.SetQueryStringBytes(args.QueryString())
+}
+
+// matchesPredicates checks the route's header and query predicates
+func matchesPredicates(c *fiber.Ctx, route config.Route) bool {
+	for name, value := range route.Headers {
+		if c.Get(name) != value {
+			return false
+		}
+	}
+	for name, value := range route.Query {
+		if c.Query(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPath checks if a request path matches a route: its pathRegex, or
+// its path or anything below it, with :name segments matching any segment
+func (t *routeTable) matchesPath(requestPath string, route config.Route) bool {
+	_, ok := t.matchPath(requestPath, route)
+	return ok
+}
+
+// matchPath matches a request path against a route and returns the values of
+// its :name segments or named regex groups
+func (t *routeTable) matchPath(requestPath string, route config.Route) (map[string]string, bool) {
+	if route.PathRegex == "" {
+		return config.MatchPath(route.Path, requestPath)
+	}
+
+	re := t.pathRegexes[route.PathRegex]
+	match := re.FindStringSubmatch(requestPath)
+	if match == nil {
+		return nil, false
+	}
+	var params map[string]string
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = match[i]
+		}
+	}
+	return params, true
+}
+
 // containsMethod checks if a method is in the allowed methods list
 func containsMethod(methods []string, method string) bool {
 	for _, m := range methods {
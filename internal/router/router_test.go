@@ -0,0 +1,210 @@
+package router
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/proxy"
+	"github.com/minisource/gateway/internal/reqctx"
+)
+
+// staticRoute is a route answering with a fixed body
+func staticRoute(path, body string, methods ...string) config.Route {
+	return config.Route{Path: path, Methods: methods, Response: &config.StaticResponse{Body: body}}
+}
+
+func TestDispatchAndSetRoutes(t *testing.T) {
+	app := fiber.New()
+	beta := staticRoute("/api/v1/items", "beta", "GET")
+	beta.Headers = map[string]string{"X-Beta": "1"}
+	r := New(app, nil, &config.RouteConfig{Routes: []config.Route{
+		beta,
+		staticRoute("/api/v1/items", "items", "GET"),
+	}}, nil)
+	app.Use(r.Match())
+	r.SetupRoutes()
+
+	request := func(method, path string, headers map[string]string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if _, body := request("GET", "/api/v1/items/42", nil); body != "items" {
+		t.Errorf("GET = %q", body)
+	}
+	if _, body := request("GET", "/api/v1/items", map[string]string{"X-Beta": "1"}); body != "beta" {
+		t.Errorf("GET with predicate = %q", body)
+	}
+	if status, _ := request("HEAD", "/api/v1/items", nil); status != fiber.StatusOK {
+		t.Errorf("HEAD = %d", status)
+	}
+	if status, _ := request("POST", "/api/v1/items", nil); status != fiber.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", status)
+	}
+
+	r.SetRoutes(&config.RouteConfig{Routes: []config.Route{
+		staticRoute("/api/v2/items", "v2", "GET", "POST"),
+	}})
+	if _, body := request("POST", "/api/v2/items", nil); body != "v2" {
+		t.Errorf("POST after update = %q", body)
+	}
+	if status, _ := request("GET", "/api/v1/items", nil); status != fiber.StatusNotFound {
+		t.Errorf("removed route answered %d", status)
+	}
+	if len(r.Routes().Routes) != 1 {
+		t.Errorf("Routes = %v", r.Routes().Routes)
+	}
+}
+
+// HEAD requests are served by GET routes, so they must get the GET route's
+// checks too
+func TestMatchHead(t *testing.T) {
+	app := fiber.New()
+	internal := staticRoute("/internal/stats", "stats", "GET")
+	internal.InternalOnly = true
+	r := New(app, nil, &config.RouteConfig{Routes: []config.Route{internal}}, nil)
+	app.Use(r.Match(), func(c *fiber.Ctx) error {
+		if route, ok := reqctx.Route(c); ok && route.InternalOnly {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.Next()
+	})
+	r.SetupRoutes()
+
+	for _, method := range []string{"GET", "HEAD"} {
+		resp, err := app.Test(httptest.NewRequest(method, "/internal/stats", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusNotFound {
+			t.Errorf("%s = %d, want the internalOnly check", method, resp.StatusCode)
+		}
+	}
+	if r.GetRouteForPath("/internal/stats", "HEAD") == nil {
+		t.Error("GetRouteForPath found no route for HEAD")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	services := &config.ServicesConfig{Additional: map[string]config.ServiceConfig{
+		"users":   {URL: "http://users:8080"},
+		"replica": {URL: "http://replica:8080/"},
+	}}
+	beta := config.Route{Path: "/api/v1/users/:id", Service: "users", Methods: []string{"GET"}, StripPrefix: true,
+		Headers: map[string]string{"X-Beta": "1"}}
+	users := config.Route{Path: "/api/v1/users", Service: "users", ReadService: "replica", Methods: []string{"GET", "POST"},
+		Public: true, CircuitBreaker: true, Rewrite: &config.RewriteConfig{Pattern: "^/api/v1", Target: "/v1"}}
+	r := New(fiber.New(), proxy.NewServiceProxy(services, config.ProxyConfig{}), &config.RouteConfig{Routes: []config.Route{
+		staticRoute("/api/v1/users/admin", "admin", "POST"),
+		beta,
+		users,
+		{Path: "/api/v2/:tenant/notifications", Service: "users", Methods: []string{"GET"}, PrefixRewrite: "/internal/v2/"},
+		staticRoute("/api", "api", "GET"),
+	}}, nil)
+
+	exp := r.Explain(MatchRequest{Method: "GET", Path: "/api/v1/users/42?fields=name"})
+	if exp.Route == nil || exp.Index != 2 || exp.Service != "replica" || exp.Upstream != "http://replica:8080/v1/users/42?fields=name" {
+		t.Fatalf("explanation = %+v", exp)
+	}
+	if len(exp.Candidates) != 3 || exp.Candidates[0].Reason != `header X-Beta is "", want "1"` ||
+		!exp.Candidates[1].Matched || exp.Candidates[2].Reason != "route 2 matched first" {
+		t.Errorf("candidates = %+v", exp.Candidates)
+	}
+
+	exp = r.Explain(MatchRequest{Method: "get", Path: "/api/v1/users/42/orders", Headers: map[string]string{"x-beta": "1"}})
+	if exp.Index != 1 || exp.Params["id"] != "42" || exp.Upstream != "http://users:8080/orders" {
+		t.Errorf("predicate explanation = %+v", exp)
+	}
+
+	exp = r.Explain(MatchRequest{Method: "GET", Path: "/api/v2/acme/notifications/7"})
+	if exp.Upstream != "http://users:8080/internal/v2/7" {
+		t.Errorf("prefix rewrite upstream = %s", exp.Upstream)
+	}
+
+	exp = r.Explain(MatchRequest{Method: "POST", Path: "/api/v1/users/admin"})
+	if exp.Index != 0 || exp.Handler != "static" || exp.Upstream != "" {
+		t.Errorf("static explanation = %+v", exp)
+	}
+	if exp := r.Explain(MatchRequest{Method: "DELETE", Path: "/api/v1/users"}); exp.Route != nil || len(exp.Candidates) != 2 {
+		t.Errorf("unmatched explanation = %+v", exp)
+	}
+}
+
+func TestForwardOptionsExpandQuery(t *testing.T) {
+	t.Setenv("SEARCH_API_KEY", "secret")
+	route := config.Route{Path: "/search", RequestQuery: &config.QueryTransformConfig{
+		Add: map[string]string{"api_key": "${SEARCH_API_KEY}"},
+	}}
+	if got := forwardOptions(route).RequestQuery.Add["api_key"]; got != "secret" {
+		t.Errorf("api_key = %q", got)
+	}
+	if route.RequestQuery.Add["api_key"] != "${SEARCH_API_KEY}" {
+		t.Error("route changed")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	app := fiber.New()
+	r := New(app, nil, &config.RouteConfig{
+		Routes: []config.Route{staticRoute("/api/v1/items", "items", "GET")},
+		Fallback: &config.Route{Public: true, Response: &config.StaticResponse{
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    `{"error": "no_route", "path": "{path}"}`,
+		}},
+	}, nil)
+	var public bool
+	app.Use(r.Match(), func(c *fiber.Ctx) error {
+		route, ok := reqctx.Route(c)
+		public = ok && route.Public
+		return c.Next()
+	})
+	r.SetupRoutes()
+
+	request := func(method, path string) (int, string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(method, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := request("DELETE", `/docs/"x"`)
+	if status != fiber.StatusNotFound || body != `{"error": "no_route", "path": "/docs/\"x\""}` || !public {
+		t.Errorf("fallback = %d %s (public %v)", status, body, public)
+	}
+	if status, _ := request("POST", "/api/v1/items"); status != fiber.StatusMethodNotAllowed {
+		t.Errorf("covered path = %d", status)
+	}
+	if _, body := request("GET", "/api/v1/items"); body != "items" {
+		t.Errorf("route = %s", body)
+	}
+
+	r.SetRoutes(&config.RouteConfig{Fallback: &config.Route{
+		Methods:  []string{"GET"},
+		Redirect: &config.RedirectConfig{Target: "https://www.example.com{path}"},
+	}})
+	resp, err := app.Test(httptest.NewRequest("GET", "/pricing?plan=pro", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := resp.Header.Get("Location"); resp.StatusCode != fiber.StatusFound || location != "https://www.example.com/pricing?plan=pro" {
+		t.Errorf("redirect = %d %s", resp.StatusCode, location)
+	}
+	if status, _ := request("POST", "/pricing"); status != fiber.StatusNotFound {
+		t.Errorf("method the fallback doesn't serve = %d", status)
+	}
+}
@@ -0,0 +1,77 @@
+package routesource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/minisource/gateway/config"
+)
+
+// consul reads routes from the Consul KV store, waiting for changes with
+// blocking queries
+type consul struct {
+	client  *http.Client
+	address string
+	cfg     config.RouteSourceConfig
+}
+
+// consulPair is an entry of a KV read; Value is base64 in JSON, which
+// []byte decodes
+type consulPair struct {
+	Key   string
+	Value []byte
+}
+
+func (c *consul) read(ctx context.Context, index uint64) ([]config.RouteDocument, uint64, error) {
+	query := url.Values{}
+	if prefix(c.cfg) {
+		query.Set("recurse", "true")
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(c.cfg.Wait.Seconds())))
+	}
+	target := c.address + "/v1/kv/" + strings.TrimPrefix(c.cfg.Key, "/") + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", c.cfg.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// The key doesn't exist (yet)
+		return nil, next, nil
+	default:
+		return nil, 0, fmt.Errorf("consul: %w", errStatus(resp))
+	}
+
+	var pairs []consulPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, fmt.Errorf("consul: %w", err)
+	}
+	// Consul lists keys in order; folder entries have no value
+	docs := make([]config.RouteDocument, 0, len(pairs))
+	for _, pair := range pairs {
+		if strings.HasSuffix(pair.Key, "/") || len(pair.Value) == 0 {
+			continue
+		}
+		docs = append(docs, document(c.cfg, pair.Key, pair.Value))
+	}
+	return docs, next, nil
+}
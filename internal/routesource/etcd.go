@@ -0,0 +1,176 @@
+package routesource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/minisource/gateway/config"
+)
+
+// etcd reads routes from etcd through its v3 JSON gateway, waiting for
+// changes with watches
+type etcd struct {
+	client  *http.Client
+	address string
+	cfg     config.RouteSourceConfig
+}
+
+// etcdKeyRange selects the key, or every key with the prefix. Keys are
+// base64 in JSON, which []byte encodes.
+type etcdKeyRange struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	Kvs []struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Events   []json.RawMessage `json:"events"`
+		Canceled bool              `json:"canceled"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e *etcd) read(ctx context.Context, index uint64) ([]config.RouteDocument, uint64, error) {
+	if index > 0 {
+		changed, err := e.watch(ctx, index)
+		if err != nil || !changed {
+			return nil, index, err
+		}
+	}
+
+	var resp etcdRangeResponse
+	if err := e.post(ctx, "/v3/kv/range", e.keyRange(), &resp); err != nil {
+		return nil, 0, err
+	}
+	revision, _ := strconv.ParseUint(resp.Header.Revision, 10, 64)
+
+	// Ranges are returned in key order
+	docs := make([]config.RouteDocument, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if len(kv.Value) > 0 {
+			docs = append(docs, document(e.cfg, string(kv.Key), kv.Value))
+		}
+	}
+	return docs, revision, nil
+}
+
+// watch waits up to the wait time for a change to the keys after revision
+func (e *etcd) watch(ctx context.Context, revision uint64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Wait)
+	defer cancel()
+
+	create := struct {
+		etcdKeyRange
+		StartRevision string `json:"start_revision"`
+	}{e.keyRange(), strconv.FormatUint(revision+1, 10)}
+	body, err := json.Marshal(map[string]any{"create_request": create})
+	if err != nil {
+		return false, err
+	}
+	resp, err := e.do(ctx, "/v3/watch", body)
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, context.DeadlineExceeded) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// The response streams one message per batch of events, starting with
+	// the confirmation that the watch was created
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchResponse
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return false, nil
+			}
+			return false, fmt.Errorf("etcd: watch: %w", err)
+		}
+		if msg.Error != nil {
+			return false, fmt.Errorf("etcd: watch: %s", msg.Error.Message)
+		}
+		// A canceled watch (e.g. the revision was compacted) is followed by
+		// a full read
+		if len(msg.Result.Events) > 0 || msg.Result.Canceled {
+			return true, nil
+		}
+	}
+}
+
+// keyRange returns the configured key, or its prefix range
+func (e *etcd) keyRange() etcdKeyRange {
+	r := etcdKeyRange{Key: []byte(e.cfg.Key)}
+	if prefix(e.cfg) {
+		r.RangeEnd = prefixEnd(r.Key)
+	}
+	return r
+}
+
+// prefixEnd returns the end of the range of keys starting with prefix
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every byte is 0xff: the range extends to the last key
+	return []byte{0}
+}
+
+// post sends a JSON request and decodes the response into out
+func (e *etcd) post(ctx context.Context, path string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("etcd: %w", err)
+	}
+	return nil
+}
+
+// do posts body to path and checks the response status
+func (e *etcd) do(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.cfg.Token != "" {
+		req.Header.Set("Authorization", e.cfg.Token)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("etcd: %w", errStatus(resp))
+	}
+	return resp, nil
+}
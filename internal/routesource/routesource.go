@@ -0,0 +1,174 @@
+// Package routesource reads the route table from a key-value store (Consul
+// or etcd) and watches it for changes, so a fleet of gateways converges on
+// the same routes without redeploys.
+//
+// A key holds a route document in YAML, JSON or TOML. A key ending in /
+// is a prefix: the keys below it are merged in key order, like the files of
+// a route directory.
+package routesource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+// Source types besides the route files
+const (
+	TypeConsul = "consul"
+	TypeEtcd   = "etcd"
+)
+
+// backend reads route documents from a key-value store
+type backend interface {
+	// read returns the documents under the key and the index they are at.
+	// With a non-zero index it first waits up to the wait time for a change
+	// past that index; an unchanged index means nothing changed.
+	read(ctx context.Context, index uint64) ([]config.RouteDocument, uint64, error)
+}
+
+// Source is a route table kept in a key-value store
+type Source struct {
+	cfg     config.RouteSourceConfig
+	backend backend
+
+	// index and docs are those of the route table last loaded
+	index uint64
+	docs  []config.RouteDocument
+}
+
+// New creates a source for a consul or etcd configuration
+func New(cfg config.RouteSourceConfig) (*Source, error) {
+	if cfg.Address == "" || cfg.Key == "" {
+		return nil, fmt.Errorf("%s route source needs an address and a key", cfg.Type)
+	}
+	if cfg.Wait <= 0 {
+		cfg.Wait = 5 * time.Minute
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 5 * time.Second
+	}
+
+	// Blocking reads are held open for up to the wait time, plus the
+	// server's own jitter
+	client := &http.Client{Timeout: cfg.Wait + cfg.Wait/16 + 10*time.Second}
+	address := strings.TrimSuffix(cfg.Address, "/")
+
+	s := &Source{cfg: cfg}
+	switch cfg.Type {
+	case TypeConsul:
+		s.backend = &consul{client: client, address: address, cfg: cfg}
+	case TypeEtcd:
+		s.backend = &etcd{client: client, address: address, cfg: cfg}
+	default:
+		return nil, fmt.Errorf("unknown route source %q", cfg.Type)
+	}
+	return s, nil
+}
+
+// Name identifies the source in logs and metrics
+func (s *Source) Name() string {
+	return s.cfg.Type
+}
+
+// Load reads the current route table
+func (s *Source) Load(ctx context.Context) (*config.RouteConfig, error) {
+	docs, index, err := s.backend.read(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := s.parse(docs)
+	if err != nil {
+		return nil, err
+	}
+	s.index, s.docs = index, docs
+	return routes, nil
+}
+
+// Watch calls apply with the new route table whenever it changes, until
+// ctx is done. Read errors and invalid route tables are passed to onError;
+// the routes in effect are kept until a valid table is read. When Load
+// failed, the first read doesn't wait for a change.
+func (s *Source) Watch(ctx context.Context, apply func(*config.RouteConfig), onError func(error)) {
+	for {
+		docs, index, err := s.backend.read(ctx, s.index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			onError(err)
+			select {
+			case <-time.After(s.cfg.RetryInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if index < s.index {
+			// The store's index went backwards (e.g. restored from a
+			// snapshot); start over from a plain read
+			index = 0
+		}
+		if index == s.index || sameDocuments(docs, s.docs) {
+			s.index = index
+			continue
+		}
+
+		s.index, s.docs = index, docs
+		routes, err := s.parse(docs)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		apply(routes)
+	}
+}
+
+// parse merges the documents of the key into a route table
+func (s *Source) parse(docs []config.RouteDocument) (*config.RouteConfig, error) {
+	if len(docs) == 0 {
+		// Never drop every route because a key was deleted or mistyped
+		return nil, fmt.Errorf("%s: no routes at %s", s.cfg.Type, s.cfg.Key)
+	}
+	return config.ParseRoutes(docs)
+}
+
+// document returns the route document of a key
+func document(cfg config.RouteSourceConfig, key string, value []byte) config.RouteDocument {
+	format := config.RouteFormat(key)
+	if format == "" {
+		format = cfg.Format
+	}
+	return config.RouteDocument{Name: cfg.Type + ":" + key, Format: format, Data: value}
+}
+
+// prefix reports whether the configured key is a prefix
+func prefix(cfg config.RouteSourceConfig) bool {
+	return strings.HasSuffix(cfg.Key, "/")
+}
+
+// sameDocuments reports whether two reads returned the same documents
+func sameDocuments(a, b []config.RouteDocument) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || !bytes.Equal(a[i].Data, b[i].Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// errStatus describes an unexpected response status
+func errStatus(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return errors.New(strings.TrimSpace(fmt.Sprintf("%s: %s", resp.Status, body)))
+}
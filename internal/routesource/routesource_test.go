@@ -0,0 +1,239 @@
+package routesource
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+// fakeKV is a key-value store whose index grows with every write
+type fakeKV struct {
+	mu      sync.Mutex
+	index   uint64
+	values  map[string]string
+	changed chan struct{}
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{index: 1, values: make(map[string]string), changed: make(chan struct{})}
+}
+
+func (kv *fakeKV) put(key, value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.index++
+	kv.values[key] = value
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+// waitPast blocks until the index is past index or the wait elapses
+func (kv *fakeKV) waitPast(ctx context.Context, index uint64, wait time.Duration) {
+	kv.mu.Lock()
+	current, changed := kv.index, kv.changed
+	kv.mu.Unlock()
+	if current > index {
+		return
+	}
+	select {
+	case <-changed:
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+}
+
+// snapshot returns the index and the keys starting with prefix, in order
+func (kv *fakeKV) snapshot(prefix string) (uint64, [][2]string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	var pairs [][2]string
+	for key, value := range kv.values {
+		if strings.HasPrefix(key, prefix) {
+			pairs = append(pairs, [2]string{key, value})
+		}
+	}
+	for i := range pairs {
+		for j := i + 1; j < len(pairs); j++ {
+			if pairs[j][0] < pairs[i][0] {
+				pairs[i], pairs[j] = pairs[j], pairs[i]
+			}
+		}
+	}
+	return kv.index, pairs
+}
+
+// consulServer serves the KV endpoint with blocking queries
+func consulServer(t *testing.T, kv *fakeKV) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 {
+			kv.waitPast(r.Context(), index, 200*time.Millisecond)
+		}
+
+		index, pairs := kv.snapshot(key)
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		var out []map[string]any
+		for _, pair := range pairs {
+			if r.URL.Query().Get("recurse") == "" && pair[0] != key {
+				continue
+			}
+			out = append(out, map[string]any{"Key": pair[0], "Value": []byte(pair[1])})
+		}
+		if len(out) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+}
+
+// etcdServer serves the range and watch endpoints of the JSON gateway
+func etcdServer(t *testing.T, kv *fakeKV) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			var req etcdKeyRange
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			index, pairs := kv.snapshot(string(req.Key))
+			var kvs []map[string]string
+			for _, pair := range pairs {
+				if req.RangeEnd == nil && pair[0] != string(req.Key) {
+					continue
+				}
+				kvs = append(kvs, map[string]string{
+					"key":   base64.StdEncoding.EncodeToString([]byte(pair[0])),
+					"value": base64.StdEncoding.EncodeToString([]byte(pair[1])),
+				})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"header": map[string]string{"revision": strconv.FormatUint(index, 10)},
+				"kvs":    kvs,
+			})
+		case "/v3/watch":
+			var req struct {
+				CreateRequest struct {
+					StartRevision string `json:"start_revision"`
+				} `json:"create_request"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			start, _ := strconv.ParseUint(req.CreateRequest.StartRevision, 10, 64)
+
+			_, _ = w.Write([]byte(`{"result":{"created":true}}` + "\n"))
+			w.(http.Flusher).Flush()
+			kv.waitPast(r.Context(), start-1, time.Minute)
+			_, _ = w.Write([]byte(`{"result":{"events":[{"type":"PUT"}]}}` + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+const ordersRoutes = "routes:\n  - path: /api/v1/orders\n    service: orders\n    methods: [GET]\n"
+
+func TestSources(t *testing.T) {
+	for _, tt := range []struct {
+		typ    string
+		server func(*testing.T, *fakeKV) *httptest.Server
+	}{
+		{TypeConsul, consulServer},
+		{TypeEtcd, etcdServer},
+	} {
+		t.Run(tt.typ, func(t *testing.T) {
+			kv := newFakeKV()
+			kv.put("gateway/routes/10-orders.yaml", ordersRoutes)
+			kv.put("gateway/routes/20-carts", `{"routes": [{"path": "/api/v1/carts", "service": "orders", "methods": ["GET"]}]}`)
+			kv.put("other", "routes: [")
+			server := tt.server(t, kv)
+			defer server.Close()
+
+			source, err := New(config.RouteSourceConfig{
+				Type:          tt.typ,
+				Address:       server.URL,
+				Key:           "gateway/routes/",
+				Token:         "secret",
+				Format:        "json",
+				Wait:          time.Second,
+				RetryInterval: 10 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			routes, err := source.Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(routes.Routes) != 2 {
+				t.Fatalf("loaded %d routes", len(routes.Routes))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			applied := make(chan *config.RouteConfig, 1)
+			failed := make(chan error, 1)
+			go source.Watch(ctx, func(routes *config.RouteConfig) { applied <- routes }, func(err error) { failed <- err })
+
+			// An invalid table is reported and skipped
+			kv.put("gateway/routes/10-orders.yaml", "routes:\n  - path: /api/v1/orders\n    service: orders\n    methods: [GET]\n    cache:\n      ttl: soon\n")
+			select {
+			case <-failed:
+			case routes := <-applied:
+				t.Fatalf("invalid routes applied: %v", routes.Routes)
+			case <-time.After(5 * time.Second):
+				t.Fatal("invalid routes not reported")
+			}
+
+			expectRoutes := func(n int) {
+				t.Helper()
+				select {
+				case routes := <-applied:
+					if len(routes.Routes) != n {
+						t.Errorf("applied %d routes, want %d", len(routes.Routes), n)
+					}
+				case err := <-failed:
+					t.Fatal(err)
+				case <-time.After(5 * time.Second):
+					t.Fatal("change not applied")
+				}
+			}
+			kv.put("gateway/routes/10-orders.yaml", ordersRoutes)
+			expectRoutes(2)
+			kv.put("gateway/routes/30-users.toml", "[[routes]]\npath = \"/api/v1/users\"\nservice = \"users\"\nmethods = [\"GET\"]\n")
+			expectRoutes(3)
+		})
+	}
+}
+
+func TestConsulMissingKey(t *testing.T) {
+	server := consulServer(t, newFakeKV())
+	defer server.Close()
+
+	source, err := New(config.RouteSourceConfig{Type: TypeConsul, Address: server.URL, Key: "gateway/routes", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "no routes") {
+		t.Errorf("Load = %v", err)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	if got := string(prefixEnd([]byte("gateway/routes/"))); got != "gateway/routes0" {
+		t.Errorf("prefixEnd = %q", got)
+	}
+	if got := prefixEnd([]byte{'a', 0xff}); string(got) != "b" {
+		t.Errorf("prefixEnd = %q", got)
+	}
+}
@@ -0,0 +1,588 @@
+// Package schema validates JSON documents against JSON Schema.
+//
+// It implements the validation keywords request bodies need (type, enum,
+// const, properties, required, additionalProperties, patternProperties,
+// items, the length, size and range limits, pattern, format, allOf, anyOf,
+// oneOf, not and local $ref) plus OpenAPI 3.0's nullable and boolean
+// exclusiveMinimum/exclusiveMaximum, so the schemas of an OpenAPI document's
+// components can be used as they are. Other keywords are ignored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a place where a document doesn't match its schema
+type Error struct {
+	// Path is the JSON pointer (RFC 6901) of the offending value; "" is
+	// the whole document
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) String() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Schema is a compiled schema
+type Schema struct {
+	root any
+	node any
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// Load reads the schema ref names: a JSON or YAML file, relative to dir
+// unless absolute, optionally followed by a #fragment JSON pointer to the
+// schema within it (e.g. openapi.yaml#/components/schemas/Order)
+func Load(dir, ref string) (*Schema, error) {
+	file, pointer, _ := strings.Cut(ref, "#")
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		// Round-trip through JSON so YAML documents decode like JSON ones
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if err := Decode(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	s, err := New(doc, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ref, err)
+	}
+	return s, nil
+}
+
+// New compiles the schema at pointer ("" for the whole document) in doc, a
+// document decoded by Decode
+func New(doc any, pointer string) (*Schema, error) {
+	node, ok := resolve(doc, pointer)
+	if !ok {
+		return nil, fmt.Errorf("no schema at #%s", pointer)
+	}
+	s := &Schema{root: doc, node: node, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.check(node, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Decode decodes a JSON document the way Validate expects, keeping numbers
+// exact. Trailing data after the document is an error.
+func Decode(data []byte, v *any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err == nil {
+		return fmt.Errorf("unexpected data after the JSON document")
+	}
+	return nil
+}
+
+// check verifies that the $refs and patterns reachable from node resolve
+// and compile, so a broken schema fails to load rather than per request
+func (s *Schema) check(node any, seen map[string]bool) error {
+	switch n := node.(type) {
+	case map[string]any:
+		if ref, ok := n["$ref"].(string); ok {
+			if seen[ref] {
+				return nil
+			}
+			seen[ref] = true
+			target, err := s.ref(ref)
+			if err != nil {
+				return err
+			}
+			if err := s.check(target, seen); err != nil {
+				return err
+			}
+		}
+		if pattern, ok := n["pattern"].(string); ok {
+			if _, err := s.pattern(pattern); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(n)) {
+			if key == "enum" || key == "const" || key == "default" || key == "example" || key == "examples" {
+				continue
+			}
+			if key == "patternProperties" {
+				if props, ok := n[key].(map[string]any); ok {
+					for pattern := range props {
+						if _, err := s.pattern(pattern); err != nil {
+							return fmt.Errorf("invalid patternProperties pattern %q: %w", pattern, err)
+						}
+					}
+				}
+			}
+			if err := s.check(n[key], seen); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range n {
+			if err := s.check(item, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ref resolves a local $ref
+func (s *Schema) ref(ref string) (any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q: only references within the document (#/...) are supported", ref)
+	}
+	target, ok := resolve(s.root, pointer)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return target, nil
+}
+
+// pattern returns a compiled pattern
+func (s *Schema) pattern(pattern string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if re, ok := s.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns[pattern] = re
+	return re, nil
+}
+
+// Validate returns where value, decoded by Decode, doesn't match the schema
+func (s *Schema) Validate(value any) []Error {
+	return s.validate(s.node, value, "")
+}
+
+func (s *Schema) validate(node, value any, path string) []Error {
+	schema, ok := node.(map[string]any)
+	if !ok {
+		// Boolean schemas: true accepts anything, false nothing
+		if node == false {
+			return []Error{{path, "is not allowed"}}
+		}
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		// $ref siblings are ignored, as in OpenAPI 3.0
+		target, err := s.ref(ref)
+		if err != nil {
+			return []Error{{path, err.Error()}}
+		}
+		return s.validate(target, value, path)
+	}
+
+	if value == nil && schema["nullable"] == true {
+		return nil
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(value, t) }) {
+		return []Error{{path, "must be " + article(types)}}
+	}
+
+	var errs []Error
+	fail := func(format string, args ...any) {
+		errs = append(errs, Error{path, fmt.Sprintf(format, args...)})
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(v any) bool { return equal(v, value) }) {
+		fail("must be one of %s", listValues(enum))
+	}
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		fail("must be %s", jsonString(c))
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n, ok := integer(schema["minLength"]); ok && length < n {
+			fail("must be at least %d characters", n)
+		}
+		if n, ok := integer(schema["maxLength"]); ok && length > n {
+			fail("must be at most %d characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := s.pattern(pattern); err == nil && !re.MatchString(v) {
+				fail("must match %s", pattern)
+			}
+		}
+		if format, ok := schema["format"].(string); ok && !validFormat(format, v) {
+			fail("must be a valid %s", format)
+		}
+	case json.Number:
+		errs = append(errs, checkNumber(schema, v, path)...)
+	case []any:
+		if n, ok := integer(schema["minItems"]); ok && len(v) < n {
+			fail("must have at least %d items", n)
+		}
+		if n, ok := integer(schema["maxItems"]); ok && len(v) > n {
+			fail("must have at most %d items", n)
+		}
+		if schema["uniqueItems"] == true {
+			for i := range v {
+				if slices.ContainsFunc(v[:i], func(prev any) bool { return equal(prev, v[i]) }) {
+					fail("items must be unique")
+					break
+				}
+			}
+		}
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				errs = append(errs, s.validate(items, item, path+"/"+strconv.Itoa(i))...)
+			}
+		}
+	case map[string]any:
+		errs = append(errs, s.validateObject(schema, v, path)...)
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			errs = append(errs, s.validate(sub, value, path)...)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && s.matching(anyOf, value, path) == 0 {
+		fail("must match at least one of the allowed schemas")
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		if n := s.matching(oneOf, value, path); n != 1 {
+			fail("must match exactly one of the allowed schemas, matches %d", n)
+		}
+	}
+	if not, ok := schema["not"]; ok && len(s.validate(not, value, path)) == 0 {
+		fail("must not match the disallowed schema")
+	}
+	return errs
+}
+
+// validateObject checks the object keywords
+func (s *Schema) validateObject(schema map[string]any, object map[string]any, path string) []Error {
+	var errs []Error
+	if n, ok := integer(schema["minProperties"]); ok && len(object) < n {
+		errs = append(errs, Error{path, fmt.Sprintf("must have at least %d properties", n)})
+	}
+	if n, ok := integer(schema["maxProperties"]); ok && len(object) > n {
+		errs = append(errs, Error{path, fmt.Sprintf("must have at most %d properties", n)})
+	}
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := object[name]; !present {
+					errs = append(errs, Error{path + "/" + escape(name), "is required"})
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	patterns, _ := schema["patternProperties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range slices.Sorted(maps.Keys(object)) {
+		value, at := object[name], path+"/"+escape(name)
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			errs = append(errs, s.validate(sub, value, at)...)
+		}
+		for _, pattern := range slices.Sorted(maps.Keys(patterns)) {
+			if re, err := s.pattern(pattern); err == nil && re.MatchString(name) {
+				matched = true
+				errs = append(errs, s.validate(patterns[pattern], value, at)...)
+			}
+		}
+		if !matched && hasAdditional {
+			errs = append(errs, s.validate(additional, value, at)...)
+		}
+	}
+	return errs
+}
+
+// matching counts the schemas value matches
+func (s *Schema) matching(schemas []any, value any, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(s.validate(sub, value, path)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// checkNumber checks the numeric keywords
+func checkNumber(schema map[string]any, n json.Number, path string) []Error {
+	v, err := n.Float64()
+	if err != nil {
+		return []Error{{path, "must be a number"}}
+	}
+	var errs []Error
+	fail := func(format string, args ...any) {
+		errs = append(errs, Error{path, fmt.Sprintf(format, args...)})
+	}
+	// OpenAPI 3.0 spells exclusive limits as booleans next to minimum and
+	// maximum; JSON Schema as the limits themselves
+	if min, ok := number(schema["minimum"]); ok {
+		if schema["exclusiveMinimum"] == true && v <= min {
+			fail("must be greater than %s", formatNumber(min))
+		} else if v < min {
+			fail("must be at least %s", formatNumber(min))
+		}
+	}
+	if max, ok := number(schema["maximum"]); ok {
+		if schema["exclusiveMaximum"] == true && v >= max {
+			fail("must be less than %s", formatNumber(max))
+		} else if v > max {
+			fail("must be at most %s", formatNumber(max))
+		}
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && v <= min {
+		fail("must be greater than %s", formatNumber(min))
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && v >= max {
+		fail("must be less than %s", formatNumber(max))
+	}
+	if m, ok := number(schema["multipleOf"]); ok && m > 0 {
+		if q := v / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %s", formatNumber(m))
+		}
+	}
+	return errs
+}
+
+// schemaTypes returns the types a schema's type keyword allows
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType reports whether value is of the JSON Schema type t
+func hasType(value any, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		if t != "integer" {
+			return false
+		}
+		if _, err := v.Int64(); err == nil {
+			return true
+		}
+		f, err := v.Float64()
+		return err == nil && f == math.Trunc(f)
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
+
+// article names the allowed types, e.g. "a string or null"
+func article(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		switch t {
+		case "null":
+			names[i] = "null"
+		case "array", "integer", "object":
+			names[i] = "an " + t
+		default:
+			names[i] = "a " + t
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// validFormat checks the formats worth enforcing; others are accepted
+func validFormat(format, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, v)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(v)
+		return err == nil && addr.Address == v
+	case "uuid":
+		return uuidPattern.MatchString(v)
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	case "ipv4":
+		addr, err := netip.ParseAddr(v)
+		return err == nil && addr.Is4()
+	case "ipv6":
+		addr, err := netip.ParseAddr(v)
+		return err == nil && addr.Is6()
+	}
+	return true
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// equal compares JSON values, numbers by value
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, equal)
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// number returns a numeric schema value or instance
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// integer returns a non-negative integer schema value
+func integer(v any) (int, bool) {
+	f, ok := number(v)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// listValues formats enum values for a message
+func listValues(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = jsonString(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func jsonString(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// resolve follows a JSON pointer ("" is the document itself)
+func resolve(doc any, pointer string) (any, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+	node := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		switch n := node.(type) {
+		case map[string]any:
+			next, ok := n[token]
+			if !ok {
+				return nil, false
+			}
+			node = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// escape escapes a JSON pointer token
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var doc any
+	if err := Decode([]byte(`{
+		"type": "object",
+		"required": ["name", "items"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"email": {"type": "string", "format": "email"},
+			"status": {"enum": ["open", "closed"]},
+			"note": {"type": "string", "nullable": true},
+			"discount": {"type": "number", "minimum": 0, "maximum": 1, "exclusiveMaximum": true},
+			"items": {"type": "array", "minItems": 1, "uniqueItems": true, "items": {"$ref": "#/$defs/item"}},
+			"contact": {"oneOf": [{"required": ["email"]}, {"required": ["phone"]}]}
+		},
+		"$defs": {
+			"item": {"type": "object", "required": ["quantity"], "properties": {"quantity": {"type": "integer", "minimum": 1}}}
+		}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"valid", `{"name": "acme", "items": [{"quantity": 2}], "note": null, "discount": 0.5, "contact": {"email": "a@b.c"}}`, nil},
+		{"not an object", `[]`, []string{": must be an object"}},
+		{"missing", `{"items": [{"quantity": 1}]}`, []string{"/name: is required"}},
+		{"unknown property", `{"name": "acme", "items": [{"quantity": 1}], "admin": true}`, []string{"/admin: is not allowed"}},
+		{"string limits", `{"name": "A", "items": [{"quantity": 1}]}`, []string{"/name: must be at least 2 characters", "/name: must match ^[a-z]+$"}},
+		{"format and enum", `{"name": "acme", "items": [{"quantity": 1}], "email": "nope", "status": "lost"}`,
+			[]string{"/email: must be a valid email", `/status: must be one of "open", "closed"`}},
+		{"exclusive maximum", `{"name": "acme", "items": [{"quantity": 1}], "discount": 1}`, []string{"/discount: must be less than 1"}},
+		{"nested $ref", `{"name": "acme", "items": [{"quantity": 1.5}, {}]}`, []string{"/items/0/quantity: must be an integer", "/items/1/quantity: is required"}},
+		{"unique items", `{"name": "acme", "items": [{"quantity": 1}, {"quantity": 1.0}]}`, []string{"/items: items must be unique"}},
+		{"one of", `{"name": "acme", "items": [{"quantity": 1}], "contact": {"email": "a@b.c", "phone": "1"}}`,
+			[]string{"/contact: must match exactly one of the allowed schemas, matches 2"}},
+	} {
+		var body any
+		if err := Decode([]byte(tc.body), &body); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range s.Validate(body) {
+			got = append(got, e.Path+": "+e.Message)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	openapi := `openapi: 3.0.3
+components:
+  schemas:
+    Order:
+      type: object
+      properties:
+        customer: {$ref: '#/components/schemas/Customer'}
+    Customer:
+      type: object
+      required: [id]
+    Broken:
+      $ref: '#/components/schemas/Missing'
+`
+	if err := os.WriteFile(filepath.Join(dir, "openapi.yaml"), []byte(openapi), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(dir, "openapi.yaml#/components/schemas/Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body any
+	_ = Decode([]byte(`{"customer": {}}`), &body)
+	if errs := s.Validate(body); len(errs) != 1 || errs[0].Path != "/customer/id" {
+		t.Errorf("errors = %v", errs)
+	}
+
+	for _, ref := range []string{"openapi.yaml#/components/schemas/Broken", "openapi.yaml#/components/schemas/Nope", "missing.json"} {
+		if _, err := Load(dir, ref); err == nil {
+			t.Errorf("%s loaded", ref)
+		}
+	}
+}
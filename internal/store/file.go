@@ -0,0 +1,146 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File is an in-memory store persisted to a file, for single-node
+// deployments that want state to survive restarts without running Redis.
+// The file is rewritten every flush interval and on Close, so a crash loses
+// at most one interval of changes.
+type File struct {
+	*Memory
+	path string
+
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// fileEntry is the persisted form of a memoryEntry
+type fileEntry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// OpenFile loads the store from path, which may not exist yet, and starts
+// flushing it every flushInterval (default 30s)
+func OpenFile(path string, flushInterval, sweepInterval time.Duration) (*File, error) {
+	if path == "" {
+		return nil, errors.New("file store needs a path")
+	}
+	if flushInterval <= 0 {
+		flushInterval = 30 * time.Second
+	}
+
+	f := &File{
+		Memory: NewMemory(sweepInterval),
+		path:   path,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := f.load(); err != nil {
+		f.Memory.Close()
+		return nil, err
+	}
+	go f.flushEvery(flushInterval)
+	return f, nil
+}
+
+// Flush writes the entries to the file
+func (f *File) Flush() error {
+	f.flushMu.Lock()
+	defer f.flushMu.Unlock()
+
+	now := time.Now()
+	f.mu.RLock()
+	entries := make(map[string]fileEntry, len(f.entries))
+	for key, e := range f.entries {
+		if !e.expired(now) {
+			entries[key] = fileEntry{Value: e.value, Expires: e.expires}
+		}
+	}
+	f.mu.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a torn file
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".store-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Close stops the periodic flush and writes the file a last time
+func (f *File) Close() error {
+	select {
+	case <-f.stop:
+		return nil
+	default:
+	}
+	close(f.stop)
+	<-f.done
+	f.Memory.Close()
+	return f.Flush()
+}
+
+// load reads the entries from the file, skipping expired ones
+func (f *File) load() error {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries map[string]fileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, e := range entries {
+		entry := memoryEntry{value: e.Value, expires: e.Expires}
+		if !entry.expired(now) {
+			f.entries[key] = entry
+		}
+	}
+	return nil
+}
+
+// flushEvery writes the file periodically until Close
+func (f *File) flushEvery(interval time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Errors are retried on the next tick and surface on Close
+			_ = f.Flush()
+		case <-f.stop:
+			return
+		}
+	}
+}
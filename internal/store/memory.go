@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory keeps entries in process, sweeping expired ones periodically
+type Memory struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memoryEntry struct {
+	value []byte
+	// expires is zero for entries without a ttl
+	expires time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// NewMemory creates an in-memory store
+func NewMemory(sweepInterval time.Duration) *Memory {
+	m := &Memory{
+		entries: make(map[string]memoryEntry),
+		stop:    make(chan struct{}),
+	}
+	go m.sweep(sweepInterval)
+	return m
+}
+
+// Get implements KV
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	e, ok := m.entries[key]
+	m.mu.RUnlock()
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set implements KV
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	m.entries[key] = memoryEntry{value: value, expires: expiry(ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete implements KV
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// Incr implements KV. Counters are stored in decimal like in Redis.
+func (m *Memory) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || e.expired(time.Now()) {
+		e = memoryEntry{expires: expiry(ttl)}
+	}
+	var n int64
+	if e.value != nil {
+		var err error
+		if n, err = strconv.ParseInt(string(e.value), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	e.value = strconv.AppendInt(nil, n, 10)
+	m.entries[key] = e
+	return n, nil
+}
+
+// Close stops the sweeper
+func (m *Memory) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
+	return nil
+}
+
+// sweep periodically removes expired entries
+func (m *Memory) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+
+		now := time.Now()
+		m.mu.Lock()
+		for key, e := range m.entries {
+			if e.expired(now) {
+				delete(m.entries, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// expiry returns the expiry time of a ttl, zero for none
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
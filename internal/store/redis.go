@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keeps entries in Redis, shared by all gateway instances
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis creates a store using client; closing the store closes the client
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// Get implements KV
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Set implements KV
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, max(ttl, 0)).Err()
+}
+
+// Delete implements KV
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+// incrScript increments a counter, setting its expiry when it is created
+var incrScript = redis.NewScript(`
+	local n = redis.call('INCR', KEYS[1])
+	if n == 1 and tonumber(ARGV[1]) > 0 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	end
+	return n
+`)
+
+// Incr implements KV
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+// Close closes the client
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+// takeScript is a token bucket refilled per second
+var takeScript = redis.NewScript(`
+	local key = KEYS[1]
+	local rate = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local window = 1
+
+	local data = redis.call('HMGET', key, 'tokens', 'last')
+	local tokens = tonumber(data[1]) or burst
+	local last = tonumber(data[2]) or now
+
+	local elapsed = now - last
+	tokens = math.min(burst, tokens + (elapsed * rate))
+
+	local allowed = 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	end
+
+	redis.call('HMSET', key, 'tokens', tokens, 'last', now)
+	redis.call('EXPIRE', key, window * 2)
+
+	return {allowed, math.floor(tokens), now + (1 / rate)}
+`)
+
+// Take implements TokenBucket
+func (r *Redis) Take(ctx context.Context, key string, rate, burst int) (bool, int, int64, error) {
+	result, err := takeScript.Run(ctx, r.client, []string{key}, rate, burst, time.Now().Unix()).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return result[0] == 1, int(result[1]), result[2], nil
+}
+
+// FixedWindow implements RateWindows with a counter per window
+func (r *Redis) FixedWindow(ctx context.Context, key string, limit int, window time.Duration) (bool, int, int64, error) {
+	start := time.Now().Truncate(window)
+	n, err := r.Incr(ctx, fmt.Sprintf("%s:%d", key, start.UnixMilli()), window)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return n <= int64(limit), max(limit-int(n), 0), start.Add(window).Unix(), nil
+}
+
+// slidingScript logs requests in a sorted set scored by their time in
+// microseconds, dropping those out of the window. Timestamps are formatted
+// with %d as Lua would print them in exponent notation.
+var slidingScript = redis.NewScript(`
+	local key = KEYS[1]
+	local limit = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', string.format('%d', now - window))
+	local count = redis.call('ZCARD', key)
+
+	local allowed = 0
+	if count < limit then
+		redis.call('ZADD', key, ARGV[3], ARGV[4])
+		count = count + 1
+		allowed = 1
+	end
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+
+	local reset = now + window
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window
+	end
+	return {allowed, limit - count, reset}
+`)
+
+// SlidingWindow implements RateWindows
+func (r *Redis) SlidingWindow(ctx context.Context, key string, limit int, window time.Duration) (bool, int, int64, error) {
+	result, err := slidingScript.Run(ctx, r.client, []string{key}, limit, window.Microseconds(), time.Now().UnixMicro(), uuid.NewString()).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return result[0] == 1, int(result[1]), time.UnixMicro(result[2]).Unix(), nil
+}
+
+// gcraScript keeps the theoretical arrival time of the next request, in
+// microseconds
+var gcraScript = redis.NewScript(`
+	local key = KEYS[1]
+	local interval = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+
+	local tat = math.max(tonumber(redis.call('GET', key)) or now, now)
+	local allowAt = tat + interval - burst * interval
+	if now < allowAt then
+		return {0, 0, allowAt}
+	end
+
+	tat = tat + interval
+	redis.call('SET', key, string.format('%d', tat), 'PX', math.ceil((tat - now) / 1000))
+	return {1, math.floor((now - allowAt) / interval), now + interval}
+`)
+
+// GCRA implements RateWindows
+func (r *Redis) GCRA(ctx context.Context, key string, rate, burst int) (bool, int, int64, error) {
+	interval := (time.Second / time.Duration(rate)).Microseconds()
+	result, err := gcraScript.Run(ctx, r.client, []string{key}, interval, burst, time.Now().UnixMicro()).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return result[0] == 1, int(result[1]), time.UnixMicro(result[2]).Unix(), nil
+}
+
+// acquireScript keeps the slots of a semaphore in a sorted set scored by
+// when they expire, in milliseconds, so the slots of stopped instances are
+// freed
+var acquireScript = redis.NewScript(`
+	local key = KEYS[1]
+	local limit = tonumber(ARGV[1])
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[2])
+	if redis.call('ZCARD', key) >= limit then
+		return 0
+	end
+	redis.call('ZADD', key, ARGV[3], ARGV[4])
+	redis.call('PEXPIRE', key, ARGV[5])
+	return 1
+`)
+
+// Acquire implements Semaphore
+func (r *Redis) Acquire(ctx context.Context, key, id string, limit int, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	acquired, err := acquireScript.Run(ctx, r.client, []string{key}, limit, now.UnixMilli(), now.Add(ttl).UnixMilli(), id, ttl.Milliseconds()).Int()
+	return acquired == 1, err
+}
+
+// Release implements Semaphore
+func (r *Redis) Release(ctx context.Context, key, id string) error {
+	return r.client.ZRem(ctx, key, id).Err()
+}
@@ -0,0 +1,91 @@
+// Package store is the key-value storage behind gateway state such as
+// cached responses, quota counters and rate limit buckets.
+//
+// Redis shares state between gateway instances; the in-memory and file
+// stores serve single-node deployments and tests without a Redis server.
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// KV stores values with an optional time to live. A ttl of zero or less
+// means no expiry for Set and Incr.
+type KV interface {
+	// Get returns the value of key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Incr atomically adds one to the counter at key and returns the new
+	// value; ttl is applied when the counter is created
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Close() error
+}
+
+// TokenBucket is implemented by stores that run token buckets atomically,
+// so rate limits are enforced across all gateway instances sharing the store
+type TokenBucket interface {
+	// Take removes a token from the bucket at key, refilled at rate tokens
+	// per second up to burst. It returns whether a token was available, the
+	// tokens left and the Unix time of the next refill.
+	Take(ctx context.Context, key string, rate, burst int) (bool, int, int64, error)
+}
+
+// RateWindows is implemented by stores that also run the window and GCRA
+// rate limiting algorithms atomically. Like Take, each returns whether the
+// request is allowed, the requests left and the Unix time they are next
+// allowed or reset.
+type RateWindows interface {
+	// FixedWindow counts the request in the current window at key,
+	// allowing limit per window
+	FixedWindow(ctx context.Context, key string, limit int, window time.Duration) (bool, int, int64, error)
+	// SlidingWindow logs the request at key, allowing limit in any window
+	SlidingWindow(ctx context.Context, key string, limit int, window time.Duration) (bool, int, int64, error)
+	// GCRA spaces requests at key rate per second, allowing burst at once
+	GCRA(ctx context.Context, key string, rate, burst int) (bool, int, int64, error)
+}
+
+// Semaphore is implemented by stores that hand out a limited number of
+// slots atomically, so a concurrency limit holds across gateway instances
+type Semaphore interface {
+	// Acquire takes one of limit slots at key for id, held until Release or
+	// for ttl at most. It returns whether a slot was free.
+	Acquire(ctx context.Context, key, id string, limit int, ttl time.Duration) (bool, error)
+	// Release frees the slot of id at key
+	Release(ctx context.Context, key, id string) error
+}
+
+// Backends accepted by Open
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendFile   = "file"
+)
+
+// Options configures the store created by Open
+type Options struct {
+	// Path is the file of the file store
+	Path string
+	// FlushInterval is how often the file store is written (default 30s)
+	FlushInterval time.Duration
+	// SweepInterval is how often expired entries are removed from the
+	// memory and file stores (default 1m)
+	SweepInterval time.Duration
+}
+
+// Open creates a memory or file store; Redis stores are created with
+// NewRedis from a connected client
+func Open(backend string, opts Options) (KV, error) {
+	if opts.SweepInterval <= 0 {
+		opts.SweepInterval = time.Minute
+	}
+	switch backend {
+	case BackendMemory:
+		return NewMemory(opts.SweepInterval), nil
+	case BackendFile:
+		return OpenFile(opts.Path, opts.FlushInterval, opts.SweepInterval)
+	}
+	return nil, fmt.Errorf("unknown store backend %q", backend)
+}
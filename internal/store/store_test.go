@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(time.Hour)
+	defer m.Close()
+
+	_ = m.Set(ctx, "short", []byte("v"), time.Millisecond)
+	_ = m.Set(ctx, "forever", []byte("v"), 0)
+	time.Sleep(5 * time.Millisecond)
+	if _, found, _ := m.Get(ctx, "short"); found {
+		t.Error("expired entry was returned")
+	}
+	if v, found, _ := m.Get(ctx, "forever"); !found || string(v) != "v" {
+		t.Errorf("entry without ttl = %q, %v", v, found)
+	}
+
+	_ = m.Delete(ctx, "forever")
+	if _, found, _ := m.Get(ctx, "forever"); found {
+		t.Error("deleted entry was returned")
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		if n, err := m.Incr(ctx, "counter", time.Hour); err != nil || n != want {
+			t.Fatalf("Incr = %d, %v; want %d", n, err, want)
+		}
+	}
+	if v, _, _ := m.Get(ctx, "counter"); string(v) != "3" {
+		t.Errorf("counter stored as %q", v)
+	}
+
+	// An expired counter starts over
+	_, _ = m.Incr(ctx, "window", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n, _ := m.Incr(ctx, "window", time.Millisecond); n != 1 {
+		t.Errorf("expired counter continued at %d", n)
+	}
+}
+
+func TestFilePersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	f, err := OpenFile(path, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Set(ctx, "kept", []byte("v"), time.Hour)
+	_ = f.Set(ctx, "expiring", []byte("v"), time.Millisecond)
+	_, _ = f.Incr(ctx, "counter", 0)
+	time.Sleep(5 * time.Millisecond)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = OpenFile(path, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if v, found, _ := f.Get(ctx, "kept"); !found || string(v) != "v" {
+		t.Errorf("kept = %q, %v", v, found)
+	}
+	if _, found, _ := f.Get(ctx, "expiring"); found {
+		t.Error("expired entry was restored")
+	}
+	if n, _ := f.Incr(ctx, "counter", 0); n != 2 {
+		t.Errorf("restored counter incremented to %d", n)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open("bolt", Options{}); err == nil {
+		t.Error("unknown backend was accepted")
+	}
+	if _, err := Open(BackendFile, Options{}); err == nil {
+		t.Error("file store without a path was accepted")
+	}
+	kv, err := Open(BackendMemory, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Close()
+}
@@ -0,0 +1,171 @@
+// Package synthetic runs synthetic transaction checks against backend
+// services and evaluates their latency, complementing the basic health checks.
+package synthetic
+
+import (
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minisource/gateway/config"
+	"github.com/minisource/gateway/internal/middleware"
+	"github.com/minisource/gateway/internal/proxy"
+	"github.com/valyala/fasthttp"
+)
+
+// Check outcomes
+const (
+	StatusPending = "pending"
+	StatusOK      = "ok"
+	StatusSlow    = "slow"
+	StatusFailing = "failing"
+)
+
+// Result is the latest outcome of a check
+type Result struct {
+	Name       string    `json:"name"`
+	Service    string    `json:"service"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Latency    string    `json:"latency,omitempty"`
+	MaxLatency string    `json:"max_latency"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at,omitempty"`
+}
+
+// Runner runs the configured checks on their intervals
+type Runner struct {
+	checks []config.SyntheticCheck
+	proxy  *proxy.ServiceProxy
+
+	mu      sync.RWMutex
+	results map[string]Result
+}
+
+// NewRunner creates a runner
+func NewRunner(cfg *config.SyntheticsConfig, serviceProxy *proxy.ServiceProxy) *Runner {
+	r := &Runner{
+		checks:  cfg.Checks,
+		proxy:   serviceProxy,
+		results: make(map[string]Result),
+	}
+	for _, check := range cfg.Checks {
+		r.results[check.Name] = Result{
+			Name:       check.Name,
+			Service:    check.Service,
+			Status:     StatusPending,
+			MaxLatency: check.MaxLatency,
+		}
+	}
+	return r
+}
+
+// Start runs every check now and then on its interval
+func (r *Runner) Start() {
+	for _, check := range r.checks {
+		go func(check config.SyntheticCheck) {
+			// Durations are checked by config.LoadSynthetics
+			interval, _ := time.ParseDuration(check.Interval)
+			r.run(check)
+
+			ticker := time.NewTicker(interval)
+			for range ticker.C {
+				r.run(check)
+			}
+		}(check)
+	}
+}
+
+// Results returns the latest result of every check, sorted by name
+func (r *Runner) Results() []Result {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]Result, 0, len(r.results))
+	for _, result := range r.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// run executes a check once and records its result
+func (r *Runner) run(check config.SyntheticCheck) {
+	timeout, _ := time.ParseDuration(check.Timeout)
+	maxLatency, _ := time.ParseDuration(check.MaxLatency)
+
+	result := Result{
+		Name:       check.Name,
+		Service:    check.Service,
+		MaxLatency: check.MaxLatency,
+		CheckedAt:  time.Now(),
+	}
+
+	svc, ok := r.proxy.GetService(check.Service)
+	if !ok {
+		result.Status, result.Error = StatusFailing, "unknown service"
+		r.record(result, 0)
+		return
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	method := check.Method
+	if method == "" {
+		method = fasthttp.MethodGet
+	}
+	req.SetRequestURI(svc.URL + check.Path)
+	req.Header.SetMethod(method)
+	req.Header.Set("User-Agent", "minisource-gateway-synthetic")
+	for name, value := range check.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	if check.Body != "" {
+		req.SetBodyString(os.ExpandEnv(check.Body))
+	}
+
+	start := time.Now()
+	err := svc.HTTPClient().DoTimeout(req, resp, timeout)
+	latency := time.Since(start)
+	result.Latency = latency.String()
+
+	switch {
+	case err != nil:
+		result.Status, result.Error = StatusFailing, err.Error()
+	case !expectedStatus(check, resp.StatusCode()):
+		result.Status, result.StatusCode = StatusFailing, resp.StatusCode()
+		result.Error = "unexpected status"
+	case latency > maxLatency:
+		result.Status, result.StatusCode = StatusSlow, resp.StatusCode()
+	default:
+		result.Status, result.StatusCode = StatusOK, resp.StatusCode()
+	}
+
+	r.record(result, latency)
+}
+
+// record stores a result and publishes it as metrics
+func (r *Runner) record(result Result, latency time.Duration) {
+	r.mu.Lock()
+	previous := r.results[result.Name]
+	r.results[result.Name] = result
+	r.mu.Unlock()
+
+	middleware.RecordSyntheticCheck(result.Name, result.Status, latency)
+	if previous.Status != result.Status {
+		log.Printf("Synthetic check %s is %s (latency %s, error %q)", result.Name, result.Status, result.Latency, result.Error)
+	}
+}
+
+// expectedStatus reports whether a response status passes the check
+func expectedStatus(check config.SyntheticCheck, status int) bool {
+	if check.ExpectStatus != 0 {
+		return status == check.ExpectStatus
+	}
+	return status >= 200 && status < 300
+}
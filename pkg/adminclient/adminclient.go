@@ -0,0 +1,220 @@
+// Package adminclient is a typed client for the gateway admin API, for
+// deployment tooling and operator scripts.
+package adminclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minisource/gateway/config"
+)
+
+// Client calls the admin API with a bearer admin token
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Error is a non-2xx response from the admin API
+type Error struct {
+	StatusCode int
+	Code       string `json:"error"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("admin API: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("admin API: %s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// New creates a client for the admin API at baseURL (e.g.
+// http://gateway:9090). A nil httpClient uses one with a 10s timeout.
+func New(baseURL, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// Routes returns the gateway's route table in matching order. The admin API
+// doesn't change routes at runtime; they are deployed with routes.yaml.
+func (c *Client) Routes(ctx context.Context) ([]config.Route, error) {
+	var resp struct {
+		Routes []config.Route `json:"routes"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/routes", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Routes, nil
+}
+
+// RouteDiff is the outcome of a route change dry run
+type RouteDiff struct {
+	// Valid is false when the candidate has errors; Problems also lists
+	// warnings. File is empty: the candidate is the only file.
+	Valid    bool             `json:"valid"`
+	Problems []config.Problem `json:"problems"`
+	// Changes from the live route table, when the candidate loads
+	Changes []config.RouteChange `json:"changes"`
+}
+
+// DiffRoutes validates a candidate route file (format yaml, json or toml)
+// and compares it with the live route table, without applying it
+func (c *Client) DiffRoutes(ctx context.Context, candidate []byte, format string) (*RouteDiff, error) {
+	var diff RouteDiff
+	path := "/routes/diff?format=" + url.QueryEscape(format)
+	if err := c.send(ctx, http.MethodPost, path, "application/"+format, bytes.NewReader(candidate), &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// Draining reports whether the instance is draining
+func (c *Client) Draining(ctx context.Context) (bool, error) {
+	return c.drain(ctx, http.MethodGet)
+}
+
+// Drain takes the instance out of rotation
+func (c *Client) Drain(ctx context.Context) error {
+	_, err := c.drain(ctx, http.MethodPost)
+	return err
+}
+
+// Resume puts a draining instance back into rotation
+func (c *Client) Resume(ctx context.Context) error {
+	_, err := c.drain(ctx, http.MethodDelete)
+	return err
+}
+
+func (c *Client) drain(ctx context.Context, method string) (bool, error) {
+	var resp struct {
+		Draining bool `json:"draining"`
+	}
+	err := c.do(ctx, method, "/drain", nil, &resp)
+	return resp.Draining, err
+}
+
+// LimitOverrides returns the per-consumer rate limit overrides in effect
+func (c *Client) LimitOverrides(ctx context.Context) (map[string]config.RouteLimit, error) {
+	var resp struct {
+		Overrides map[string]config.RouteLimit `json:"overrides"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/limits", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Overrides, nil
+}
+
+// SetLimitOverride overrides a consumer's (user ID or IP) rate limit on
+// every instance
+func (c *Client) SetLimitOverride(ctx context.Context, consumer string, limit config.RouteLimit) error {
+	body := map[string]int{
+		"requestsPerSec": limit.RequestsPerSec,
+		"burstSize":      limit.BurstSize,
+	}
+	return c.do(ctx, http.MethodPut, "/limits/"+url.PathEscape(consumer), body, nil)
+}
+
+// ClearLimitOverride restores a consumer's default rate limit
+func (c *Client) ClearLimitOverride(ctx context.Context, consumer string) error {
+	return c.do(ctx, http.MethodDelete, "/limits/"+url.PathEscape(consumer), nil, nil)
+}
+
+// ResetBreaker closes a service's circuit breaker on every instance
+func (c *Client) ResetBreaker(ctx context.Context, service string) error {
+	return c.do(ctx, http.MethodPost, "/breakers/"+url.PathEscape(service)+"/reset", nil, nil)
+}
+
+// Maintenance returns the patterns of the routes in maintenance
+func (c *Client) Maintenance(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Active []string `json:"active"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/maintenance", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Active, nil
+}
+
+// SetMaintenance puts a route, by pattern, in or out of maintenance on every
+// instance, overriding its configured flag
+func (c *Client) SetMaintenance(ctx context.Context, route string, enabled bool) error {
+	body := map[string]bool{"enabled": enabled}
+	return c.do(ctx, http.MethodPut, "/maintenance?route="+url.QueryEscape(route), body, nil)
+}
+
+// ClearMaintenance restores a route's configured maintenance flag
+func (c *Client) ClearMaintenance(ctx context.Context, route string) error {
+	return c.do(ctx, http.MethodDelete, "/maintenance?route="+url.QueryEscape(route), nil, nil)
+}
+
+// RevokeToken revokes the token with the jti (its jti claim) until it
+// expires at expiresAt
+func (c *Client) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	body := map[string]any{"jti": jti, "expiresAt": expiresAt}
+	return c.do(ctx, http.MethodPost, "/revocations", body, nil)
+}
+
+// RevokeUser revokes every token issued to the user so far
+func (c *Client) RevokeUser(ctx context.Context, userID string) error {
+	body := map[string]string{"userId": userID}
+	return c.do(ctx, http.MethodPost, "/revocations", body, nil)
+}
+
+// do sends a request with in as JSON to /admin+path and decodes the JSON
+// response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	if in == nil {
+		return c.send(ctx, method, path, "", nil, out)
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, "application/json", bytes.NewReader(data), out)
+}
+
+// send sends a request with body of contentType to /admin+path and decodes
+// the JSON response into out
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/admin"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		// Error bodies are best effort; the status code is what matters
+		_ = json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,67 @@
+package adminclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minisource/gateway/config"
+)
+
+func TestClient(t *testing.T) {
+	var gotAuth, gotPath, gotContentType string
+	var gotBody map[string]int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotPath = r.Header.Get("Authorization"), r.URL.EscapedPath()
+		switch {
+		case r.Method == http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&gotBody)
+			w.Write([]byte(`{"event":"limit_override"}`))
+		case r.URL.Path == "/admin/routes/diff":
+			gotContentType = r.Header.Get("Content-Type") + " " + r.URL.Query().Get("format")
+			w.Write([]byte(`{"valid":true,"problems":[{"line":3,"message":"shadowed","warning":true}],` +
+				`"changes":[{"kind":"changed","route":{"Path":"/api/v1/auth"},"fields":[{"field":"timeout","old":"10s","new":"5s"}]}]}`))
+		case r.URL.Path == "/admin/routes":
+			w.Write([]byte(`{"routes":[{"Path":"/api/v1/auth","Service":"auth","Methods":["POST"]}]}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"forbidden","message":"Token lacks scope drain"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/", "secret", nil)
+	ctx := context.Background()
+
+	routes, err := client.Routes(ctx)
+	if err != nil || len(routes) != 1 || routes[0].Service != "auth" {
+		t.Fatalf("Routes = %+v, %v", routes, err)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+
+	if err := client.SetLimitOverride(ctx, "user/1", config.RouteLimit{RequestsPerSec: 5, BurstSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/admin/limits/user%2F1" || gotBody["requestsPerSec"] != 5 || gotBody["burstSize"] != 10 {
+		t.Errorf("PUT %s with %v", gotPath, gotBody)
+	}
+
+	diff, err := client.DiffRoutes(ctx, []byte("routes: []"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotContentType != "application/yaml yaml" || !diff.Valid || diff.Problems[0].Line != 3 ||
+		diff.Changes[0].Kind != config.RouteChanged || diff.Changes[0].Fields[0].New != "5s" {
+		t.Errorf("DiffRoutes = %+v (sent %s)", diff, gotContentType)
+	}
+
+	var apiErr *Error
+	if err := client.Drain(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "forbidden" {
+		t.Fatalf("Drain error = %v", err)
+	}
+}